@@ -0,0 +1,152 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// VirtualClock is a strategies.Clock which advances simulated time instead of wall time.
+//
+// The clock advances to the earliest pending timer as soon as all the participants
+// (e.g. the strategies goroutines) are waiting on it, so the history is replayed as fast as possible.
+type VirtualClock struct {
+	mu           sync.Mutex
+	now          atomic.Int64 // unix nanoseconds.
+	end          time.Time
+	participants int
+	timers       []virtualTimer
+	ended        bool
+
+	onAdvance func(now time.Time) // called when the time advances, before waking up the participants.
+	onEnd     func()              // called when the time reaches the end.
+}
+
+// virtualTimer represents a participant waiting for a time to come.
+type virtualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewVirtualClock creates a new virtual clock running from start to end.
+func NewVirtualClock(start time.Time, end time.Time, onAdvance func(now time.Time), onEnd func()) *VirtualClock {
+	clock := &VirtualClock{
+		end:       end,
+		onAdvance: onAdvance,
+		onEnd:     onEnd,
+	}
+	clock.now.Store(start.UnixNano())
+	return clock
+}
+
+// Now gets the current simulated time.
+func (clock *VirtualClock) Now() time.Time {
+	return time.Unix(0, clock.now.Load()).UTC()
+}
+
+// After sends the simulated time on the returned channel when it is advanced by d.
+//
+//     NOTE: the channel never fires once the clock reached the end.
+func (clock *VirtualClock) After(d time.Duration) <-chan time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	c := make(chan time.Time, 1)
+	if clock.ended {
+		return c
+	}
+
+	clock.timers = append(clock.timers, virtualTimer{
+		at: clock.Now().Add(d),
+		c:  c,
+	})
+	clock.advanceIfIdle()
+
+	return c
+}
+
+// Join adds participants to the clock.
+func (clock *VirtualClock) Join(count int) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.participants += count
+}
+
+// Leave removes a participant from the clock.
+func (clock *VirtualClock) Leave() {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.participants--
+	clock.advanceIfIdle()
+}
+
+// Ended tells if the clock reached the end.
+func (clock *VirtualClock) Ended() bool {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.ended
+}
+
+// advanceIfIdle advances the time when all the participants are waiting.
+//
+//     NOTE: must be called holding the lock.
+func (clock *VirtualClock) advanceIfIdle() {
+	if clock.ended || len(clock.timers) == 0 || len(clock.timers) < clock.participants {
+		return
+	}
+
+	next := clock.timers[0].at
+	for _, timer := range clock.timers[1:] {
+		if timer.at.Before(next) {
+			next = timer.at
+		}
+	}
+
+	if next.After(clock.end) {
+		clock.ended = true
+		clock.timers = nil
+		clock.setTime(clock.end)
+		if clock.onEnd != nil {
+			clock.onEnd()
+		}
+		return
+	}
+
+	clock.setTime(next)
+
+	pending := clock.timers[:0]
+	for _, timer := range clock.timers {
+		if timer.at.After(next) {
+			pending = append(pending, timer)
+		} else {
+			timer.c <- next
+		}
+	}
+	clock.timers = pending
+}
+
+// setTime sets the simulated time, notifying the advance.
+func (clock *VirtualClock) setTime(now time.Time) {
+	clock.now.Store(now.UnixNano())
+	if clock.onAdvance != nil {
+		clock.onAdvance(now)
+	}
+}
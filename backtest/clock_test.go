@@ -0,0 +1,141 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClockAdvance(t *testing.T) {
+	tests := []struct {
+		name         string
+		participants int
+		waits        []time.Duration // timers requested by the participants, in order.
+		wantNow      time.Duration   // simulated time elapsed after the waits.
+		wantFired    []bool
+	}{
+		{"single participant", 1, []time.Duration{time.Minute}, time.Minute, []bool{true}},
+		{"waits for all participants", 2, []time.Duration{time.Minute}, 0, []bool{false}},
+		{"advances to the earliest timer", 2, []time.Duration{5 * time.Minute, time.Minute}, time.Minute, []bool{false, true}},
+		{"fires the timers due together", 2, []time.Duration{time.Minute, time.Minute}, time.Minute, []bool{true, true}},
+		{"no participants", 0, nil, 0, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var advances []time.Time
+			clock := NewVirtualClock(testStart, testStart.Add(time.Hour), func(now time.Time) {
+				advances = append(advances, now)
+			}, nil)
+			clock.Join(test.participants)
+
+			channels := make([]<-chan time.Time, len(test.waits))
+			for i, wait := range test.waits {
+				channels[i] = clock.After(wait)
+			}
+
+			if got := clock.Now().Sub(testStart); got != test.wantNow {
+				t.Errorf("elapsed = %s, want %s", got, test.wantNow)
+			}
+			for i, c := range channels {
+				select {
+				case fired := <-c:
+					if !test.wantFired[i] {
+						t.Errorf("timer %d fired at %s, want not fired", i, fired)
+					} else if !fired.Equal(clock.Now()) {
+						t.Errorf("timer %d fired at %s, want %s", i, fired, clock.Now())
+					}
+				default:
+					if test.wantFired[i] {
+						t.Errorf("timer %d not fired, want fired", i)
+					}
+				}
+			}
+			if test.wantNow > 0 && len(advances) != 1 {
+				t.Errorf("advances = %v, want one", advances)
+			}
+		})
+	}
+}
+
+func TestVirtualClockLeave(t *testing.T) {
+	clock := NewVirtualClock(testStart, testStart.Add(time.Hour), nil, nil)
+	clock.Join(2)
+
+	c := clock.After(time.Minute)
+	if !clock.Now().Equal(testStart) {
+		t.Fatalf("clock advanced before all the participants waited")
+	}
+
+	clock.Leave()
+	select {
+	case <-c:
+	default:
+		t.Fatalf("timer not fired once the other participant left")
+	}
+}
+
+func TestVirtualClockEnd(t *testing.T) {
+	tests := []struct {
+		name      string
+		wait      time.Duration
+		wantEnded bool
+		wantNow   time.Duration
+	}{
+		{"before the end", 30 * time.Minute, false, 30 * time.Minute},
+		{"at the end", time.Hour, false, time.Hour},
+		{"after the end", 2 * time.Hour, true, time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ends := 0
+			clock := NewVirtualClock(testStart, testStart.Add(time.Hour), nil, func() { ends++ })
+			clock.Join(1)
+
+			c := clock.After(test.wait)
+			if clock.Ended() != test.wantEnded {
+				t.Errorf("Ended() = %v, want %v", clock.Ended(), test.wantEnded)
+			}
+			if got := clock.Now().Sub(testStart); got != test.wantNow {
+				t.Errorf("elapsed = %s, want %s", got, test.wantNow)
+			}
+
+			select {
+			case <-c:
+				if test.wantEnded {
+					t.Errorf("timer after the end fired")
+				}
+			default:
+				if !test.wantEnded {
+					t.Errorf("timer not fired")
+				}
+			}
+
+			if test.wantEnded {
+				if ends != 1 {
+					t.Errorf("onEnd called %d times, want 1", ends)
+				}
+				select {
+				case <-clock.After(time.Minute):
+					t.Errorf("timer requested after the end fired")
+				default:
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+// Bar represents a replayed candle along with its open time.
+type Bar struct {
+	Time   time.Time               //Represents the open time of the candle.
+	Candle environment.CandleStick //Represents the candle data.
+}
+
+// BookSnapshot represents a replayed order book along with the time it was taken.
+type BookSnapshot struct {
+	Time time.Time             //Represents the time of the snapshot.
+	Book environment.OrderBook //Represents the order book data.
+}
+
+// MarketData contains the history of a market to be replayed.
+//
+//     NOTE: a bar is visible to the strategies only after it is closed,
+//     the candle period is inferred from the distance between bars.
+type MarketData struct {
+	Bars   []Bar          //Represents the candles of the market, sorted by time.
+	Books  []BookSnapshot //[optional] Represents the order books of the market, sorted by time.
+	Period time.Duration  //Represents the candle period.
+}
+
+// bookRecord represents a line of an order book file.
+type bookRecord struct {
+	Time time.Time            `json:"time"`
+	Asks [][2]decimal.Decimal `json:"asks"` // [price, quantity] levels.
+	Bids [][2]decimal.Decimal `json:"bids"` // [price, quantity] levels.
+}
+
+// CandlesFile gets the path of the candles file of a market:
+// a CSV with time (RFC3339 or unix seconds), open, high, low, close, volume columns.
+func CandlesFile(dataDir string, exchangeName string, marketName string) string {
+	return filepath.Join(dataDir, exchangeName, marketName+".csv")
+}
+
+// BooksFile gets the path of the order books file of a market:
+// a JSON object per line with time, asks and bids ([price, quantity] levels) fields.
+func BooksFile(dataDir string, exchangeName string, marketName string) string {
+	return filepath.Join(dataDir, exchangeName, marketName+".book.jsonl")
+}
+
+// LoadMarketData loads the history of a market from the data directory.
+//
+//     The candles file is mandatory, the order books file is optional.
+func LoadMarketData(dataDir string, exchangeName string, marketName string) (*MarketData, error) {
+	candlesFile, err := os.Open(CandlesFile(dataDir, exchangeName, marketName))
+	if err != nil {
+		return nil, err
+	}
+	defer candlesFile.Close()
+
+	bars, err := readBars(candlesFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read candles of %s on %s: %s", marketName, exchangeName, err)
+	}
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("No candles for %s on %s", marketName, exchangeName)
+	}
+
+	data := &MarketData{
+		Bars:   bars,
+		Period: inferPeriod(bars),
+	}
+
+	booksFile, err := os.Open(BooksFile(dataDir, exchangeName, marketName))
+	if os.IsNotExist(err) {
+		return data, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer booksFile.Close()
+
+	data.Books, err = readBooks(booksFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read order books of %s on %s: %s", marketName, exchangeName, err)
+	}
+
+	return data, nil
+}
+
+// readBars reads candles from a CSV, skipping the header if present.
+func readBars(r io.Reader) ([]Bar, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 6
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	bars := make([]Bar, 0, len(records))
+	for i, record := range records {
+		openTime, err := parseTime(record[0])
+		if err != nil {
+			if i == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+
+		var values [5]decimal.Decimal
+		for j := range values {
+			values[j], err = decimal.NewFromString(record[j+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+		}
+
+		bars = append(bars, Bar{
+			Time: openTime,
+			Candle: environment.CandleStick{
+				OpenTime: openTime,
+				Open:     values[0],
+				High:     values[1],
+				Low:      values[2],
+				Close:    values[3],
+				Volume:   values[4],
+			},
+		})
+	}
+
+	sort.SliceStable(bars, func(i, j int) bool {
+		return bars[i].Time.Before(bars[j].Time)
+	})
+
+	return bars, nil
+}
+
+// readBooks reads order book snapshots, one JSON object per line.
+func readBooks(r io.Reader) ([]BookSnapshot, error) {
+	var books []BookSnapshot
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record bookRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		snapshot := BookSnapshot{Time: record.Time}
+		for _, level := range record.Asks {
+			snapshot.Book.Asks = append(snapshot.Book.Asks, environment.Order{Value: level[0], Quantity: level[1]})
+		}
+		for _, level := range record.Bids {
+			snapshot.Book.Bids = append(snapshot.Book.Bids, environment.Order{Value: level[0], Quantity: level[1]})
+		}
+		sort.SliceStable(snapshot.Book.Asks, func(i, j int) bool {
+			return snapshot.Book.Asks[i].Value.LessThan(snapshot.Book.Asks[j].Value)
+		})
+		sort.SliceStable(snapshot.Book.Bids, func(i, j int) bool {
+			return snapshot.Book.Bids[i].Value.GreaterThan(snapshot.Book.Bids[j].Value)
+		})
+
+		books = append(books, snapshot)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(books, func(i, j int) bool {
+		return books[i].Time.Before(books[j].Time)
+	})
+
+	return books, nil
+}
+
+// parseTime parses a time expressed in RFC3339 or in unix seconds (milliseconds are detected).
+func parseTime(value string) (time.Time, error) {
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if timestamp > 1e12 {
+			return time.UnixMilli(timestamp).UTC(), nil
+		}
+		return time.Unix(timestamp, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// inferPeriod infers the candle period as the minimum distance between two bars.
+func inferPeriod(bars []Bar) time.Duration {
+	var period time.Duration
+	for i := 1; i < len(bars); i++ {
+		distance := bars[i].Time.Sub(bars[i-1].Time)
+		if distance > 0 && (period == 0 || distance < period) {
+			period = distance
+		}
+	}
+	return period
+}
+
+// closedBars gets the bars closed at the specified time.
+func (data *MarketData) closedBars(now time.Time) []Bar {
+	count := sort.Search(len(data.Bars), func(i int) bool {
+		return data.Bars[i].Time.Add(data.Period).After(now)
+	})
+	return data.Bars[:count]
+}
+
+// barsClosedBetween gets the bars closed in the (from, to] time interval.
+func (data *MarketData) barsClosedBetween(from time.Time, to time.Time) []Bar {
+	start := len(data.closedBars(from))
+	end := len(data.closedBars(to))
+	return data.Bars[start:end]
+}
+
+// candles aggregates the bars closed at the specified time into candles of the specified interval,
+// keeping the ones opened in the [from, to) time range (a zero time means no bound).
+//
+//     NOTE: the interval must be a multiple of the period of the data,
+//     the last candle is partial if not all its bars are closed yet.
+func (data *MarketData) candles(now time.Time, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	step := interval.Duration()
+	if step == 0 {
+		return nil, fmt.Errorf("Invalid candle interval: %s", interval)
+	}
+	if data.Period != 0 && (step < data.Period || step%data.Period != 0) {
+		return nil, fmt.Errorf("Cannot build %s candles from %s bars", interval, data.Period)
+	}
+
+	var ret []environment.CandleStick
+	for _, bar := range data.closedBars(now) {
+		openTime := bar.Time.Truncate(step)
+		if openTime.Before(from) || (!to.IsZero() && !openTime.Before(to)) {
+			continue
+		}
+
+		if len(ret) == 0 || !ret[len(ret)-1].OpenTime.Equal(openTime) {
+			candle := bar.Candle
+			candle.OpenTime = openTime
+			ret = append(ret, candle)
+			continue
+		}
+
+		candle := &ret[len(ret)-1]
+		candle.High = decimal.Max(candle.High, bar.Candle.High)
+		candle.Low = decimal.Min(candle.Low, bar.Candle.Low)
+		candle.Close = bar.Candle.Close
+		candle.Volume = candle.Volume.Add(bar.Candle.Volume)
+	}
+	return ret, nil
+}
+
+// booksBetween gets the order book snapshots taken in the (from, to] time interval.
+func (data *MarketData) booksBetween(from time.Time, to time.Time) []BookSnapshot {
+	start := sort.Search(len(data.Books), func(i int) bool {
+		return data.Books[i].Time.After(from)
+	})
+	end := sort.Search(len(data.Books), func(i int) bool {
+		return data.Books[i].Time.After(to)
+	})
+	return data.Books[start:end]
+}
+
+// lastBar gets the last bar closed at the specified time, if any.
+func (data *MarketData) lastBar(now time.Time) (Bar, bool) {
+	bars := data.closedBars(now)
+	if len(bars) == 0 {
+		return Bar{}, false
+	}
+	return bars[len(bars)-1], true
+}
+
+// bookAt gets the order book at the specified time.
+//
+//     If no snapshot is available, a book with one level at the last close price is used,
+//     with the volume of the last candle as quantity.
+func (data *MarketData) bookAt(now time.Time) (*environment.OrderBook, bool) {
+	count := sort.Search(len(data.Books), func(i int) bool {
+		return data.Books[i].Time.After(now)
+	})
+	if count > 0 {
+		book := data.Books[count-1].Book
+		return &environment.OrderBook{
+			Asks: append([]environment.Order(nil), book.Asks...),
+			Bids: append([]environment.Order(nil), book.Bids...),
+		}, true
+	}
+
+	bar, exists := data.lastBar(now)
+	if !exists {
+		return nil, false
+	}
+
+	level := environment.Order{
+		Value:    bar.Candle.Close,
+		Quantity: bar.Candle.Volume,
+	}
+	return &environment.OrderBook{
+		Asks: []environment.Order{level},
+		Bids: []environment.Order{level},
+	}, true
+}
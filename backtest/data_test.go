@@ -0,0 +1,174 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+// minuteBars creates 1m bars from testStart, each with the specified close, open at the previous close, and a volume of 1.
+func minuteBars(closes ...float64) []Bar {
+	ret := make([]Bar, len(closes))
+	open := decimal.NewFromFloat(closes[0])
+	for i, value := range closes {
+		close := decimal.NewFromFloat(value)
+		openTime := testStart.Add(time.Duration(i) * time.Minute)
+		ret[i] = Bar{
+			Time: openTime,
+			Candle: environment.CandleStick{
+				OpenTime: openTime,
+				Open:     open,
+				High:     decimal.Max(open, close),
+				Low:      decimal.Min(open, close),
+				Close:    close,
+				Volume:   decimal.NewFromInt(1),
+			},
+		}
+		open = close
+	}
+	return ret
+}
+
+func TestInferPeriod(t *testing.T) {
+	tests := []struct {
+		name string
+		bars []Bar
+		want time.Duration
+	}{
+		{"no bars", nil, 0},
+		{"single bar", minuteBars(1), 0},
+		{"regular bars", minuteBars(1, 2, 3), time.Minute},
+		{"gaps", []Bar{{Time: testStart}, {Time: testStart.Add(5 * time.Minute)}, {Time: testStart.Add(6 * time.Minute)}}, time.Minute},
+		{"duplicated times", []Bar{{Time: testStart}, {Time: testStart}, {Time: testStart.Add(time.Hour)}}, time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := inferPeriod(test.bars); got != test.want {
+				t.Errorf("inferPeriod() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClosedBars(t *testing.T) {
+	data := &MarketData{Bars: minuteBars(1, 2, 3), Period: time.Minute}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    int
+	}{
+		{"first bar open", 0, 0},
+		{"first bar not closed yet", 59 * time.Second, 0},
+		{"first bar closed", time.Minute, 1},
+		{"all bars closed", time.Hour, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := len(data.closedBars(testStart.Add(test.elapsed))); got != test.want {
+				t.Errorf("closedBars() = %d bars, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCandles(t *testing.T) {
+	// 10 bars of 1m, closing at 1..10.
+	data := &MarketData{Bars: minuteBars(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), Period: time.Minute}
+	at := func(minutes int) time.Time {
+		return testStart.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	type candle struct {
+		open   int // minutes from testStart.
+		close  float64
+		high   float64
+		low    float64
+		volume int64
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		interval environment.CandleInterval
+		from     time.Time
+		to       time.Time
+		period   time.Duration // period of the bars, 1m if zero.
+		want     []candle
+		wantErr  string
+	}{
+		{"bars as they are", at(3), environment.Interval1m, time.Time{}, time.Time{}, 0, []candle{
+			{0, 1, 1, 1, 1}, {1, 2, 2, 1, 1}, {2, 3, 3, 2, 1},
+		}, ""},
+		{"aggregated bars", at(10), environment.Interval5m, time.Time{}, time.Time{}, 0, []candle{
+			{0, 5, 5, 1, 5}, {5, 10, 10, 5, 5},
+		}, ""},
+		{"partial last candle", at(7), environment.Interval5m, time.Time{}, time.Time{}, 0, []candle{
+			{0, 5, 5, 1, 5}, {5, 7, 7, 5, 2},
+		}, ""},
+		{"from bound", at(10), environment.Interval1m, at(8), time.Time{}, 0, []candle{
+			{8, 9, 9, 8, 1}, {9, 10, 10, 9, 1},
+		}, ""},
+		{"to bound excluded", at(10), environment.Interval1m, at(1), at(3), 0, []candle{
+			{1, 2, 2, 1, 1}, {2, 3, 3, 2, 1},
+		}, ""},
+		{"future bars not visible", at(2), environment.Interval1m, at(1), at(10), 0, []candle{
+			{1, 2, 2, 1, 1},
+		}, ""},
+		{"nothing closed", at(0), environment.Interval1m, time.Time{}, time.Time{}, 0, nil, ""},
+		{"invalid interval", at(10), environment.CandleInterval("7m"), time.Time{}, time.Time{}, 0, nil, "Invalid candle interval"},
+		{"interval shorter than the period", at(10), environment.Interval1m, time.Time{}, time.Time{}, 5 * time.Minute, nil, "Cannot build"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := data
+			if test.period != 0 {
+				source = &MarketData{Bars: data.Bars, Period: test.period}
+			}
+
+			got, err := source.candles(test.now, test.interval, test.from, test.to)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("candles() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("candles() error = %v", err)
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("candles() = %d candles, want %d", len(got), len(test.want))
+			}
+			for i, want := range test.want {
+				c := got[i]
+				if !c.OpenTime.Equal(at(want.open)) || !c.Close.Equal(decimal.NewFromFloat(want.close)) ||
+					!c.High.Equal(decimal.NewFromFloat(want.high)) || !c.Low.Equal(decimal.NewFromFloat(want.low)) ||
+					!c.Volume.Equal(decimal.NewFromInt(want.volume)) {
+					t.Errorf("candle %d = %s O%s H%s L%s C%s V%s, want %+v", i, c.OpenTime, c.Open, c.High, c.Low, c.Close, c.Volume, want)
+				}
+			}
+		})
+	}
+}
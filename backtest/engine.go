@@ -0,0 +1,153 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/saniales/golang-crypto-trading-bot/exchanges"
+	"github.com/saniales/golang-crypto-trading-bot/strategies"
+	"github.com/shopspring/decimal"
+)
+
+// Config contains the parameters of a backtest.
+type Config struct {
+	From     time.Time       //Represents the start of the replayed history.
+	To       time.Time       //Represents the end of the replayed history.
+	DataDir  string          //Represents the directory containing the history files (see CandlesFile and BooksFile).
+	MakerFee decimal.Decimal //Represents the fee rate applied to resting orders.
+	TakerFee decimal.Decimal //Represents the fee rate applied to orders matching the book.
+	Currency string          //Represents the currency used to value the accounts, the base currency of the first market if empty.
+	Period   time.Duration   //[optional] Represents the candle period of the history files, inferred from the distance between bars if zero.
+}
+
+// Run replays the history through the specified tactics, using a backtest exchange
+// for each exchange config (starting from its fake balances), and returns the report.
+//
+//     NOTE: only interval strategies can be backtested, sleeping for their interval advances the simulated time.
+//     The candle period of a market which cannot be inferred (a single bar) is the shortest interval of the strategies, if not configured.
+func Run(config Config, exchangeConfigs []environment.ExchangeConfig, tactics []strategies.Tactic) (*Report, error) {
+	if !config.From.Before(config.To) {
+		return nil, errors.New("Backtest start must be before its end")
+	}
+	if len(tactics) == 0 {
+		return nil, errors.New("No tactic to backtest")
+	}
+	var shortestInterval time.Duration
+	for _, tactic := range tactics {
+		strategy, isInterval := tactic.Strategy.(strategies.IntervalStrategy)
+		if !isInterval {
+			return nil, fmt.Errorf("Cannot backtest strategy %s: only interval strategies are supported", tactic.Strategy.Name())
+		}
+		if strategy.Interval <= 0 {
+			return nil, fmt.Errorf("Cannot backtest strategy %s: interval must be > 0", strategy.Name())
+		}
+		if shortestInterval == 0 || strategy.Interval < shortestInterval {
+			shortestInterval = strategy.Interval
+		}
+	}
+
+	currency := config.Currency
+	if currency == "" {
+		for _, tactic := range tactics {
+			if len(tactic.Markets) > 0 {
+				currency = tactic.Markets[0].BaseCurrency
+				break
+			}
+		}
+	}
+	if currency == "" {
+		return nil, errors.New("No currency to value the accounts: no tactic has markets")
+	}
+
+	var equity []EquityPoint
+	var backtestExchanges []*Exchange
+
+	sample := func(now time.Time) {
+		total := decimal.Zero
+		for _, exchange := range backtestExchanges {
+			exchange.match(now)
+			total = total.Add(exchange.equity(currency, now))
+		}
+		equity = append(equity, EquityPoint{Time: now, Equity: total})
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	clock := NewVirtualClock(config.From, config.To, sample, stop)
+
+	wrappers := make([]exchanges.ExchangeWrapper, len(exchangeConfigs))
+	for i, exchangeConfig := range exchangeConfigs {
+		exchange := NewExchange(exchangeConfig.ExchangeName, clock, exchangeConfig.FakeBalances, config.MakerFee, config.TakerFee)
+		for _, tactic := range tactics {
+			for _, market := range tactic.Markets {
+				marketName := exchanges.MarketNameFor(market, exchange)
+				if marketName == "" {
+					continue
+				}
+				data, err := LoadMarketData(config.DataDir, exchange.Name(), marketName)
+				if err != nil {
+					return nil, err
+				}
+				if config.Period > 0 {
+					data.Period = config.Period
+				} else if data.Period == 0 {
+					data.Period = shortestInterval // a bar must never be visible at its open time.
+				}
+				exchange.AddMarket(market, data)
+			}
+		}
+		backtestExchanges = append(backtestExchanges, exchange)
+		wrappers[i] = exchange
+	}
+
+	if err := strategies.CheckTacticsRequirements(tactics, wrappers); err != nil {
+		return nil, err
+	}
+
+	strategies.SetClock(clock)
+	strategies.SetStopContext(ctx)
+	sample(config.From)
+
+	var wg sync.WaitGroup
+	wg.Add(len(tactics))
+	clock.Join(len(tactics))
+	for _, tactic := range tactics {
+		go func(tactic strategies.Tactic) {
+			defer wg.Done()
+			defer clock.Leave()
+			tactic.Execute(wrappers)
+		}(tactic)
+	}
+	wg.Wait()
+
+	end := clock.Now()
+	if !clock.Ended() {
+		sample(end)
+	}
+
+	var fills []Fill
+	for _, exchange := range backtestExchanges {
+		fills = append(fills, exchange.Fills()...)
+	}
+
+	return newReport(config.From, end, currency, equity, fills, shortestInterval), nil
+}
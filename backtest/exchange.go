@@ -0,0 +1,656 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/saniales/golang-crypto-trading-bot/exchanges"
+	"github.com/shopspring/decimal"
+)
+
+// Fill represents a (partial) execution of an order during the backtest.
+type Fill struct {
+	Time        time.Time             //Represents the simulated time of the execution.
+	Exchange    string                //Represents the name of the exchange.
+	Market      string                //Represents the name of the market.
+	OrderID     string                //Represents the ID of the filled order.
+	Type        environment.OrderType //Represents the side of the order.
+	Price       decimal.Decimal       //Represents the execution price.
+	Quantity    decimal.Decimal       //Represents the executed quantity.
+	Fee         decimal.Decimal       //Represents the paid fee.
+	FeeCurrency string                //Represents the currency of the fee.
+	Maker       bool                  //Tells if the order was resting on the book.
+}
+
+// String returns a string representation of the object.
+func (fill Fill) String() string {
+	side := "BUY"
+	if fill.Type == environment.Ask {
+		side = "SELL"
+	}
+	liquidity := "taker"
+	if fill.Maker {
+		liquidity = "maker"
+	}
+	return fmt.Sprintf("%s %s %s %s %s @ %s fee %s %s (%s)", fill.Time.Format(time.RFC3339), fill.Exchange, fill.Market, side, fill.Quantity, fill.Price, fill.Fee, fill.FeeCurrency, liquidity)
+}
+
+// backtestOrder represents an order placed on the backtest exchange.
+type backtestOrder struct {
+	status   environment.OrderStatus
+	market   *environment.Market
+	limit    decimal.Decimal // zero for market orders.
+	reserved decimal.Decimal // balance reserved for the remaining quantity.
+}
+
+// backtestMarket contains the replayed history of a market traded on the exchange.
+type backtestMarket struct {
+	market *environment.Market
+	data   *MarketData
+}
+
+// Exchange is an ExchangeWrapper which replays historical data following a virtual clock
+// and matches the orders against the replayed order books.
+type Exchange struct {
+	name     string
+	clock    *VirtualClock
+	makerFee decimal.Decimal
+	takerFee decimal.Decimal
+
+	mu          sync.Mutex
+	markets     map[string]*backtestMarket // market name on the exchange -> market.
+	balances    map[string]decimal.Decimal
+	orders      map[string]*backtestOrder
+	orderList   []*backtestOrder // orders sorted by placement, iterated instead of orders for repeatable runs.
+	fills       []Fill
+	lastMatch   time.Time
+	lastOrderID int
+}
+
+// NewExchange creates a new backtest exchange with the specified name, starting balances and fee rates.
+func NewExchange(name string, clock *VirtualClock, initialBalances map[string]decimal.Decimal, makerFee decimal.Decimal, takerFee decimal.Decimal) *Exchange {
+	balances := make(map[string]decimal.Decimal, len(initialBalances))
+	for coin, amount := range initialBalances {
+		balances[coin] = amount
+	}
+
+	return &Exchange{
+		name:      name,
+		clock:     clock,
+		makerFee:  makerFee,
+		takerFee:  takerFee,
+		markets:   make(map[string]*backtestMarket),
+		balances:  balances,
+		orders:    make(map[string]*backtestOrder),
+		lastMatch: clock.Now(),
+	}
+}
+
+// AddMarket adds the history of a market to be replayed.
+func (wrapper *Exchange) AddMarket(market *environment.Market, data *MarketData) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	wrapper.markets[exchanges.MarketNameFor(market, wrapper)] = &backtestMarket{
+		market: market,
+		data:   data,
+	}
+}
+
+// Name returns the name of the replayed exchange.
+func (wrapper *Exchange) Name() string {
+	return wrapper.name
+}
+
+// Capabilities gets the operations supported by the replayed exchange, all but stop orders and the account stream.
+func (wrapper *Exchange) Capabilities() exchanges.Capabilities {
+	return exchanges.Capabilities{
+		WebsocketFeeds: true,
+		Candles:        true,
+		LimitOrders:    true,
+		MarketOrders:   true,
+		Withdraw:       true,
+		TradingFees:    true,
+		WithdrawFees:   true,
+		OrderQuery:     true,
+	}
+}
+
+// String returns a string representation of the object.
+func (wrapper *Exchange) String() string {
+	return fmt.Sprint(wrapper.Name(), "backtest")
+}
+
+// marketData gets the history of a market.
+//
+//     NOTE: must be called holding the lock.
+func (wrapper *Exchange) marketData(market *environment.Market) (*MarketData, error) {
+	m, exists := wrapper.markets[exchanges.MarketNameFor(market, wrapper)]
+	if !exists {
+		return nil, fmt.Errorf("No data for market %s on %s", market.Name, wrapper.name)
+	}
+	return m.data, nil
+}
+
+// GetCandles gets the candles opened in the [from, to) time range, built from the bars closed at the current simulated time.
+func (wrapper *Exchange) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	data, err := wrapper.marketData(market)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.candles(wrapper.clock.Now(), interval, from, to)
+}
+
+// GetMarketSummary gets the market summary of the last 24 hours at the current simulated time.
+func (wrapper *Exchange) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	data, err := wrapper.marketData(market)
+	if err != nil {
+		return nil, err
+	}
+
+	now := wrapper.clock.Now()
+	bars := data.barsClosedBetween(now.Add(-24*time.Hour), now)
+	if len(bars) == 0 {
+		return nil, errors.New("Summary not yet loaded")
+	}
+
+	summary := &environment.MarketSummary{
+		High: bars[0].Candle.High,
+		Low:  bars[0].Candle.Low,
+		Last: bars[len(bars)-1].Candle.Close,
+	}
+	for _, bar := range bars {
+		summary.High = decimal.Max(summary.High, bar.Candle.High)
+		summary.Low = decimal.Min(summary.Low, bar.Candle.Low)
+		summary.Volume = summary.Volume.Add(bar.Candle.Volume)
+	}
+
+	book, _ := data.bookAt(now)
+	summary.Ask, summary.Bid = summary.Last, summary.Last
+	if len(book.Asks) > 0 {
+		summary.Ask = book.Asks[0].Value
+	}
+	if len(book.Bids) > 0 {
+		summary.Bid = book.Bids[0].Value
+	}
+
+	return summary, nil
+}
+
+// GetOrderBook gets the order book at the current simulated time.
+func (wrapper *Exchange) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	data, err := wrapper.marketData(market)
+	if err != nil {
+		return nil, err
+	}
+
+	book, exists := data.bookAt(wrapper.clock.Now())
+	if !exists {
+		return nil, errors.New("Orderbook not loaded")
+	}
+	return book, nil
+}
+
+// GetRecentTrades fails with ErrNotSupported: the trade tape is not part of the replayed history.
+func (wrapper *Exchange) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return nil, fmt.Errorf("%w: GetRecentTrades on %s backtest", exchanges.ErrNotSupported, wrapper.name)
+}
+
+// BuyLimit places a limit buy order, which is matched against the current book and then rests until filled or canceled.
+func (wrapper *Exchange) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Bid, amount, limit)
+}
+
+// SellLimit places a limit sell order, which is matched against the current book and then rests until filled or canceled.
+func (wrapper *Exchange) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Ask, amount, limit)
+}
+
+// BuyMarket places a market buy order, which is matched against the current book.
+//
+//     NOTE: the order is partially filled when the book is not deep enough.
+func (wrapper *Exchange) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Bid, amount, decimal.Zero)
+}
+
+// SellMarket places a market sell order, which is matched against the current book.
+//
+//     NOTE: the order is partially filled when the book is not deep enough.
+func (wrapper *Exchange) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Ask, amount, decimal.Zero)
+}
+
+// placeOrder places an order, reserving the balance and matching it against the current book as taker.
+//
+//     Market orders have a zero limit.
+func (wrapper *Exchange) placeOrder(market *environment.Market, orderType environment.OrderType, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("%w: order amount must be > 0", exchanges.ErrInvalidOrder)
+	}
+
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	data, err := wrapper.marketData(market)
+	if err != nil {
+		return "", err
+	}
+
+	now := wrapper.clock.Now()
+	book, exists := data.bookAt(now)
+	if !exists {
+		return "", errors.New("Cannot place order without orderbook knowledge")
+	}
+
+	isMarketOrder := limit.IsZero()
+	order := &backtestOrder{
+		market: market,
+		limit:  limit,
+		status: environment.OrderStatus{
+			Type:      orderType,
+			State:     environment.OrderNew,
+			Price:     limit,
+			Quantity:  amount,
+			Timestamp: now,
+		},
+	}
+
+	reserveCurrency := market.MarketCurrency
+	if orderType == environment.Bid {
+		reserveCurrency = market.BaseCurrency
+		price := limit
+		if isMarketOrder {
+			price = worstPrice(book.Asks, amount)
+		}
+		order.reserved = amount.Mul(price).Mul(decimal.NewFromInt(1).Add(decimal.Max(wrapper.makerFee, wrapper.takerFee)))
+	} else {
+		order.reserved = amount
+	}
+
+	if wrapper.balances[reserveCurrency].LessThan(order.reserved) {
+		return "", fmt.Errorf("Cannot place order: %w, not enough %s balance", exchanges.ErrInsufficientFunds, reserveCurrency)
+	}
+	wrapper.balances[reserveCurrency] = wrapper.balances[reserveCurrency].Sub(order.reserved)
+
+	wrapper.lastOrderID++
+	order.status.ID = fmt.Sprintf("BACKTEST-%d", wrapper.lastOrderID)
+	wrapper.orders[order.status.ID] = order
+	wrapper.orderList = append(wrapper.orderList, order)
+
+	levels := book.Asks
+	if orderType == environment.Ask {
+		levels = book.Bids
+	}
+	for _, level := range levels {
+		if order.status.RemainingQuantity().IsZero() || (!isMarketOrder && !crosses(orderType, limit, level.Value)) {
+			break
+		}
+		wrapper.fill(order, level.Value, decimal.Min(level.Quantity, order.status.RemainingQuantity()), false)
+	}
+
+	if isMarketOrder && order.status.State.IsOpen() {
+		wrapper.closeOrder(order, environment.OrderCanceled)
+	}
+
+	return order.status.ID, nil
+}
+
+// worstPrice gets the price of the deepest level needed to fill the amount, used to reserve balance for market buys.
+func worstPrice(levels []environment.Order, amount decimal.Decimal) decimal.Decimal {
+	price := decimal.Zero
+	for _, level := range levels {
+		price = level.Value
+		amount = amount.Sub(level.Quantity)
+		if !amount.IsPositive() {
+			break
+		}
+	}
+	return price
+}
+
+// crosses tells if a book level at the specified price can be matched by an order.
+func crosses(orderType environment.OrderType, limit decimal.Decimal, price decimal.Decimal) bool {
+	if orderType == environment.Bid {
+		return price.LessThanOrEqual(limit)
+	}
+	return price.GreaterThanOrEqual(limit)
+}
+
+// fill executes a quantity of an order at the specified price, updating balances.
+//
+//     NOTE: must be called holding the lock.
+func (wrapper *Exchange) fill(order *backtestOrder, price decimal.Decimal, quantity decimal.Decimal, maker bool) {
+	if !quantity.IsPositive() {
+		return
+	}
+
+	feeRate := wrapper.takerFee
+	if maker {
+		feeRate = wrapper.makerFee
+	}
+
+	market := order.market
+	total := quantity.Mul(price)
+	fee := total.Mul(feeRate)
+	remaining := order.status.RemainingQuantity()
+
+	if order.status.Type == environment.Bid {
+		release := order.reserved.Mul(quantity).Div(remaining)
+		order.reserved = order.reserved.Sub(release)
+		wrapper.balances[market.BaseCurrency] = wrapper.balances[market.BaseCurrency].Add(release).Sub(total).Sub(fee)
+		wrapper.balances[market.MarketCurrency] = wrapper.balances[market.MarketCurrency].Add(quantity)
+	} else {
+		order.reserved = order.reserved.Sub(quantity)
+		wrapper.balances[market.BaseCurrency] = wrapper.balances[market.BaseCurrency].Add(total).Sub(fee)
+	}
+
+	status := &order.status
+	status.AveragePrice = status.AveragePrice.Mul(status.FilledQuantity).Add(total).Div(status.FilledQuantity.Add(quantity))
+	status.FilledQuantity = status.FilledQuantity.Add(quantity)
+	status.Fee = status.Fee.Add(fee)
+	status.FeeCurrency = market.BaseCurrency
+	if status.RemainingQuantity().IsZero() {
+		status.State = environment.OrderFilled
+	} else {
+		status.State = environment.OrderPartiallyFilled
+	}
+
+	wrapper.fills = append(wrapper.fills, Fill{
+		Time:        wrapper.clock.Now(),
+		Exchange:    wrapper.name,
+		Market:      market.Name,
+		OrderID:     status.ID,
+		Type:        status.Type,
+		Price:       price,
+		Quantity:    quantity,
+		Fee:         fee,
+		FeeCurrency: market.BaseCurrency,
+		Maker:       maker,
+	})
+}
+
+// closeOrder closes an open order, releasing the reserved balance.
+//
+//     NOTE: must be called holding the lock.
+func (wrapper *Exchange) closeOrder(order *backtestOrder, state environment.OrderState) {
+	reserveCurrency := order.market.MarketCurrency
+	if order.status.Type == environment.Bid {
+		reserveCurrency = order.market.BaseCurrency
+	}
+	wrapper.balances[reserveCurrency] = wrapper.balances[reserveCurrency].Add(order.reserved)
+	order.reserved = decimal.Zero
+	order.status.State = state
+}
+
+// match matches the resting orders against the history replayed until the specified time.
+//
+//     Order book snapshots are used when available, otherwise an order is filled
+//     at its limit price by the first candle whose range reaches it.
+func (wrapper *Exchange) match(now time.Time) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	from := wrapper.lastMatch
+	wrapper.lastMatch = now
+
+	for _, order := range wrapper.orderList {
+		if !order.status.State.IsOpen() {
+			continue
+		}
+
+		data, err := wrapper.marketData(order.market)
+		if err != nil {
+			continue
+		}
+
+		if len(data.Books) > 0 {
+			for _, snapshot := range data.booksBetween(from, now) {
+				levels := snapshot.Book.Asks
+				if order.status.Type == environment.Ask {
+					levels = snapshot.Book.Bids
+				}
+				for _, level := range levels {
+					if !order.status.State.IsOpen() || !crosses(order.status.Type, order.limit, level.Value) {
+						break
+					}
+					wrapper.fill(order, order.limit, decimal.Min(level.Quantity, order.status.RemainingQuantity()), true)
+				}
+			}
+			continue
+		}
+
+		for _, bar := range data.barsClosedBetween(from, now) {
+			reached := bar.Candle.Low.LessThanOrEqual(order.limit)
+			if order.status.Type == environment.Ask {
+				reached = bar.Candle.High.GreaterThanOrEqual(order.limit)
+			}
+			if reached {
+				wrapper.fill(order, order.limit, order.status.RemainingQuantity(), true)
+				break
+			}
+		}
+	}
+}
+
+// GetOrder gets the status of an order placed on the backtest exchange.
+func (wrapper *Exchange) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	order, exists := wrapper.orders[orderID]
+	if !exists {
+		return nil, errors.New("Order not found")
+	}
+
+	ret := order.status
+	return &ret, nil
+}
+
+// GetOpenOrders gets the open orders on a market.
+func (wrapper *Exchange) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	ret := make([]environment.OrderStatus, 0)
+	for _, order := range wrapper.orderList {
+		if order.market.Name == market.Name && order.status.State.IsOpen() {
+			ret = append(ret, order.status)
+		}
+	}
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *Exchange) CancelOrder(market *environment.Market, orderID string) error {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	order, exists := wrapper.orders[orderID]
+	if !exists {
+		return errors.New("Order not found")
+	}
+	if !order.status.State.IsOpen() {
+		return fmt.Errorf("Cannot cancel order %s: order is %s", orderID, order.status.State)
+	}
+
+	wrapper.closeOrder(order, environment.OrderCanceled)
+	return nil
+}
+
+// CancelAllOrders cancels all the open orders on a market.
+func (wrapper *Exchange) CancelAllOrders(market *environment.Market) error {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	for _, order := range wrapper.orderList {
+		if order.market.Name == market.Name && order.status.State.IsOpen() {
+			wrapper.closeOrder(order, environment.OrderCanceled)
+		}
+	}
+	return nil
+}
+
+// CalculateTradingFees calculates the trading fees for an order on a specified market.
+func (wrapper *Exchange) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType exchanges.TradeType) (decimal.Decimal, error) {
+	feeRate := wrapper.takerFee
+	if orderType == exchanges.MakerTrade {
+		feeRate = wrapper.makerFee
+	}
+	return amount.Mul(limit).Mul(feeRate), nil
+}
+
+// CalculateWithdrawFees calculates the withdrawal fees on a specified market.
+//
+//     NOTE: withdrawals are free in backtests.
+func (wrapper *Exchange) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, nil
+}
+
+// GetBalance gets the available balance of the specified currency.
+func (wrapper *Exchange) GetBalance(symbol string) (*decimal.Decimal, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	balance := wrapper.balances[symbol]
+	return &balance, nil
+}
+
+// GetBalances gets the free, locked and total balances of all the currencies, by currency:
+// the locked balances are the amounts reserved by the open orders.
+func (wrapper *Exchange) GetBalances() (map[string]environment.Balance, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	locked := wrapper.reservedBalances()
+	ret := make(map[string]environment.Balance, len(wrapper.balances))
+	for coin, free := range wrapper.balances {
+		ret[coin] = environment.Balance{
+			Free:   free,
+			Locked: locked[coin],
+			Total:  free.Add(locked[coin]),
+		}
+	}
+	for coin, amount := range locked {
+		if _, exists := ret[coin]; !exists {
+			ret[coin] = environment.Balance{
+				Locked: amount,
+				Total:  amount,
+			}
+		}
+	}
+	return ret, nil
+}
+
+// reservedBalances gets the balances reserved by the open orders, by currency.
+//
+//     NOTE: must be called holding the lock.
+func (wrapper *Exchange) reservedBalances() map[string]decimal.Decimal {
+	ret := make(map[string]decimal.Decimal)
+	for _, order := range wrapper.orderList {
+		if !order.status.State.IsOpen() {
+			continue
+		}
+		reserveCurrency := order.market.MarketCurrency
+		if order.status.Type == environment.Bid {
+			reserveCurrency = order.market.BaseCurrency
+		}
+		ret[reserveCurrency] = ret[reserveCurrency].Add(order.reserved)
+	}
+	return ret
+}
+
+// GetDepositAddress gets the deposit address for the specified coin on the exchange.
+func (wrapper *Exchange) GetDepositAddress(coinTicker string) (string, bool) {
+	return "", false
+}
+
+// FeedConnect does nothing: the replayed data is always up to date with the simulated time.
+func (wrapper *Exchange) FeedConnect(markets []*environment.Market) error {
+	return nil
+}
+
+// Withdraw removes the amount from the balance.
+func (wrapper *Exchange) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return errors.New("Withdraw amount must be > 0")
+	}
+
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	if wrapper.balances[coinTicker].LessThan(amount) {
+		return fmt.Errorf("Cannot withdraw: %w, not enough %s balance", exchanges.ErrInsufficientFunds, coinTicker)
+	}
+	wrapper.balances[coinTicker] = wrapper.balances[coinTicker].Sub(amount)
+	return nil
+}
+
+// Fills gets all the executions occurred on the exchange.
+func (wrapper *Exchange) Fills() []Fill {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	return append([]Fill(nil), wrapper.fills...)
+}
+
+// equity gets the value of the account (including reserved balances) in the specified currency,
+// using the last close price of the replayed markets.
+//
+//     NOTE: coins which cannot be valued in the specified currency are ignored.
+func (wrapper *Exchange) equity(currency string, now time.Time) decimal.Decimal {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	holdings := make(map[string]decimal.Decimal, len(wrapper.balances))
+	for coin, amount := range wrapper.balances {
+		holdings[coin] = amount
+	}
+	for coin, amount := range wrapper.reservedBalances() {
+		holdings[coin] = holdings[coin].Add(amount)
+	}
+
+	total := holdings[currency]
+	for coin, amount := range holdings {
+		if coin == currency || amount.IsZero() {
+			continue
+		}
+		for _, m := range wrapper.markets {
+			if m.market.MarketCurrency != coin || m.market.BaseCurrency != currency {
+				continue
+			}
+			if bar, exists := m.data.lastBar(now); exists {
+				total = total.Add(amount.Mul(bar.Candle.Close))
+			}
+			break
+		}
+	}
+	return total
+}
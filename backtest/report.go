@@ -0,0 +1,244 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+const year = 365 * 24 * time.Hour
+
+// EquityPoint represents the value of the accounts at a simulated time.
+type EquityPoint struct {
+	Time   time.Time       //Represents the simulated time.
+	Equity decimal.Decimal //Represents the value of all the accounts in the report currency.
+}
+
+// Report contains the results of a backtest.
+type Report struct {
+	From     time.Time //Represents the start of the replayed history.
+	To       time.Time //Represents the end of the replayed history.
+	Currency string    //Represents the currency used to value the accounts.
+
+	InitialEquity decimal.Decimal //Represents the value of the accounts at the start.
+	FinalEquity   decimal.Decimal //Represents the value of the accounts at the end.
+	PnL           decimal.Decimal //Represents the profit (or loss) in the report currency.
+	PnLPercent    float64         //Represents the profit (or loss) in percentage of the initial equity.
+	MaxDrawdown   float64         //Represents the max loss from a peak of equity, in percentage.
+	SharpeRatio   float64         //Represents the annualized Sharpe ratio of the equity returns (zero risk free rate).
+
+	ClosedTrades int     //Represents the number of sells closing (part of) a position.
+	WinRate      float64 //Represents the percentage of closed trades in profit.
+
+	TotalFees map[string]decimal.Decimal //Represents the paid fees, by currency.
+	Trades    []Fill                     //Represents all the executions, sorted by time.
+	Equity    []EquityPoint              //Represents the equity curve.
+}
+
+// newReport computes a report from the equity curve and the executions of a backtest,
+// the returns of the Sharpe ratio are computed every period.
+func newReport(from time.Time, to time.Time, currency string, equity []EquityPoint, fills []Fill, period time.Duration) *Report {
+	report := &Report{
+		From:      from,
+		To:        to,
+		Currency:  currency,
+		TotalFees: make(map[string]decimal.Decimal),
+		Trades:    fills,
+		Equity:    equity,
+	}
+
+	sort.SliceStable(report.Trades, func(i, j int) bool {
+		return report.Trades[i].Time.Before(report.Trades[j].Time)
+	})
+
+	if len(equity) > 0 {
+		report.InitialEquity = equity[0].Equity
+		report.FinalEquity = equity[len(equity)-1].Equity
+		report.PnL = report.FinalEquity.Sub(report.InitialEquity)
+		if !report.InitialEquity.IsZero() {
+			report.PnLPercent, _ = report.PnL.Div(report.InitialEquity).Mul(decimal.NewFromInt(100)).Float64()
+		}
+	}
+
+	report.MaxDrawdown = maxDrawdown(equity)
+	report.SharpeRatio = sharpeRatio(equity, period)
+
+	for _, fill := range fills {
+		report.TotalFees[fill.FeeCurrency] = report.TotalFees[fill.FeeCurrency].Add(fill.Fee)
+	}
+
+	report.ClosedTrades, report.WinRate = winRate(report.Trades)
+
+	return report
+}
+
+// maxDrawdown computes the max loss from a peak of the equity curve, in percentage.
+func maxDrawdown(equity []EquityPoint) float64 {
+	var peak, drawdown float64
+	for _, point := range equity {
+		value, _ := point.Equity.Float64()
+		if value > peak {
+			peak = value
+		}
+		if peak > 0 && (peak-value)/peak > drawdown {
+			drawdown = (peak - value) / peak
+		}
+	}
+	return drawdown * 100
+}
+
+// sharpeRatio computes the annualized Sharpe ratio of the returns of the equity curve every period, with a zero risk free rate.
+//
+//     NOTE: the equity is sampled at irregular times, it is resampled every period (taking the last sample before each step) first.
+func sharpeRatio(equity []EquityPoint, period time.Duration) float64 {
+	if period <= 0 {
+		return 0
+	}
+
+	values := resample(equity, period)
+	returns := make([]float64, 0, len(values))
+	for i := 1; i < len(values); i++ {
+		if values[i-1] == 0 {
+			continue
+		}
+		returns = append(returns, values[i]/values[i-1]-1)
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(returns)-1))
+	if stdDev < 1e-12 { // constant returns, up to rounding errors.
+		return 0
+	}
+
+	return mean / stdDev * math.Sqrt(float64(year)/float64(period))
+}
+
+// resample gets the equity every period from the first sample, as the value of the last sample taken at or before each step.
+func resample(equity []EquityPoint, period time.Duration) []float64 {
+	if len(equity) == 0 {
+		return nil
+	}
+
+	var ret []float64
+	last := 0
+	end := equity[len(equity)-1].Time
+	for step := equity[0].Time; !step.After(end); step = step.Add(period) {
+		for last+1 < len(equity) && !equity[last+1].Time.After(step) {
+			last++
+		}
+		value, _ := equity[last].Equity.Float64()
+		ret = append(ret, value)
+	}
+	return ret
+}
+
+// position represents the quantity held on a market and its cost, used to value closed trades.
+type position struct {
+	quantity decimal.Decimal
+	cost     decimal.Decimal
+}
+
+// winRate computes the number of closed trades and the percentage of them in profit,
+// valuing each sell against the average cost of the position (fees included).
+func winRate(fills []Fill) (int, float64) {
+	positions := make(map[string]*position)
+	var closed, won int
+
+	for _, fill := range fills {
+		key := fill.Exchange + "/" + fill.Market
+		pos, exists := positions[key]
+		if !exists {
+			pos = &position{}
+			positions[key] = pos
+		}
+
+		total := fill.Price.Mul(fill.Quantity)
+		if fill.Type == environment.Bid {
+			pos.quantity = pos.quantity.Add(fill.Quantity)
+			pos.cost = pos.cost.Add(total).Add(fill.Fee)
+			continue
+		}
+
+		if !pos.quantity.IsPositive() {
+			continue
+		}
+
+		quantity := decimal.Min(fill.Quantity, pos.quantity)
+		cost := pos.cost.Mul(quantity).Div(pos.quantity)
+		proceeds := fill.Price.Mul(quantity).Sub(fill.Fee.Mul(quantity).Div(fill.Quantity))
+
+		pos.quantity = pos.quantity.Sub(quantity)
+		pos.cost = pos.cost.Sub(cost)
+
+		closed++
+		if proceeds.GreaterThan(cost) {
+			won++
+		}
+	}
+
+	if closed == 0 {
+		return 0, 0
+	}
+	return closed, float64(won) / float64(closed) * 100
+}
+
+// String returns a string representation of the object.
+func (report Report) String() string {
+	var ret strings.Builder
+
+	fmt.Fprintln(&ret, "Backtest from", report.From.Format(time.RFC3339), "to", report.To.Format(time.RFC3339))
+	fmt.Fprintln(&ret, "  Initial equity:", report.InitialEquity.StringFixed(8), report.Currency)
+	fmt.Fprintln(&ret, "  Final equity:  ", report.FinalEquity.StringFixed(8), report.Currency)
+	fmt.Fprintf(&ret, "  PnL:            %s %s (%.2f%%)\n", report.PnL.StringFixed(8), report.Currency, report.PnLPercent)
+	fmt.Fprintf(&ret, "  Max drawdown:   %.2f%%\n", report.MaxDrawdown)
+	fmt.Fprintf(&ret, "  Sharpe ratio:   %.2f\n", report.SharpeRatio)
+	fmt.Fprintf(&ret, "  Win rate:       %.2f%% (%d closed trades)\n", report.WinRate, report.ClosedTrades)
+
+	currencies := make([]string, 0, len(report.TotalFees))
+	for currency := range report.TotalFees {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		fmt.Fprintln(&ret, "  Fees:          ", report.TotalFees[currency].StringFixed(8), currency)
+	}
+
+	fmt.Fprintf(&ret, "Trades (%d):\n", len(report.Trades))
+	for _, trade := range report.Trades {
+		fmt.Fprintln(&ret, " ", trade)
+	}
+
+	return strings.TrimSpace(ret.String())
+}
@@ -0,0 +1,150 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+var testStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// equityCurve creates an equity curve sampled every step from testStart.
+func equityCurve(step time.Duration, values ...float64) []EquityPoint {
+	ret := make([]EquityPoint, len(values))
+	for i, value := range values {
+		ret[i] = EquityPoint{
+			Time:   testStart.Add(time.Duration(i) * step),
+			Equity: decimal.NewFromFloat(value),
+		}
+	}
+	return ret
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		equity []EquityPoint
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"always rising", equityCurve(time.Hour, 100, 110, 120), 0},
+		{"single drop", equityCurve(time.Hour, 100, 80, 120), 20},
+		{"deepest from highest peak", equityCurve(time.Hour, 100, 90, 200, 150, 180, 100), 50},
+		{"zero equity", equityCurve(time.Hour, 0, 0), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := maxDrawdown(test.equity); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("maxDrawdown() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSharpeRatio(t *testing.T) {
+	// returns of +10% and -5% alternated every day: mean 2.5%, sample standard deviation of 8.66%.
+	alternated := equityCurve(24*time.Hour, 100, 110, 104.5, 114.95, 109.2025)
+	alternatedSharpe := 0.025 / (0.075 * math.Sqrt(4.0/3.0)) * math.Sqrt(365)
+
+	// the same curve sampled at irregular times, with more samples in the same days.
+	irregular := []EquityPoint{
+		{Time: testStart, Equity: decimal.NewFromFloat(100)},
+		{Time: testStart.Add(time.Hour), Equity: decimal.NewFromFloat(100)},
+		{Time: testStart.Add(24 * time.Hour), Equity: decimal.NewFromFloat(110)},
+		{Time: testStart.Add(30 * time.Hour), Equity: decimal.NewFromFloat(110)},
+		{Time: testStart.Add(31 * time.Hour), Equity: decimal.NewFromFloat(110)},
+		{Time: testStart.Add(48 * time.Hour), Equity: decimal.NewFromFloat(104.5)},
+		{Time: testStart.Add(72 * time.Hour), Equity: decimal.NewFromFloat(114.95)},
+		{Time: testStart.Add(95 * time.Hour), Equity: decimal.NewFromFloat(114.95)},
+		{Time: testStart.Add(96 * time.Hour), Equity: decimal.NewFromFloat(109.2025)},
+	}
+
+	tests := []struct {
+		name   string
+		equity []EquityPoint
+		period time.Duration
+		want   float64
+	}{
+		{"empty", nil, 24 * time.Hour, 0},
+		{"too few returns", equityCurve(24*time.Hour, 100, 110), 24 * time.Hour, 0},
+		{"constant returns", equityCurve(24*time.Hour, 100, 110, 121, 133.1), 24 * time.Hour, 0},
+		{"no period", alternated, 0, 0},
+		{"alternated returns", alternated, 24 * time.Hour, alternatedSharpe},
+		{"irregular samples are resampled", irregular, 24 * time.Hour, alternatedSharpe},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sharpeRatio(test.equity, test.period); math.Abs(got-test.want) > 1e-6 {
+				t.Errorf("sharpeRatio() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWinRate(t *testing.T) {
+	fill := func(market string, orderType environment.OrderType, price float64, quantity float64, fee float64) Fill {
+		return Fill{
+			Exchange: "test",
+			Market:   market,
+			Type:     orderType,
+			Price:    decimal.NewFromFloat(price),
+			Quantity: decimal.NewFromFloat(quantity),
+			Fee:      decimal.NewFromFloat(fee),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		fills      []Fill
+		wantClosed int
+		wantRate   float64
+	}{
+		{"no fills", nil, 0, 0},
+		{"only buys", []Fill{fill("A", environment.Bid, 10, 1, 0)}, 0, 0},
+		{"sell without position", []Fill{fill("A", environment.Ask, 10, 1, 0)}, 0, 0},
+		{"win", []Fill{fill("A", environment.Bid, 10, 1, 0), fill("A", environment.Ask, 12, 1, 0)}, 1, 100},
+		{"loss", []Fill{fill("A", environment.Bid, 10, 1, 0), fill("A", environment.Ask, 8, 1, 0)}, 1, 0},
+		{"fees turn a win into a loss", []Fill{fill("A", environment.Bid, 10, 1, 0.5), fill("A", environment.Ask, 10.8, 1, 0.5)}, 1, 0},
+		{"partial closes at average cost", []Fill{
+			fill("A", environment.Bid, 10, 1, 0),
+			fill("A", environment.Bid, 20, 1, 0),
+			fill("A", environment.Ask, 16, 1, 0),
+			fill("A", environment.Ask, 14, 1, 0),
+		}, 2, 50},
+		{"markets are separate positions", []Fill{
+			fill("A", environment.Bid, 10, 1, 0),
+			fill("B", environment.Bid, 100, 1, 0),
+			fill("A", environment.Ask, 11, 1, 0),
+			fill("B", environment.Ask, 90, 1, 0),
+		}, 2, 50},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			closed, rate := winRate(test.fills)
+			if closed != test.wantClosed || math.Abs(rate-test.wantRate) > 1e-9 {
+				t.Errorf("winRate() = %d, %v, want %d, %v", closed, rate, test.wantClosed, test.wantRate)
+			}
+		})
+	}
+}
@@ -1,43 +1,39 @@
 package helpers
 
 import (
+	"fmt"
+
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/saniales/golang-crypto-trading-bot/exchanges"
 	"github.com/shopspring/decimal"
 )
 
-//InitExchange initialize a new ExchangeWrapper binded to the specified exchange provided.
-func InitExchange(exchangeConfig environment.ExchangeConfig, simulatedMode bool, fakeBalances map[string]decimal.Decimal, depositAddresses map[string]string) exchanges.ExchangeWrapper {
+//InitExchange initialize a new ExchangeWrapper binded to the specified exchange provided, resolving it through the exchanges registry.
+func InitExchange(exchangeConfig environment.ExchangeConfig, simulatedMode bool, fakeBalances map[string]decimal.Decimal, depositAddresses map[string]string) (exchanges.ExchangeWrapper, error) {
 	if depositAddresses == nil && !simulatedMode {
-		return nil
+		return nil, fmt.Errorf("No deposit addresses for %s", exchangeConfig.ExchangeName)
+	}
+	if fakeBalances == nil && simulatedMode {
+		return nil, fmt.Errorf("No fake balances for %s, needed in simulation mode", exchangeConfig.ExchangeName)
 	}
 
-	var exch exchanges.ExchangeWrapper
-	switch exchangeConfig.ExchangeName {
-	case "bittrex":
-		exch = exchanges.NewBittrexWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "bittrexV2":
-		exch = exchanges.NewBittrexV2Wrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "poloniex":
-		exch = exchanges.NewPoloniexWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "binance":
-		exch = exchanges.NewBinanceWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "bitfinex":
-		exch = exchanges.NewBitfinexWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "hitbtc":
-		exch = exchanges.NewHitBtcV2Wrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "kucoin":
-		exch = exchanges.NewKucoinWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	default:
-		return nil
+	exchangeConfig.DepositAddresses = depositAddresses
+	exch, err := exchanges.New(exchangeConfig)
+	if err != nil {
+		return nil, err
 	}
+	exch = exchanges.NewRateLimitedWrapper(exch, exchangeConfig.RateLimits)
 
 	if simulatedMode {
-		if fakeBalances == nil {
-			return nil
+		simulator := exchanges.NewExchangeWrapperSimulator(exch, fakeBalances)
+		simulator.SetOptions(exchangeConfig.Simulation)
+		if exchangeConfig.Simulation.StateFile != "" {
+			if err := simulator.SetStateFile(exchangeConfig.Simulation.StateFile); err != nil {
+				return nil, fmt.Errorf("Cannot use simulator state file %s: %w", exchangeConfig.Simulation.StateFile, err)
+			}
 		}
-		exch = exchanges.NewExchangeWrapperSimulator(exch, fakeBalances)
+		exch = simulator
 	}
 
-	return exch
+	return exch, nil
 }
@@ -0,0 +1,100 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/backtest"
+	"github.com/saniales/golang-crypto-trading-bot/strategies"
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+)
+
+// backtestCmd represents the backtest command
+var backtestCmd = &cobra.Command{
+	Use:   "backtest",
+	Short: "Evaluates the strategies against historical data",
+	Long: `Evaluates the interval strategies of the saved configs against historical data.
+	For each exchange binding, candles are read from <data-dir>/<exchange>/<market_name>.csv
+	and (optionally) order books from <data-dir>/<exchange>/<market_name>.book.jsonl.
+	Fake balances of the configs are used as starting balances.`,
+	Run: executeBacktestCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(backtestCmd)
+
+	backtestCmd.Flags().StringVar(&backtestFlags.From, "from", "", "Start of the backtest (RFC3339 or YYYY-MM-DD)")
+	backtestCmd.Flags().StringVar(&backtestFlags.To, "to", "", "End of the backtest (RFC3339 or YYYY-MM-DD)")
+	backtestCmd.Flags().StringVar(&backtestFlags.DataDir, "data-dir", "./data", "Directory containing the historical data")
+	backtestCmd.Flags().Float64Var(&backtestFlags.MakerFee, "maker-fee", 0.001, "Fee rate of resting orders")
+	backtestCmd.Flags().Float64Var(&backtestFlags.TakerFee, "taker-fee", 0.001, "Fee rate of orders matching the book")
+	backtestCmd.Flags().StringVar(&backtestFlags.Currency, "currency", "", "Currency used to value the accounts (default: base currency of the first market)")
+	backtestCmd.Flags().DurationVar(&backtestFlags.Period, "period", 0, "Candle period of the historical data (default: inferred from the candles)")
+	backtestCmd.MarkFlagRequired("from")
+	backtestCmd.MarkFlagRequired("to")
+}
+
+// parseBacktestTime parses a time expressed in RFC3339 or as a date.
+func parseBacktestTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func executeBacktestCommand(cmd *cobra.Command, args []string) {
+	from, err := parseBacktestTime(backtestFlags.From)
+	if err != nil {
+		fmt.Println("Invalid --from value:", err)
+		return
+	}
+	to, err := parseBacktestTime(backtestFlags.To)
+	if err != nil {
+		fmt.Println("Invalid --to value:", err)
+		return
+	}
+
+	fmt.Print("Getting configurations ... ")
+	if err := initConfigs(); err != nil {
+		fmt.Println("Cannot read from configuration file, please create or replace the current one using gobot init")
+		return
+	}
+	fmt.Println("DONE")
+
+	fmt.Print("Getting markets cold info ... ")
+	initTactics()
+	fmt.Println("DONE")
+
+	fmt.Println("Running backtest ... ")
+	report, err := backtest.Run(backtest.Config{
+		From:     from,
+		To:       to,
+		DataDir:  backtestFlags.DataDir,
+		MakerFee: decimal.NewFromFloat(backtestFlags.MakerFee),
+		TakerFee: decimal.NewFromFloat(backtestFlags.TakerFee),
+		Currency: backtestFlags.Currency,
+		Period:   backtestFlags.Period,
+	}, botConfig.ExchangeConfigs, strategies.AppliedTactics())
+	if err != nil {
+		fmt.Println("Cannot run backtest:", err)
+		return
+	}
+
+	fmt.Println(report)
+}
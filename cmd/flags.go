@@ -15,6 +15,8 @@
 
 package bot
 
+import "time"
+
 //GlobalFlags provides flag definitions valid for the whole system.
 var GlobalFlags struct {
 	Verbose    int    //Tells the program to print everything to screen (used multiple times for better verbosity).
@@ -41,3 +43,14 @@ var initFlags struct {
 var startFlags struct {
 	Simulate bool
 }
+
+// backtestFlags provides flag definition for backtest command.
+var backtestFlags struct {
+	From     string
+	To       string
+	DataDir  string
+	MakerFee float64
+	TakerFee float64
+	Currency string
+	Period   time.Duration
+}
@@ -18,7 +18,6 @@ package bot
 import (
 	"fmt"
 	"os"
-	"os/signal"
 
 	"github.com/spf13/cobra"
 )
@@ -35,8 +34,6 @@ var RootCmd = &cobra.Command{
 	Run:   executeRootCommand,
 }
 
-var signals chan os.Signal
-
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -46,17 +43,6 @@ func Execute() {
 }
 
 func init() {
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
-
-	go func() {
-		<-signals
-		signal.Stop(signals)
-		fmt.Println()
-		fmt.Println("CTRL-C command received. Exiting...")
-		os.Exit(0)
-	}()
-
 	RootCmd.Flags().BoolVarP(&rootFlags.Version, "version", "V", false, "show version information.")
 
 	RootCmd.PersistentFlags().CountVarP(&GlobalFlags.Verbose, "verbose", "v", "show verbose information when trading : use multiple times to increase verbosity level.")
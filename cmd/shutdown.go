@@ -0,0 +1,161 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/saniales/golang-crypto-trading-bot/exchanges"
+	"github.com/saniales/golang-crypto-trading-bot/strategies"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	exitOK             = 0 // Represents a clean exit.
+	exitShutdownFailed = 1 // Represents an exit with TearDown, order cancellation or state saving failures.
+	exitShutdownForced = 2 // Represents an exit forced by a second signal.
+
+	cancelOrdersTimeout = 30 * time.Second // Represents the max time given to cancel the open orders.
+)
+
+// runUntilShutdown executes the bot loop until the strategies end or a SIGINT/SIGTERM is received,
+// then performs the shutdown procedure configured in the bot config.
+//
+// Returns the exit status of the bot.
+//
+//     NOTE: the open orders are cancelled only once all the strategies stopped, so that none can place new ones.
+//     The websocket feeds are closed and the state of the simulators saved on every exit but a forced one.
+func runUntilShutdown(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, config environment.ShutdownConfig) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	logrus.RegisterExitHandler(flushLogger)
+
+	botLoopDone := make(chan struct{})
+	go func() {
+		executeBotLoop(wrappers)
+		close(botLoopDone)
+	}()
+
+	select {
+	case <-botLoopDone:
+		return releaseResources(wrappers, markets, exitOK)
+	case sig := <-signals:
+		fmt.Println()
+		fmt.Printf("%s received, shutting down (send it again to force exit) ...\n", sig)
+	}
+
+	go func() {
+		<-signals
+		fmt.Println("Shutdown forced")
+		logrus.Exit(exitShutdownForced)
+	}()
+
+	status := exitOK
+
+	tearDownTimeout := config.TearDownTimeout
+	if tearDownTimeout <= 0 {
+		tearDownTimeout = strategies.DefaultTearDownTimeout
+	}
+
+	fmt.Print("Stopping strategies ... ")
+	strategies.StopAllStrategies(tearDownTimeout)
+	stopped := true
+	select {
+	case <-botLoopDone:
+		fmt.Println("DONE")
+	case <-time.After(tearDownTimeout + time.Second):
+		fmt.Println("TIMEOUT")
+		stopped = false
+		status = exitShutdownFailed
+	}
+
+	if config.CancelOpenOrders {
+		fmt.Print("Cancelling open orders ... ")
+		if !stopped {
+			fmt.Println("SKIPPED, some strategies are still running and may place new orders")
+		} else if cancelOpenOrders(wrappers, markets) {
+			fmt.Println("DONE")
+		} else {
+			fmt.Println("FAILED")
+			status = exitShutdownFailed
+		}
+	}
+
+	return releaseResources(wrappers, markets, status)
+}
+
+// releaseResources closes the websocket feeds of the markets and saves the state of the simulators,
+// returning the exit status updated with the outcome.
+func releaseResources(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, status int) int {
+	fmt.Print("Closing feeds ... ")
+	for _, wrapper := range wrappers {
+		exchanges.CloseFeed(wrapper, markets)
+	}
+	fmt.Println("DONE")
+
+	for _, wrapper := range wrappers {
+		simulator, isSimulator := wrapper.(*exchanges.ExchangeWrapperSimulator)
+		if !isSimulator {
+			continue
+		}
+
+		if err := simulator.SaveState(); err != nil {
+			logrus.Errorf("Cannot save the simulator state of %s: %s", simulator, err)
+			status = exitShutdownFailed
+		}
+	}
+
+	return status
+}
+
+// flushLogger commits the log written to a file to stable storage, before exiting.
+func flushLogger() {
+	if file, isFile := logrus.StandardLogger().Out.(*os.File); isFile {
+		file.Sync() // fails on terminals and pipes, which need no flush.
+	}
+}
+
+// cancelOpenOrders cancels all the open orders on the specified markets, for each wrapper trading them.
+//
+// Returns true if all the orders have been cancelled.
+func cancelOpenOrders(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelOrdersTimeout)
+	defer cancel()
+
+	success := true
+	for _, wrapper := range wrappers {
+		boundWrapper := exchanges.BindContext(ctx, wrapper)
+		for _, market := range markets {
+			if exchanges.MarketNameFor(market, wrapper) == "" {
+				continue
+			}
+
+			err := boundWrapper.CancelAllOrders(market)
+			if err != nil {
+				logrus.Errorf("Cannot cancel open orders of %s on %s: %s", market.Name, wrapper.Name(), err)
+				success = false
+			}
+		}
+	}
+	return success
+}
@@ -19,12 +19,12 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
 	helpers "github.com/saniales/golang-crypto-trading-bot/bot_helpers"
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/saniales/golang-crypto-trading-bot/exchanges"
 	"github.com/saniales/golang-crypto-trading-bot/strategies"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
@@ -72,37 +72,53 @@ func executeStartCommand(cmd *cobra.Command, args []string) {
 	fmt.Print("Getting exchange info ... ")
 	wrappers := make([]exchanges.ExchangeWrapper, len(botConfig.ExchangeConfigs))
 	for i, config := range botConfig.ExchangeConfigs {
-		wrappers[i] = helpers.InitExchange(config, botConfig.SimulationModeOn, config.FakeBalances, config.DepositAddresses)
+		wrapper, err := helpers.InitExchange(config, botConfig.SimulationModeOn, config.FakeBalances, config.DepositAddresses)
+		if err != nil {
+			fmt.Printf("Cannot initialize exchange %s: %s\n", config.ExchangeName, err)
+			return
+		}
+		wrappers[i] = wrapper
 	}
 	fmt.Println("DONE")
 
 	fmt.Print("Getting markets cold info ... ")
-	for _, strategyConf := range botConfig.Strategies {
-		mkts := make([]*environment.Market, len(strategyConf.Markets))
-		for i, mkt := range strategyConf.Markets {
-			currencies := strings.SplitN(mkt.Name, "-", 2)
-			mkts[i] = &environment.Market{
-				Name:           mkt.Name,
-				BaseCurrency:   currencies[0],
-				MarketCurrency: currencies[1],
-			}
+	tradedMarkets := initTactics()
+	fmt.Println("DONE")
+
+	fmt.Print("Checking exchange capabilities ... ")
+	if err := strategies.CheckRequirements(wrappers); err != nil {
+		fmt.Println("Cannot start, the strategies need operations not supported by their exchanges:", err)
+		return
+	}
+	fmt.Println("DONE")
 
-			mkts[i].ExchangeNames = make(map[string]string, len(wrappers))
+	fmt.Println("Starting bot ... ")
+	status := runUntilShutdown(wrappers, tradedMarkets, botConfig.Shutdown)
+	fmt.Println("EXIT, good bye :)")
+	logrus.Exit(status)
+}
 
-			for _, exName := range mkt.Exchanges {
-				mkts[i].ExchangeNames[exName.Name] = exName.MarketName
+// initTactics matches the strategies of the bot config with their markets, returning all the traded markets.
+//
+//     NOTE: the strategies trading the same market share the same *environment.Market.
+func initTactics() []*environment.Market {
+	registry := environment.NewMarketRegistry()
+	for _, strategyConf := range botConfig.Strategies {
+		mkts := make([]*environment.Market, 0, len(strategyConf.Markets))
+		for _, mkt := range strategyConf.Markets {
+			market, err := registry.Register(mkt)
+			if err != nil {
+				fmt.Println("Cannot add market : ", err)
+				continue
 			}
+			mkts = append(mkts, market)
 		}
 		err := strategies.MatchWithMarkets(strategyConf.Strategy, mkts)
 		if err != nil {
 			fmt.Println("Cannot add tactic : ", err)
 		}
 	}
-	fmt.Println("DONE")
-
-	fmt.Println("Starting bot ... ")
-	executeBotLoop(wrappers)
-	fmt.Println("EXIT, good bye :)")
+	return registry.Markets()
 }
 
 func executeBotLoop(wrappers []exchanges.ExchangeWrapper) {
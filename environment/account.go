@@ -0,0 +1,90 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package environment
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+//AccountEventType is an enum {OrderUpdateEvent, FillEvent, BalanceEvent}
+type AccountEventType int16
+
+const (
+	//OrderUpdateEvent Represents a change of the state (or of the filled quantity) of an order of the user.
+	OrderUpdateEvent AccountEventType = iota
+	//FillEvent Represents a (partial) execution of an order of the user.
+	FillEvent AccountEventType = iota
+	//BalanceEvent Represents a change of the balance of a currency of the user.
+	BalanceEvent AccountEventType = iota
+)
+
+// String returns the string representation of the object.
+func (eventType AccountEventType) String() string {
+	switch eventType {
+	case OrderUpdateEvent:
+		return "Order Update"
+	case FillEvent:
+		return "Fill"
+	case BalanceEvent:
+		return "Balance"
+	default:
+		return "Unknown"
+	}
+}
+
+//Fill represents a (partial) execution of an order of the user.
+type Fill struct {
+	OrderID     string          //Order number as returned by the order placement functions.
+	TradeID     string          //[optional] Trade number as seen in exchange archives.
+	Side        OrderType       //Represents the side of the order (Bid = buy, Ask = sell).
+	Price       decimal.Decimal //Execution price.
+	Quantity    decimal.Decimal //Executed quantity.
+	Fee         decimal.Decimal //[optional] Fee paid for the execution.
+	FeeCurrency string          //[optional] Currency used to pay the fee.
+	Maker       bool            //[optional] Tells if the order was resting on the book when filled.
+	Time        time.Time       //The time of the execution.
+}
+
+//Total returns fill total in base currency.
+func (fill Fill) Total() decimal.Decimal {
+	return fill.Quantity.Mul(fill.Price)
+}
+
+//BalanceUpdate represents the new balance of a currency of the user.
+type BalanceUpdate struct {
+	Currency string          //Currency of the balance, as named by the exchange.
+	Free     decimal.Decimal //Balance available, amounts reserved by open orders excluded.
+}
+
+//AccountEvent represents an event of the account of the user on an exchange, sent by its private stream.
+type AccountEvent struct {
+	Type     AccountEventType //Represents the kind of event, telling which of Order, Fill and Balance is set.
+	Exchange string           //Name of the exchange of the account.
+	Market   *Market          //Market of the order, nil for BalanceEvent.
+	Order    *OrderStatus     //New status of the order, set for OrderUpdateEvent.
+	Fill     *Fill            //Execution of the order, set for FillEvent.
+	Balance  *BalanceUpdate   //New balance, set for BalanceEvent.
+	Time     time.Time        //The time of the event (as got from the exchange, if sent).
+}
+
+//Balance represents the balance of a currency of the user.
+type Balance struct {
+	Free   decimal.Decimal //Balance available, amounts reserved by open orders excluded.
+	Locked decimal.Decimal //Balance reserved by open orders (or otherwise not available).
+	Total  decimal.Decimal //Whole balance, Free + Locked.
+}
@@ -24,13 +24,63 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+//CandleInterval represents the period of a candle, normalized across the exchanges.
+type CandleInterval string
+
+const (
+	//Interval1m represents 1 minute candles.
+	Interval1m CandleInterval = "1m"
+	//Interval5m represents 5 minutes candles.
+	Interval5m CandleInterval = "5m"
+	//Interval15m represents 15 minutes candles.
+	Interval15m CandleInterval = "15m"
+	//Interval30m represents 30 minutes candles.
+	Interval30m CandleInterval = "30m"
+	//Interval1h represents 1 hour candles.
+	Interval1h CandleInterval = "1h"
+	//Interval4h represents 4 hours candles.
+	Interval4h CandleInterval = "4h"
+	//Interval1d represents 1 day candles.
+	Interval1d CandleInterval = "1d"
+)
+
+var candleIntervalDurations = map[CandleInterval]time.Duration{
+	Interval1m:  time.Minute,
+	Interval5m:  5 * time.Minute,
+	Interval15m: 15 * time.Minute,
+	Interval30m: 30 * time.Minute,
+	Interval1h:  time.Hour,
+	Interval4h:  4 * time.Hour,
+	Interval1d:  24 * time.Hour,
+}
+
+// ParseCandleInterval gets the interval represented by a string (e.g. "15m"), returning an error if it is not supported.
+func ParseCandleInterval(s string) (CandleInterval, error) {
+	interval := CandleInterval(s)
+	if _, valid := candleIntervalDurations[interval]; !valid {
+		return "", fmt.Errorf("Invalid candle interval: %s", s)
+	}
+	return interval, nil
+}
+
+// Duration gets the length of the interval, or zero if the interval is not valid.
+func (interval CandleInterval) Duration() time.Duration {
+	return candleIntervalDurations[interval]
+}
+
+// String returns the string representation of the object.
+func (interval CandleInterval) String() string {
+	return string(interval)
+}
+
 //CandleStick represents a single candlestick in a chart.
 type CandleStick struct {
-	High   decimal.Decimal //Represents the highest value obtained during candle period.
-	Open   decimal.Decimal //Represents the first value of the candle period.
-	Close  decimal.Decimal //Represents the last value of the candle period.
-	Low    decimal.Decimal //Represents the lowest value obtained during candle period.
-	Volume decimal.Decimal //Represents the volume of trades during the candle period.
+	OpenTime time.Time       //Represents the start time of the candle period.
+	High     decimal.Decimal //Represents the highest value obtained during candle period.
+	Open     decimal.Decimal //Represents the first value of the candle period.
+	Close    decimal.Decimal //Represents the last value of the candle period.
+	Low      decimal.Decimal //Represents the lowest value obtained during candle period.
+	Volume   decimal.Decimal //Represents the volume of trades during the candle period.
 }
 
 // String returns the string representation of the object.
@@ -44,6 +94,7 @@ func (cs CandleStick) String() string {
 		color = "Neutral"
 	}
 	ret := fmt.Sprintln(color, "Candle")
+	ret += fmt.Sprintln("Open Time:", cs.OpenTime)
 	ret += fmt.Sprintln("High:", cs.High)
 	ret += fmt.Sprintln("Open:", cs.Open)
 	ret += fmt.Sprintln("Close:", cs.Close)
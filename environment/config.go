@@ -16,6 +16,8 @@
 package environment
 
 import (
+	"time"
+
 	"github.com/shopspring/decimal"
 )
 
@@ -28,6 +30,35 @@ type ExchangeConfig struct {
 	SecretKey        string                     `yaml:"secret_key"`        // Represents the secret key used to connect to Exchange API.
 	DepositAddresses map[string]string          `yaml:"deposit_addresses"` // Represents the bindings between coins and deposit address on the exchange.
 	FakeBalances     map[string]decimal.Decimal `yaml:"fake_balances"`     // Used only in simulation mode, fake starting balance [coin:balance].
+	Simulation       SimulationConfig           `yaml:"simulation"`        // Used only in simulation mode, paper trading parameters.
+	Options          map[string]interface{}     `yaml:"options"`           // [optional] Represents the extra options of the exchange, read by its factory.
+	RateLimits       RateLimitConfig            `yaml:"rate_limits"`       // [optional] Represents the limits of the requests to the exchange API and the retries of the failed reads.
+	MaxDataAge       time.Duration              `yaml:"max_data_age"`      // [optional] Represents the max age of the data served from the websocket feeds (0 for the default, negative for no limit).
+	OrderBookDepth   int                        `yaml:"orderbook_depth"`   // [optional] Represents the max number of price levels per side of the order books kept by the websocket feeds (0 for all).
+}
+
+// RateLimitConfig contains the limits of the requests to an exchange API and the retry policy of the failed reads.
+//
+//     Limits are set per endpoint class: market_data, orders and account. Missing classes use the defaults of the exchange.
+type RateLimitConfig struct {
+	Limits        map[string]RequestLimit `yaml:"limits"`          // Represents the limits of each endpoint class.
+	Retries       int                     `yaml:"retries"`         // Represents the max retries of a failed read (0 for the default, negative to disable).
+	RetryDelay    time.Duration           `yaml:"retry_delay"`     // Represents the delay before the first retry, doubled at each retry.
+	MaxRetryDelay time.Duration           `yaml:"max_retry_delay"` // Represents the max delay between two retries.
+}
+
+// RequestLimit represents a token bucket limit of the requests to an endpoint class.
+type RequestLimit struct {
+	Rate  float64 `yaml:"rate"`  // Represents the requests per second (0 or less for no limit).
+	Burst int     `yaml:"burst"` // Represents the requests which can be performed at once.
+}
+
+// SimulationConfig contains the parameters of paper trading on an exchange.
+type SimulationConfig struct {
+	Latency      time.Duration `yaml:"latency"`       // Represents the delay applied before placing each order.
+	Slippage     float64       `yaml:"slippage"`      // Represents the adverse slippage applied to taker fills (e.g. 0.001 for 0.1%).
+	PartialFills bool          `yaml:"partial_fills"` // if true, market orders are partially filled when the book is not deep enough, otherwise they are rejected.
+	StateFile    string        `yaml:"state_file"`    // [optional] file where balances and open orders are persisted across restarts, when it exists it takes precedence over the fake balances.
 }
 
 // StrategyConfig contains where a strategy will be applied in the specified exchange.
@@ -48,9 +79,16 @@ type ExchangeBindingsConfig struct {
 	MarketName string `yaml:"market_name"` // Represents the name of the market as seen from the exchange.
 }
 
+// ShutdownConfig contains the behaviour of the bot when it is stopped.
+type ShutdownConfig struct {
+	TearDownTimeout  time.Duration `yaml:"teardown_timeout"`   // Represents the max time given to each strategy TearDown (default 30s).
+	CancelOpenOrders bool          `yaml:"cancel_open_orders"` // if true, cancels all the open orders on the markets of the strategies.
+}
+
 // BotConfig contains all config data of the bot, which can be also loaded from config file.
 type BotConfig struct {
 	SimulationModeOn bool             `yaml:"simulation_mode"`  // if true, do not create real orders and do not get real balance
 	ExchangeConfigs  []ExchangeConfig `yaml:"exchange_configs"` // Represents the current exchange configuration.
 	Strategies       []StrategyConfig `yaml:"strategies"`       // Represents the current strategies adopted by the bot.
+	Shutdown         ShutdownConfig   `yaml:"shutdown"`         // Represents the behaviour of the bot when stopped.
 }
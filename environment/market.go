@@ -17,6 +17,7 @@ package environment
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/shopspring/decimal"
@@ -36,6 +37,7 @@ type Market struct {
 	BaseCurrency   string            `json:"baseCurrency,omitempty"`   //Represents the base currency of the market.
 	MarketCurrency string            `json:"marketCurrency,omitempty"` //Represents the currency to exchange by using base currency.
 	ExchangeNames  map[string]string `json:"-"`                        // Represents the various names of the market on various exchanges.
+	Info           *MarketInfo       `json:"info,omitempty"`           //[optional] Represents the trading rules of the market, as got from the exchange.
 }
 
 func (m Market) String() string {
@@ -43,6 +45,83 @@ func (m Market) String() string {
 	return strings.TrimSpace(ret)
 }
 
+//MarketInfo represents the trading rules of a market on an exchange, a zero value means no rule.
+type MarketInfo struct {
+	PriceTick              decimal.Decimal `json:"priceTick"`              //Represents the minimum price increment.
+	PriceSignificantDigits int32           `json:"priceSignificantDigits"` //Represents the max number of significant digits of the price.
+	QuantityStep           decimal.Decimal `json:"quantityStep"`           //Represents the minimum quantity increment.
+	MinQuantity            decimal.Decimal `json:"minQuantity"`            //Represents the minimum quantity of an order.
+	MaxQuantity            decimal.Decimal `json:"maxQuantity"`            //Represents the maximum quantity of an order.
+	MinNotional            decimal.Decimal `json:"minNotional"`            //Represents the minimum value (quantity * price) of an order.
+}
+
+//RoundPrice rounds a limit price to the price rules of the market, down for buy orders and up for sell orders,
+//so that the rounded limit is never worse than the requested one.
+func (info MarketInfo) RoundPrice(orderType OrderType, price decimal.Decimal) decimal.Decimal {
+	if info.PriceTick.IsPositive() {
+		ticks := price.Div(info.PriceTick)
+		if orderType == Bid {
+			ticks = ticks.Floor()
+		} else {
+			ticks = ticks.Ceil()
+		}
+		price = ticks.Mul(info.PriceTick)
+	}
+
+	if info.PriceSignificantDigits > 0 && price.IsPositive() {
+		magnitude := int32(math.Floor(math.Log10(price.InexactFloat64()))) + 1
+		places := info.PriceSignificantDigits - magnitude
+		if orderType == Bid {
+			price = price.RoundFloor(places)
+		} else {
+			price = price.RoundCeil(places)
+		}
+	}
+
+	return price
+}
+
+//RoundQuantity rounds a quantity down to the quantity step of the market.
+func (info MarketInfo) RoundQuantity(quantity decimal.Decimal) decimal.Decimal {
+	if !info.QuantityStep.IsPositive() {
+		return quantity
+	}
+	return quantity.Div(info.QuantityStep).Floor().Mul(info.QuantityStep)
+}
+
+//ValidateOrder checks the quantity and the price of an order against the rules of the market.
+//
+//The price is zero for market orders, whose value cannot be checked.
+func (info MarketInfo) ValidateOrder(quantity decimal.Decimal, price decimal.Decimal) error {
+	if !quantity.IsPositive() {
+		return fmt.Errorf("Invalid order: quantity %s must be > 0 after rounding", quantity)
+	}
+	if quantity.LessThan(info.MinQuantity) {
+		return fmt.Errorf("Invalid order: quantity %s is lower than the minimum %s", quantity, info.MinQuantity)
+	}
+	if info.MaxQuantity.IsPositive() && quantity.GreaterThan(info.MaxQuantity) {
+		return fmt.Errorf("Invalid order: quantity %s is greater than the maximum %s", quantity, info.MaxQuantity)
+	}
+	if price.IsPositive() && quantity.Mul(price).LessThan(info.MinNotional) {
+		return fmt.Errorf("Invalid order: value %s is lower than the minimum %s", quantity.Mul(price), info.MinNotional)
+	}
+	return nil
+}
+
+//PrepareOrder rounds the quantity and the price (zero for market orders) of an order to the rules of the market,
+//then validates the rounded order.
+func (info MarketInfo) PrepareOrder(orderType OrderType, quantity decimal.Decimal, price decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	quantity = info.RoundQuantity(quantity)
+	if price.IsPositive() {
+		price = info.RoundPrice(orderType, price)
+	}
+
+	if err := info.ValidateOrder(quantity, price); err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return quantity, price, nil
+}
+
 //MarketSummary represents the summary data of a market.
 type MarketSummary struct {
 	High   decimal.Decimal `json:"high,required"`   //Represents the 24 hours maximum peak of this market.
@@ -0,0 +1,103 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package environment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//MarketRegistry holds the canonical instance of each traded market, so that all the strategies trading
+//the same market on an exchange share it, along with its feed and cached data.
+type MarketRegistry struct {
+	mutex     sync.Mutex
+	byName    map[string]*Market
+	byBinding map[marketBinding]*Market
+}
+
+//marketBinding represents a market as seen by an exchange.
+type marketBinding struct {
+	exchange string
+	symbol   string
+}
+
+//NewMarketRegistry creates an empty MarketRegistry.
+func NewMarketRegistry() *MarketRegistry {
+	return &MarketRegistry{
+		byName:    make(map[string]*Market),
+		byBinding: make(map[marketBinding]*Market),
+	}
+}
+
+//Register gets the canonical market of a market config, creating it or adding the new exchange bindings to it.
+//
+//     NOTE: it fails if the market is bound to another symbol on the same exchange,
+//     or if the symbol is already bound to another market.
+func (registry *MarketRegistry) Register(config MarketConfig) (*Market, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, binding := range config.Exchanges {
+		owner, exists := registry.byBinding[marketBinding{binding.Name, binding.MarketName}]
+		if exists && owner.Name != config.Name {
+			return nil, fmt.Errorf("Market %s on %s is already traded as %s, cannot trade it as %s", binding.MarketName, binding.Name, owner.Name, config.Name)
+		}
+	}
+
+	market, exists := registry.byName[config.Name]
+	if !exists {
+		currencies := strings.SplitN(config.Name, "-", 2)
+		if len(currencies) != 2 {
+			return nil, fmt.Errorf("Invalid market name %s, expected BASE-MARKET", config.Name)
+		}
+		market = &Market{
+			Name:           config.Name,
+			BaseCurrency:   currencies[0],
+			MarketCurrency: currencies[1],
+			ExchangeNames:  make(map[string]string, len(config.Exchanges)),
+		}
+	}
+
+	for _, binding := range config.Exchanges {
+		if symbol, bound := market.ExchangeNames[binding.Name]; bound && symbol != binding.MarketName {
+			return nil, fmt.Errorf("Market %s is traded as %s on %s, cannot trade it as %s", config.Name, symbol, binding.Name, binding.MarketName)
+		}
+	}
+
+	for _, binding := range config.Exchanges {
+		market.ExchangeNames[binding.Name] = binding.MarketName
+		registry.byBinding[marketBinding{binding.Name, binding.MarketName}] = market
+	}
+	registry.byName[config.Name] = market
+	return market, nil
+}
+
+//Markets gets all the registered markets, sorted by name.
+func (registry *MarketRegistry) Markets() []*Market {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	ret := make([]*Market, 0, len(registry.byName))
+	for _, market := range registry.byName {
+		ret = append(ret, market)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
@@ -0,0 +1,96 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package environment
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRoundPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      MarketInfo
+		orderType OrderType
+		price     string
+		want      string
+	}{
+		{"no rules", MarketInfo{}, Bid, "1.23456789", "1.23456789"},
+		{"buy rounded down to the tick", MarketInfo{PriceTick: decimal.RequireFromString("0.01")}, Bid, "1.239", "1.23"},
+		{"sell rounded up to the tick", MarketInfo{PriceTick: decimal.RequireFromString("0.01")}, Ask, "1.231", "1.24"},
+		{"already on the tick", MarketInfo{PriceTick: decimal.RequireFromString("0.5")}, Ask, "2.5", "2.5"},
+		{"buy rounded down to the significant digits", MarketInfo{PriceSignificantDigits: 3}, Bid, "12345", "12300"},
+		{"sell rounded up to the significant digits", MarketInfo{PriceSignificantDigits: 3}, Ask, "0.0012341", "0.00124"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.info.RoundPrice(test.orderType, decimal.RequireFromString(test.price))
+			if !got.Equal(decimal.RequireFromString(test.want)) {
+				t.Errorf("RoundPrice(%s) = %s, want %s", test.price, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrepareOrder(t *testing.T) {
+	info := MarketInfo{
+		PriceTick:    decimal.RequireFromString("0.01"),
+		QuantityStep: decimal.RequireFromString("0.001"),
+		MinQuantity:  decimal.RequireFromString("0.01"),
+		MaxQuantity:  decimal.RequireFromString("100"),
+		MinNotional:  decimal.RequireFromString("10"),
+	}
+
+	tests := []struct {
+		name         string
+		orderType    OrderType
+		quantity     string
+		price        string
+		wantQuantity string
+		wantPrice    string
+		wantErr      bool
+	}{
+		{"limit buy rounded", Bid, "1.23456", "20.129", "1.234", "20.12", false},
+		{"limit sell rounded", Ask, "1.23456", "20.121", "1.234", "20.13", false},
+		{"market order keeps a zero price", Bid, "1.23456", "0", "1.234", "0", false},
+		{"market order skips the min notional", Ask, "0.01", "0", "0.01", "0", false},
+		{"zero after rounding", Bid, "0.0004", "20", "", "", true},
+		{"lower than the min quantity", Bid, "0.009", "2000", "", "", true},
+		{"greater than the max quantity", Ask, "100.001", "20", "", "", true},
+		{"lower than the min notional", Bid, "0.5", "19.99", "", "", true},
+		{"min notional checked after rounding", Bid, "0.5009", "19.999", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quantity, price, err := info.PrepareOrder(test.orderType, decimal.RequireFromString(test.quantity), decimal.RequireFromString(test.price))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("PrepareOrder(%s, %s) = %s, %s, want an error", test.quantity, test.price, quantity, price)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PrepareOrder(%s, %s) failed: %s", test.quantity, test.price, err)
+			}
+			if !quantity.Equal(decimal.RequireFromString(test.wantQuantity)) || !price.Equal(decimal.RequireFromString(test.wantPrice)) {
+				t.Errorf("PrepareOrder(%s, %s) = %s, %s, want %s, %s", test.quantity, test.price, quantity, price, test.wantQuantity, test.wantPrice)
+			}
+		})
+	}
+}
@@ -58,3 +58,84 @@ type Order struct {
 func (order Order) Total() decimal.Decimal {
 	return order.Quantity.Mul(order.Value)
 }
+
+//Trade represents a single trade executed on a market, as published in its trade tape.
+type Trade struct {
+	ID       string          `json:"id,omitempty"` //[optional] Represents the trade ID as seen in exchange archives, empty if the exchange does not publish it.
+	Price    decimal.Decimal `json:"price"`        //Represents the price of the trade.
+	Quantity decimal.Decimal `json:"quantity"`     //Represents the traded quantity.
+	Side     OrderType       `json:"side"`         //Represents the side of the taker: Bid for a buy, Ask for a sell.
+	Time     time.Time       `json:"time"`         //Represents the time of the trade.
+}
+
+//Total returns trade total in base currency.
+func (trade Trade) Total() decimal.Decimal {
+	return trade.Quantity.Mul(trade.Price)
+}
+
+//OrderState is an enum {New, PartiallyFilled, Filled, Canceled, Rejected}
+type OrderState int16
+
+const (
+	//OrderNew Represents an order accepted by the exchange but not yet filled.
+	OrderNew OrderState = iota
+	//OrderPartiallyFilled Represents an open order which has been partially filled.
+	OrderPartiallyFilled OrderState = iota
+	//OrderFilled Represents an order which has been completely filled.
+	OrderFilled OrderState = iota
+	//OrderCanceled Represents an order canceled (or expired) before being completely filled.
+	OrderCanceled OrderState = iota
+	//OrderRejected Represents an order rejected by the exchange.
+	OrderRejected OrderState = iota
+)
+
+// String returns the string representation of the object.
+func (state OrderState) String() string {
+	switch state {
+	case OrderNew:
+		return "New"
+	case OrderPartiallyFilled:
+		return "Partially Filled"
+	case OrderFilled:
+		return "Filled"
+	case OrderCanceled:
+		return "Canceled"
+	case OrderRejected:
+		return "Rejected"
+	default:
+		return "Unknown"
+	}
+}
+
+//IsOpen returns true if the order is still live on the exchange book.
+func (state OrderState) IsOpen() bool {
+	return state == OrderNew || state == OrderPartiallyFilled
+}
+
+//OrderStatus represents the status of an order placed by the user on an exchange.
+type OrderStatus struct {
+	ID             string          //Order number as returned by the order placement functions.
+	Type           OrderType       //Represents the side of the order (Bid = buy, Ask = sell).
+	State          OrderState      //Represents the current state of the order.
+	Price          decimal.Decimal //Limit price of the order (zero for market orders).
+	Quantity       decimal.Decimal //Quantity of Coins requested by the order.
+	FilledQuantity decimal.Decimal //Quantity of Coins already filled.
+	AveragePrice   decimal.Decimal //Average price of the fills (zero if not filled).
+	Fee            decimal.Decimal //[optional] Fees paid for the fills.
+	FeeCurrency    string          //[optional] Currency used to pay the fees.
+	Timestamp      time.Time       //[optional] The creation time of the order (as got from the exchange).
+}
+
+//RemainingQuantity returns the quantity which still needs to be filled.
+func (status OrderStatus) RemainingQuantity() decimal.Decimal {
+	return status.Quantity.Sub(status.FilledQuantity)
+}
+
+// String returns the string representation of the object.
+func (status OrderStatus) String() string {
+	side := "BUY"
+	if status.Type == Ask {
+		side = "SELL"
+	}
+	return fmt.Sprintf("Order %s %s %s: %s/%s @ %s", status.ID, side, status.State, status.FilledQuantity, status.Quantity, status.Price)
+}
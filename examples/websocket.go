@@ -16,6 +16,10 @@
 package examples
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/saniales/golang-crypto-trading-bot/exchanges"
 	"github.com/saniales/golang-crypto-trading-bot/strategies"
@@ -29,7 +33,7 @@ var Websocket = strategies.WebsocketStrategy{
 		Setup: func(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
 			for _, wrapper := range wrappers {
 				err := wrapper.FeedConnect(markets)
-				if err == exchanges.ErrWebsocketNotSupported || err == nil {
+				if err == nil || errors.Is(err, exchanges.ErrNotSupported) {
 					continue
 				}
 				return err
@@ -37,10 +41,20 @@ var Websocket = strategies.WebsocketStrategy{
 			return nil
 		},
 		OnUpdate: func(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
+			for _, wrapper := range wrappers {
+				for _, feed := range exchanges.FeedStatusOf(wrapper) {
+					if !feed.Healthy(time.Minute) { // the cached data may be outdated.
+						return fmt.Errorf("Feed %s is %s: %v", feed.Name, feed.State, feed.LastError)
+					}
+				}
+			}
 			// do something
 			return nil
 		},
 		TearDown: func(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
+			for _, wrapper := range wrappers {
+				exchanges.ReleaseFeed(wrapper, markets) // other strategies may still use the feeds.
+			}
 			return nil
 		},
 		OnError: func(err error) {
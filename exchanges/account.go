@@ -0,0 +1,308 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// accountPollInterval is the interval between two polls of the account of the wrappers without a private stream.
+const accountPollInterval = 10 * time.Second
+
+// AccountStreamer is implemented by the wrappers sending the events of the account of the user (order updates, fills and balance changes).
+type AccountStreamer interface {
+	SubscribeAccount(markets []*environment.Market, handler func(environment.AccountEvent)) (unsubscribe func(), err error) // Subscribes a handler to the events of the account on the markets.
+}
+
+// SubscribeAccount subscribes a handler to the events of the account of the user on the markets of a wrapper,
+// returning the function removing the subscription.
+//
+//     NOTE: the wrappers without a private stream (see Capabilities.AccountStream) only send the balance changes,
+//     polled every 10 seconds: their orders cannot be followed by polling, an order could be placed and filled between two polls.
+//     The handler is called by the goroutine of the stream, concurrently with the strategy.
+func SubscribeAccount(wrapper ExchangeWrapper, markets []*environment.Market, handler func(environment.AccountEvent)) (func(), error) {
+	if streamer, isStreamer := wrapper.(AccountStreamer); isStreamer {
+		return streamer.SubscribeAccount(markets, handler)
+	}
+	return pollAccount(wrapper, markets, handler), nil
+}
+
+// accountStream represents the private stream of the account of a wrapper, shared between all its subscriptions.
+//
+//     NOTE: the stream is started by the first subscription and stopped when the last one is removed.
+//     The events of the orders are sent to the subscriptions of their market, the balance changes to all of them.
+type accountStream struct {
+	exchange      string
+	mutex         sync.Mutex
+	subscriptions map[int]*accountSubscription
+	nextID        int
+	feed          *feedSupervisor // nil when nobody is subscribed.
+}
+
+// accountSubscription represents a handler subscribed to the events of the account on some markets.
+type accountSubscription struct {
+	markets []*environment.Market
+	handler func(environment.AccountEvent)
+}
+
+// subscribe adds a subscription to the stream, starting the feed created by newFeed if not started yet.
+//
+//     NOTE: if the feed cannot be started the subscription is removed.
+//     A nil newFeed means the events are dispatched by the wrapper itself, without a feed.
+func (stream *accountStream) subscribe(markets []*environment.Market, handler func(environment.AccountEvent), newFeed func() *feedSupervisor) (func(), error) {
+	stream.mutex.Lock()
+	if stream.subscriptions == nil {
+		stream.subscriptions = make(map[int]*accountSubscription)
+	}
+	id := stream.nextID
+	stream.nextID++
+	stream.subscriptions[id] = &accountSubscription{
+		markets: markets,
+		handler: handler,
+	}
+
+	var unsubscribeOnce sync.Once
+	unsubscribe := func() {
+		unsubscribeOnce.Do(func() {
+			stream.unsubscribe(id)
+		})
+	}
+
+	if stream.feed != nil || newFeed == nil {
+		stream.mutex.Unlock()
+		return unsubscribe, nil
+	}
+	feed := newFeed()
+	stream.feed = feed
+	stream.mutex.Unlock()
+
+	if err := feed.start(); err != nil {
+		stream.mutex.Lock()
+		if stream.feed == feed {
+			stream.feed = nil
+		}
+		stream.mutex.Unlock()
+		unsubscribe()
+		return nil, err
+	}
+	return unsubscribe, nil
+}
+
+// unsubscribe removes a subscription from the stream, stopping the feed if it was the last one.
+func (stream *accountStream) unsubscribe(id int) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	delete(stream.subscriptions, id)
+	if len(stream.subscriptions) == 0 && stream.feed != nil {
+		stream.feed.stop()
+		stream.feed = nil
+	}
+}
+
+// subscribed returns true if a handler is subscribed to the stream.
+func (stream *accountStream) subscribed() bool {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	return len(stream.subscriptions) > 0
+}
+
+// market gets the subscribed market with the specified name on the exchange, nil if not subscribed.
+func (stream *accountStream) market(name string) *environment.Market {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	for _, subscription := range stream.subscriptions {
+		for _, market := range subscription.markets {
+			if strings.EqualFold(market.ExchangeNames[stream.exchange], name) {
+				return market
+			}
+		}
+	}
+	return nil
+}
+
+// dispatch sends an event to the subscriptions of its market (to all the subscriptions for the balance changes).
+func (stream *accountStream) dispatch(event environment.AccountEvent) {
+	event.Exchange = stream.exchange
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	stream.mutex.Lock()
+	handlers := make([]func(environment.AccountEvent), 0, len(stream.subscriptions))
+	for _, subscription := range stream.subscriptions {
+		if event.Market == nil || containsMarket(subscription.markets, event.Market) {
+			handlers = append(handlers, subscription.handler)
+		}
+	}
+	stream.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// status gets the status of the feed of the stream, nil if not started.
+func (stream *accountStream) status() []FeedStatus {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.feed == nil {
+		return nil
+	}
+	return []FeedStatus{stream.feed.Status()}
+}
+
+// containsMarket returns true if the market is in the list, the same market may be described by more instances.
+func containsMarket(markets []*environment.Market, market *environment.Market) bool {
+	key := keyOf(market)
+	for _, m := range markets {
+		if keyOf(m) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// accountPollers represents the pollers of the wrappers without a private stream, one for each wrapper shared between its subscriptions.
+var accountPollers = struct {
+	mutex   sync.Mutex
+	pollers map[ExchangeWrapper]*accountPoller
+}{pollers: make(map[ExchangeWrapper]*accountPoller)}
+
+// accountPoller emulates the private stream of the account of a wrapper for the balances, polling them.
+//
+//     NOTE: the balances of the currencies of the markets of all the subscriptions are polled,
+//     their changes are sent to all the subscriptions as for a private stream.
+type accountPoller struct {
+	wrapper  ExchangeWrapper
+	stream   accountStream // subscriptions of the poller.
+	stop     context.CancelFunc
+	balances map[string]decimal.Decimal
+}
+
+// pollAccount subscribes a handler to the poller of the balances of a wrapper, started by the first subscription
+// and stopped when the returned function removes the last one.
+func pollAccount(wrapper ExchangeWrapper, markets []*environment.Market, handler func(environment.AccountEvent)) func() {
+	accountPollers.mutex.Lock()
+	defer accountPollers.mutex.Unlock()
+
+	poller, exists := accountPollers.pollers[wrapper]
+	if !exists {
+		ctx, stop := context.WithCancel(context.Background())
+		poller = &accountPoller{
+			wrapper:  wrapper,
+			stop:     stop,
+			balances: make(map[string]decimal.Decimal),
+		}
+		poller.stream.exchange = wrapper.Name()
+		accountPollers.pollers[wrapper] = poller
+		go poller.run(ctx)
+	}
+
+	unsubscribe, _ := poller.stream.subscribe(markets, handler, nil) // cannot fail without a feed.
+
+	var unsubscribeOnce sync.Once
+	return func() {
+		unsubscribeOnce.Do(func() {
+			accountPollers.mutex.Lock()
+			defer accountPollers.mutex.Unlock()
+
+			unsubscribe()
+			if !poller.stream.subscribed() {
+				poller.stop()
+				delete(accountPollers.pollers, wrapper)
+			}
+		})
+	}
+}
+
+// currencies gets the currencies of the subscribed markets bound to the wrapper.
+func (poller *accountPoller) currencies() []string {
+	poller.stream.mutex.Lock()
+	defer poller.stream.mutex.Unlock()
+
+	var ret []string
+	seen := make(map[string]bool)
+	for _, subscription := range poller.stream.subscriptions {
+		for _, market := range subscription.markets {
+			if MarketNameFor(market, poller.wrapper) == "" {
+				continue
+			}
+			for _, currency := range []string{market.BaseCurrency, market.MarketCurrency} {
+				if !seen[currency] {
+					seen[currency] = true
+					ret = append(ret, currency)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// run polls the account until ctx is done.
+func (poller *accountPoller) run(ctx context.Context) {
+	for {
+		poller.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(accountPollInterval):
+		}
+	}
+}
+
+// poll compares the balances with the ones of the previous poll, sending the changes to the subscriptions.
+//
+//     NOTE: the balances of all the currencies are loaded at once with GetBalances, the first poll of a currency only records it.
+func (poller *accountPoller) poll(ctx context.Context) {
+	balances, err := BindContext(ctx, poller.wrapper).GetBalances()
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.Warnf("Cannot poll the balances on %s: %s", poller.wrapper.Name(), err)
+		}
+		return
+	}
+
+	for _, currency := range poller.currencies() {
+		balance := balances[currency].Free // zero for the currencies never held.
+		previous, exists := poller.balances[currency]
+		poller.balances[currency] = balance
+		if exists && !previous.Equal(balance) {
+			poller.notify(environment.AccountEvent{
+				Type: environment.BalanceEvent,
+				Balance: &environment.BalanceUpdate{
+					Currency: currency,
+					Free:     balance,
+				},
+			})
+		}
+	}
+}
+
+// notify sends an event to the subscriptions.
+func (poller *accountPoller) notify(event environment.AccountEvent) {
+	poller.stream.dispatch(event)
+}
@@ -0,0 +1,120 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+// balancesMaxAge is the time the balances of the account are served from the cache of the rate limited wrappers.
+const balancesMaxAge = 2 * time.Second
+
+// newBalance creates the balance of a currency from its free and locked amounts.
+func newBalance(free decimal.Decimal, locked decimal.Decimal) environment.Balance {
+	return environment.Balance{
+		Free:   free,
+		Locked: locked,
+		Total:  free.Add(locked),
+	}
+}
+
+// freeBalance gets the free balance of a currency from the balances of the account.
+func freeBalance(balances map[string]environment.Balance, symbol string) (*decimal.Decimal, error) {
+	balance, exists := balances[symbol]
+	if !exists {
+		return nil, errors.New("Symbol not found")
+	}
+	return &balance.Free, nil
+}
+
+// balancesCache represents the balances of the account loaded last, shared between the calls performed in balancesMaxAge.
+//
+//     NOTE: concurrent calls wait for the pending load instead of performing their own.
+type balancesCache struct {
+	mutex      sync.Mutex
+	balances   map[string]environment.Balance
+	loaded     time.Time
+	generation int           // incremented by invalidate, a load started before is not cached.
+	pending    chan struct{} // closed when the pending load ends, nil if none.
+}
+
+// get gets the cached balances, loading them with load if expired.
+func (cache *balancesCache) get(ctx context.Context, load func(ctx context.Context) (map[string]environment.Balance, error)) (map[string]environment.Balance, error) {
+	cache.mutex.Lock()
+	for {
+		if cache.balances != nil && time.Since(cache.loaded) < balancesMaxAge {
+			ret := copyBalances(cache.balances)
+			cache.mutex.Unlock()
+			return ret, nil
+		}
+		if cache.pending == nil {
+			break
+		}
+
+		pending := cache.pending
+		cache.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-pending:
+		}
+		cache.mutex.Lock()
+	}
+
+	pending := make(chan struct{})
+	cache.pending = pending
+	generation := cache.generation
+	cache.mutex.Unlock()
+
+	balances, err := load(ctx)
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.pending = nil
+	close(pending)
+	if err != nil {
+		return nil, err
+	}
+	if generation == cache.generation {
+		cache.balances = balances
+		cache.loaded = time.Now()
+	}
+	return copyBalances(balances), nil
+}
+
+// invalidate discards the cached balances, the requests changing the account must call it.
+func (cache *balancesCache) invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.balances = nil
+	cache.generation++
+}
+
+// copyBalances gets a copy of the balances, which can be changed by the caller.
+func copyBalances(balances map[string]environment.Balance) map[string]environment.Balance {
+	ret := make(map[string]environment.Balance, len(balances))
+	for currency, balance := range balances {
+		ret[currency] = balance
+	}
+	return ret
+}
@@ -17,13 +17,14 @@ package exchanges
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/adshao/go-binance/v2"
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/shopspring/decimal"
-	"github.com/sirupsen/logrus"
 )
 
 // BinanceWrapper represents the wrapper for the Binance exchange.
@@ -32,21 +33,42 @@ type BinanceWrapper struct {
 	summaries        *SummaryCache
 	candles          *CandlesCache
 	orderbook        *OrderbookCache
+	trades           *TradesCache
+	marketInfo       *MarketInfoCache
 	depositAddresses map[string]string
 	websocketOn      bool
+	feeds            feedSet
+	account          accountStream
+	maxDataAge       time.Duration
+	bookDepth        int
 }
 
+// binanceListenKeyKeepAlive is the interval between the keepalives of the listen key of the user data stream, valid for 60 minutes.
+const binanceListenKeyKeepAlive = 30 * time.Minute
+
 // NewBinanceWrapper creates a generic wrapper of the binance API.
 func NewBinanceWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
 	client := binance.NewClient(publicKey, secretKey)
-	return &BinanceWrapper{
+	client.HTTPClient = restClient
+	wrapper := &BinanceWrapper{
 		api:              client,
 		summaries:        NewSummaryCache(),
 		candles:          NewCandlesCache(),
 		orderbook:        NewOrderbookCache(),
+		trades:           NewTradesCache(),
 		depositAddresses: depositAddresses,
 		websocketOn:      false,
+		maxDataAge:       DefaultMaxDataAge,
 	}
+	wrapper.marketInfo = NewMarketInfoCache(wrapper.GetMarkets)
+	wrapper.account.exchange = wrapper.Name()
+	return wrapper
+}
+
+func init() {
+	Register("binance", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewBinanceWrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
 }
 
 // Name returns the name of the wrapped exchange.
@@ -54,6 +76,21 @@ func (wrapper *BinanceWrapper) Name() string {
 	return "binance"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *BinanceWrapper) Capabilities() Capabilities {
+	return Capabilities{
+		WebsocketFeeds: true,
+		Candles:        true,
+		Trades:         true,
+		LimitOrders:    true,
+		MarketOrders:   true,
+		Withdraw:       true,
+		TradingFees:    true,
+		OrderQuery:     true,
+		AccountStream:  true,
+	}
+}
+
 func (wrapper *BinanceWrapper) String() string {
 	return wrapper.Name()
 }
@@ -63,7 +100,7 @@ func (wrapper *BinanceWrapper) GetMarkets() ([]*environment.Market, error) {
 	binanceExchangeInfo, err := wrapper.api.NewExchangeInfoService().Do(context.Background())
 
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	ret := make([]*environment.Market, len(binanceExchangeInfo.Symbols))
@@ -73,36 +110,104 @@ func (wrapper *BinanceWrapper) GetMarkets() ([]*environment.Market, error) {
 			Name:           market.Symbol,
 			BaseCurrency:   market.BaseAsset,
 			MarketCurrency: market.QuoteAsset,
+			Info:           binanceMarketInfo(&binanceExchangeInfo.Symbols[i]),
 		}
 	}
 
 	return ret, nil
 }
 
+// binanceMarketInfo gets the trading rules of a market from the filters of its symbol.
+func binanceMarketInfo(symbol *binance.Symbol) *environment.MarketInfo {
+	info := &environment.MarketInfo{}
+	if filter := symbol.PriceFilter(); filter != nil {
+		info.PriceTick, _ = decimal.NewFromString(filter.TickSize)
+	}
+	if filter := symbol.LotSizeFilter(); filter != nil {
+		info.QuantityStep, _ = decimal.NewFromString(filter.StepSize)
+		info.MinQuantity, _ = decimal.NewFromString(filter.MinQuantity)
+		info.MaxQuantity, _ = decimal.NewFromString(filter.MaxQuantity)
+	}
+	if filter := symbol.MinNotionalFilter(); filter != nil {
+		info.MinNotional, _ = decimal.NewFromString(filter.MinNotional)
+	} else if filter := symbol.NotionalFilter(); filter != nil {
+		info.MinNotional, _ = decimal.NewFromString(filter.MinNotional)
+	}
+	return info
+}
+
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *BinanceWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return wrapper.marketInfo.Get(MarketNameFor(market, wrapper))
+}
+
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *BinanceWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	return wrapper.GetOrderBookContext(context.Background(), market)
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
 	if !wrapper.websocketOn {
-		orderbook, _, err := wrapper.orderbookFromREST(market)
+		orderbook, _, err := wrapper.orderbookFromREST(ctx, market, 0)
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		wrapper.orderbook.Set(market, orderbook)
 		return orderbook, nil
 	}
 
-	orderbook, exists := wrapper.orderbook.Get(market)
-	if !exists {
-		return nil, errors.New("Orderbook not loaded")
+	return wrapper.orderbook.GetFresh(market, wrapper.maxDataAge)
+}
+
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+func (wrapper *BinanceWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.GetRecentTradesContext(context.Background(), market)
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+//
+//     NOTE: the trades of the markets subscribed to the feed are loaded once, then updated by the websocket.
+func (wrapper *BinanceWrapper) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	subscribed := wrapper.feeds.subscribed(market)
+	if trades, loaded := wrapper.trades.Get(market); subscribed && loaded {
+		return trades, nil
 	}
 
-	return orderbook, nil
+	binanceTrades, err := wrapper.api.NewRecentTradesService().Symbol(MarketNameFor(market, wrapper)).Limit(tradesCacheSize).Do(ctx)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	trades := make([]environment.Trade, len(binanceTrades))
+	for i, trade := range binanceTrades {
+		price, _ := decimal.NewFromString(trade.Price)
+		quantity, _ := decimal.NewFromString(trade.Quantity)
+		trades[i] = environment.Trade{
+			ID:       strconv.FormatInt(trade.ID, 10),
+			Price:    price,
+			Quantity: quantity,
+			Side:     takerSide(!trade.IsBuyerMaker),
+			Time:     time.UnixMilli(trade.Time),
+		}
+	}
+
+	if subscribed {
+		return wrapper.trades.Load(market, trades), nil
+	}
+	return trades, nil
 }
 
-func (wrapper *BinanceWrapper) orderbookFromREST(market *environment.Market) (*environment.OrderBook, int64, error) {
-	binanceOrderBook, err := wrapper.api.NewDepthService().Symbol(MarketNameFor(market, wrapper)).Do(context.Background())
+// orderbookFromREST gets the order book of a market with its last update ID, with at most limit levels per side (0 for the default).
+func (wrapper *BinanceWrapper) orderbookFromREST(ctx context.Context, market *environment.Market, limit int) (*environment.OrderBook, int64, error) {
+	service := wrapper.api.NewDepthService().Symbol(MarketNameFor(market, wrapper))
+	if limit > 0 {
+		service = service.Limit(limit)
+	}
+	binanceOrderBook, err := service.Do(ctx)
 	if err != nil {
-		return nil, -1, err
+		return nil, -1, mapError(wrapper, err)
 	}
 
 	var orderBook environment.OrderBook
@@ -110,12 +215,12 @@ func (wrapper *BinanceWrapper) orderbookFromREST(market *environment.Market) (*e
 	for _, ask := range binanceOrderBook.Asks {
 		qty, err := decimal.NewFromString(ask.Quantity)
 		if err != nil {
-			return nil, -1, err
+			return nil, -1, mapError(wrapper, err)
 		}
 
 		value, err := decimal.NewFromString(ask.Price)
 		if err != nil {
-			return nil, -1, err
+			return nil, -1, mapError(wrapper, err)
 		}
 
 		orderBook.Asks = append(orderBook.Asks, environment.Order{
@@ -127,12 +232,12 @@ func (wrapper *BinanceWrapper) orderbookFromREST(market *environment.Market) (*e
 	for _, bid := range binanceOrderBook.Bids {
 		qty, err := decimal.NewFromString(bid.Quantity)
 		if err != nil {
-			return nil, -1, err
+			return nil, -1, mapError(wrapper, err)
 		}
 
 		value, err := decimal.NewFromString(bid.Price)
 		if err != nil {
-			return nil, -1, err
+			return nil, -1, mapError(wrapper, err)
 		}
 
 		orderBook.Bids = append(orderBook.Bids, environment.Order{
@@ -145,47 +250,221 @@ func (wrapper *BinanceWrapper) orderbookFromREST(market *environment.Market) (*e
 }
 
 // BuyLimit performs a limit buy action.
-func (wrapper *BinanceWrapper) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeLimit).Side(binance.SideTypeBuy).Symbol(MarketNameFor(market, wrapper)).Price(fmt.Sprint(limit)).Quantity(fmt.Sprint(amount)).Do(context.Background())
+func (wrapper *BinanceWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.BuyLimitContext(context.Background(), market, amount, limit)
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BinanceWrapper) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Bid, amount, limit)
 	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeLimit).Side(binance.SideTypeBuy).Symbol(MarketNameFor(market, wrapper)).Price(formattedPrice).Quantity(formattedQuantity).Do(context.WithoutCancel(ctx))
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
 	return orderNumber.ClientOrderID, nil
 }
 
 // SellLimit performs a limit sell action.
-func (wrapper *BinanceWrapper) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeLimit).Side(binance.SideTypeSell).Symbol(MarketNameFor(market, wrapper)).Price(fmt.Sprint(limit)).Quantity(fmt.Sprint(amount)).Do(context.Background())
+func (wrapper *BinanceWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.SellLimitContext(context.Background(), market, amount, limit)
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BinanceWrapper) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Ask, amount, limit)
 	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeLimit).Side(binance.SideTypeSell).Symbol(MarketNameFor(market, wrapper)).Price(formattedPrice).Quantity(formattedQuantity).Do(context.WithoutCancel(ctx))
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
 	return orderNumber.ClientOrderID, nil
 }
 
 // BuyMarket performs a market buy action.
-func (wrapper *BinanceWrapper) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeMarket).Side(binance.SideTypeBuy).Symbol(MarketNameFor(market, wrapper)).Quantity(fmt.Sprint(amount)).Do(context.Background())
+func (wrapper *BinanceWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.BuyMarketContext(context.Background(), market, amount)
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BinanceWrapper) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	quantity, _, err := prepareOrder(wrapper, market, environment.Bid, amount, decimal.Zero)
 	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
+	formattedQuantity, _ := formatOrder(wrapper, market, quantity, decimal.Zero)
+	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeMarket).Side(binance.SideTypeBuy).Symbol(MarketNameFor(market, wrapper)).Quantity(formattedQuantity).Do(context.WithoutCancel(ctx))
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
 
 	return orderNumber.ClientOrderID, nil
 }
 
 // SellMarket performs a market sell action.
-func (wrapper *BinanceWrapper) SellMarket(market *environment.Market, amount float64) (string, error) {
-	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeMarket).Side(binance.SideTypeSell).Symbol(MarketNameFor(market, wrapper)).Quantity(fmt.Sprint(amount)).Do(context.Background())
+func (wrapper *BinanceWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.SellMarketContext(context.Background(), market, amount)
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BinanceWrapper) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	quantity, _, err := prepareOrder(wrapper, market, environment.Ask, amount, decimal.Zero)
 	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
+	formattedQuantity, _ := formatOrder(wrapper, market, quantity, decimal.Zero)
+	orderNumber, err := wrapper.api.NewCreateOrderService().Type(binance.OrderTypeMarket).Side(binance.SideTypeSell).Symbol(MarketNameFor(market, wrapper)).Quantity(formattedQuantity).Do(context.WithoutCancel(ctx))
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
 	return orderNumber.ClientOrderID, nil
 }
 
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *BinanceWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return wrapper.GetOrderContext(context.Background(), market, orderID)
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	binanceOrder, err := wrapper.api.NewGetOrderService().Symbol(MarketNameFor(market, wrapper)).OrigClientOrderID(orderID).Do(ctx)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := convertFromBinanceOrder(binanceOrder)
+
+	if !ret.FilledQuantity.IsZero() {
+		binanceTrades, err := wrapper.api.NewListTradesService().Symbol(MarketNameFor(market, wrapper)).OrderId(binanceOrder.OrderID).Do(ctx)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+
+		for _, trade := range binanceTrades {
+			commission, _ := decimal.NewFromString(trade.Commission)
+			ret.Fee = ret.Fee.Add(commission)
+			ret.FeeCurrency = trade.CommissionAsset
+		}
+	}
+
+	return &ret, nil
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+//
+//     NOTE: fees are not loaded, use GetOrder to get them.
+func (wrapper *BinanceWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	return wrapper.GetOpenOrdersContext(context.Background(), market)
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	binanceOrders, err := wrapper.api.NewListOpenOrdersService().Symbol(MarketNameFor(market, wrapper)).Do(ctx)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, len(binanceOrders))
+	for i, binanceOrder := range binanceOrders {
+		ret[i] = convertFromBinanceOrder(binanceOrder)
+	}
+
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *BinanceWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	return wrapper.CancelOrderContext(context.Background(), market, orderID)
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	_, err := wrapper.api.NewCancelOrderService().Symbol(MarketNameFor(market, wrapper)).OrigClientOrderID(orderID).Do(ctx)
+	return mapError(wrapper, err)
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *BinanceWrapper) CancelAllOrders(market *environment.Market) error {
+	return wrapper.CancelAllOrdersContext(context.Background(), market)
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	_, err := wrapper.api.NewCancelOpenOrdersService().Symbol(MarketNameFor(market, wrapper)).Do(ctx)
+	return mapError(wrapper, err)
+}
+
+// convertFromBinanceOrder converts a binance order to a environment.OrderStatus.
+func convertFromBinanceOrder(binanceOrder *binance.Order) environment.OrderStatus {
+	price, _ := decimal.NewFromString(binanceOrder.Price)
+	quantity, _ := decimal.NewFromString(binanceOrder.OrigQuantity)
+	filled, _ := decimal.NewFromString(binanceOrder.ExecutedQuantity)
+	quoteQuantity, _ := decimal.NewFromString(binanceOrder.CummulativeQuoteQuantity)
+
+	ret := environment.OrderStatus{
+		ID:             binanceOrder.ClientOrderID,
+		Type:           environment.Bid,
+		Price:          price,
+		Quantity:       quantity,
+		FilledQuantity: filled,
+		Timestamp:      time.Unix(0, binanceOrder.Time*int64(time.Millisecond)),
+	}
+
+	if binanceOrder.Side == binance.SideTypeSell {
+		ret.Type = environment.Ask
+	}
+
+	if !filled.IsZero() {
+		ret.AveragePrice = quoteQuantity.Div(filled)
+	}
+	ret.State = binanceOrderState(binanceOrder.Status)
+
+	return ret
+}
+
+// binanceOrderState converts the status of a binance order to a environment.OrderState.
+func binanceOrderState(status binance.OrderStatusType) environment.OrderState {
+	switch status {
+	case binance.OrderStatusTypeNew:
+		return environment.OrderNew
+	case binance.OrderStatusTypePartiallyFilled:
+		return environment.OrderPartiallyFilled
+	case binance.OrderStatusTypeFilled:
+		return environment.OrderFilled
+	case binance.OrderStatusTypeRejected:
+		return environment.OrderRejected
+	default: // canceled, pending cancel or expired.
+		return environment.OrderCanceled
+	}
+}
+
 // GetTicker gets the updated ticker for a market.
 func (wrapper *BinanceWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 	binanceTicker, err := wrapper.api.NewListBookTickersService().Symbol(MarketNameFor(market, wrapper)).Do(context.Background())
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	ask, _ := decimal.NewFromString(binanceTicker[0].AskPrice)
@@ -200,10 +479,15 @@ func (wrapper *BinanceWrapper) GetTicker(market *environment.Market) (*environme
 
 // GetMarketSummary gets the current market summary.
 func (wrapper *BinanceWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	return wrapper.GetMarketSummaryContext(context.Background(), market)
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
 	if !wrapper.websocketOn {
-		binanceSummary, err := wrapper.api.NewListPriceChangeStatsService().Symbol(MarketNameFor(market, wrapper)).Do(context.Background())
+		binanceSummary, err := wrapper.api.NewListPriceChangeStatsService().Symbol(MarketNameFor(market, wrapper)).Do(ctx)
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		ask, _ := decimal.NewFromString(binanceSummary[0].AskPrice)
@@ -222,69 +506,114 @@ func (wrapper *BinanceWrapper) GetMarketSummary(market *environment.Market) (*en
 		})
 	}
 
-	ret, summaryLoaded := wrapper.summaries.Get(market)
-	if !summaryLoaded {
-		return nil, errors.New("Summary not loaded")
-	}
+	return wrapper.summaries.GetFresh(market, wrapper.maxDataAge)
+}
 
-	return ret, nil
+// binanceCandlesPageSize represents the max number of candles returned by a single klines request.
+const binanceCandlesPageSize = 1000
+
+// binanceSnapshotDepth represents the number of levels per side of the order book snapshots the websocket updates are applied to.
+const binanceSnapshotDepth = 1000
+
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+func (wrapper *BinanceWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.GetCandlesContext(context.Background(), market, interval, from, to)
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *BinanceWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
 	if !wrapper.websocketOn {
-		binanceCandles, err := wrapper.api.NewKlinesService().Symbol(MarketNameFor(market, wrapper)).Do(context.Background())
-		if err != nil {
-			return nil, err
-		}
-
-		ret := make([]environment.CandleStick, len(binanceCandles))
+		ret, err := paginateCandles(interval, from, to, func(since time.Time) ([]environment.CandleStick, error) {
+			service := wrapper.api.NewKlinesService().
+				Symbol(MarketNameFor(market, wrapper)).
+				Interval(string(interval)).
+				Limit(binanceCandlesPageSize)
+			if !since.IsZero() {
+				service.StartTime(since.UnixNano() / int64(time.Millisecond))
+			}
+			if !to.IsZero() {
+				service.EndTime(to.UnixNano()/int64(time.Millisecond) - 1)
+			}
 
-		for i, binanceCandle := range binanceCandles {
-			high, _ := decimal.NewFromString(binanceCandle.High)
-			open, _ := decimal.NewFromString(binanceCandle.Open)
-			close, _ := decimal.NewFromString(binanceCandle.Close)
-			low, _ := decimal.NewFromString(binanceCandle.Low)
-			volume, _ := decimal.NewFromString(binanceCandle.Volume)
+			binanceCandles, err := service.Do(ctx)
+			if err != nil {
+				return nil, mapError(wrapper, err)
+			}
 
-			ret[i] = environment.CandleStick{
-				High:   high,
-				Open:   open,
-				Close:  close,
-				Low:    low,
-				Volume: volume,
+			page := make([]environment.CandleStick, len(binanceCandles))
+
+			for i, binanceCandle := range binanceCandles {
+				high, _ := decimal.NewFromString(binanceCandle.High)
+				open, _ := decimal.NewFromString(binanceCandle.Open)
+				close, _ := decimal.NewFromString(binanceCandle.Close)
+				low, _ := decimal.NewFromString(binanceCandle.Low)
+				volume, _ := decimal.NewFromString(binanceCandle.Volume)
+
+				page[i] = environment.CandleStick{
+					OpenTime: time.Unix(0, binanceCandle.OpenTime*int64(time.Millisecond)),
+					High:     high,
+					Open:     open,
+					Close:    close,
+					Low:      low,
+					Volume:   volume,
+				}
 			}
+			return page, nil
+		})
+		if err != nil {
+			return nil, mapError(wrapper, err)
 		}
 
-		wrapper.candles.Set(market, ret)
+		wrapper.candles.Set(market, interval, ret)
 	}
 
-	ret, candleLoaded := wrapper.candles.Get(market)
-	if !candleLoaded {
-		return nil, errors.New("No candle data yet")
+	ret, err := wrapper.candles.GetFresh(market, interval, wrapper.maxDataAge)
+	if err != nil {
+		return nil, err
 	}
 
-	return ret, nil
+	return filterCandles(ret, from, to), nil
 }
 
 // GetBalance gets the balance of the user of the specified currency.
 func (wrapper *BinanceWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
-	binanceAccount, err := wrapper.api.NewGetAccountService().Do(context.Background())
+	return wrapper.GetBalanceContext(context.Background(), symbol)
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	balances, err := wrapper.GetBalancesContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return freeBalance(balances, symbol)
+}
 
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+func (wrapper *BinanceWrapper) GetBalances() (map[string]environment.Balance, error) {
+	return wrapper.GetBalancesContext(context.Background())
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	binanceAccount, err := wrapper.api.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make(map[string]environment.Balance, len(binanceAccount.Balances))
 	for _, binanceBalance := range binanceAccount.Balances {
-		if binanceBalance.Asset == symbol {
-			ret, err := decimal.NewFromString(binanceBalance.Free)
-			if err != nil {
-				return nil, err
-			}
-			return &ret, nil
+		free, err := decimal.NewFromString(binanceBalance.Free)
+		if err != nil {
+			return nil, mapError(wrapper, err)
 		}
+		locked, err := decimal.NewFromString(binanceBalance.Locked)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+		ret[binanceBalance.Asset] = newBalance(free, locked)
 	}
-
-	return nil, errors.New("Symbol not found")
+	return ret, nil
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -296,41 +625,107 @@ func (wrapper *BinanceWrapper) GetDepositAddress(coinTicker string) (string, boo
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
 //
 //     NOTE: In Binance fees are currently hardcoded.
-func (wrapper *BinanceWrapper) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
-	var feePercentage float64
+func (wrapper *BinanceWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0010
+		feePercentage = decimal.NewFromFloat(0.0010)
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0010
+		feePercentage = decimal.NewFromFloat(0.0010)
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *BinanceWrapper) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *BinanceWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
 }
 
 // FeedConnect connects to the feed of the exchange.
 func (wrapper *BinanceWrapper) FeedConnect(markets []*environment.Market) error {
-	for _, m := range markets {
-		err := wrapper.subscribeMarketSummaryFeed(m)
-		if err != nil {
-			return err
+	return wrapper.FeedConnectContext(context.Background(), markets)
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *BinanceWrapper) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	if err := ctx.Err(); err != nil {
+		return mapError(wrapper, err)
+	}
+
+	err := wrapper.feeds.connect(markets, func(markets []*environment.Market) (*feedSupervisor, error) {
+		bySymbol := make(map[string]*environment.Market, len(markets))
+		for _, m := range markets {
+			bySymbol[strings.ToUpper(MarketNameFor(m, wrapper))] = m
 		}
-		wrapper.subscribeOrderbookFeed(m)
+
+		return newFeedSupervisor(wrapper.Name(), nil, func(ctx context.Context, feed *feedSupervisor) error {
+			return wrapper.readFeeds(ctx, feed, bySymbol)
+		}), nil
+	})
+	if err != nil {
+		return mapError(wrapper, err)
 	}
 	wrapper.websocketOn = true
 
 	return nil
 }
 
-// SubscribeMarketSummaryFeed subscribes to the Market Summary Feed service.
-func (wrapper *BinanceWrapper) subscribeMarketSummaryFeed(market *environment.Market) error {
-	_, _, err := binance.WsMarketStatServe(MarketNameFor(market, wrapper), func(event *binance.WsMarketStatEvent) {
+// FeedStatus gets the status of the websocket feeds connected, including the user data stream.
+func (wrapper *BinanceWrapper) FeedStatus() []FeedStatus {
+	return append(wrapper.feeds.status(), wrapper.account.status()...)
+}
+
+// SetMaxDataAge sets the max age of the data served from the websocket feeds, not positive means no limit.
+func (wrapper *BinanceWrapper) SetMaxDataAge(maxAge time.Duration) {
+	wrapper.maxDataAge = maxAge
+}
+
+// SetOrderBookDepth sets the max number of price levels per side of the order books of the websocket feeds, not positive means all the levels.
+func (wrapper *BinanceWrapper) SetOrderBookDepth(depth int) {
+	wrapper.bookDepth = depth
+}
+
+// FeedRelease releases a subscription to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *BinanceWrapper) FeedRelease(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribe(markets))
+}
+
+// FeedClose releases all the subscriptions to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *BinanceWrapper) FeedClose(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribeAll(markets))
+}
+
+// readFeeds subscribes to the market summaries, the order books and the trades of the markets, reading them until a stream fails or ctx is done.
+//
+//     NOTE: the order book stream sends the changed levels, they are buffered until the snapshot is loaded from REST.
+func (wrapper *BinanceWrapper) readFeeds(ctx context.Context, feed *feedSupervisor, bySymbol map[string]*environment.Market) error {
+	symbols := make([]string, 0, len(bySymbol))
+	markets := make([]*environment.Market, 0, len(bySymbol))
+	books := make(map[string]*l2Book, len(bySymbol))
+	for symbol, market := range bySymbol {
+		symbols = append(symbols, symbol)
+		markets = append(markets, market)
+		books[symbol] = newL2Book(market, wrapper.orderbook, wrapper.bookDepth)
+	}
+	wrapper.trades.Reset(markets)
+
+	failed := make(chan error, 1)
+	onError := func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	}
+
+	summariesDone, summariesStop, err := binance.WsCombinedMarketStatServe(symbols, func(event *binance.WsMarketStatEvent) {
+		feed.alive()
+		market, exists := bySymbol[event.Symbol]
+		if !exists {
+			return
+		}
+
 		high, _ := decimal.NewFromString(event.HighPrice)
 		low, _ := decimal.NewFromString(event.LowPrice)
 		ask, _ := decimal.NewFromString(event.AskPrice)
@@ -346,70 +741,266 @@ func (wrapper *BinanceWrapper) subscribeMarketSummaryFeed(market *environment.Ma
 			Last:   last,
 			Volume: volume,
 		})
-	}, func(error) {})
+	}, onError)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer func() {
+		close(summariesStop)
+		<-summariesDone
+	}()
+
+	booksDone, booksStop, err := binance.WsCombinedDepthServe(symbols, func(event *binance.WsDepthEvent) {
+		feed.alive()
+		book, exists := books[event.Symbol]
+		if !exists {
+			return
+		}
+
+		update := bookUpdate{
+			FirstSequence: event.FirstUpdateID,
+			Sequence:      event.LastUpdateID,
+		}
+		for _, ask := range event.Asks {
+			price, _ := decimal.NewFromString(ask.Price)
+			quantity, _ := decimal.NewFromString(ask.Quantity)
+			update.Asks = append(update.Asks, environment.Order{
+				Value:    price,
+				Quantity: quantity,
+			})
+		}
+		for _, bid := range event.Bids {
+			price, _ := decimal.NewFromString(bid.Price)
+			quantity, _ := decimal.NewFromString(bid.Quantity)
+			update.Bids = append(update.Bids, environment.Order{
+				Value:    price,
+				Quantity: quantity,
+			})
+		}
+
+		if err := book.apply(update); err != nil {
+			onError(err)
+		}
+	}, onError)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		close(booksStop)
+		<-booksDone
+	}()
+
+	tradesDone, tradesStop, err := binance.WsCombinedTradeServe(symbols, func(event *binance.WsCombinedTradeEvent) {
+		feed.alive()
+		market, exists := bySymbol[event.Data.Symbol]
+		if !exists {
+			return
+		}
+
+		price, _ := decimal.NewFromString(event.Data.Price)
+		quantity, _ := decimal.NewFromString(event.Data.Quantity)
+		wrapper.trades.Add(market, environment.Trade{
+			ID:       strconv.FormatInt(event.Data.TradeID, 10),
+			Price:    price,
+			Quantity: quantity,
+			Side:     takerSide(!event.Data.IsBuyerMaker),
+			Time:     time.UnixMilli(event.Data.TradeTime),
+		})
+	}, onError)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		close(tradesStop)
+		<-tradesDone
+	}()
+
+	for _, book := range books {
+		orderbook, lastUpdateID, err := wrapper.orderbookFromREST(ctx, book.market, binanceSnapshotDepth)
+		if err != nil {
+			return err
+		}
+		if err := book.reset(lastUpdateID, orderbook.Asks, orderbook.Bids); err != nil {
+			return err
+		}
+	}
+	feed.connected()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-failed:
+		return err
+	case <-summariesDone:
+	case <-booksDone:
+	case <-tradesDone:
+	}
+
+	select {
+	case err := <-failed:
+		return err
+	default:
+		return nil
+	}
 }
 
-func (wrapper *BinanceWrapper) subscribeOrderbookFeed(market *environment.Market) {
-	go func() {
-		for {
-			_, lastUpdateID, err := wrapper.orderbookFromREST(market)
-			if err != nil {
-				logrus.Error(err)
-				return
-			}
-			// 24 hours max
-			currentUpdateID := lastUpdateID
+// SubscribeAccount subscribes a handler to the events of the account on the markets, sent by the user data stream.
+//
+//     NOTE: the stream is silent while the account is idle, it is not reconnected for the lack of messages.
+func (wrapper *BinanceWrapper) SubscribeAccount(markets []*environment.Market, handler func(environment.AccountEvent)) (func(), error) {
+	unsubscribe, err := wrapper.account.subscribe(markets, handler, func() *feedSupervisor {
+		feed := newFeedSupervisor(wrapper.Name()+" user data", nil, wrapper.readUserData)
+		feed.staleAfter = 0
+		return feed
+	})
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+	return unsubscribe, nil
+}
 
-			done, _, _ := binance.WsPartialDepthServe(MarketNameFor(market, wrapper), "20", func(event *binance.WsPartialDepthEvent) {
-				if event.LastUpdateID <= currentUpdateID { // this update is more recent than the latest fetched
-					return
-				}
+// readUserData opens the user data stream, reading it until it fails or ctx is done.
+func (wrapper *BinanceWrapper) readUserData(ctx context.Context, feed *feedSupervisor) error {
+	listenKey, err := wrapper.api.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return err
+	}
+	defer wrapper.api.NewCloseUserStreamService().ListenKey(listenKey).Do(context.Background())
+
+	failed := make(chan error, 1)
+	done, stop, err := binance.WsUserDataServe(listenKey, func(event *binance.WsUserDataEvent) {
+		feed.alive()
+		wrapper.handleUserData(event)
+	}, func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	feed.connected()
 
-				var orderbook environment.OrderBook
+	keepAlive := time.NewTicker(binanceListenKeyKeepAlive)
+	defer keepAlive.Stop()
 
-				orderbook.Asks = make([]environment.Order, len(event.Asks))
-				orderbook.Bids = make([]environment.Order, len(event.Bids))
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-failed:
+			return err
+		case <-done:
+			return nil
+		case <-keepAlive.C:
+			if err := wrapper.api.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
 
-				for i, ask := range event.Asks {
-					price, _ := decimal.NewFromString(ask.Price)
-					quantity, _ := decimal.NewFromString(ask.Quantity)
-					newOrder := environment.Order{
-						Value:    price,
-						Quantity: quantity,
-					}
-					orderbook.Asks[i] = newOrder
-				}
+// handleUserData sends the order updates, the fills and the balances of an event of the user data stream to the subscribers.
+//
+//     NOTE: balanceUpdate events (deposits and withdrawals) are skipped, they are followed by the new balances.
+func (wrapper *BinanceWrapper) handleUserData(event *binance.WsUserDataEvent) {
+	eventTime := time.UnixMilli(event.Time)
+
+	switch event.Event {
+	case binance.UserDataEventTypeExecutionReport:
+		update := event.OrderUpdate
+		market := wrapper.account.market(update.Symbol)
+		if market == nil {
+			return
+		}
 
-				for i, bid := range event.Bids {
-					price, _ := decimal.NewFromString(bid.Price)
-					quantity, _ := decimal.NewFromString(bid.Quantity)
-					newOrder := environment.Order{
-						Value:    price,
-						Quantity: quantity,
-					}
-					orderbook.Bids[i] = newOrder
-				}
+		price, _ := decimal.NewFromString(update.Price)
+		quantity, _ := decimal.NewFromString(update.Volume)
+		filled, _ := decimal.NewFromString(update.FilledVolume)
+		quoteQuantity, _ := decimal.NewFromString(update.FilledQuoteVolume)
+
+		order := environment.OrderStatus{
+			ID:             update.ClientOrderId,
+			Type:           environment.Bid,
+			State:          binanceOrderState(binance.OrderStatusType(update.Status)),
+			Price:          price,
+			Quantity:       quantity,
+			FilledQuantity: filled,
+			Timestamp:      time.UnixMilli(update.CreateTime),
+		}
+		if update.OrigCustomOrderId != "" { // the client order ID of a cancellation is the one of the cancel request.
+			order.ID = update.OrigCustomOrderId
+		}
+		if update.Side == string(binance.SideTypeSell) {
+			order.Type = environment.Ask
+		}
+		if !filled.IsZero() {
+			order.AveragePrice = quoteQuantity.Div(filled)
+		}
 
-				wrapper.orderbook.Set(market, &orderbook)
-			}, func(err error) {
-				logrus.Error(err)
+		if update.ExecutionType == "TRADE" {
+			lastPrice, _ := decimal.NewFromString(update.LatestPrice)
+			lastQuantity, _ := decimal.NewFromString(update.LatestVolume)
+			fee, _ := decimal.NewFromString(update.FeeCost)
+
+			wrapper.account.dispatch(environment.AccountEvent{
+				Type:   environment.FillEvent,
+				Market: market,
+				Fill: &environment.Fill{
+					OrderID:     order.ID,
+					TradeID:     strconv.FormatInt(update.TradeId, 10),
+					Side:        order.Type,
+					Price:       lastPrice,
+					Quantity:    lastQuantity,
+					Fee:         fee,
+					FeeCurrency: update.FeeAsset,
+					Maker:       update.IsMaker,
+					Time:        time.UnixMilli(update.TransactionTime),
+				},
+				Time: eventTime,
 			})
+		}
 
-			<-done
+		wrapper.account.dispatch(environment.AccountEvent{
+			Type:   environment.OrderUpdateEvent,
+			Market: market,
+			Order:  &order,
+			Time:   eventTime,
+		})
+	case binance.UserDataEventTypeOutboundAccountPosition:
+		for _, balance := range event.AccountUpdate.WsAccountUpdates {
+			free, _ := decimal.NewFromString(balance.Free)
+			wrapper.account.dispatch(environment.AccountEvent{
+				Type: environment.BalanceEvent,
+				Balance: &environment.BalanceUpdate{
+					Currency: balance.Asset,
+					Free:     free,
+				},
+				Time: eventTime,
+			})
 		}
-	}()
+	}
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *BinanceWrapper) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	_, err := wrapper.api.NewCreateWithdrawService().Address(destinationAddress).Coin(coinTicker).Amount(fmt.Sprint(amount)).Do(context.Background())
-	if err != nil {
+func (wrapper *BinanceWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return wrapper.WithdrawContext(context.Background(), destinationAddress, coinTicker, amount)
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BinanceWrapper) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	_, err := wrapper.api.NewCreateWithdrawService().Address(destinationAddress).Coin(coinTicker).Amount(amount.String()).Do(context.WithoutCancel(ctx))
+	if err != nil {
+		return mapError(wrapper, err)
+	}
 
 	return nil
 }
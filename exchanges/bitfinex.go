@@ -1,38 +1,86 @@
 package exchanges
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
-	"sort"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/shopspring/decimal"
 
+	"github.com/bitfinexcom/bitfinex-api-go/pkg/models/common"
+	"github.com/bitfinexcom/bitfinex-api-go/pkg/utils"
 	bitfinex "github.com/bitfinexcom/bitfinex-api-go/v1"
+	"github.com/bitfinexcom/bitfinex-api-go/v2/rest"
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 )
 
 // BitfinexWrapper provides a Generic wrapper of the Bitfinex API.
 type BitfinexWrapper struct {
 	api                 *bitfinex.Client
+	publicAPI           *rest.Client // V2 API, used for the endpoints missing in V1.
 	websocketOn         bool
 	unsubscribeChannels map[string]chan bool
 	summaries           *SummaryCache
 	orderbook           *OrderbookCache
+	trades              *TradesCache
+	marketInfo          *MarketInfoCache
 	depositAddresses    map[string]string
+	feeds               feedSet
+	account             accountStream
+	maxDataAge          time.Duration
+	bookDepth           int
 }
 
+// bitfinexAccountWebsocketURL is the endpoint of the authenticated channel of the account, on the V2 websocket.
+const bitfinexAccountWebsocketURL = "wss://api.bitfinex.com/ws/2"
+
+const (
+	bitfinexWallet   = bitfinex.WALLET_TRADING // wallet used by the orders and withdrawals of the wrapper.
+	bitfinexWalletV2 = "margin"                // name of the same wallet on the V2 API.
+)
+
 // NewBitfinexWrapper creates a generic wrapper of the bittrex API.
+//
+//     NOTE: the V1 client always sends its requests through http.DefaultClient, they are bounded
+//     only by the timeouts of the default transport.
 func NewBitfinexWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
-	return &BitfinexWrapper{
+	wrapper := &BitfinexWrapper{
 		api:                 bitfinex.NewClient().Auth(publicKey, secretKey),
+		publicAPI:           rest.NewClientWithHttpDo(bitfinexHTTPDo),
 		unsubscribeChannels: make(map[string]chan bool),
 		summaries:           NewSummaryCache(),
 		orderbook:           NewOrderbookCache(),
+		trades:              NewTradesCache(),
 		websocketOn:         false,
 		depositAddresses:    depositAddresses,
+		maxDataAge:          DefaultMaxDataAge,
 	}
+	wrapper.marketInfo = NewMarketInfoCache(wrapper.GetMarkets)
+	wrapper.account.exchange = wrapper.Name()
+	return wrapper
+}
+
+// bitfinexHTTPDo sends the requests of the V2 client through the client of the adapters.
+func bitfinexHTTPDo(_ *http.Client, req *http.Request) (*http.Response, error) {
+	return restClient.Do(req)
+}
+
+func init() {
+	Register("bitfinex", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewBitfinexWrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
 }
 
 // Name returns the name of the wrapped exchange.
@@ -40,36 +88,61 @@ func (wrapper *BitfinexWrapper) Name() string {
 	return "bitfinex"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *BitfinexWrapper) Capabilities() Capabilities {
+	return Capabilities{
+		WebsocketFeeds: true,
+		Candles:        true,
+		Trades:         true,
+		LimitOrders:    true,
+		MarketOrders:   true,
+		Withdraw:       true,
+		TradingFees:    true,
+		OrderQuery:     true,
+		AccountStream:  true,
+	}
+}
+
 func (wrapper *BitfinexWrapper) String() string {
 	return wrapper.Name()
 }
 
 // GetMarkets gets all the markets info.
 func (wrapper *BitfinexWrapper) GetMarkets() ([]*environment.Market, error) {
-	bitfinexMarkets, err := wrapper.api.Pairs.All()
+	bitfinexMarkets, err := wrapper.api.Pairs.AllDetailed()
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	wrappedMarkets := make([]*environment.Market, len(bitfinexMarkets))
 	for i, pair := range bitfinexMarkets {
-		quote, base := pair[0:2], pair[3:5]
+		quote, base := pair.Pair[0:3], pair.Pair[3:]
 		wrappedMarkets[i] = &environment.Market{
-			Name:           pair,
+			Name:           pair.Pair,
 			BaseCurrency:   base,
 			MarketCurrency: quote,
+			Info: &environment.MarketInfo{
+				PriceSignificantDigits: int32(pair.PricePrecision),
+				MinQuantity:            decimal.NewFromFloat(pair.MinimumOrderSize),
+				MaxQuantity:            decimal.NewFromFloat(pair.MaximumOrderSize),
+			},
 		}
 	}
 
 	return wrappedMarkets, nil
 }
 
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *BitfinexWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return wrapper.marketInfo.Get(MarketNameFor(market, wrapper))
+}
+
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *BitfinexWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
 	if !wrapper.websocketOn {
 		bitfinexOrderBook, err := wrapper.api.OrderBook.Get(MarketNameFor(market, wrapper), 0, 0, false)
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		var orderBook environment.OrderBook
@@ -108,62 +181,290 @@ func (wrapper *BitfinexWrapper) GetOrderBook(market *environment.Market) (*envir
 		return &orderBook, nil
 	}
 
-	orderbook, exists := wrapper.orderbook.Get(market)
-	if !exists {
-		return nil, errors.New("Orderbook not loaded")
+	return wrapper.orderbook.GetFresh(market, wrapper.maxDataAge)
+}
+
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+//
+//     NOTE: the trades of the markets subscribed to the feed are loaded once, then updated by the websocket.
+func (wrapper *BitfinexWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	subscribed := wrapper.feeds.subscribed(market)
+	if trades, loaded := wrapper.trades.Get(market); subscribed && loaded {
+		return trades, nil
 	}
 
-	return orderbook, nil
+	bitfinexTrades, err := wrapper.api.Trades.All(MarketNameFor(market, wrapper), time.Time{}, tradesCacheSize)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	// the trades are sent from the most recent.
+	trades := make([]environment.Trade, len(bitfinexTrades))
+	for i, trade := range bitfinexTrades {
+		price, _ := decimal.NewFromString(trade.Price)
+		amount, _ := decimal.NewFromString(trade.Amount)
+		trades[len(trades)-1-i] = environment.Trade{
+			ID:       strconv.FormatInt(trade.TradeId, 10),
+			Price:    price,
+			Quantity: amount.Abs(),
+			Side:     takerSide(trade.Type == "buy"),
+			Time:     *trade.Time(),
+		}
+	}
+
+	if subscribed {
+		return wrapper.trades.Load(market, trades), nil
+	}
+	return trades, nil
 }
 
 // BuyLimit performs a limit buy action.
 //
 // NOTE: In bitfinex buy and sell orders behave the same (the go bitfinex api automatically puts it on correct side)
-func (wrapper *BitfinexWrapper) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	amount = math.Abs(amount)
+func (wrapper *BitfinexWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	amount = amount.Abs()
 	return wrapper.createOrder(market, bitfinex.OrderTypeLimit, amount, limit)
 }
 
 // SellLimit performs a limit sell action.
 //
 // NOTE: In bitfinex buy and sell orders behave the same (the go bitfinex api automatically puts it on correct side)
-func (wrapper *BitfinexWrapper) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	amount = -math.Abs(amount) // a sell is a buy with negative amount.
+func (wrapper *BitfinexWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	amount = amount.Abs().Neg() // a sell is a buy with negative amount.
 	return wrapper.createOrder(market, bitfinex.OrderTypeLimit, amount, limit)
 }
 
 // BuyMarket performs a limit buy action.
 //
 // NOTE: In bitfinex buy and sell orders behave the same (the go bitfinex api automatically puts it on correct side)
-func (wrapper *BitfinexWrapper) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	amount = math.Abs(amount)
-	return wrapper.createOrder(market, bitfinex.OrderTypeMarket, amount, 0)
+func (wrapper *BitfinexWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	amount = amount.Abs()
+	return wrapper.createOrder(market, bitfinex.OrderTypeMarket, amount, decimal.Zero)
 }
 
 // SellMarket performs a limit sell action.
 //
 // NOTE: In bitfinex buy and sell orders behave the same (the go bitfinex api automatically puts it on correct side)
-func (wrapper *BitfinexWrapper) SellMarket(market *environment.Market, amount float64) (string, error) {
-	amount = -math.Abs(amount) // a sell is a buy with negative amount.
-	return wrapper.createOrder(market, bitfinex.OrderTypeMarket, amount, 0)
+func (wrapper *BitfinexWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	amount = amount.Abs().Neg() // a sell is a buy with negative amount.
+	return wrapper.createOrder(market, bitfinex.OrderTypeMarket, amount, decimal.Zero)
 }
 
 // createOrder creates a generic order.
 //
 // NOTE: In bitfinex buy and sell orders behave the same (in sell the amount is negative)
-func (wrapper *BitfinexWrapper) createOrder(market *environment.Market, orderType string, amount float64, price float64) (string, error) {
-	orderNumber, err := wrapper.api.Orders.Create(MarketNameFor(market, wrapper), amount, price, orderType)
+//
+//     NOTE: the v1 client formats float64 values as float32, the order is sent by the wrapper
+//     with the decimals formatted at the precision of the market.
+func (wrapper *BitfinexWrapper) createOrder(market *environment.Market, orderType string, amount decimal.Decimal, price decimal.Decimal) (string, error) {
+	side, bitfinexSide := environment.Bid, "buy"
+	if amount.IsNegative() {
+		side, bitfinexSide = environment.Ask, "sell"
+	}
+
+	quantity, limit, err := prepareOrder(wrapper, market, side, amount.Abs(), price)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, limit)
+	if formattedPrice == "" {
+		formattedPrice = "1" // must be positive even for market orders, which ignore it.
+	}
+
+	var order bitfinex.Order
+	err = wrapper.privatePost("order/new", map[string]interface{}{
+		"symbol":   MarketNameFor(market, wrapper),
+		"amount":   formattedQuantity,
+		"price":    formattedPrice,
+		"side":     bitfinexSide,
+		"type":     orderType,
+		"exchange": "bitfinex",
+	}, &order)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+	return fmt.Sprint(order.ID), nil
+}
+
+// privatePost performs an authenticated request to a path of the V1 REST API, decoding the JSON response into target.
+//
+//     NOTE: the nonce is the one of the client, so that the requests performed here and by the client stay in order.
+func (wrapper *BitfinexWrapper) privatePost(path string, params map[string]interface{}, target interface{}) error {
+	payload := map[string]interface{}{
+		"request": "/v1/" + path,
+		"nonce":   utils.GetNonce(),
+	}
+	for key, value := range params {
+		payload[key] = value
+	}
+
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(encodedPayload)
+	signature := hmac.New(sha512.New384, []byte(wrapper.api.APISecret))
+	signature.Write([]byte(encoded))
+
+	req, err := http.NewRequest(http.MethodPost, bitfinex.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-BFX-APIKEY", wrapper.api.APIKey)
+	req.Header.Set("X-BFX-PAYLOAD", encoded)
+	req.Header.Set("X-BFX-SIGNATURE", hex.EncodeToString(signature.Sum(nil)))
+
+	resp, err := restClient.Do(req)
 	if err != nil {
-		return "", err
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
 	}
-	return fmt.Sprint(orderNumber.ID), nil
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &failure) == nil && failure.Message != "" {
+			return errors.New(failure.Message)
+		}
+		return fmt.Errorf("Request to %s failed: %s %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, target)
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *BitfinexWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	id, err := strconv.ParseInt(orderID, 10, 64)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	bitfinexOrder, err := wrapper.api.Orders.Status(id)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := convertFromBitfinexOrder(bitfinexOrder)
+
+	if !ret.FilledQuantity.IsZero() {
+		bitfinexTrades, err := wrapper.api.History.Trades(MarketNameFor(market, wrapper), ret.Timestamp, time.Now(), 0, false)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+
+		for _, trade := range bitfinexTrades {
+			if trade.OrderId != id {
+				continue
+			}
+			fee, _ := decimal.NewFromString(trade.FeeAmount)
+			ret.Fee = ret.Fee.Add(fee.Abs())
+			ret.FeeCurrency = trade.FeeCurrency
+		}
+	}
+
+	return &ret, nil
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+//
+//     NOTE: fees are not loaded, use GetOrder to get them.
+func (wrapper *BitfinexWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	bitfinexOrders, err := wrapper.api.Orders.All()
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, 0, len(bitfinexOrders))
+	for _, bitfinexOrder := range bitfinexOrders {
+		if strings.EqualFold(bitfinexOrder.Symbol, MarketNameFor(market, wrapper)) {
+			ret = append(ret, convertFromBitfinexOrder(bitfinexOrder))
+		}
+	}
+
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *BitfinexWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	id, err := strconv.ParseInt(orderID, 10, 64)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	return wrapper.api.Orders.Cancel(id)
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *BitfinexWrapper) CancelAllOrders(market *environment.Market) error {
+	openOrders, err := wrapper.api.Orders.All()
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	orderIDs := make([]int64, 0, len(openOrders))
+	for _, order := range openOrders {
+		if strings.EqualFold(order.Symbol, MarketNameFor(market, wrapper)) {
+			orderIDs = append(orderIDs, order.ID)
+		}
+	}
+
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	_, err = wrapper.api.Orders.CancelMulti(orderIDs)
+	return mapError(wrapper, err)
+}
+
+// convertFromBitfinexOrder converts a bitfinex order to a environment.OrderStatus.
+func convertFromBitfinexOrder(bitfinexOrder bitfinex.Order) environment.OrderStatus {
+	price, _ := decimal.NewFromString(bitfinexOrder.Price)
+	avgPrice, _ := decimal.NewFromString(bitfinexOrder.AvgExecutionPrice)
+	quantity, _ := decimal.NewFromString(bitfinexOrder.OriginalAmount)
+	filled, _ := decimal.NewFromString(bitfinexOrder.ExecutedAmount)
+	timestamp, _ := strconv.ParseFloat(bitfinexOrder.Timestamp, 64)
+
+	ret := environment.OrderStatus{
+		ID:             fmt.Sprint(bitfinexOrder.ID),
+		Type:           environment.Bid,
+		Price:          price,
+		Quantity:       quantity.Abs(),
+		FilledQuantity: filled.Abs(),
+		AveragePrice:   avgPrice,
+		Timestamp:      time.Unix(int64(timestamp), 0),
+	}
+
+	if bitfinexOrder.Side == "sell" {
+		ret.Type = environment.Ask
+	}
+
+	if bitfinexOrder.IsLive {
+		if ret.FilledQuantity.IsZero() {
+			ret.State = environment.OrderNew
+		} else {
+			ret.State = environment.OrderPartiallyFilled
+		}
+	} else if bitfinexOrder.IsCanceled {
+		ret.State = environment.OrderCanceled
+	} else {
+		ret.State = environment.OrderFilled
+	}
+
+	return ret
 }
 
 // GetTicker gets the updated ticker for a market.
 func (wrapper *BitfinexWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 	bitfinexTicker, err := wrapper.api.Ticker.Get(MarketNameFor(market, wrapper))
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	last, _ := decimal.NewFromString(bitfinexTicker.LastPrice)
@@ -182,7 +483,7 @@ func (wrapper *BitfinexWrapper) GetMarketSummary(market *environment.Market) (*e
 	if !wrapper.websocketOn {
 		bitfinexSummary, err := wrapper.api.Ticker.Get(MarketNameFor(market, wrapper))
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		high, _ := decimal.NewFromString(bitfinexSummary.High)
@@ -201,38 +502,115 @@ func (wrapper *BitfinexWrapper) GetMarketSummary(market *environment.Market) (*e
 		})
 	}
 
-	ret, exists := wrapper.summaries.Get(market)
-	if !exists {
-		return nil, errors.New("Summary not loaded")
-	}
+	return wrapper.summaries.GetFresh(market, wrapper.maxDataAge)
+}
 
-	return ret, nil
+// bitfinexCandlesPageSize represents the max number of candles returned by a single candles request.
+const bitfinexCandlesPageSize = 1000
+
+// bitfinexCandleResolutions represents the candle resolutions supported by Bitfinex.
+var bitfinexCandleResolutions = map[environment.CandleInterval]common.CandleResolution{
+	environment.Interval1m:  common.OneMinute,
+	environment.Interval5m:  common.FiveMinutes,
+	environment.Interval15m: common.FifteenMinutes,
+	environment.Interval30m: common.ThirtyMinutes,
+	environment.Interval1h:  common.OneHour,
+	environment.Interval1d:  common.OneDay,
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *BitfinexWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	panic("Not supported in V1")
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+//
+//     NOTE: candles are not available in V1, they are always requested to the V2 REST API
+//     since the V1 websocket does not provide them.
+func (wrapper *BitfinexWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	resolution, supported := bitfinexCandleResolutions[interval]
+	if !supported {
+		return nil, fmt.Errorf("Candle interval %s not supported by Bitfinex", interval)
+	}
+
+	symbol := "t" + strings.ToUpper(MarketNameFor(market, wrapper))
+
+	return paginateCandles(interval, from, to, func(since time.Time) ([]environment.CandleStick, error) {
+		end := to
+		if end.IsZero() {
+			end = time.Now()
+		}
+
+		// without a start, the most recent candles are requested.
+		start, sortOrder := common.Mts(since.UnixNano()/int64(time.Millisecond)), common.OldestFirst
+		if since.IsZero() {
+			start, sortOrder = 0, common.NewestFirst
+		}
+
+		bitfinexCandles, err := wrapper.publicAPI.Candles.HistoryWithQuery(
+			symbol,
+			resolution,
+			start,
+			common.Mts(end.UnixNano()/int64(time.Millisecond)-1),
+			bitfinexCandlesPageSize,
+			sortOrder,
+		)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+
+		page := make([]environment.CandleStick, len(bitfinexCandles.Snapshot))
+		for i, bitfinexCandle := range bitfinexCandles.Snapshot {
+			candle := environment.CandleStick{
+				OpenTime: time.Unix(0, bitfinexCandle.MTS*int64(time.Millisecond)),
+				High:     decimal.NewFromFloat(bitfinexCandle.High),
+				Open:     decimal.NewFromFloat(bitfinexCandle.Open),
+				Close:    decimal.NewFromFloat(bitfinexCandle.Close),
+				Low:      decimal.NewFromFloat(bitfinexCandle.Low),
+				Volume:   decimal.NewFromFloat(bitfinexCandle.Volume),
+			}
+
+			if sortOrder == common.NewestFirst {
+				page[len(page)-1-i] = candle
+			} else {
+				page[i] = candle
+			}
+		}
+		return page, nil
+	})
 }
 
 // GetBalance gets the balance of the user of the specified currency.
 func (wrapper *BitfinexWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
-	bitfinexBalances, err := wrapper.api.Balances.All()
+	balances, err := wrapper.GetBalances()
 	if err != nil {
 		return nil, err
 	}
+	return freeBalance(balances, strings.ToUpper(symbol))
+}
+
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+//
+//     NOTE: only the balances of the wallet used by the orders of the wrapper are returned,
+//     by currency in upper case (as named by the V2 API).
+func (wrapper *BitfinexWrapper) GetBalances() (map[string]environment.Balance, error) {
+	bitfinexBalances, err := wrapper.api.Balances.All()
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
 
+	ret := make(map[string]environment.Balance, len(bitfinexBalances))
 	for _, bitfinexBalance := range bitfinexBalances {
-		if bitfinexBalance.Currency == symbol {
-			ret, err := decimal.NewFromString(bitfinexBalance.Available)
-			if err != nil {
-				return nil, err
-			}
+		if bitfinexBalance.Type != bitfinexWallet {
+			continue
+		}
 
-			return &ret, nil
+		total, err := decimal.NewFromString(bitfinexBalance.Amount)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+		free, err := decimal.NewFromString(bitfinexBalance.Available)
+		if err != nil {
+			return nil, mapError(wrapper, err)
 		}
+		ret[strings.ToUpper(bitfinexBalance.Currency)] = newBalance(free, total.Sub(free))
 	}
-
-	return nil, errors.New("Symbol not found")
+	return ret, nil
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -244,82 +622,113 @@ func (wrapper *BitfinexWrapper) GetDepositAddress(coinTicker string) (string, bo
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
 //
 //     NOTE: In Bitfinex fees are currently hardcoded.
-func (wrapper *BitfinexWrapper) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
-	var feePercentage float64
+func (wrapper *BitfinexWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0010 // 0.1%
+		feePercentage = decimal.NewFromFloat(0.0010) // 0.1%
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0020 // 0.2%
+		feePercentage = decimal.NewFromFloat(0.0020) // 0.2%
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *BitfinexWrapper) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *BitfinexWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
 }
 
 // FeedConnect connects to the feed of the exchange.
 func (wrapper *BitfinexWrapper) FeedConnect(markets []*environment.Market) error {
-	err := wrapper.api.WebSocket.Connect()
+	err := wrapper.feeds.connect(markets, func(markets []*environment.Market) (*feedSupervisor, error) {
+		return newFeedSupervisor(wrapper.Name(), nil, func(ctx context.Context, feed *feedSupervisor) error {
+			return wrapper.readFeeds(ctx, feed, markets)
+		}), nil
+	})
 	if err != nil {
-		fmt.Println(err)
+		return mapError(wrapper, err)
 	}
+	wrapper.websocketOn = true
 
-	bookMap := make(map[string]chan []float64)
-	tickers := make(chan []float64, 25)
+	return nil
+}
 
-	for _, m := range markets {
-		tickerKey := MarketNameFor(m, wrapper)
-		bookMap[tickerKey] = make(chan []float64, 25)
-		wrapper.api.WebSocket.AddSubscribe(bitfinex.ChanBook, tickerKey, bookMap[tickerKey])
-		wrapper.subscribeFeeds(m, tickers, bookMap[tickerKey]) // tickers is not used
-	}
+// FeedStatus gets the status of the websocket feeds connected, including the authenticated channel.
+func (wrapper *BitfinexWrapper) FeedStatus() []FeedStatus {
+	return append(wrapper.feeds.status(), wrapper.account.status()...)
+}
 
-	wrapper.websocketOn = true
+// SetMaxDataAge sets the max age of the data served from the websocket feeds, not positive means no limit.
+func (wrapper *BitfinexWrapper) SetMaxDataAge(maxAge time.Duration) {
+	wrapper.maxDataAge = maxAge
+}
 
-	go func(tickers chan []float64, orderbooks map[string]chan []float64) {
-		for {
-			err = wrapper.api.WebSocket.Subscribe()
-			if err != nil {
-				fmt.Println(err)
-			}
+// SetOrderBookDepth sets the max number of price levels per side of the order books of the websocket feeds, not positive means all the levels.
+func (wrapper *BitfinexWrapper) SetOrderBookDepth(depth int) {
+	wrapper.bookDepth = depth
+}
 
-			wrapper.api.WebSocket.Close()
+// FeedRelease releases a subscription to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *BitfinexWrapper) FeedRelease(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribe(markets))
+}
 
-			for _, channel := range bookMap {
-				close(channel)
-			}
+// FeedClose releases all the subscriptions to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *BitfinexWrapper) FeedClose(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribeAll(markets))
+}
 
-			bookMap := make(map[string]chan []float64)
-			err = errors.New("")
-			for err != nil {
-				err = wrapper.api.WebSocket.Connect()
-				if err != nil {
-					fmt.Println(err)
-				}
-			}
-			wrapper.api.WebSocket.ClearSubscriptions()
-
-			for _, m := range markets {
-				tickerKey := MarketNameFor(m, wrapper)
-				bookMap[tickerKey] = make(chan []float64)
-				//wrapper.api.WebSocket.AddSubscribe(bitfinex.ChanTicker, tickerKey, tickers)
-				wrapper.api.WebSocket.AddSubscribe(bitfinex.ChanBook, tickerKey, bookMap[tickerKey])
-				//wrapper.api.WebSocket.AddSubscribe(bitfinex.ChanTrade, tickerKey, trades)
-			}
-		}
-	}(tickers, bookMap)
-	return nil
+// readFeeds connects to the websocket, subscribing to the order books and the trades of the markets, until the connection fails or ctx is done.
+//
+//     NOTE: the order books are resynced by the snapshots sent when subscribing.
+func (wrapper *BitfinexWrapper) readFeeds(ctx context.Context, feed *feedSupervisor, markets []*environment.Market) error {
+	ws := wrapper.api.WebSocket
+	if err := ws.Connect(); err != nil {
+		return err
+	}
+	ws.ClearSubscriptions()
+	wrapper.trades.Reset(markets)
+
+	tickers := make(chan []float64, 25) // tickers is not used
+	orderbooks := make([]chan []float64, len(markets))
+	trades := make([]chan []float64, len(markets))
+	for i, m := range markets {
+		orderbooks[i] = make(chan []float64, 25)
+		trades[i] = make(chan []float64, 25)
+		ws.AddSubscribe(bitfinex.ChanBook, MarketNameFor(m, wrapper), orderbooks[i])
+		ws.AddSubscribe(bitfinex.ChanTrade, MarketNameFor(m, wrapper), trades[i])
+		wrapper.subscribeFeeds(m, feed, tickers, orderbooks[i], trades[i])
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ws.Subscribe()
+	}()
+	feed.connected()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		ws.Close()
+		<-done
+		err = ctx.Err()
+	}
+	ws.Close()
+
+	// the channels are closed once the client stopped writing them.
+	close(tickers)
+	for i := range markets {
+		close(orderbooks[i])
+		close(trades[i])
+	}
+	return err
 }
 
 // subscribeMarketSummaryFeed subscribes to the Market Summary Feed service.
-func (wrapper *BitfinexWrapper) subscribeFeeds(market *environment.Market, tickers <-chan []float64, orderbooks <-chan []float64) {
-	//trades := make(chan []float64)
-
+func (wrapper *BitfinexWrapper) subscribeFeeds(market *environment.Market, feed *feedSupervisor, tickers <-chan []float64, orderbooks <-chan []float64, trades <-chan []float64) {
 	//     NOTE: Content of result array
 	//     BID	float	Price of last highest bid
 	//     BID_SIZE	float	Size of the last highest bid
@@ -350,13 +759,16 @@ func (wrapper *BitfinexWrapper) subscribeFeeds(market *environment.Market, ticke
 	}
 
 	handleOrderbook := func(results <-chan []float64, m *environment.Market) {
-		orderbookMap := make(map[float64]float64)
+		book := newL2Book(m, wrapper.orderbook, wrapper.bookDepth)
+		book.reset(0, nil, nil) // the levels of the snapshot are sent one at a time.
+
 		for {
 			// values : []float64 { PRICE, COUNT, TOTAL_AMOUNT }
 			values, stillOpen := <-results
 			if !stillOpen {
 				return
 			}
+			feed.alive()
 
 			if len(values) != 3 { // for client bug : https://github.com/bitfinexcom/bitfinex-api-go/issues/133
 				continue
@@ -366,81 +778,440 @@ func (wrapper *BitfinexWrapper) subscribeFeeds(market *environment.Market, ticke
 			count := values[1]
 			amount := values[2]
 
+			// a zero count removes the level, the amount is 1 for bids and -1 for asks.
+			level := environment.Order{
+				Value:    decimal.NewFromFloat(price),
+				Quantity: decimal.NewFromFloat(math.Abs(amount)),
+			}
 			if count == 0 {
-				delete(orderbookMap, price)
-				continue
+				level.Quantity = decimal.Zero
 			}
 
-			orderbookMap[price] = amount
+			if amount < 0 {
+				book.apply(bookUpdate{Asks: []environment.Order{level}})
+			} else {
+				book.apply(bookUpdate{Bids: []environment.Order{level}})
+			}
+		}
+	}
 
-			orderbook := environment.OrderBook{
-				Asks: make([]environment.Order, 0, 25),
-				Bids: make([]environment.Order, 0, 25),
+	handleTrades := func(results <-chan []float64, m *environment.Market) {
+		for {
+			// values : []float64 { ID, TIMESTAMP, PRICE, AMOUNT }
+			values, stillOpen := <-results
+			if !stillOpen {
+				return
 			}
+			feed.alive()
 
-			// now let's create the cache
-			for price, amount := range orderbookMap {
-				if amount < 0 {
-					orderbook.Asks = insertSort(orderbook.Asks, environment.Order{
-						Value:    decimal.NewFromFloat(price),
-						Quantity: decimal.NewFromFloat(-amount),
-					}, false)
-				} else if amount > 0 {
-					orderbook.Bids = insertSort(orderbook.Bids, environment.Order{
-						Value:    decimal.NewFromFloat(price),
-						Quantity: decimal.NewFromFloat(amount),
-					}, true)
-				}
+			// the executed trades ("te") are sent without ID, they are taken once updated ("tu").
+			if len(values) != 4 {
+				continue
 			}
 
-			wrapper.orderbook.Set(m, &orderbook)
+			// the amount is positive for buys and negative for sells.
+			wrapper.trades.Add(m, environment.Trade{
+				ID:       strconv.FormatInt(int64(values[0]), 10),
+				Price:    decimal.NewFromFloat(values[2]),
+				Quantity: decimal.NewFromFloat(math.Abs(values[3])),
+				Side:     takerSide(values[3] > 0),
+				Time:     time.Unix(int64(values[1]), 0),
+			})
 		}
 	}
 
-	/*
-		handleTrades := func(results <-chan []float64, tickerKey string) {
-			for {
-				values, closed := <-results
-				if closed {
-					return
+	go handleTicker(tickers, market)
+	go handleOrderbook(orderbooks, market)
+	go handleTrades(trades, market)
+}
+
+// bitfinexWsAuth represents the authentication request of the Bitfinex websocket.
+type bitfinexWsAuth struct {
+	Event       string   `json:"event"`
+	APIKey      string   `json:"apiKey"`
+	AuthSig     string   `json:"authSig"`
+	AuthPayload string   `json:"authPayload"`
+	AuthNonce   string   `json:"authNonce"`
+	Filter      []string `json:"filter"`
+}
+
+// bitfinexWsEvent represents an event (info, auth) sent by the Bitfinex websocket.
+type bitfinexWsEvent struct {
+	Event   string `json:"event"`
+	Status  string `json:"status"`
+	Message string `json:"msg"`
+}
+
+// SubscribeAccount subscribes a handler to the events of the account on the markets, sent by the authenticated channel.
+func (wrapper *BitfinexWrapper) SubscribeAccount(markets []*environment.Market, handler func(environment.AccountEvent)) (func(), error) {
+	unsubscribe, err := wrapper.account.subscribe(markets, handler, func() *feedSupervisor {
+		return newFeedSupervisor(wrapper.Name()+" account", nil, wrapper.readAccount)
+	})
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+	return unsubscribe, nil
+}
+
+// readAccount connects to the authenticated channel, reading it until the connection fails or ctx is done.
+//
+//     NOTE: channel messages are arrays [0, term, payload], the snapshots (os, ws) carry a list of items.
+//     The heartbeats [0, "hb"] are sent every 15 seconds.
+func (wrapper *BitfinexWrapper) readAccount(ctx context.Context, feed *feedSupervisor) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, bitfinexAccountWebsocketURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	nonce := strconv.FormatInt(time.Now().UnixMicro(), 10)
+	signature := hmac.New(sha512.New384, []byte(wrapper.api.APISecret))
+	signature.Write([]byte("AUTH" + nonce))
+
+	err = conn.WriteJSON(bitfinexWsAuth{
+		Event:       "auth",
+		APIKey:      wrapper.api.APIKey,
+		AuthSig:     hex.EncodeToString(signature.Sum(nil)),
+		AuthPayload: "AUTH" + nonce,
+		AuthNonce:   nonce,
+		Filter:      []string{"trading", "wallet"},
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		feed.alive() // including the heartbeats.
+
+		var fields []json.RawMessage
+		if err := json.Unmarshal(message, &fields); err != nil {
+			var event bitfinexWsEvent
+			if json.Unmarshal(message, &event) == nil && event.Event == "auth" {
+				if event.Status != "OK" {
+					return fmt.Errorf("Cannot authenticate to %s: %s", wrapper.Name(), event.Message)
 				}
-				wrapper.summaries.Set(market, &environment.MarketSummary{
-					Bid:    decimal.NewFromFloat(values[0]),
-					Ask:    decimal.NewFromFloat(values[2]),
-					Volume: decimal.NewFromFloat(values[7]),
-					High:   decimal.NewFromFloat(values[8]),
-					Low:    decimal.NewFromFloat(values[9]),
-				})
+				feed.connected()
 			}
+			continue
+		}
+		if len(fields) < 3 {
+			continue
 		}
-	*/
 
-	go handleTicker(tickers, market)
-	go handleOrderbook(orderbooks, market)
+		var term string
+		if json.Unmarshal(fields[1], &term) != nil {
+			continue
+		}
+		wrapper.handleAccount(term, fields[2])
+	}
+}
+
+// handleAccount sends the orders (os, on, ou, oc), the fills (tu) and the exchange wallets (ws, wu) of a message of the authenticated channel to the subscribers.
+//
+//     NOTE: the executed trades ("te") are sent without fees, the fills are taken once updated ("tu").
+func (wrapper *BitfinexWrapper) handleAccount(term string, payload json.RawMessage) {
+	var items [][]interface{}
+	switch term {
+	case "os", "ws":
+		if err := json.Unmarshal(payload, &items); err != nil {
+			return
+		}
+	case "on", "ou", "oc", "tu", "wu":
+		var item []interface{}
+		if err := json.Unmarshal(payload, &item); err != nil {
+			return
+		}
+		items = append(items, item)
+	default:
+		return
+	}
+
+	for _, item := range items {
+		switch term {
+		case "tu":
+			wrapper.handleAccountFill(item)
+		case "ws", "wu":
+			wrapper.handleAccountWallet(item)
+		default:
+			wrapper.handleAccountOrder(item)
+		}
+	}
+}
+
+// handleAccountOrder sends an order of the authenticated channel to the subscribers.
+//
+//     NOTE: Content of the order array
+//     ID	int	Order ID
+//     SYMBOL	string	Pair (tBTCUSD, ...)
+//     MTS_CREATE	int	Millisecond timestamp of creation
+//     MTS_UPDATE	int	Millisecond timestamp of update
+//     AMOUNT	float	Remaining amount, positive means buy, negative means sell
+//     AMOUNT_ORIG	float	Original amount
+//     ORDER_STATUS	string	ACTIVE, EXECUTED @ PRICE(AMOUNT), PARTIALLY FILLED @ PRICE(AMOUNT), CANCELED
+//     PRICE	float	Price
+//     PRICE_AVG	float	Average price
+func (wrapper *BitfinexWrapper) handleAccountOrder(item []interface{}) {
+	if len(item) < 18 {
+		return
+	}
+	market := wrapper.account.market(strings.TrimPrefix(bitfinexString(item, 3), "t"))
+	if market == nil {
+		return
+	}
+
+	amount := bitfinexFloat(item, 7)
+	remaining := bitfinexFloat(item, 6)
+	order := environment.OrderStatus{
+		ID:             strconv.FormatInt(int64(bitfinexFloat(item, 0)), 10),
+		Type:           takerSide(amount > 0),
+		Price:          decimal.NewFromFloat(bitfinexFloat(item, 16)),
+		Quantity:       decimal.NewFromFloat(math.Abs(amount)),
+		FilledQuantity: decimal.NewFromFloat(math.Abs(amount - remaining)),
+		AveragePrice:   decimal.NewFromFloat(bitfinexFloat(item, 17)),
+		Timestamp:      time.UnixMilli(int64(bitfinexFloat(item, 4))),
+	}
+
+	switch status := bitfinexString(item, 13); {
+	case strings.HasPrefix(status, "ACTIVE"):
+		order.State = environment.OrderNew
+	case strings.HasPrefix(status, "PARTIALLY FILLED"):
+		order.State = environment.OrderPartiallyFilled
+	case strings.HasPrefix(status, "EXECUTED"):
+		order.State = environment.OrderFilled
+	default: // canceled, also when partially filled, or closed for insufficient margin.
+		order.State = environment.OrderCanceled
+	}
+
+	wrapper.account.dispatch(environment.AccountEvent{
+		Type:   environment.OrderUpdateEvent,
+		Market: market,
+		Order:  &order,
+		Time:   time.UnixMilli(int64(bitfinexFloat(item, 5))),
+	})
+}
+
+// handleAccountFill sends a fill of the authenticated channel to the subscribers.
+//
+//     NOTE: Content of the trade array
+//     ID	int	Trade ID
+//     SYMBOL	string	Pair (tBTCUSD, ...)
+//     MTS	int	Millisecond timestamp of the execution
+//     ORDER_ID	int	Order ID
+//     EXEC_AMOUNT	float	Executed amount, positive means buy, negative means sell
+//     EXEC_PRICE	float	Execution price
+//     MAKER	int	1 if maker, -1 if taker
+//     FEE	float	Fee, negative
+//     FEE_CURRENCY	string	Fee currency
+func (wrapper *BitfinexWrapper) handleAccountFill(item []interface{}) {
+	if len(item) < 11 {
+		return
+	}
+	market := wrapper.account.market(strings.TrimPrefix(bitfinexString(item, 1), "t"))
+	if market == nil {
+		return
+	}
+
+	amount := bitfinexFloat(item, 4)
+	timestamp := time.UnixMilli(int64(bitfinexFloat(item, 2)))
+	wrapper.account.dispatch(environment.AccountEvent{
+		Type:   environment.FillEvent,
+		Market: market,
+		Fill: &environment.Fill{
+			OrderID:     strconv.FormatInt(int64(bitfinexFloat(item, 3)), 10),
+			TradeID:     strconv.FormatInt(int64(bitfinexFloat(item, 0)), 10),
+			Side:        takerSide(amount > 0),
+			Price:       decimal.NewFromFloat(bitfinexFloat(item, 5)),
+			Quantity:    decimal.NewFromFloat(math.Abs(amount)),
+			Fee:         decimal.NewFromFloat(math.Abs(bitfinexFloat(item, 9))),
+			FeeCurrency: bitfinexString(item, 10),
+			Maker:       bitfinexFloat(item, 8) > 0,
+			Time:        timestamp,
+		},
+		Time: timestamp,
+	})
+}
+
+// handleAccountWallet sends the balance of the wallet of the wrapper, as sent by the authenticated channel, to the subscribers.
+//
+//     NOTE: Content of the wallet array
+//     WALLET_TYPE	string	exchange, margin, funding
+//     CURRENCY	string	Currency
+//     BALANCE	float	Balance
+//     UNSETTLED_INTEREST	float	Unsettled interest
+//     BALANCE_AVAILABLE	float	Balance available, null if not calculated yet
+func (wrapper *BitfinexWrapper) handleAccountWallet(item []interface{}) {
+	if len(item) < 3 || bitfinexString(item, 0) != bitfinexWalletV2 {
+		return
+	}
+
+	free := bitfinexFloat(item, 2)
+	if len(item) > 4 && item[4] != nil {
+		free = bitfinexFloat(item, 4)
+	}
+
+	wrapper.account.dispatch(environment.AccountEvent{
+		Type: environment.BalanceEvent,
+		Balance: &environment.BalanceUpdate{
+			Currency: bitfinexString(item, 1),
+			Free:     decimal.NewFromFloat(free),
+		},
+	})
+}
+
+// bitfinexFloat gets a number of an array sent by the websocket, 0 if missing or null.
+func bitfinexFloat(item []interface{}, i int) float64 {
+	if i >= len(item) {
+		return 0
+	}
+	value, _ := item[i].(float64)
+	return value
+}
+
+// bitfinexString gets a string of an array sent by the websocket, empty if missing or null.
+func bitfinexString(item []interface{}, i int) string {
+	if i >= len(item) {
+		return ""
+	}
+	value, _ := item[i].(string)
+	return value
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *BitfinexWrapper) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	status, err := wrapper.api.Wallet.WithdrawCrypto(amount, coinTicker, bitfinex.WALLET_TRADING, destinationAddress)
+func (wrapper *BitfinexWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	var status []bitfinex.WithdrawStatus
+	err := wrapper.privatePost("withdraw", map[string]interface{}{
+		"amount":         amount.String(),
+		"walletselected": bitfinexWallet,
+		"withdraw_type":  coinTicker,
+		"address":        destinationAddress,
+	}, &status)
 	if err != nil {
-		return err
+		return mapError(wrapper, err)
 	}
-	if status[0].Status == "error" {
+	if len(status) > 0 && status[0].Status == "error" {
 		return errors.New(status[0].Message)
 	}
 
 	return nil
 }
 
-func insertSort(data []environment.Order, el environment.Order, reverse bool) []environment.Order {
-	index := sort.Search(len(data), func(i int) bool {
-		if reverse {
-			return data[i].Value.LessThan(el.Value)
-		}
-		return data[i].Value.GreaterThan(el.Value)
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return callContext(ctx, func() ([]environment.CandleStick, error) {
+		return wrapper.GetCandles(market, interval, from, to)
+	})
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return callContext(ctx, func() (*environment.MarketSummary, error) {
+		return wrapper.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return callContext(ctx, func() (*environment.OrderBook, error) {
+		return wrapper.GetOrderBook(market)
+	})
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return callContext(ctx, func() ([]environment.Trade, error) {
+		return wrapper.GetRecentTrades(market)
+	})
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BitfinexWrapper) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BitfinexWrapper) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BitfinexWrapper) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyMarket(market, amount)
+	})
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BitfinexWrapper) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellMarket(market, amount)
+	})
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return callContext(ctx, func() (*environment.OrderStatus, error) {
+		return wrapper.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return callContext(ctx, func() ([]environment.OrderStatus, error) {
+		return wrapper.GetOpenOrders(market)
+	})
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelAllOrders(market)
+	})
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	return callContext(ctx, func() (*decimal.Decimal, error) {
+		return wrapper.GetBalance(symbol)
+	})
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return callContext(ctx, func() (map[string]environment.Balance, error) {
+		return wrapper.GetBalances()
+	})
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *BitfinexWrapper) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.FeedConnect(markets)
+	})
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BitfinexWrapper) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return sendContextErr(ctx, func() error {
+		return wrapper.Withdraw(destinationAddress, coinTicker, amount)
 	})
-	data = append(data, environment.Order{})
-	copy(data[index+1:], data[index:])
-	data[index] = el
-	return data
 }
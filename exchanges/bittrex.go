@@ -16,7 +16,20 @@
 package exchanges
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/shopspring/decimal"
@@ -31,8 +44,11 @@ import (
 // BittrexWrapper provides a Generic wrapper of the Bittrex API.
 type BittrexWrapper struct {
 	api                 *api.Bittrex //Represents the helper of the Bittrex API.
+	publicKey           string       //Represents the credentials of the requests not exposed by the helper.
+	secretKey           string
 	summaries           *SummaryCache
 	candles             *CandlesCache
+	marketInfo          *MarketInfoCache
 	websocketOn         bool
 	unsubscribeChannels map[*environment.Market]chan bool
 	depositAddresses    map[string]string
@@ -40,13 +56,23 @@ type BittrexWrapper struct {
 
 // NewBittrexWrapper creates a generic wrapper of the bittrex API.
 func NewBittrexWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
-	return &BittrexWrapper{
-		api:              api.New(publicKey, secretKey),
+	wrapper := &BittrexWrapper{
+		api:              api.NewWithCustomHttpClient(publicKey, secretKey, restClient),
+		publicKey:        publicKey,
+		secretKey:        secretKey,
 		websocketOn:      false,
 		summaries:        NewSummaryCache(),
 		candles:          NewCandlesCache(),
 		depositAddresses: depositAddresses,
 	}
+	wrapper.marketInfo = NewMarketInfoCache(wrapper.GetMarkets)
+	return wrapper
+}
+
+func init() {
+	Register("bittrex", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewBittrexWrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
 }
 
 // Name returns the name of the wrapped exchange.
@@ -54,15 +80,29 @@ func (wrapper *BittrexWrapper) Name() string {
 	return "bittrex"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *BittrexWrapper) Capabilities() Capabilities {
+	return Capabilities{
+		Trades:      true,
+		LimitOrders: true,
+		Withdraw:    true,
+		TradingFees: true,
+		OrderQuery:  true,
+	}
+}
+
 func (wrapper *BittrexWrapper) String() string {
 	return wrapper.Name()
 }
 
+// bittrexQuantityStep is the quantity increment accepted by Bittrex on every market, which does not list it.
+var bittrexQuantityStep = decimal.New(1, -8)
+
 // GetMarkets gets all the markets info.
 func (wrapper *BittrexWrapper) GetMarkets() ([]*environment.Market, error) {
 	bittrexMarkets, err := wrapper.api.GetMarkets()
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 	wrappedMarkets := make([]*environment.Market, 0, len(bittrexMarkets))
 	for _, market := range bittrexMarkets {
@@ -70,16 +110,26 @@ func (wrapper *BittrexWrapper) GetMarkets() ([]*environment.Market, error) {
 			Name:           market.Symbol,
 			BaseCurrency:   market.BaseCurrencySymbol,
 			MarketCurrency: market.QuoteCurrencySymbol,
+			Info: &environment.MarketInfo{
+				PriceTick:    decimal.New(1, -market.Precision),
+				QuantityStep: bittrexQuantityStep,
+				MinQuantity:  market.MinTradeSize,
+			},
 		})
 	}
 	return wrappedMarkets, nil
 }
 
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *BittrexWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return wrapper.marketInfo.Get(MarketNameFor(market, wrapper))
+}
+
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *BittrexWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
 	bittrexOrderBook, err := wrapper.api.GetOrderBook(MarketNameFor(market, wrapper), 5, "both")
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	var orderBook environment.OrderBook
@@ -99,49 +149,254 @@ func (wrapper *BittrexWrapper) GetOrderBook(market *environment.Market) (*enviro
 	return &orderBook, nil
 }
 
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+func (wrapper *BittrexWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	bittrexTrades, err := wrapper.api.GetMarketHistory(MarketNameFor(market, wrapper))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	return convertFromBittrexTrades(bittrexTrades), nil
+}
+
+// convertFromBittrexTrades converts the trades of a bittrex market to environment.Trade, sorted by time.
+func convertFromBittrexTrades(bittrexTrades []bittrex.TradeV3) []environment.Trade {
+	trades := make([]environment.Trade, len(bittrexTrades))
+	for i, trade := range bittrexTrades {
+		price, _ := decimal.NewFromString(trade.Rate)
+		quantity, _ := decimal.NewFromString(trade.Quantity)
+		trades[i] = environment.Trade{
+			ID:       trade.ID,
+			Price:    price,
+			Quantity: quantity,
+			Side:     takerSide(trade.TakerSide == "BUY"),
+			Time:     trade.ExecutedAt,
+		}
+	}
+
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Time.Before(trades[j].Time)
+	})
+	return trades
+}
+
 // BuyLimit performs a limit buy action.
-func (wrapper *BittrexWrapper) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.CreateOrder(bittrex.CreateOrderParams{
+func (wrapper *BittrexWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Bid, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderNumber, err := createBittrexOrder(wrapper.publicKey, wrapper.secretKey, bittrexOrderParams{
 		Type:         bittrex.LIMIT,
 		TimeInForce:  bittrex.GOOD_TIL_CANCELLED,
 		MarketSymbol: MarketNameFor(market, wrapper),
-		Quantity:     decimal.NewFromFloat(amount),
-		Limit:        limit,
+		Quantity:     formattedQuantity,
+		Limit:        formattedPrice,
 		Direction:    bittrex.BUY,
 	})
 
-	return orderNumber.ID, err
+	return orderNumber.ID, mapError(wrapper, err)
 }
 
 // SellLimit performs a limit sell action.
-func (wrapper *BittrexWrapper) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.CreateOrder(bittrex.CreateOrderParams{
+func (wrapper *BittrexWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Ask, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderNumber, err := createBittrexOrder(wrapper.publicKey, wrapper.secretKey, bittrexOrderParams{
 		Type:         bittrex.LIMIT,
 		TimeInForce:  bittrex.GOOD_TIL_CANCELLED,
 		MarketSymbol: MarketNameFor(market, wrapper),
-		Quantity:     decimal.NewFromFloat(amount),
-		Limit:        limit,
+		Quantity:     formattedQuantity,
+		Limit:        formattedPrice,
 		Direction:    bittrex.SELL,
 	})
 
-	return orderNumber.ID, err
+	return orderNumber.ID, mapError(wrapper, err)
 }
 
 // BuyMarket performs a market buy action.
-func (wrapper *BittrexWrapper) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	panic("Not supported on bittrex")
+func (wrapper *BittrexWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", notSupported(wrapper, "BuyMarket")
 }
 
 // SellMarket performs a market sell action.
-func (wrapper *BittrexWrapper) SellMarket(market *environment.Market, amount float64) (string, error) {
-	panic("Not supported on bittrex")
+func (wrapper *BittrexWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", notSupported(wrapper, "SellMarket")
+}
+
+// bittrexOrderParams represents an order sent to the Bittrex v3 API, with the decimals formatted at the market precision.
+//
+//     NOTE: the client sends the limit as a float64, this is sent as text instead.
+type bittrexOrderParams struct {
+	MarketSymbol string                 `json:"marketSymbol"`
+	Direction    bittrex.OrderDirection `json:"direction"`
+	Type         bittrex.OrderType      `json:"type"`
+	Quantity     string                 `json:"quantity"`
+	Limit        string                 `json:"limit,omitempty"`
+	TimeInForce  bittrex.TimeInForce    `json:"timeInForce"`
+}
+
+// createBittrexOrder places an order with the Bittrex v3 API, signing the request with the specified credentials
+// like the client does.
+func createBittrexOrder(publicKey string, secretKey string, params bittrexOrderParams) (bittrex.OrderV3, error) {
+	var order bittrex.OrderV3
+
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return order, err
+	}
+
+	endpoint := bittrex.API_BASE + bittrex.API_VERSION + "/orders"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return order, err
+	}
+
+	// the signature is the HMAC-SHA512 of timestamp, url, method and hash of the payload.
+	payloadSum := sha512.Sum512(payload)
+	payloadHash := hex.EncodeToString(payloadSum[:])
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	mac := hmac.New(sha512.New, []byte(secretKey))
+	mac.Write([]byte(timestamp + endpoint + http.MethodPost + payloadHash))
+
+	req.Header.Set("Content-Type", "application/json;charset=utf-8")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Api-Key", publicKey)
+	req.Header.Set("Api-Timestamp", timestamp)
+	req.Header.Set("Api-Content-Hash", payloadHash)
+	req.Header.Set("Api-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return order, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return order, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return order, fmt.Errorf("Request to %s failed: %s %s", endpoint, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	err = json.Unmarshal(body, &order)
+	return order, err
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *BittrexWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	openOrders, err := wrapper.api.GetOpenOrders(MarketNameFor(market, wrapper))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	for _, order := range openOrders {
+		if order.ID == orderID {
+			ret := convertFromBittrexOrder(order)
+			return &ret, nil
+		}
+	}
+
+	closedOrders, err := wrapper.api.GetClosedOrders(MarketNameFor(market, wrapper))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	for _, order := range closedOrders {
+		if order.ID == orderID {
+			ret := convertFromBittrexOrder(order)
+			return &ret, nil
+		}
+	}
+
+	return nil, errors.New("Order not found")
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+func (wrapper *BittrexWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	bittrexOrders, err := wrapper.api.GetOpenOrders(MarketNameFor(market, wrapper))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, len(bittrexOrders))
+	for i, order := range bittrexOrders {
+		ret[i] = convertFromBittrexOrder(order)
+	}
+
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *BittrexWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	_, err := wrapper.api.CancelOrder(orderID)
+	return mapError(wrapper, err)
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *BittrexWrapper) CancelAllOrders(market *environment.Market) error {
+	bittrexOrders, err := wrapper.api.GetOpenOrders(MarketNameFor(market, wrapper))
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	for _, order := range bittrexOrders {
+		_, err := wrapper.api.CancelOrder(order.ID)
+		if err != nil {
+			return mapError(wrapper, err)
+		}
+	}
+
+	return nil
+}
+
+// convertFromBittrexOrder converts a bittrex order to a environment.OrderStatus.
+func convertFromBittrexOrder(order api.OrderV3) environment.OrderStatus {
+	ret := environment.OrderStatus{
+		ID:             order.ID,
+		Type:           environment.Bid,
+		Price:          order.Limit,
+		Quantity:       order.Quantity,
+		FilledQuantity: order.FillQuantity,
+		Fee:            order.Commission,
+		Timestamp:      order.CreatedAt,
+	}
+
+	if order.Direction == string(bittrex.SELL) {
+		ret.Type = environment.Ask
+	}
+
+	if !order.FillQuantity.IsZero() {
+		ret.AveragePrice = order.Proceeds.Div(order.FillQuantity)
+	}
+
+	if order.Status == "OPEN" {
+		if order.FillQuantity.IsZero() {
+			ret.State = environment.OrderNew
+		} else {
+			ret.State = environment.OrderPartiallyFilled
+		}
+	} else if order.FillQuantity.LessThan(order.Quantity) {
+		ret.State = environment.OrderCanceled
+	} else {
+		ret.State = environment.OrderFilled
+	}
+
+	return ret
 }
 
 // GetTicker gets the updated ticker for a market.
 func (wrapper *BittrexWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 	bittrexTicker, err := wrapper.api.GetTicker(MarketNameFor(market, wrapper))
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	return &environment.Ticker{
@@ -156,12 +411,12 @@ func (wrapper *BittrexWrapper) GetMarketSummary(market *environment.Market) (*en
 	if !wrapper.websocketOn {
 		summary, err := wrapper.api.GetMarketSummary(MarketNameFor(market, wrapper))
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		ticker, err := wrapper.GetTicker(market)
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		wrapper.summaries.Set(market, &environment.MarketSummary{
@@ -185,28 +440,44 @@ func (wrapper *BittrexWrapper) GetMarketSummary(market *environment.Market) (*en
 //convertFromBittrexCandle converts a bittrex candle to a environment.CandleStick.
 func convertFromBittrexCandle(candle api.Candle) environment.CandleStick {
 	return environment.CandleStick{
-		High:  candle.High,
-		Open:  candle.Open,
-		Close: candle.Close,
-		Low:   candle.Low,
+		OpenTime: candle.TimeStamp.Time,
+		High:     candle.High,
+		Open:     candle.Open,
+		Close:    candle.Close,
+		Low:      candle.Low,
+		Volume:   candle.BaseVolume,
 	}
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *BittrexWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	panic("Not supported in Bittrex V1")
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+func (wrapper *BittrexWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return nil, notSupported(wrapper, "GetCandles")
 }
 
 // GetBalance gets the balance of the user of the specified currency.
 func (wrapper *BittrexWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
 	balance, err := wrapper.api.GetBalance(symbol)
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	return &balance.Available, nil
 }
 
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+func (wrapper *BittrexWrapper) GetBalances() (map[string]environment.Balance, error) {
+	bittrexBalances, err := wrapper.api.GetBalances()
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make(map[string]environment.Balance, len(bittrexBalances))
+	for _, bittrexBalance := range bittrexBalances {
+		ret[bittrexBalance.CurrencySymbol] = newBalance(bittrexBalance.Available, bittrexBalance.Total.Sub(bittrexBalance.Available))
+	}
+	return ret, nil
+}
+
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
 func (wrapper *BittrexWrapper) GetDepositAddress(coinTicker string) (string, bool) {
 	addr, exists := wrapper.depositAddresses[coinTicker]
@@ -216,22 +487,22 @@ func (wrapper *BittrexWrapper) GetDepositAddress(coinTicker string) (string, boo
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
 //
 //     NOTE: In Bittrex fees are hardcoded due to the inability to obtain them via API before placing an order.
-func (wrapper *BittrexWrapper) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
-	var feePercentage float64
+func (wrapper *BittrexWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *BittrexWrapper) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *BittrexWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
 }
 
 // FeedConnect connects to the feed of the exchange.
@@ -239,18 +510,123 @@ func (wrapper *BittrexWrapper) FeedConnect(markets []*environment.Market) error
 	return ErrWebsocketNotSupported
 }
 
-// SubscribeMarketSummaryFeed subscribes to the Market Summary Feed service.
-//
-//     NOTE: Not supported on Bittrex v1 API, use *BittrexWrapperV2.
-func (wrapper *BittrexWrapper) subscribeMarketSummaryFeed(market *environment.Market) {
-	panic(ErrWebsocketNotSupported)
-}
-
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *BittrexWrapper) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	_, err := wrapper.api.Withdraw(destinationAddress, coinTicker, decimal.NewFromFloat(amount), "golang-crypto-trading-bot")
+func (wrapper *BittrexWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	_, err := wrapper.api.Withdraw(destinationAddress, coinTicker, amount, "golang-crypto-trading-bot")
 	if err != nil {
-		return err
+		return mapError(wrapper, err)
 	}
 	return nil
 }
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return callContext(ctx, func() ([]environment.CandleStick, error) {
+		return wrapper.GetCandles(market, interval, from, to)
+	})
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return callContext(ctx, func() (*environment.MarketSummary, error) {
+		return wrapper.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return callContext(ctx, func() (*environment.OrderBook, error) {
+		return wrapper.GetOrderBook(market)
+	})
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return callContext(ctx, func() ([]environment.Trade, error) {
+		return wrapper.GetRecentTrades(market)
+	})
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapper) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapper) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapper) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyMarket(market, amount)
+	})
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapper) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellMarket(market, amount)
+	})
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return callContext(ctx, func() (*environment.OrderStatus, error) {
+		return wrapper.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return callContext(ctx, func() ([]environment.OrderStatus, error) {
+		return wrapper.GetOpenOrders(market)
+	})
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelAllOrders(market)
+	})
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	return callContext(ctx, func() (*decimal.Decimal, error) {
+		return wrapper.GetBalance(symbol)
+	})
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return callContext(ctx, func() (map[string]environment.Balance, error) {
+		return wrapper.GetBalances()
+	})
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *BittrexWrapper) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.FeedConnect(markets)
+	})
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapper) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return sendContextErr(ctx, func() error {
+		return wrapper.Withdraw(destinationAddress, coinTicker, amount)
+	})
+}
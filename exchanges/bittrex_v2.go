@@ -16,29 +16,47 @@
 package exchanges
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/shopspring/decimal"
 	"github.com/thebotguys/golang-bittrex-api/bittrex"
+	api "github.com/toorop/go-bittrex"
 )
 
 // BittrexWrapperV2 wraps Bittrex API v2.0
+//
+//     NOTE: the private calls (orders, balances, withdrawals) are performed with the Bittrex v3 API.
 type BittrexWrapperV2 struct {
 	PublicKey        string
 	SecretKey        string
+	api              *api.Bittrex //Represents the helper of the Bittrex v3 API, for the private calls.
 	summaries        *SummaryCache
+	marketInfo       *MarketInfoCache
 	depositAddresses map[string]string
 }
 
 // NewBittrexV2Wrapper creates a generic wrapper of the bittrex API v2.0.
 func NewBittrexV2Wrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
-	return &BittrexWrapperV2{
+	wrapper := &BittrexWrapperV2{
 		PublicKey:        publicKey,
 		SecretKey:        secretKey,
+		api:              api.New(publicKey, secretKey),
 		summaries:        NewSummaryCache(),
 		depositAddresses: depositAddresses,
 	}
+	wrapper.marketInfo = NewMarketInfoCache(wrapper.GetMarkets)
+	return wrapper
+}
+
+func init() {
+	Register("bittrexV2", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewBittrexV2Wrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
 }
 
 // Name returns the name of the wrapped exchange.
@@ -46,6 +64,19 @@ func (wrapper *BittrexWrapperV2) Name() string {
 	return "bittrex"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *BittrexWrapperV2) Capabilities() Capabilities {
+	return Capabilities{
+		Candles:      true,
+		Trades:       true,
+		LimitOrders:  true,
+		MarketOrders: true,
+		Withdraw:     true,
+		TradingFees:  true,
+		OrderQuery:   true,
+	}
+}
+
 func (wrapper *BittrexWrapperV2) String() string {
 	return wrapper.Name()
 }
@@ -54,8 +85,19 @@ func (wrapper *BittrexWrapperV2) String() string {
 func (wrapper *BittrexWrapperV2) GetMarkets() ([]*environment.Market, error) {
 	bittrexMarkets, err := bittrex.GetMarkets()
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
+
+	// the price precision is listed only by the v3 API, which accepts the orders.
+	v3Markets, err := wrapper.api.GetMarkets()
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+	priceTicks := make(map[string]decimal.Decimal, len(v3Markets))
+	for _, market := range v3Markets {
+		priceTicks[market.Symbol] = decimal.New(1, -market.Precision)
+	}
+
 	wrappedMarkets := make([]*environment.Market, 0, len(bittrexMarkets))
 	for _, market := range bittrexMarkets {
 		if market.IsActive {
@@ -63,42 +105,187 @@ func (wrapper *BittrexWrapperV2) GetMarkets() ([]*environment.Market, error) {
 				Name:           market.MarketName,
 				BaseCurrency:   market.BaseCurrency,
 				MarketCurrency: market.MarketCurrency,
+				Info: &environment.MarketInfo{
+					PriceTick:    priceTicks[bittrexV3Symbol(market.MarketName)],
+					QuantityStep: bittrexQuantityStep,
+					MinQuantity:  market.MinTradeSize,
+				},
 			})
 		}
 	}
 	return wrappedMarkets, nil
 }
 
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *BittrexWrapperV2) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return wrapper.marketInfo.Get(MarketNameFor(market, wrapper))
+}
+
+// bittrexV3Symbol gets the v3 symbol (e.g. LTC-BTC) of a market named as in v2 (e.g. BTC-LTC).
+func bittrexV3Symbol(marketName string) string {
+	currencies := strings.SplitN(marketName, "-", 2)
+	if len(currencies) != 2 {
+		return marketName
+	}
+	return currencies[1] + "-" + currencies[0]
+}
+
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *BittrexWrapperV2) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
-	panic("GetOrderBook not implemented")
+	bittrexOrderBook, err := wrapper.api.GetOrderBook(bittrexV3Symbol(MarketNameFor(market, wrapper)), 25, "both")
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	var orderBook environment.OrderBook
+	for _, order := range bittrexOrderBook.Bid {
+		orderBook.Bids = append(orderBook.Bids, environment.Order{
+			Quantity: order.Quantity,
+			Value:    order.Rate,
+		})
+	}
+	for _, order := range bittrexOrderBook.Ask {
+		orderBook.Asks = append(orderBook.Asks, environment.Order{
+			Quantity: order.Quantity,
+			Value:    order.Rate,
+		})
+	}
+
+	return &orderBook, nil
+}
+
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+func (wrapper *BittrexWrapperV2) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	bittrexTrades, err := wrapper.api.GetMarketHistory(bittrexV3Symbol(MarketNameFor(market, wrapper)))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	return convertFromBittrexTrades(bittrexTrades), nil
 }
 
 // BuyLimit performs a limit buy action.
-func (wrapper *BittrexWrapperV2) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	return "", errors.New("BuyLimit not implemented")
+func (wrapper *BittrexWrapperV2) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.createOrder(market, environment.Bid, api.LIMIT, amount, limit)
 }
 
 // BuyMarket performs a market buy action.
-func (wrapper *BittrexWrapperV2) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	return "", errors.New("BuyMarket not implemented")
+func (wrapper *BittrexWrapperV2) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.createOrder(market, environment.Bid, api.MARKET, amount, decimal.Zero)
 }
 
 // SellLimit performs a limit sell action.
-func (wrapper *BittrexWrapperV2) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	return "", errors.New("SellLimit not implemented")
+func (wrapper *BittrexWrapperV2) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.createOrder(market, environment.Ask, api.LIMIT, amount, limit)
 }
 
 // SellMarket performs a market sell action.
-func (wrapper *BittrexWrapperV2) SellMarket(market *environment.Market, amount float64) (string, error) {
-	return "", errors.New("SellMarket not implemented")
+func (wrapper *BittrexWrapperV2) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.createOrder(market, environment.Ask, api.MARKET, amount, decimal.Zero)
+}
+
+// createOrder places an order, market orders are executed immediately or cancelled.
+func (wrapper *BittrexWrapperV2) createOrder(market *environment.Market, orderType environment.OrderType, bittrexType api.OrderType, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, orderType, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	params := bittrexOrderParams{
+		Type:         bittrexType,
+		TimeInForce:  api.GOOD_TIL_CANCELLED,
+		MarketSymbol: bittrexV3Symbol(MarketNameFor(market, wrapper)),
+		Quantity:     formattedQuantity,
+		Limit:        formattedPrice,
+		Direction:    api.BUY,
+	}
+	if bittrexType == api.MARKET {
+		params.TimeInForce = api.IMMEDIATE_OR_CANCEL
+	}
+	if orderType == environment.Ask {
+		params.Direction = api.SELL
+	}
+
+	order, err := createBittrexOrder(wrapper.PublicKey, wrapper.SecretKey, params)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+	return order.ID, nil
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *BittrexWrapperV2) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	openOrders, err := wrapper.api.GetOpenOrders(bittrexV3Symbol(MarketNameFor(market, wrapper)))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	for _, order := range openOrders {
+		if order.ID == orderID {
+			ret := convertFromBittrexOrder(order)
+			return &ret, nil
+		}
+	}
+
+	closedOrders, err := wrapper.api.GetClosedOrders(bittrexV3Symbol(MarketNameFor(market, wrapper)))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	for _, order := range closedOrders {
+		if order.ID == orderID {
+			ret := convertFromBittrexOrder(order)
+			return &ret, nil
+		}
+	}
+
+	return nil, errors.New("Order not found")
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+func (wrapper *BittrexWrapperV2) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	bittrexOrders, err := wrapper.api.GetOpenOrders(bittrexV3Symbol(MarketNameFor(market, wrapper)))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, len(bittrexOrders))
+	for i, order := range bittrexOrders {
+		ret[i] = convertFromBittrexOrder(order)
+	}
+
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *BittrexWrapperV2) CancelOrder(market *environment.Market, orderID string) error {
+	_, err := wrapper.api.CancelOrder(orderID)
+	return mapError(wrapper, err)
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *BittrexWrapperV2) CancelAllOrders(market *environment.Market) error {
+	bittrexOrders, err := wrapper.api.GetOpenOrders(bittrexV3Symbol(MarketNameFor(market, wrapper)))
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	for _, order := range bittrexOrders {
+		_, err := wrapper.api.CancelOrder(order.ID)
+		if err != nil {
+			return mapError(wrapper, err)
+		}
+	}
+
+	return nil
 }
 
 // GetMarketSummary gets the current market summary.
 func (wrapper *BittrexWrapperV2) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
-	summary, err := bittrex.GetMarketSummary(market.Name)
+	summary, err := bittrex.GetMarketSummary(MarketNameFor(market, wrapper))
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	ret := &environment.MarketSummary{
@@ -115,31 +302,67 @@ func (wrapper *BittrexWrapperV2) GetMarketSummary(market *environment.Market) (*
 	return ret, nil
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *BittrexWrapperV2) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	bittrexCandles, err := bittrex.GetTicks(MarketNameFor(market, wrapper), "30m")
+// bittrexTickIntervals represents the tick intervals supported by Bittrex.
+var bittrexTickIntervals = map[environment.CandleInterval]string{
+	environment.Interval1m:  "oneMin",
+	environment.Interval5m:  "fiveMin",
+	environment.Interval30m: "thirtyMin",
+	environment.Interval1h:  "hour",
+	environment.Interval1d:  "day",
+}
+
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+//
+//     NOTE: Bittrex returns a fixed history for each interval, older candles are not available.
+func (wrapper *BittrexWrapperV2) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	tickInterval, supported := bittrexTickIntervals[interval]
+	if !supported {
+		return nil, fmt.Errorf("Candle interval %s not supported by Bittrex", interval)
+	}
+
+	bittrexCandles, err := bittrex.GetTicks(MarketNameFor(market, wrapper), tickInterval)
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	ret := make([]environment.CandleStick, len(bittrexCandles))
 
 	for i, bittrexCandle := range bittrexCandles {
 		ret[i] = environment.CandleStick{
-			High:   bittrexCandle.High,
-			Open:   bittrexCandle.Open,
-			Close:  bittrexCandle.Close,
-			Low:    bittrexCandle.Low,
-			Volume: bittrexCandle.BaseVolume,
+			OpenTime: time.Time(bittrexCandle.Timestamp),
+			High:     bittrexCandle.High,
+			Open:     bittrexCandle.Open,
+			Close:    bittrexCandle.Close,
+			Low:      bittrexCandle.Low,
+			Volume:   bittrexCandle.BaseVolume,
 		}
 	}
 
-	return ret, nil
+	return filterCandles(ret, from, to), nil
 }
 
 // GetBalance gets the balance of the user of the specified currency.
 func (wrapper *BittrexWrapperV2) GetBalance(symbol string) (*decimal.Decimal, error) {
-	panic("Not Implemented")
+	balance, err := wrapper.api.GetBalance(symbol)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	return &balance.Available, nil
+}
+
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+func (wrapper *BittrexWrapperV2) GetBalances() (map[string]environment.Balance, error) {
+	bittrexBalances, err := wrapper.api.GetBalances()
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make(map[string]environment.Balance, len(bittrexBalances))
+	for _, bittrexBalance := range bittrexBalances {
+		ret[bittrexBalance.CurrencySymbol] = newBalance(bittrexBalance.Available, bittrexBalance.Total.Sub(bittrexBalance.Available))
+	}
+	return ret, nil
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -151,22 +374,22 @@ func (wrapper *BittrexWrapperV2) GetDepositAddress(coinTicker string) (string, b
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
 //
 //     NOTE: In Bittrex fees are hardcoded due to the inability to obtain them via API before placing an order.
-func (wrapper *BittrexWrapperV2) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
-	var feePercentage float64
+func (wrapper *BittrexWrapperV2) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *BittrexWrapperV2) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *BittrexWrapperV2) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
 }
 
 // FeedConnect connects to the feed of the exchange.
@@ -177,6 +400,122 @@ func (wrapper *BittrexWrapperV2) FeedConnect(markets []*environment.Market) erro
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *BittrexWrapperV2) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	panic("Not Implemented")
+func (wrapper *BittrexWrapperV2) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	_, err := wrapper.api.Withdraw(destinationAddress, coinTicker, amount, "golang-crypto-trading-bot")
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+	return nil
+}
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return callContext(ctx, func() ([]environment.CandleStick, error) {
+		return wrapper.GetCandles(market, interval, from, to)
+	})
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return callContext(ctx, func() (*environment.MarketSummary, error) {
+		return wrapper.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return callContext(ctx, func() (*environment.OrderBook, error) {
+		return wrapper.GetOrderBook(market)
+	})
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return callContext(ctx, func() ([]environment.Trade, error) {
+		return wrapper.GetRecentTrades(market)
+	})
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapperV2) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapperV2) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapperV2) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyMarket(market, amount)
+	})
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapperV2) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellMarket(market, amount)
+	})
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return callContext(ctx, func() (*environment.OrderStatus, error) {
+		return wrapper.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return callContext(ctx, func() ([]environment.OrderStatus, error) {
+		return wrapper.GetOpenOrders(market)
+	})
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelAllOrders(market)
+	})
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	return callContext(ctx, func() (*decimal.Decimal, error) {
+		return wrapper.GetBalance(symbol)
+	})
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return callContext(ctx, func() (map[string]environment.Balance, error) {
+		return wrapper.GetBalances()
+	})
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *BittrexWrapperV2) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.FeedConnect(markets)
+	})
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *BittrexWrapperV2) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return sendContextErr(ctx, func() error {
+		return wrapper.Withdraw(destinationAddress, coinTicker, amount)
+	})
 }
@@ -1,30 +1,54 @@
 package exchanges
 
 import (
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/sirupsen/logrus"
 )
 
+// marketKey identifies a market in the caches and feeds of a wrapper, independently of the *environment.Market instance describing it.
+type marketKey string
+
+// keyOf gets the identity of a market.
+func keyOf(market *environment.Market) marketKey {
+	return marketKey(market.Name)
+}
+
+// checkAge returns an ErrStaleData if the data of a market updated at the specified time is older than maxAge, not positive means no limit.
+func checkAge(what string, market *environment.Market, updated time.Time, maxAge time.Duration) error {
+	if age := time.Since(updated); maxAge > 0 && age > maxAge {
+		return fmt.Errorf("%w: %s of %s updated %s ago", ErrStaleData, what, market.Name, age.Round(time.Second))
+	}
+	return nil
+}
+
 // SummaryCache represents a local summary cache for every exchange. To allow dinamic polling from multiple sources (REST + Websocket)
 type SummaryCache struct {
 	mutex    *sync.RWMutex
-	internal map[*environment.Market]*environment.MarketSummary
+	internal map[marketKey]*environment.MarketSummary
+	updated  map[marketKey]time.Time
 }
 
 // NewSummaryCache creates a new SummaryCache Object
 func NewSummaryCache() *SummaryCache {
 	return &SummaryCache{
 		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market]*environment.MarketSummary),
+		internal: make(map[marketKey]*environment.MarketSummary),
+		updated:  make(map[marketKey]time.Time),
 	}
 }
 
 // Set sets a value for the specified key.
 func (sc *SummaryCache) Set(market *environment.Market, summary *environment.MarketSummary) *environment.MarketSummary {
 	sc.mutex.Lock()
-	old := sc.internal[market]
-	sc.internal[market] = summary
+	key := keyOf(market)
+	old := sc.internal[key]
+	sc.internal[key] = summary
+	sc.updated[key] = time.Now()
 	sc.mutex.Unlock()
 	return old
 }
@@ -32,61 +56,158 @@ func (sc *SummaryCache) Set(market *environment.Market, summary *environment.Mar
 // Get gets the value for the specified key.
 func (sc *SummaryCache) Get(market *environment.Market) (*environment.MarketSummary, bool) {
 	sc.mutex.RLock()
-	ret, isSet := sc.internal[market]
+	ret, isSet := sc.internal[keyOf(market)]
 	sc.mutex.RUnlock()
 	return ret, isSet
 }
 
-// CandlesCache represents a local candles cache for every exchange. To allow dinamic polling from multiple sources (REST + Websocket)
+// UpdatedAt gets the time the value for the specified key was set.
+func (sc *SummaryCache) UpdatedAt(market *environment.Market) (time.Time, bool) {
+	sc.mutex.RLock()
+	ret, isSet := sc.updated[keyOf(market)]
+	sc.mutex.RUnlock()
+	return ret, isSet
+}
+
+// GetFresh gets the value for the specified key, failing with ErrStaleData if it was set more than maxAge ago (not positive means no limit).
+func (sc *SummaryCache) GetFresh(market *environment.Market, maxAge time.Duration) (*environment.MarketSummary, error) {
+	sc.mutex.RLock()
+	key := keyOf(market)
+	ret, isSet := sc.internal[key]
+	updated := sc.updated[key]
+	sc.mutex.RUnlock()
+
+	if !isSet {
+		return nil, fmt.Errorf("Summary of %s not loaded", market.Name)
+	}
+	if err := checkAge("summary", market, updated, maxAge); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// CandlesCache represents a local candles cache for every exchange, keyed by market and candle interval. To allow dinamic polling from multiple sources (REST + Websocket)
 type CandlesCache struct {
 	mutex    *sync.RWMutex
-	internal map[*environment.Market][]environment.CandleStick
+	internal map[candlesKey][]environment.CandleStick
+	updated  map[candlesKey]time.Time
+}
+
+// candlesKey represents the key of the candles of a market with a specified interval.
+type candlesKey struct {
+	market   marketKey
+	interval environment.CandleInterval
 }
 
 // NewCandlesCache creates a new CandlesCache Object
 func NewCandlesCache() *CandlesCache {
 	return &CandlesCache{
 		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market][]environment.CandleStick),
+		internal: make(map[candlesKey][]environment.CandleStick),
+		updated:  make(map[candlesKey]time.Time),
 	}
 }
 
 // Set sets a value for the specified key.
-func (cc *CandlesCache) Set(market *environment.Market, candles []environment.CandleStick) []environment.CandleStick {
+func (cc *CandlesCache) Set(market *environment.Market, interval environment.CandleInterval, candles []environment.CandleStick) []environment.CandleStick {
 	cc.mutex.Lock()
-	old := cc.internal[market]
-	cc.internal[market] = candles
+	key := candlesKey{keyOf(market), interval}
+	old := cc.internal[key]
+	cc.internal[key] = candles
+	cc.updated[key] = time.Now()
 	cc.mutex.Unlock()
 	return old
 }
 
 // Get gets the value for the specified key.
-func (cc *CandlesCache) Get(market *environment.Market) ([]environment.CandleStick, bool) {
+func (cc *CandlesCache) Get(market *environment.Market, interval environment.CandleInterval) ([]environment.CandleStick, bool) {
+	cc.mutex.RLock()
+	ret, isSet := cc.internal[candlesKey{keyOf(market), interval}]
+	cc.mutex.RUnlock()
+	return ret, isSet
+}
+
+// UpdatedAt gets the time the value for the specified key was set or merged.
+func (cc *CandlesCache) UpdatedAt(market *environment.Market, interval environment.CandleInterval) (time.Time, bool) {
 	cc.mutex.RLock()
-	ret, isSet := cc.internal[market]
+	ret, isSet := cc.updated[candlesKey{keyOf(market), interval}]
 	cc.mutex.RUnlock()
 	return ret, isSet
 }
 
+// GetFresh gets the value for the specified key, failing with ErrStaleData if it was updated more than maxAge ago (not positive means no limit).
+func (cc *CandlesCache) GetFresh(market *environment.Market, interval environment.CandleInterval, maxAge time.Duration) ([]environment.CandleStick, error) {
+	cc.mutex.RLock()
+	key := candlesKey{keyOf(market), interval}
+	ret, isSet := cc.internal[key]
+	updated := cc.updated[key]
+	cc.mutex.RUnlock()
+
+	if !isSet {
+		return nil, fmt.Errorf("No %s candle data of %s yet", interval, market.Name)
+	}
+	if err := checkAge(string(interval)+" candles", market, updated, maxAge); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Merge adds the candles to the ones set for the specified key, replacing the ones with the same open time.
+func (cc *CandlesCache) Merge(market *environment.Market, interval environment.CandleInterval, candles []environment.CandleStick) []environment.CandleStick {
+	cc.mutex.Lock()
+	key := candlesKey{keyOf(market), interval}
+	merged := mergeCandles(cc.internal[key], candles)
+	cc.internal[key] = merged
+	cc.updated[key] = time.Now()
+	cc.mutex.Unlock()
+	return merged
+}
+
+// mergeCandles merges two lists of candles sorted by open time, preferring the updates on the same open time.
+func mergeCandles(candles []environment.CandleStick, updates []environment.CandleStick) []environment.CandleStick {
+	ret := make([]environment.CandleStick, 0, len(candles)+len(updates))
+	i, j := 0, 0
+	for i < len(candles) && j < len(updates) {
+		switch {
+		case candles[i].OpenTime.Before(updates[j].OpenTime):
+			ret = append(ret, candles[i])
+			i++
+		case updates[j].OpenTime.Before(candles[i].OpenTime):
+			ret = append(ret, updates[j])
+			j++
+		default:
+			ret = append(ret, updates[j])
+			i++
+			j++
+		}
+	}
+	ret = append(ret, candles[i:]...)
+	return append(ret, updates[j:]...)
+}
+
 // OrderbookCache represents a local orderbook cache for every exchange. To allow dinamic polling from multiple sources (REST + Websocket)
 type OrderbookCache struct {
 	mutex    *sync.RWMutex
-	internal map[*environment.Market]*environment.OrderBook
+	internal map[marketKey]*environment.OrderBook
+	updated  map[marketKey]time.Time
 }
 
 // NewOrderbookCache creates a new OrderbookCache Object
 func NewOrderbookCache() *OrderbookCache {
 	return &OrderbookCache{
 		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market]*environment.OrderBook),
+		internal: make(map[marketKey]*environment.OrderBook),
+		updated:  make(map[marketKey]time.Time),
 	}
 }
 
 // Set sets a value for the specified key.
 func (cc *OrderbookCache) Set(market *environment.Market, book *environment.OrderBook) *environment.OrderBook {
 	cc.mutex.Lock()
-	old := cc.internal[market]
-	cc.internal[market] = book
+	key := keyOf(market)
+	old := cc.internal[key]
+	cc.internal[key] = book
+	cc.updated[key] = time.Now()
 	cc.mutex.Unlock()
 	return old
 }
@@ -94,7 +215,220 @@ func (cc *OrderbookCache) Set(market *environment.Market, book *environment.Orde
 // Get gets the value for the specified key.
 func (cc *OrderbookCache) Get(market *environment.Market) (*environment.OrderBook, bool) {
 	cc.mutex.RLock()
-	ret, isSet := cc.internal[market]
+	ret, isSet := cc.internal[keyOf(market)]
+	cc.mutex.RUnlock()
+	return ret, isSet
+}
+
+// UpdatedAt gets the time the value for the specified key was set.
+func (cc *OrderbookCache) UpdatedAt(market *environment.Market) (time.Time, bool) {
+	cc.mutex.RLock()
+	ret, isSet := cc.updated[keyOf(market)]
 	cc.mutex.RUnlock()
 	return ret, isSet
 }
+
+// GetFresh gets the value for the specified key, failing with ErrStaleData if it was set more than maxAge ago (not positive means no limit).
+func (cc *OrderbookCache) GetFresh(market *environment.Market, maxAge time.Duration) (*environment.OrderBook, error) {
+	cc.mutex.RLock()
+	key := keyOf(market)
+	ret, isSet := cc.internal[key]
+	updated := cc.updated[key]
+	cc.mutex.RUnlock()
+
+	if !isSet {
+		return nil, fmt.Errorf("Orderbook of %s not loaded", market.Name)
+	}
+	if err := checkAge("orderbook", market, updated, maxAge); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// tradesCacheSize is the max number of trades kept per market by a TradesCache.
+const tradesCacheSize = 1000
+
+// TradesCache represents a local cache of the recent trades of every market, loaded from the REST API and extended by the websocket feeds.
+type TradesCache struct {
+	mutex    *sync.RWMutex
+	internal map[marketKey][]environment.Trade
+	loaded   map[marketKey]bool
+}
+
+// NewTradesCache creates a new TradesCache Object
+func NewTradesCache() *TradesCache {
+	return &TradesCache{
+		mutex:    &sync.RWMutex{},
+		internal: make(map[marketKey][]environment.Trade),
+		loaded:   make(map[marketKey]bool),
+	}
+}
+
+// Load merges the trades got from the REST API with the ones of the specified key, marking it as loaded.
+func (tc *TradesCache) Load(market *environment.Market, trades []environment.Trade) []environment.Trade {
+	tc.mutex.Lock()
+	key := keyOf(market)
+	merged := mergeTrades(tc.internal[key], trades)
+	tc.internal[key] = merged
+	tc.loaded[key] = true
+	tc.mutex.Unlock()
+	return merged
+}
+
+// Add adds the trades received from a websocket feed to the ones of the specified key.
+func (tc *TradesCache) Add(market *environment.Market, trades ...environment.Trade) {
+	tc.mutex.Lock()
+	key := keyOf(market)
+	tc.internal[key] = mergeTrades(tc.internal[key], trades)
+	tc.mutex.Unlock()
+}
+
+// Get gets the trades for the specified key, if loaded from the REST API.
+func (tc *TradesCache) Get(market *environment.Market) ([]environment.Trade, bool) {
+	tc.mutex.RLock()
+	key := keyOf(market)
+	ret, isLoaded := tc.internal[key], tc.loaded[key]
+	tc.mutex.RUnlock()
+	return ret, isLoaded
+}
+
+// Reset drops the trades of the specified keys, so that they are loaded again from the REST API.
+//
+// The feeds reset their markets when they (re)connect, since the trades executed while disconnected are missing.
+func (tc *TradesCache) Reset(markets []*environment.Market) {
+	tc.mutex.Lock()
+	for _, market := range markets {
+		key := keyOf(market)
+		delete(tc.internal, key)
+		delete(tc.loaded, key)
+	}
+	tc.mutex.Unlock()
+}
+
+// mergeTrades merges two lists of trades sorted by time, dropping the duplicates and keeping the most recent tradesCacheSize trades.
+func mergeTrades(trades []environment.Trade, updates []environment.Trade) []environment.Trade {
+	ret := make([]environment.Trade, len(trades), len(trades)+len(updates))
+	copy(ret, trades)
+	for _, update := range updates {
+		if !containsTrade(ret, update) {
+			ret = append(ret, update)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+
+	if len(ret) > tradesCacheSize {
+		ret = ret[len(ret)-tradesCacheSize:]
+	}
+	return ret
+}
+
+// containsTrade returns true if the trades contain the specified one, identified by its ID or, if not published by both, by all its fields.
+func containsTrade(trades []environment.Trade, trade environment.Trade) bool {
+	for i := len(trades) - 1; i >= 0; i-- {
+		if trade.ID != "" && trades[i].ID != "" {
+			if trades[i].ID == trade.ID {
+				return true
+			}
+			continue
+		}
+		if trades[i].Time.Equal(trade.Time) && trades[i].Side == trade.Side &&
+			trades[i].Price.Equal(trade.Price) && trades[i].Quantity.Equal(trade.Quantity) {
+			return true
+		}
+	}
+	return false
+}
+
+// marketInfoMaxAge is the time the trading rules of the markets are served from the cache before being reloaded.
+const marketInfoMaxAge = time.Hour
+
+// marketInfoRetryDelay is the time a failed load of the trading rules is reported before being retried.
+const marketInfoRetryDelay = 30 * time.Second
+
+// MarketInfoCache represents a local cache of the trading rules of the markets of an exchange, reloaded from its markets list every marketInfoMaxAge.
+//
+//     NOTE: when a reload fails the rules loaded last keep being served until the next attempt.
+//     Expired rules are reloaded in background, served as they are meanwhile: only the first load is waited for,
+//     and concurrent calls wait for the pending load instead of performing their own.
+type MarketInfoCache struct {
+	mutex    *sync.Mutex
+	internal map[string]environment.MarketInfo
+	loaded   time.Time
+	lastErr  error         // error of the last load, nil if succeeded.
+	failed   time.Time     // time of the last failed load.
+	pending  chan struct{} // closed when the pending load ends, nil if none.
+	load     func() ([]*environment.Market, error)
+}
+
+// NewMarketInfoCache creates a new MarketInfoCache Object, which loads the trading rules using the specified function.
+func NewMarketInfoCache(load func() ([]*environment.Market, error)) *MarketInfoCache {
+	return &MarketInfoCache{
+		mutex: &sync.Mutex{},
+		load:  load,
+	}
+}
+
+// Get gets the trading rules of the market with the specified exchange name, loading them on first use and when expired.
+//
+// A market without known rules gets a zero MarketInfo.
+func (mc *MarketInfoCache) Get(marketName string) (environment.MarketInfo, error) {
+	mc.mutex.Lock()
+	for mc.internal == nil && mc.pending != nil {
+		pending := mc.pending
+		mc.mutex.Unlock()
+		<-pending // bounded by the timeout of the requests of the wrapper.
+		mc.mutex.Lock()
+	}
+	defer mc.mutex.Unlock()
+
+	expired := mc.internal == nil || time.Since(mc.loaded) >= marketInfoMaxAge
+	retry := mc.lastErr == nil || time.Since(mc.failed) >= marketInfoRetryDelay
+	if expired && retry && mc.pending == nil {
+		pending := make(chan struct{})
+		mc.pending = pending
+		if mc.internal != nil {
+			go mc.reload(pending)
+		} else {
+			mc.mutex.Unlock()
+			mc.reload(pending)
+			mc.mutex.Lock()
+		}
+	}
+
+	if mc.internal == nil {
+		return environment.MarketInfo{}, mc.lastErr
+	}
+	return mc.internal[marketName], nil
+}
+
+// reload loads the trading rules of all the markets without holding the lock, keeping the ones loaded last if it fails,
+// then closes pending.
+func (mc *MarketInfoCache) reload(pending chan struct{}) {
+	markets, err := mc.load()
+
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	mc.pending = nil
+	close(pending)
+
+	if err != nil {
+		if mc.internal != nil {
+			logrus.Warnf("Cannot reload the trading rules of the markets, using the ones loaded %s ago: %s", time.Since(mc.loaded).Round(time.Second), err)
+		}
+		mc.lastErr = err
+		mc.failed = time.Now()
+		return
+	}
+
+	internal := make(map[string]environment.MarketInfo, len(markets))
+	for _, market := range markets {
+		if market.Info != nil {
+			internal[market.Name] = *market.Info
+		}
+	}
+	mc.internal = internal
+	mc.loaded = time.Now()
+	mc.lastErr = nil
+}
@@ -0,0 +1,66 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capabilities represents the operations supported by a wrapper, the ones not supported fail with ErrNotSupported.
+//
+// Strategies use it to declare the operations they need.
+type Capabilities struct {
+	WebsocketFeeds bool //FeedConnect keeps the market summaries and order books updated.
+	Candles        bool //GetCandles is supported.
+	Trades         bool //GetRecentTrades is supported.
+	LimitOrders    bool //BuyLimit and SellLimit are supported.
+	MarketOrders   bool //BuyMarket and SellMarket are supported.
+	StopOrders     bool //Stop orders are supported.
+	Withdraw       bool //Withdraw is supported.
+	TradingFees    bool //CalculateTradingFees is supported.
+	WithdrawFees   bool //CalculateWithdrawFees is supported.
+	OrderQuery     bool //GetOrder and GetOpenOrders are supported.
+	AccountStream  bool //SubscribeAccount sends every order update and fill of the user, from a private stream.
+}
+
+// Missing gets the names of the required capabilities not in the capabilities.
+func (c Capabilities) Missing(required Capabilities) []string {
+	var missing []string
+	check := func(name string, has bool, needs bool) {
+		if needs && !has {
+			missing = append(missing, name)
+		}
+	}
+
+	check("websocket feeds", c.WebsocketFeeds, required.WebsocketFeeds)
+	check("candles", c.Candles, required.Candles)
+	check("trades", c.Trades, required.Trades)
+	check("limit orders", c.LimitOrders, required.LimitOrders)
+	check("market orders", c.MarketOrders, required.MarketOrders)
+	check("stop orders", c.StopOrders, required.StopOrders)
+	check("withdraw", c.Withdraw, required.Withdraw)
+	check("trading fees", c.TradingFees, required.TradingFees)
+	check("withdraw fees", c.WithdrawFees, required.WithdrawFees)
+	check("order query", c.OrderQuery, required.OrderQuery)
+	check("account stream", c.AccountStream, required.AccountStream)
+	return missing
+}
+
+// String returns a string representation of the object.
+func (c Capabilities) String() string {
+	return fmt.Sprintf("[%s]", strings.Join(Capabilities{}.Missing(c), ", "))
+}
@@ -0,0 +1,271 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+// ContextExchangeWrapper provides a context-aware variant of ExchangeWrapper.
+//
+// Every call returns as soon as the context is canceled or its deadline expires,
+// except for order placements and withdrawals.
+//
+//     NOTE: a call returning because its context is done may still complete on the exchange,
+//     e.g. a cancel may be executed after the caller got the error: the request is left running
+//     in background, bounded only by the timeout of the HTTP client of the adapter.
+//     Order placements and withdrawals are not sent if the context is already done,
+//     once sent they wait for the response of the exchange whatever happens to the context
+//     (up to the timeout of the HTTP client): an interrupted request could still be executed,
+//     leaving an order the caller knows nothing of.
+type ContextExchangeWrapper interface {
+	ExchangeWrapper
+
+	GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) // Gets the candles of a market opened in the [from, to) time range.
+	GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error)                                                             // Gets the current market summary.
+	GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error)                                                                     // Gets the order(ASK + BID) book of a market.
+	GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error)                                                                     // Gets the most recent trades of a market, sorted by time.
+
+	BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error)  // Performs a limit buy action.
+	SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) // Performs a limit sell action.
+	BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error)                        // Performs a market buy action.
+	SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error)                       // Performs a market sell action.
+
+	GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) // Gets the status of an order placed on the exchange.
+	GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error)           // Gets the open orders of the user on a market.
+	CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error                          // Cancels an open order.
+	CancelAllOrdersContext(ctx context.Context, market *environment.Market) error                                      // Cancels all the open orders of the user on a market.
+
+	GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) // Gets the balance of the user of the specified currency.
+	GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) // Gets the free, locked and total balances of the user of all the currencies, by currency.
+
+	FeedConnectContext(ctx context.Context, markets []*environment.Market) error // Connects to the feed of the exchange, ctx only bounds the connection phase.
+
+	WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error // Performs a withdraw operation from the exchange to a destination address.
+}
+
+// BindContext returns a wrapper which performs every call of the specified wrapper using ctx.
+//
+// If the wrapper is not context-aware it is returned as is.
+func BindContext(ctx context.Context, wrapper ExchangeWrapper) ExchangeWrapper {
+	contextWrapper, isContextAware := wrapper.(ContextExchangeWrapper)
+	if !isContextAware {
+		return wrapper
+	}
+	return &contextBoundWrapper{
+		ContextExchangeWrapper: contextWrapper,
+		ctx:                    ctx,
+	}
+}
+
+// BindContextAll binds ctx to all the specified wrappers.
+func BindContextAll(ctx context.Context, wrappers []ExchangeWrapper) []ExchangeWrapper {
+	ret := make([]ExchangeWrapper, len(wrappers))
+	for i, wrapper := range wrappers {
+		ret[i] = BindContext(ctx, wrapper)
+	}
+	return ret
+}
+
+// contextBoundWrapper is an ExchangeWrapper which uses a fixed context for every call.
+type contextBoundWrapper struct {
+	ContextExchangeWrapper
+	ctx context.Context
+}
+
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+func (wrapper *contextBoundWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.GetCandlesContext(wrapper.ctx, market, interval, from, to)
+}
+
+// GetMarketSummary gets the current market summary.
+func (wrapper *contextBoundWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	return wrapper.GetMarketSummaryContext(wrapper.ctx, market)
+}
+
+// GetOrderBook gets the order(ASK + BID) book of a market.
+func (wrapper *contextBoundWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	return wrapper.GetOrderBookContext(wrapper.ctx, market)
+}
+
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+func (wrapper *contextBoundWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.GetRecentTradesContext(wrapper.ctx, market)
+}
+
+// BuyLimit performs a limit buy action.
+func (wrapper *contextBoundWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.BuyLimitContext(wrapper.ctx, market, amount, limit)
+}
+
+// SellLimit performs a limit sell action.
+func (wrapper *contextBoundWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.SellLimitContext(wrapper.ctx, market, amount, limit)
+}
+
+// BuyMarket performs a market buy action.
+func (wrapper *contextBoundWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.BuyMarketContext(wrapper.ctx, market, amount)
+}
+
+// SellMarket performs a market sell action.
+func (wrapper *contextBoundWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.SellMarketContext(wrapper.ctx, market, amount)
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *contextBoundWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return wrapper.GetOrderContext(wrapper.ctx, market, orderID)
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+func (wrapper *contextBoundWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	return wrapper.GetOpenOrdersContext(wrapper.ctx, market)
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *contextBoundWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	return wrapper.CancelOrderContext(wrapper.ctx, market, orderID)
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *contextBoundWrapper) CancelAllOrders(market *environment.Market) error {
+	return wrapper.CancelAllOrdersContext(wrapper.ctx, market)
+}
+
+// GetBalance gets the balance of the user of the specified currency.
+func (wrapper *contextBoundWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	return wrapper.GetBalanceContext(wrapper.ctx, symbol)
+}
+
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+func (wrapper *contextBoundWrapper) GetBalances() (map[string]environment.Balance, error) {
+	return wrapper.GetBalancesContext(wrapper.ctx)
+}
+
+// FeedConnect connects to the feed of the exchange.
+func (wrapper *contextBoundWrapper) FeedConnect(markets []*environment.Market) error {
+	return wrapper.FeedConnectContext(wrapper.ctx, markets)
+}
+
+// GetMarketInfo gets the trading rules of a market from the bound wrapper, if it knows them.
+func (wrapper *contextBoundWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	provider, hasRules := wrapper.ContextExchangeWrapper.(MarketInfoProvider)
+	if !hasRules {
+		return environment.MarketInfo{}, nil
+	}
+	return callContext(wrapper.ctx, func() (environment.MarketInfo, error) {
+		return provider.GetMarketInfo(market)
+	})
+}
+
+// SetMaxDataAge sets the max age of the data cached by the bound wrapper, if it limits it.
+func (wrapper *contextBoundWrapper) SetMaxDataAge(maxAge time.Duration) {
+	if limiter, isLimiter := wrapper.ContextExchangeWrapper.(DataAgeLimiter); isLimiter {
+		limiter.SetMaxDataAge(maxAge)
+	}
+}
+
+// SetOrderBookDepth sets the max number of price levels of the order books maintained by the bound wrapper, if it maintains them.
+func (wrapper *contextBoundWrapper) SetOrderBookDepth(depth int) {
+	if limiter, isLimiter := wrapper.ContextExchangeWrapper.(OrderBookDepthLimiter); isLimiter {
+		limiter.SetOrderBookDepth(depth)
+	}
+}
+
+// FeedStatus gets the status of the websocket feeds of the bound wrapper.
+func (wrapper *contextBoundWrapper) FeedStatus() []FeedStatus {
+	return FeedStatusOf(wrapper.ContextExchangeWrapper)
+}
+
+// FeedRelease releases a subscription to the feed of the markets of the bound wrapper.
+func (wrapper *contextBoundWrapper) FeedRelease(markets []*environment.Market) {
+	ReleaseFeed(wrapper.ContextExchangeWrapper, markets)
+}
+
+// FeedClose releases all the subscriptions to the feed of the markets of the bound wrapper.
+func (wrapper *contextBoundWrapper) FeedClose(markets []*environment.Market) {
+	CloseFeed(wrapper.ContextExchangeWrapper, markets)
+}
+
+// SubscribeAccount subscribes a handler to the events of the account on the markets of the bound wrapper, the subscription is not bound to ctx.
+func (wrapper *contextBoundWrapper) SubscribeAccount(markets []*environment.Market, handler func(environment.AccountEvent)) (func(), error) {
+	return SubscribeAccount(wrapper.ContextExchangeWrapper, markets, handler)
+}
+
+// Withdraw performs a withdraw operation from the exchange to a destination address.
+func (wrapper *contextBoundWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return wrapper.WithdrawContext(wrapper.ctx, destinationAddress, coinTicker, amount)
+}
+
+// callContext performs a blocking call, returning ctx.Err() as soon as ctx is done.
+//
+// Used to give context support to the clients which do not have it: the call keeps running
+// in background until the HTTP client of the adapter gives up, its outcome is discarded.
+func callContext[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case res := <-done:
+		return res.value, res.err
+	}
+}
+
+// callContextErr is like callContext, for calls returning only an error.
+func callContextErr(ctx context.Context, call func() error) error {
+	_, err := callContext(ctx, func() (struct{}, error) {
+		return struct{}{}, call()
+	})
+	return err
+}
+
+// sendContext performs a call which cannot be undone once sent (order placements, withdrawals)
+// if ctx is not done yet, then waits for its outcome whatever happens to ctx.
+func sendContext[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	return call()
+}
+
+// sendContextErr is like sendContext, for calls returning only an error.
+func sendContextErr(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return call()
+}
@@ -0,0 +1,232 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// The kinds of errors returned by the wrappers, to be checked with errors.Is.
+var (
+	// ErrNotSupported is the error representing an operation not supported by an exchange (or by its wrapper).
+	ErrNotSupported = errors.New("Operation not supported")
+	// ErrInsufficientFunds is the error representing a balance not enough to perform an operation.
+	ErrInsufficientFunds = errors.New("Insufficient funds")
+	// ErrRateLimited is the error representing a request refused because of the rate limits of an exchange.
+	ErrRateLimited = errors.New("Rate limited")
+	// ErrInvalidOrder is the error representing an order refused because of its parameters (e.g. below the minimum size).
+	ErrInvalidOrder = errors.New("Invalid order")
+	// ErrAuth is the error representing a request refused because of missing or wrong API credentials.
+	ErrAuth = errors.New("Authentication failed")
+	// ErrNetwork is the error representing a failure in the communication with an exchange.
+	ErrNetwork = errors.New("Network error")
+	// ErrStaleData is the error representing cached data, kept updated by a websocket feed, older than the max age allowed.
+	ErrStaleData = errors.New("Stale data")
+)
+
+// errorKinds represents all the kinds of errors.
+var errorKinds = []error{ErrNotSupported, ErrInsufficientFunds, ErrRateLimited, ErrInvalidOrder, ErrAuth, ErrNetwork, ErrStaleData}
+
+// errorKindMarkers represents the (lowercase) fragments of the error messages of the exchanges identifying each kind of error,
+// used for the exchanges whose errors have no code.
+//
+//     NOTE: the fragments must not match messages of other kinds, a bare word like "minimum" or "timeout" is not enough.
+var errorKindMarkers = []struct {
+	kind    error
+	markers []string
+}{
+	{ErrRateLimited, []string{"rate limit", "too many requests", "ddos", "request limit", "throttl"}},
+	{ErrInsufficientFunds, []string{"insufficient funds", "insufficient balance", "not enough funds", "not enough balance", "not enough exchange balance", "exceeds balance", "balance too low"}},
+	{ErrAuth, []string{"invalid api key", "invalid apikey", "invalid api-key", "invalid key", "invalid signature", "signature mismatch", "invalid nonce", "permission denied", "unauthorized", "invalid credentials"}},
+	{ErrInvalidOrder, []string{"min_trade", "minimum order", "order minimum", "minimum size", "total must be at least", "below the minimum", "lot_size", "price_filter", "min_notional", "minimum notional", "invalid quantity", "invalid price", "invalid amount", "too much precision", "invalid precision", "order size"}},
+	{ErrNetwork, []string{"connection refused", "connection reset", "no such host", "broken pipe", "bad gateway", "gateway timeout", "service unavailable"}},
+}
+
+// binanceErrorKinds maps the Binance API error codes to the kinds of errors.
+var binanceErrorKinds = map[int64]error{
+	-1003: ErrRateLimited,  // TOO_MANY_REQUESTS
+	-1015: ErrRateLimited,  // TOO_MANY_ORDERS
+	-1002: ErrAuth,         // UNAUTHORIZED
+	-1022: ErrAuth,         // INVALID_SIGNATURE
+	-2014: ErrAuth,         // BAD_API_KEY_FMT
+	-2015: ErrAuth,         // REJECTED_MBX_KEY
+	-1013: ErrInvalidOrder, // INVALID_MESSAGE (filter failures)
+	-1100: ErrInvalidOrder, // ILLEGAL_CHARS
+	-1111: ErrInvalidOrder, // BAD_PRECISION
+	-1116: ErrInvalidOrder, // INVALID_ORDER_TYPE
+	-1117: ErrInvalidOrder, // INVALID_SIDE
+}
+
+// hitbtcErrorKinds maps the HitBTC API error codes to the kinds of errors.
+var hitbtcErrorKinds = map[int]error{
+	429:   ErrRateLimited,       // Too many requests
+	503:   ErrNetwork,           // Service unavailable
+	504:   ErrNetwork,           // Gateway timeout
+	1001:  ErrAuth,              // Authorization required
+	1002:  ErrAuth,              // Authorization failed
+	1003:  ErrAuth,              // Action is forbidden for this API key
+	1004:  ErrAuth,              // Unsupported authorization method
+	2010:  ErrInvalidOrder,      // Quantity not a valid number
+	2011:  ErrInvalidOrder,      // Quantity too low
+	2012:  ErrInvalidOrder,      // Bad quantity
+	2020:  ErrInvalidOrder,      // Price not a valid number
+	2021:  ErrInvalidOrder,      // Price too low
+	2022:  ErrInvalidOrder,      // Bad price
+	20001: ErrInsufficientFunds, // Insufficient funds
+}
+
+// bittrexErrorKinds maps the Bittrex v3 API error codes, sent in the error messages, to the kinds of errors.
+var bittrexErrorKinds = map[string]error{
+	"TOO_MANY_REQUESTS":                ErrRateLimited,
+	"APIKEY_INVALID":                   ErrAuth,
+	"INVALID_SIGNATURE":                ErrAuth,
+	"UNAUTHORIZED":                     ErrAuth,
+	"INSUFFICIENT_FUNDS":               ErrInsufficientFunds,
+	"MIN_TRADE_REQUIREMENT_NOT_MET":    ErrInvalidOrder,
+	"DUST_TRADE_DISALLOWED_MIN_VALUE":  ErrInvalidOrder,
+	"ORDER_TRADE_SIZE_EXCEEDS_MAXIMUM": ErrInvalidOrder,
+}
+
+// krakenErrorKinds maps the Kraken API error codes, sent in the error messages, to the kinds of errors.
+var krakenErrorKinds = map[string]error{
+	"EAPI:Rate limit exceeded":     ErrRateLimited,
+	"EOrder:Rate limit exceeded":   ErrRateLimited,
+	"EGeneral:Too many requests":   ErrRateLimited,
+	"EAPI:Invalid key":             ErrAuth,
+	"EAPI:Invalid signature":       ErrAuth,
+	"EAPI:Invalid nonce":           ErrAuth,
+	"EGeneral:Permission denied":   ErrAuth,
+	"EOrder:Insufficient funds":    ErrInsufficientFunds,
+	"EFunding:Insufficient funds":  ErrInsufficientFunds,
+	"EOrder:Order minimum not met": ErrInvalidOrder,
+	"EOrder:Invalid price":         ErrInvalidOrder,
+	"EService:Unavailable":         ErrNetwork,
+	"EService:Busy":                ErrNetwork,
+}
+
+// kindError represents an error of a kind which keeps the message of the original error.
+type kindError struct {
+	kind error
+	err  error
+}
+
+// withKind marks an error as of the specified kind, keeping its message.
+func withKind(kind error, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+// Is returns true if target is the kind of the error.
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Unwrap returns the original error.
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// notSupported gets the error returned by a wrapper for an operation it does not support.
+func notSupported(wrapper ExchangeWrapper, operation string) error {
+	return fmt.Errorf("%w: %s on %s", ErrNotSupported, operation, wrapper.Name())
+}
+
+// mapError maps an error returned by the client of an exchange into the kinds of errors of the wrappers.
+//
+// The mapped error wraps both its kind and the original error: errors.Is matches either,
+// errors.As still gets the error of the client (e.g. the code of a Binance *common.APIError).
+//
+//     NOTE: errors already of a kind, context errors and errors not recognized are returned as they are.
+func mapError(wrapper ExchangeWrapper, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+
+	kind := errorKindOf(err)
+	if kind == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %w", kind, wrapper.Name(), err)
+}
+
+// errorKindOf gets the kind of an error returned by the client of an exchange, or nil if not recognized.
+func errorKindOf(err error) error {
+	var binanceErr *common.APIError
+	if errors.As(err, &binanceErr) {
+		if kind, known := binanceErrorKinds[binanceErr.Code]; known {
+			return kind
+		}
+	}
+
+	var hitbtcErr *hitbtcError
+	if errors.As(err, &hitbtcErr) {
+		if kind, known := hitbtcErrorKinds[hitbtcErr.Code]; known {
+			return kind
+		}
+	}
+
+	for _, codeKinds := range []map[string]error{bittrexErrorKinds, krakenErrorKinds} {
+		for code, kind := range codeKinds {
+			if strings.Contains(err.Error(), code) {
+				return kind
+			}
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || isServerFailure(err) {
+		return ErrNetwork
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, kindMarkers := range errorKindMarkers {
+		for _, marker := range kindMarkers.markers {
+			if strings.Contains(message, marker) {
+				return kindMarkers.kind
+			}
+		}
+	}
+	return nil
+}
+
+// isServerFailure returns true if an error reports an HTTP 5xx status of the exchange (e.g. "502 Bad Gateway"),
+// as the failed requests of the wrappers and of most clients do.
+func isServerFailure(err error) bool {
+	message := err.Error()
+	for code := 500; code < 600; code++ {
+		if text := http.StatusText(code); text != "" && strings.Contains(message, fmt.Sprintf("%d %s", code, text)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// namedWrapper is an ExchangeWrapper which only knows its name.
+type namedWrapper struct {
+	ExchangeWrapper
+	name string
+}
+
+func (wrapper namedWrapper) Name() string {
+	return wrapper.name
+}
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error // the kind of the mapped error, nil if returned as is.
+	}{
+		{"binance code", &common.APIError{Code: -1013, Message: "Filter failure: LOT_SIZE"}, ErrInvalidOrder},
+		{"binance code over the message", &common.APIError{Code: -2015, Message: "Invalid API-key, IP, or permissions for action."}, ErrAuth},
+		{"hitbtc code", &hitbtcError{Code: 20001, Message: "Insufficient funds"}, ErrInsufficientFunds},
+		{"hitbtc code without marker", &hitbtcError{Code: 2011, Message: "Quantity too low"}, ErrInvalidOrder},
+		{"kraken code", errors.New("Could not execute request! #7 ([EOrder:Order minimum not met])"), ErrInvalidOrder},
+		{"kraken rate limit", errors.New("Could not execute request! #7 ([EAPI:Rate limit exceeded])"), ErrRateLimited},
+		{"bittrex code", errors.New(`Request to orders failed: 400 Bad Request {"code":"INSUFFICIENT_FUNDS"}`), ErrInsufficientFunds},
+		{"network error", &net.DNSError{Err: "no such host", Name: "api.exchange.com"}, ErrNetwork},
+		{"server failure", errors.New("Request to trades failed: 503 Service Unavailable"), ErrNetwork},
+		{"client failure is not a network error", errors.New("Request to trades failed: 404 Not Found"), nil},
+		{"insufficient funds message", errors.New("Insufficient funds to place the order"), ErrInsufficientFunds},
+		{"auth message", errors.New("Invalid signature"), ErrAuth},
+		{"insufficient permissions are not funds", errors.New("Insufficient permissions for this action"), nil},
+		{"minimum withdrawal is not an order", errors.New("Amount is lower than the minimum withdrawal"), nil},
+		{"timeout parameter is not a network error", errors.New("Invalid timeout parameter"), nil},
+		{"not recognized", errors.New("Something went wrong"), nil},
+	}
+
+	wrapper := namedWrapper{name: "exchange"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := mapError(wrapper, test.err)
+			if test.want == nil {
+				if got != test.err {
+					t.Errorf("mapError(%q) = %q, want it returned as is", test.err, got)
+				}
+				return
+			}
+			if !errors.Is(got, test.want) {
+				t.Errorf("mapError(%q) = %q, want a %q error", test.err, got, test.want)
+			}
+			if !errors.Is(got, test.err) {
+				t.Errorf("mapError(%q) = %q, does not wrap the original error", test.err, got)
+			}
+			if !strings.Contains(got.Error(), "exchange") {
+				t.Errorf("mapError(%q) = %q, does not name the exchange", test.err, got)
+			}
+		})
+	}
+}
+
+func TestMapErrorKeepsClientError(t *testing.T) {
+	got := mapError(namedWrapper{name: "binance"}, &common.APIError{Code: -1003, Message: "Too many requests"})
+
+	var binanceErr *common.APIError
+	if !errors.As(got, &binanceErr) || binanceErr.Code != -1003 {
+		t.Errorf("errors.As(%q) did not get the code of the client error", got)
+	}
+	if !errors.Is(got, ErrRateLimited) {
+		t.Errorf("mapError = %q, want a %q error", got, ErrRateLimited)
+	}
+}
+
+func TestMapErrorAsIs(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"nil", nil},
+		{"canceled", fmt.Errorf("Request failed: %w", context.Canceled)},
+		{"deadline", context.DeadlineExceeded},
+		{"already of a kind", fmt.Errorf("%w: too small", ErrInvalidOrder)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mapError(namedWrapper{name: "exchange"}, test.err); got != test.err {
+				t.Errorf("mapError(%v) = %v, want it returned as is", test.err, got)
+			}
+		})
+	}
+}
@@ -1,160 +1,1139 @@
 package exchanges
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/juju/errors"
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 )
 
 // ExchangeWrapperSimulator wraps another wrapper and returns simulated balances and orders.
+//
+//     Limit orders rest on the simulator and are filled when the order book or the ticker
+//     of the wrapped exchange (got via GetOrderBook, GetMarketSummary, GetOrder or GetOpenOrders) crosses them.
+//
+//     The simulator is safe for concurrent use, and its account state (balances and open orders)
+//     can be persisted to a file using SetStateFile.
 type ExchangeWrapperSimulator struct {
 	innerWrapper ExchangeWrapper
-	balances     map[string]decimal.Decimal
+
+	mu        sync.Mutex                 // guards the fields below, never held during the calls to the inner wrapper.
+	balances  map[string]decimal.Decimal // available balances, reserved amounts of open orders excluded.
+	orders    map[string]*simulatedOrder
+	orderList []*simulatedOrder // orders sorted by placement, for time priority when matching.
+	fills     []SimulatedFill
+	onFill    func(SimulatedFill)
+	account   accountStream
+	options   environment.SimulationConfig
+	stateFile string // file where the account state is saved after each change, empty if not persisted.
+	dirty     bool   // tells if the account state changed since the last save.
+}
+
+// SimulatedFill represents a (partial) execution of a FAKE order.
+type SimulatedFill struct {
+	OrderID     string                //Represents the ID of the filled order.
+	Market      *environment.Market   //Represents the market of the order.
+	Type        environment.OrderType //Represents the side of the order.
+	Price       decimal.Decimal       //Represents the execution price.
+	Quantity    decimal.Decimal       //Represents the executed quantity.
+	Fee         decimal.Decimal       //Represents the fee charged by the inner wrapper fee schedule.
+	FeeCurrency string                //Represents the currency of the fee (the base currency of the market).
+	Maker       bool                  //Tells if the order was resting when filled.
+	Timestamp   time.Time             //Represents the time of the execution.
+}
+
+// simulatorSnapshot represents the account state of the simulator when locked, to find the changes to send to the account subscribers.
+type simulatorSnapshot struct {
+	balances   map[string]decimal.Decimal
+	openOrders []simulatedOrderStatus
+	orderIDs   map[string]bool // orders placed before the lock.
+}
+
+// simulatedOrderStatus represents the status of a FAKE order at a point in time.
+type simulatedOrderStatus struct {
+	order  *simulatedOrder
+	status environment.OrderStatus
+}
+
+// simulatedOrder represents a FAKE order placed on the simulator.
+type simulatedOrder struct {
+	status   environment.OrderStatus
+	market   *environment.Market
+	reserved decimal.Decimal // balance reserved for the remaining quantity of an open order.
 }
 
 // NewExchangeWrapperSimulator creates a new simulated wrapper from another wrapper and an initial balance.
 func NewExchangeWrapperSimulator(mockedWrapper ExchangeWrapper, initialBalances map[string]decimal.Decimal) *ExchangeWrapperSimulator {
-	return &ExchangeWrapperSimulator{
+	wrapper := &ExchangeWrapperSimulator{
 		innerWrapper: mockedWrapper,
 		balances:     initialBalances,
+		orders:       make(map[string]*simulatedOrder),
+	}
+	wrapper.account.exchange = mockedWrapper.Name()
+	return wrapper
+}
+
+// SetOptions sets the latency, slippage and partial fills behaviour of the simulator.
+func (wrapper *ExchangeWrapperSimulator) SetOptions(options environment.SimulationConfig) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	wrapper.options = options
+}
+
+// simulatorState represents the persisted account state of the simulator.
+type simulatorState struct {
+	Balances map[string]decimal.Decimal `json:"balances"`
+	Orders   []simulatedOrderState      `json:"orders"`
+}
+
+// simulatedOrderState represents a persisted FAKE open order.
+type simulatedOrderState struct {
+	Status        environment.OrderStatus `json:"status"`
+	Market        environment.Market      `json:"market"`
+	ExchangeNames map[string]string       `json:"exchangeNames"` // Market.ExchangeNames is not serialized by the market itself.
+	Reserved      decimal.Decimal         `json:"reserved"`
+}
+
+// SetStateFile persists the account state of the simulator in the specified file, saving it after each change.
+//
+// If the file exists, the balances and the open orders it contains replace the current ones (e.g. the fake balances
+// of the configuration, with a warning), so that a paper trading session survives restarts.
+func (wrapper *ExchangeWrapperSimulator) SetStateFile(path string) error {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Annotate(err, "Cannot read the simulator state")
+	}
+
+	if err == nil {
+		var state simulatorState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return errors.Annotatef(err, "Cannot parse the simulator state in %s", path)
+		}
+
+		if len(wrapper.balances) > 0 {
+			logrus.Warnf("Simulator state of %s loaded from %s: its balances replace the configured fake balances", wrapper, path)
+		}
+		wrapper.balances = state.Balances
+		if wrapper.balances == nil {
+			wrapper.balances = make(map[string]decimal.Decimal)
+		}
+		wrapper.orders = make(map[string]*simulatedOrder, len(state.Orders))
+		wrapper.orderList = make([]*simulatedOrder, 0, len(state.Orders))
+		for _, orderState := range state.Orders {
+			market := orderState.Market
+			market.ExchangeNames = orderState.ExchangeNames
+			order := &simulatedOrder{
+				status:   orderState.Status,
+				market:   &market,
+				reserved: orderState.Reserved,
+			}
+			wrapper.orders[order.status.ID] = order
+			wrapper.orderList = append(wrapper.orderList, order)
+		}
 	}
+
+	wrapper.stateFile = path
+	return wrapper.saveState()
+}
+
+// SaveState writes the balances and the open orders to the state file, if any.
+//
+//     NOTE: the state is already saved after each change, this writes it again (e.g. on shutdown)
+//     in case a save failed.
+func (wrapper *ExchangeWrapperSimulator) SaveState() error {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+	return wrapper.saveState()
 }
 
-// String returns a string representation of the exchange simulator.
+// saveState writes the balances and the open orders to the state file, if any, the account state must be locked.
+//
+//     NOTE: the state is written to a temporary file and then renamed, so that a crash never leaves a truncated state.
+func (wrapper *ExchangeWrapperSimulator) saveState() error {
+	if wrapper.stateFile == "" {
+		return nil
+	}
+
+	state := simulatorState{
+		Balances: wrapper.balances,
+		Orders:   make([]simulatedOrderState, 0),
+	}
+	for _, order := range wrapper.orderList {
+		if order.status.State.IsOpen() {
+			state.Orders = append(state.Orders, simulatedOrderState{
+				Status:        order.status,
+				Market:        *order.market,
+				ExchangeNames: order.market.ExchangeNames,
+				Reserved:      order.reserved,
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(wrapper.stateFile), filepath.Base(wrapper.stateFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), wrapper.stateFile)
+}
+
+// lock locks the account state of the simulator.
+//
+// Returns the function to unlock it, which saves the state if changed and then notifies
+// the fill handler and the account subscribers of the changes occurred in the meanwhile, without holding the lock.
+func (wrapper *ExchangeWrapperSimulator) lock() (unlock func()) {
+	var before *simulatorSnapshot
+	if wrapper.account.subscribed() {
+		before = &simulatorSnapshot{}
+	}
+
+	wrapper.mu.Lock()
+	start := len(wrapper.fills)
+	if before != nil {
+		wrapper.snapshot(before)
+	}
+
+	return func() {
+		if wrapper.dirty {
+			wrapper.dirty = false
+			if err := wrapper.saveState(); err != nil {
+				logrus.Errorf("Cannot save the simulator state of %s: %s", wrapper, err)
+			}
+		}
+
+		fills := append([]SimulatedFill(nil), wrapper.fills[start:]...)
+		wrapper.trimFills()
+		handler := wrapper.onFill
+		var events []environment.AccountEvent
+		if before != nil {
+			events = wrapper.accountEvents(before, fills)
+		}
+		wrapper.trimOrders()
+		wrapper.mu.Unlock()
+
+		if handler != nil {
+			for _, fill := range fills {
+				handler(fill)
+			}
+		}
+		for _, event := range events {
+			wrapper.account.dispatch(event)
+		}
+	}
+}
+
+// snapshot records the balances and the open orders, the account state must be locked.
+func (wrapper *ExchangeWrapperSimulator) snapshot(snapshot *simulatorSnapshot) {
+	snapshot.balances = make(map[string]decimal.Decimal, len(wrapper.balances))
+	for currency, amount := range wrapper.balances {
+		snapshot.balances[currency] = amount
+	}
+	snapshot.orderIDs = make(map[string]bool, len(wrapper.orderList))
+	for _, order := range wrapper.orderList {
+		snapshot.orderIDs[order.status.ID] = true
+		if order.status.State.IsOpen() {
+			snapshot.openOrders = append(snapshot.openOrders, simulatedOrderStatus{order, order.status})
+		}
+	}
+}
+
+// accountEvents gets the events of the fills, and of the orders and the balances changed since the snapshot, the account state must be locked.
+func (wrapper *ExchangeWrapperSimulator) accountEvents(before *simulatorSnapshot, fills []SimulatedFill) []environment.AccountEvent {
+	var events []environment.AccountEvent
+	for _, fill := range fills {
+		events = append(events, environment.AccountEvent{
+			Type:   environment.FillEvent,
+			Market: fill.Market,
+			Fill: &environment.Fill{
+				OrderID:     fill.OrderID,
+				Side:        fill.Type,
+				Price:       fill.Price,
+				Quantity:    fill.Quantity,
+				Fee:         fill.Fee,
+				FeeCurrency: fill.FeeCurrency,
+				Maker:       fill.Maker,
+				Time:        fill.Timestamp,
+			},
+		})
+	}
+
+	orderEvent := func(order *simulatedOrder) environment.AccountEvent {
+		status := order.status
+		return environment.AccountEvent{
+			Type:   environment.OrderUpdateEvent,
+			Market: order.market,
+			Order:  &status,
+		}
+	}
+	for _, previous := range before.openOrders {
+		status := previous.order.status
+		if status.State != previous.status.State || !status.FilledQuantity.Equal(previous.status.FilledQuantity) {
+			events = append(events, orderEvent(previous.order))
+		}
+	}
+	for _, order := range wrapper.orderList {
+		if !before.orderIDs[order.status.ID] {
+			events = append(events, orderEvent(order))
+		}
+	}
+
+	currencies := make([]string, 0, len(wrapper.balances))
+	for currency, amount := range wrapper.balances {
+		if !amount.Equal(before.balances[currency]) {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		events = append(events, environment.AccountEvent{
+			Type: environment.BalanceEvent,
+			Balance: &environment.BalanceUpdate{
+				Currency: currency,
+				Free:     wrapper.balances[currency],
+			},
+		})
+	}
+	return events
+}
+
+// String returns a string representation of the exchange simulator, its name as for the other wrappers.
 func (wrapper *ExchangeWrapperSimulator) String() string {
 	return wrapper.Name()
 }
 
-// Name gets the name of the exchange.
+// Name gets the name of the simulated exchange, the markets are bound to it.
 func (wrapper *ExchangeWrapperSimulator) Name() string {
-	return fmt.Sprint(wrapper.innerWrapper.Name(), "mock")
+	return wrapper.innerWrapper.Name()
+}
+
+// Capabilities gets the operations supported by the exchange simulator.
+//
+//     NOTE: orders and withdrawals are simulated, market data comes from the real exchange.
+func (wrapper *ExchangeWrapperSimulator) Capabilities() Capabilities {
+	inner := wrapper.innerWrapper.Capabilities()
+	return Capabilities{
+		WebsocketFeeds: inner.WebsocketFeeds,
+		Candles:        inner.Candles,
+		Trades:         inner.Trades,
+		LimitOrders:    true,
+		MarketOrders:   true,
+		Withdraw:       true,
+		TradingFees:    inner.TradingFees,
+		WithdrawFees:   inner.WithdrawFees,
+		OrderQuery:     true,
+		AccountStream:  true,
+	}
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *ExchangeWrapperSimulator) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	return wrapper.innerWrapper.GetCandles(market)
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+func (wrapper *ExchangeWrapperSimulator) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.GetCandlesContext(context.Background(), market, interval, from, to)
+}
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *ExchangeWrapperSimulator) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return BindContext(ctx, wrapper.innerWrapper).GetCandles(market, interval, from, to)
 }
 
 // GetMarketSummary gets the current market summary.
 func (wrapper *ExchangeWrapperSimulator) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
-	return wrapper.innerWrapper.GetMarketSummary(market)
+	return wrapper.GetMarketSummaryContext(context.Background(), market)
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *ExchangeWrapperSimulator) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	summary, err := BindContext(ctx, wrapper.innerWrapper).GetMarketSummary(market)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := wrapper.lock()
+	wrapper.matchTicker(market, summary)
+	unlock()
+
+	return summary, nil
 }
 
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *ExchangeWrapperSimulator) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
-	return wrapper.innerWrapper.GetOrderBook(market)
+	return wrapper.GetOrderBookContext(context.Background(), market)
 }
 
-// BuyLimit here is just to implement the ExchangeWrapper Interface, do not use, use BuyMarket instead.
-func (wrapper *ExchangeWrapperSimulator) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	return "", errors.New("BuyLimit operation is not mockable")
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *ExchangeWrapperSimulator) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	orderbook, err := BindContext(ctx, wrapper.innerWrapper).GetOrderBook(market)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := wrapper.lock()
+	wrapper.matchOrderBook(market, orderbook)
+	unlock()
+
+	return orderbook, nil
 }
 
-// SellLimit here is just to implement the ExchangeWrapper Interface, do not use, use SellMarket instead.
-func (wrapper *ExchangeWrapperSimulator) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	return "", errors.New("SellLimit operation is not mockable")
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+//
+//     NOTE: the trades come from the real exchange, the FAKE orders do not appear in them.
+func (wrapper *ExchangeWrapperSimulator) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.GetRecentTradesContext(context.Background(), market)
 }
 
-// BuyMarket performs a FAKE market buy action.
-func (wrapper *ExchangeWrapperSimulator) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	baseBalance, _ := wrapper.GetBalance(market.BaseCurrency)
-	quoteBalance, _ := wrapper.GetBalance(market.MarketCurrency)
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *ExchangeWrapperSimulator) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return BindContext(ctx, wrapper.innerWrapper).GetRecentTrades(market)
+}
 
-	orderbook, err := wrapper.GetOrderBook(market)
+// BuyLimit places a FAKE limit buy order, which rests on the simulator until filled or canceled.
+func (wrapper *ExchangeWrapperSimulator) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.BuyLimitContext(context.Background(), market, amount, limit)
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *ExchangeWrapperSimulator) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Bid, amount, limit)
 	if err != nil {
-		return "", errors.Annotate(err, "Cannot market buy without orderbook knowledge")
+		return "", err
 	}
+	return wrapper.placeLimitOrder(ctx, market, environment.Bid, quantity, price)
+}
 
-	totalQuote := decimal.Zero
-	remainingAmount := decimal.NewFromFloat(amount)
-	expense := decimal.Zero
+// SellLimit places a FAKE limit sell order, which rests on the simulator until filled or canceled.
+func (wrapper *ExchangeWrapperSimulator) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.SellLimitContext(context.Background(), market, amount, limit)
+}
 
-	for _, ask := range orderbook.Asks {
-		if remainingAmount.LessThanOrEqual(ask.Quantity) {
-			totalQuote = totalQuote.Add(remainingAmount)
-			expense = expense.Add(remainingAmount.Mul(ask.Value))
-			if expense.GreaterThan(*baseBalance) {
-				return "", fmt.Errorf("cannot Buy not enough %s balance", market.BaseCurrency)
-			}
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *ExchangeWrapperSimulator) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Ask, amount, limit)
+	if err != nil {
+		return "", err
+	}
+	return wrapper.placeLimitOrder(ctx, market, environment.Ask, quantity, price)
+}
+
+// placeLimitOrder reserves the balance for a FAKE limit order and matches it as taker against the current order book,
+// the remaining quantity rests on the simulator.
+func (wrapper *ExchangeWrapperSimulator) placeLimitOrder(ctx context.Context, market *environment.Market, orderType environment.OrderType, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	if !amount.IsPositive() || !limit.IsPositive() {
+		return "", fmt.Errorf("%w: limit order amount and price must be > 0", ErrInvalidOrder)
+	}
+
+	if err := wrapper.waitLatency(ctx); err != nil {
+		return "", err
+	}
+
+	// the order can be filled both as maker and as taker, the fees of both must be known.
+	makerFee, err := wrapper.tradingFee(market, amount, limit, MakerTrade)
+	if err != nil {
+		return "", err
+	}
+	takerFee, err := wrapper.tradingFee(market, amount, limit, TakerTrade)
+	if err != nil {
+		return "", err
+	}
+
+	orderbook, err := BindContext(ctx, wrapper.innerWrapper).GetOrderBook(market)
+	if err != nil {
+		return "", errors.Annotate(err, "Cannot place limit order without orderbook knowledge")
+	}
+
+	unlock := wrapper.lock()
+	defer unlock()
+
+	reserveCurrency, reserved := market.MarketCurrency, amount
+	if orderType == environment.Bid {
+		reserveCurrency, reserved = market.BaseCurrency, amount.Mul(limit).Add(decimal.Max(makerFee, takerFee))
+	}
+
+	balance := wrapper.balance(reserveCurrency)
+	if balance.LessThan(reserved) {
+		return "", fmt.Errorf("Cannot place limit order: %w, not enough %s balance", ErrInsufficientFunds, reserveCurrency)
+	}
+
+	orderID, err := newFakeOrderID(orderType)
+	if err != nil {
+		return "", err
+	}
+
+	wrapper.balances[reserveCurrency] = balance.Sub(reserved)
+	wrapper.dirty = true
+
+	order := &simulatedOrder{
+		market:   market,
+		reserved: reserved,
+		status: environment.OrderStatus{
+			ID:          orderID,
+			Type:        orderType,
+			State:       environment.OrderNew,
+			Price:       limit,
+			Quantity:    amount,
+			FeeCurrency: market.BaseCurrency,
+			Timestamp:   time.Now(),
+		},
+	}
+	wrapper.orders[order.status.ID] = order
+	wrapper.orderList = append(wrapper.orderList, order)
+
+	levels := orderbook.Asks
+	if orderType == environment.Ask {
+		levels = orderbook.Bids
+	}
+	for _, level := range levels {
+		if !order.status.State.IsOpen() || !crossesLimit(order, level.Value) {
 			break
 		}
-		totalQuote = totalQuote.Add(ask.Quantity)
-		expense = expense.Add(ask.Quantity.Mul(ask.Value))
-		if expense.GreaterThan(*baseBalance) {
-			return "", fmt.Errorf("cannot Buy not enough %s balance", market.BaseCurrency)
+
+		price := wrapper.slippedPrice(orderType, level.Value)
+		if !crossesLimit(order, price) {
+			price = limit
+		}
+		if err := wrapper.fillOrder(order, price, decimal.Min(level.Quantity, order.status.RemainingQuantity()), false); err != nil {
+			logrus.Errorf("Cannot fill the FAKE order %s, left open: %s", order.status.ID, err)
+			break
 		}
 	}
 
-	wrapper.balances[market.BaseCurrency] = baseBalance.Sub(expense)
-	wrapper.balances[market.MarketCurrency] = quoteBalance.Add(totalQuote)
+	return order.status.ID, nil
+}
 
+// newFakeOrderID generates the ID of a FAKE order.
+func newFakeOrderID(orderType environment.OrderType) (string, error) {
 	orderFakeID, err := uuid.NewV4()
 	if err != nil {
 		return "", errors.Annotate(err, "UUID Generation")
 	}
-	return fmt.Sprintf("FAKE_BUY-%s", orderFakeID), nil
+
+	if orderType == environment.Bid {
+		return fmt.Sprintf("FAKE_BUY-%s", orderFakeID), nil
+	}
+	return fmt.Sprintf("FAKE_SELL-%s", orderFakeID), nil
+}
+
+// waitLatency waits for the configured latency before placing an order.
+func (wrapper *ExchangeWrapperSimulator) waitLatency(ctx context.Context) error {
+	wrapper.mu.Lock()
+	latency := wrapper.options.Latency
+	wrapper.mu.Unlock()
+
+	if latency <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(latency):
+		return nil
+	}
 }
 
-// SellMarket performs a FAKE market buy action.
-func (wrapper *ExchangeWrapperSimulator) SellMarket(market *environment.Market, amount float64) (string, error) {
-	baseBalance, _ := wrapper.GetBalance(market.BaseCurrency)
-	quoteBalance, _ := wrapper.GetBalance(market.MarketCurrency)
+// slippedPrice applies the configured adverse slippage to the price of a taker fill.
+func (wrapper *ExchangeWrapperSimulator) slippedPrice(orderType environment.OrderType, price decimal.Decimal) decimal.Decimal {
+	slippage := decimal.NewFromFloat(wrapper.options.Slippage)
+	if orderType == environment.Bid {
+		return price.Mul(decimal.NewFromInt(1).Add(slippage))
+	}
+	return price.Mul(decimal.NewFromInt(1).Sub(slippage))
+}
 
-	orderbook, err := wrapper.GetOrderBook(market)
+// tradingFee calculates the fee of a fill using the fee schedule of the inner wrapper.
+//
+//     NOTE: a fill whose fees cannot be calculated is not simulated, it would be free.
+func (wrapper *ExchangeWrapperSimulator) tradingFee(market *environment.Market, quantity decimal.Decimal, price decimal.Decimal, tradeType TradeType) (decimal.Decimal, error) {
+	fee, err := wrapper.innerWrapper.CalculateTradingFees(market, quantity, price, tradeType)
 	if err != nil {
-		return "", errors.Annotate(err, "Cannot market buy without orderbook knowledge")
+		return decimal.Zero, errors.Annotatef(err, "Cannot calculate the trading fees of %s on %s", market.Name, wrapper.innerWrapper.Name())
 	}
+	return fee, nil
+}
 
-	totalQuote := decimal.Zero
-	remainingAmount := decimal.NewFromFloat(amount)
-	gain := decimal.Zero
+// crossesLimit tells if a price can be matched by a limit order.
+func crossesLimit(order *simulatedOrder, price decimal.Decimal) bool {
+	if order.status.Type == environment.Bid {
+		return price.LessThanOrEqual(order.status.Price)
+	}
+	return price.GreaterThanOrEqual(order.status.Price)
+}
+
+// matchOrderBook fills the resting FAKE orders of a market crossed by the order book, at their limit price,
+// returning the quantities consumed from each ask and bid level.
+//
+//     Orders are matched by time priority, each book level is consumed by the fills of the same match.
+//
+//     NOTE: the liquidity of the book is considered to be refreshed on each match.
+func (wrapper *ExchangeWrapperSimulator) matchOrderBook(market *environment.Market, orderbook *environment.OrderBook) (consumedAsks []decimal.Decimal, consumedBids []decimal.Decimal) {
+	consumedAsks = make([]decimal.Decimal, len(orderbook.Asks))
+	consumedBids = make([]decimal.Decimal, len(orderbook.Bids))
+
+	for _, order := range wrapper.orderList {
+		if order.market.Name != market.Name || !order.status.State.IsOpen() {
+			continue
+		}
 
-	if quoteBalance.LessThan(remainingAmount) {
-		return "", fmt.Errorf("Cannot Sell: not enough %s balance", market.MarketCurrency)
+		levels, consumed := orderbook.Asks, consumedAsks
+		if order.status.Type == environment.Ask {
+			levels, consumed = orderbook.Bids, consumedBids
+		}
+
+		for i, level := range levels {
+			if !order.status.State.IsOpen() || !crossesLimit(order, level.Value) {
+				break
+			}
+			quantity := decimal.Min(level.Quantity.Sub(consumed[i]), order.status.RemainingQuantity())
+			if !quantity.IsPositive() {
+				continue
+			}
+			if err := wrapper.fillOrder(order, order.status.Price, quantity, true); err != nil {
+				logrus.Errorf("Cannot fill the FAKE order %s, left open: %s", order.status.ID, err)
+				break
+			}
+			consumed[i] = consumed[i].Add(quantity)
+		}
 	}
+	return consumedAsks, consumedBids
+}
+
+// matchTicker completely fills the resting FAKE orders of a market crossed by the ticker, at their limit price.
+func (wrapper *ExchangeWrapperSimulator) matchTicker(market *environment.Market, summary *environment.MarketSummary) {
+	for _, order := range wrapper.orderList {
+		if order.market.Name != market.Name || !order.status.State.IsOpen() {
+			continue
+		}
+
+		price := summary.Ask
+		if order.status.Type == environment.Ask {
+			price = summary.Bid
+		}
+
+		if price.IsPositive() && crossesLimit(order, price) {
+			if err := wrapper.fillOrder(order, order.status.Price, order.status.RemainingQuantity(), true); err != nil {
+				logrus.Errorf("Cannot fill the FAKE order %s, left open: %s", order.status.ID, err)
+			}
+		}
+	}
+}
+
+// refreshOrders matches the resting FAKE orders of a market against the current order book, if any.
+func (wrapper *ExchangeWrapperSimulator) refreshOrders(ctx context.Context, market *environment.Market) error {
+	if !wrapper.hasOpenOrders(market) {
+		return nil
+	}
+
+	_, err := wrapper.GetOrderBookContext(ctx, market)
+	return err
+}
+
+// hasOpenOrders tells if there are resting FAKE orders on a market.
+func (wrapper *ExchangeWrapperSimulator) hasOpenOrders(market *environment.Market) bool {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
 
-	for _, bid := range orderbook.Bids {
-		if remainingAmount.LessThanOrEqual(bid.Quantity) {
-			totalQuote = totalQuote.Add(remainingAmount)
-			gain = gain.Add(remainingAmount.Mul(bid.Value))
+	for _, order := range wrapper.orderList {
+		if order.market.Name == market.Name && order.status.State.IsOpen() {
+			return true
+		}
+	}
+	return false
+}
+
+// fillOrder executes a quantity of a FAKE limit order at the specified price, charging fees, updating balances and recording the fill.
+//
+//     NOTE: nothing is changed if the fees of the fill cannot be calculated.
+func (wrapper *ExchangeWrapperSimulator) fillOrder(order *simulatedOrder, price decimal.Decimal, quantity decimal.Decimal, maker bool) error {
+	if !quantity.IsPositive() {
+		return nil
+	}
+
+	tradeType := TradeType(TakerTrade)
+	if maker {
+		tradeType = MakerTrade
+	}
+
+	market := order.market
+	status := &order.status
+	total := quantity.Mul(price)
+	fee, err := wrapper.tradingFee(market, quantity, price, tradeType)
+	if err != nil {
+		return err
+	}
+
+	if status.Type == environment.Bid {
+		released := order.reserved.Mul(quantity).Div(status.RemainingQuantity())
+		order.reserved = order.reserved.Sub(released)
+		wrapper.balances[market.BaseCurrency] = wrapper.balances[market.BaseCurrency].Add(released).Sub(total).Sub(fee)
+		wrapper.balances[market.MarketCurrency] = wrapper.balances[market.MarketCurrency].Add(quantity)
+	} else {
+		order.reserved = order.reserved.Sub(quantity)
+		wrapper.balances[market.BaseCurrency] = wrapper.balances[market.BaseCurrency].Add(total).Sub(fee)
+	}
+
+	status.AveragePrice = status.AveragePrice.Mul(status.FilledQuantity).Add(total).Div(status.FilledQuantity.Add(quantity))
+	status.FilledQuantity = status.FilledQuantity.Add(quantity)
+	status.Fee = status.Fee.Add(fee)
+	if status.RemainingQuantity().IsPositive() {
+		status.State = environment.OrderPartiallyFilled
+	} else {
+		status.State = environment.OrderFilled
+	}
+	wrapper.dirty = true
+
+	wrapper.recordFill(SimulatedFill{
+		OrderID:     status.ID,
+		Market:      market,
+		Type:        status.Type,
+		Price:       price,
+		Quantity:    quantity,
+		Fee:         fee,
+		FeeCurrency: market.BaseCurrency,
+		Maker:       maker,
+		Timestamp:   time.Now(),
+	})
+	return nil
+}
+
+// recordFill keeps track of a FAKE fill, the fill handler is notified when the account state is unlocked.
+func (wrapper *ExchangeWrapperSimulator) recordFill(fill SimulatedFill) {
+	wrapper.fills = append(wrapper.fills, fill)
+}
+
+// maxSimulatedFills is the number of most recent FAKE fills kept in memory by the simulator.
+const maxSimulatedFills = 10000
+
+// trimFills discards the oldest FAKE fills once they are twice maxSimulatedFills, the account state must be locked.
+//
+//     NOTE: the fills are trimmed in batches, not to copy them at each new fill.
+func (wrapper *ExchangeWrapperSimulator) trimFills() {
+	if len(wrapper.fills) < 2*maxSimulatedFills {
+		return
+	}
+	wrapper.fills = append([]SimulatedFill(nil), wrapper.fills[len(wrapper.fills)-maxSimulatedFills:]...)
+}
+
+// maxClosedOrders is the number of most recent closed FAKE orders kept in memory by the simulator, for GetOrder.
+const maxClosedOrders = 10000
+
+// trimOrders discards the oldest closed FAKE orders once they are twice maxClosedOrders, the account state must be locked.
+//
+//     NOTE: the orders are trimmed in batches as the fills, the open orders are always kept.
+func (wrapper *ExchangeWrapperSimulator) trimOrders() {
+	if len(wrapper.orderList) < 2*maxClosedOrders {
+		return
+	}
+	closed := 0
+	for _, order := range wrapper.orderList {
+		if !order.status.State.IsOpen() {
+			closed++
+		}
+	}
+	if closed < 2*maxClosedOrders {
+		return
+	}
+
+	discarded := closed - maxClosedOrders
+	orderList := make([]*simulatedOrder, 0, len(wrapper.orderList)-discarded)
+	for _, order := range wrapper.orderList {
+		if discarded > 0 && !order.status.State.IsOpen() {
+			delete(wrapper.orders, order.status.ID)
+			discarded--
+			continue
+		}
+		orderList = append(orderList, order)
+	}
+	wrapper.orderList = orderList
+}
+
+// Fills gets the FAKE fills occurred on a market, all the fills if market is nil.
+//
+//     NOTE: fills are not persisted in the state file, and only the most recent ones (at least maxSimulatedFills) are kept.
+func (wrapper *ExchangeWrapperSimulator) Fills(market *environment.Market) []SimulatedFill {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	ret := make([]SimulatedFill, 0)
+	for _, fill := range wrapper.fills {
+		if market == nil || fill.Market.Name == market.Name {
+			ret = append(ret, fill)
+		}
+	}
+	return ret
+}
+
+// OnFill sets a handler called on each FAKE fill.
+//
+//     NOTE: the handler is called synchronously by the call which caused the fill,
+//     after the account state has been unlocked, so it can call the simulator.
+func (wrapper *ExchangeWrapperSimulator) OnFill(handler func(SimulatedFill)) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	wrapper.onFill = handler
+}
+
+// BuyMarket performs a FAKE market buy action.
+func (wrapper *ExchangeWrapperSimulator) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.BuyMarketContext(context.Background(), market, amount)
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *ExchangeWrapperSimulator) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	quantity, _, err := prepareOrder(wrapper, market, environment.Bid, amount, decimal.Zero)
+	if err != nil {
+		return "", err
+	}
+	return wrapper.placeMarketOrder(ctx, market, environment.Bid, quantity)
+}
+
+// SellMarket performs a FAKE market sell action.
+func (wrapper *ExchangeWrapperSimulator) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.SellMarketContext(context.Background(), market, amount)
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *ExchangeWrapperSimulator) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	quantity, _, err := prepareOrder(wrapper, market, environment.Ask, amount, decimal.Zero)
+	if err != nil {
+		return "", err
+	}
+	return wrapper.placeMarketOrder(ctx, market, environment.Ask, quantity)
+}
+
+// placeMarketOrder executes a FAKE market order walking the order book as taker, charging taker fees.
+//
+//     When the book is not deep enough the order is rejected, or partially filled if partial fills are enabled.
+func (wrapper *ExchangeWrapperSimulator) placeMarketOrder(ctx context.Context, market *environment.Market, orderType environment.OrderType, amount decimal.Decimal) (string, error) {
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("%w: market order amount must be > 0", ErrInvalidOrder)
+	}
+
+	if err := wrapper.waitLatency(ctx); err != nil {
+		return "", err
+	}
+
+	orderbook, err := BindContext(ctx, wrapper.innerWrapper).GetOrderBook(market)
+	if err != nil {
+		return "", errors.Annotate(err, "Cannot place market order without orderbook knowledge")
+	}
+
+	unlock := wrapper.lock()
+	defer unlock()
+
+	// the resting orders are matched first, the market order walks the liquidity they left in the same book.
+	consumedAsks, consumedBids := wrapper.matchOrderBook(market, orderbook)
+	levels, consumed := orderbook.Asks, consumedAsks
+	if orderType == environment.Ask {
+		levels, consumed = orderbook.Bids, consumedBids
+	}
+
+	var fills []SimulatedFill
+	remaining := amount
+	totalQuantity, totalCost, totalFee := decimal.Zero, decimal.Zero, decimal.Zero
+	for i, level := range levels {
+		if !remaining.IsPositive() {
 			break
 		}
-		totalQuote = totalQuote.Add(bid.Quantity)
-		gain = gain.Add(bid.Quantity.Mul(bid.Value))
+
+		quantity := decimal.Min(remaining, level.Quantity.Sub(consumed[i]))
+		if !quantity.IsPositive() {
+			continue
+		}
+		price := wrapper.slippedPrice(orderType, level.Value)
+		fee, err := wrapper.tradingFee(market, quantity, price, TakerTrade)
+		if err != nil {
+			return "", err
+		}
+
+		fills = append(fills, SimulatedFill{
+			Market:      market,
+			Type:        orderType,
+			Price:       price,
+			Quantity:    quantity,
+			Fee:         fee,
+			FeeCurrency: market.BaseCurrency,
+		})
+		remaining = remaining.Sub(quantity)
+		totalQuantity = totalQuantity.Add(quantity)
+		totalCost = totalCost.Add(quantity.Mul(price))
+		totalFee = totalFee.Add(fee)
 	}
 
-	wrapper.balances[market.BaseCurrency] = baseBalance.Add(gain)
-	wrapper.balances[market.MarketCurrency] = quoteBalance.Sub(totalQuote)
+	if totalQuantity.IsZero() || (remaining.IsPositive() && !wrapper.options.PartialFills) {
+		return "", fmt.Errorf("Cannot place market order: orderbook not deep enough to fill %s %s", amount, market.MarketCurrency)
+	}
 
-	orderFakeID, err := uuid.NewV4()
+	baseBalance := wrapper.balance(market.BaseCurrency)
+	quoteBalance := wrapper.balance(market.MarketCurrency)
+
+	if orderType == environment.Bid && baseBalance.LessThan(totalCost.Add(totalFee)) {
+		return "", fmt.Errorf("Cannot Buy: %w, not enough %s balance", ErrInsufficientFunds, market.BaseCurrency)
+	}
+	if orderType == environment.Ask && quoteBalance.LessThan(totalQuantity) {
+		return "", fmt.Errorf("Cannot Sell: %w, not enough %s balance", ErrInsufficientFunds, market.MarketCurrency)
+	}
+
+	orderID, err := newFakeOrderID(orderType)
 	if err != nil {
-		return "", errors.Annotate(err, "UUID Generation")
+		return "", err
 	}
-	return fmt.Sprintf("FAKE_SELL-%s", orderFakeID), nil
+
+	if orderType == environment.Bid {
+		wrapper.balances[market.BaseCurrency] = baseBalance.Sub(totalCost).Sub(totalFee)
+		wrapper.balances[market.MarketCurrency] = quoteBalance.Add(totalQuantity)
+	} else {
+		wrapper.balances[market.BaseCurrency] = baseBalance.Add(totalCost).Sub(totalFee)
+		wrapper.balances[market.MarketCurrency] = quoteBalance.Sub(totalQuantity)
+	}
+	wrapper.dirty = true
+
+	now := time.Now()
+	order := &simulatedOrder{
+		market: market,
+		status: environment.OrderStatus{
+			ID:             orderID,
+			Type:           orderType,
+			State:          environment.OrderFilled,
+			Quantity:       amount,
+			FilledQuantity: totalQuantity,
+			AveragePrice:   totalCost.Div(totalQuantity),
+			Fee:            totalFee,
+			FeeCurrency:    market.BaseCurrency,
+			Timestamp:      now,
+		},
+	}
+	if remaining.IsPositive() {
+		order.status.State = environment.OrderCanceled
+	}
+	wrapper.orders[orderID] = order
+	wrapper.orderList = append(wrapper.orderList, order)
+
+	for _, fill := range fills {
+		fill.OrderID = orderID
+		fill.Timestamp = now
+		wrapper.recordFill(fill)
+	}
+
+	return orderID, nil
+}
+
+// GetOrder gets the status of a FAKE order placed on the simulator.
+//
+//     NOTE: only the most recent closed orders (at least maxClosedOrders) are kept, the older ones are not found.
+func (wrapper *ExchangeWrapperSimulator) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return wrapper.GetOrderContext(context.Background(), market, orderID)
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *ExchangeWrapperSimulator) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	wrapper.mu.Lock()
+	order, exists := wrapper.orders[orderID]
+	wrapper.mu.Unlock()
+
+	if !exists {
+		return nil, errors.New("Order not found")
+	}
+
+	if err := wrapper.refreshOrders(ctx, order.market); err != nil {
+		return nil, err
+	}
+
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	ret := order.status
+	return &ret, nil
+}
+
+// GetOpenOrders gets the FAKE open orders of the user on a market.
+func (wrapper *ExchangeWrapperSimulator) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	return wrapper.GetOpenOrdersContext(context.Background(), market)
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *ExchangeWrapperSimulator) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	if err := wrapper.refreshOrders(ctx, market); err != nil {
+		return nil, err
+	}
+
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	ret := make([]environment.OrderStatus, 0)
+	for _, order := range wrapper.orderList {
+		if order.market.Name == market.Name && order.status.State.IsOpen() {
+			ret = append(ret, order.status)
+		}
+	}
+	return ret, nil
+}
+
+// CancelOrder cancels a FAKE open order, releasing its reserved balance.
+func (wrapper *ExchangeWrapperSimulator) CancelOrder(market *environment.Market, orderID string) error {
+	unlock := wrapper.lock()
+	defer unlock()
+
+	order, exists := wrapper.orders[orderID]
+	if !exists {
+		return errors.New("Order not found")
+	}
+	if !order.status.State.IsOpen() {
+		return fmt.Errorf("Cannot cancel order %s: order is %s", orderID, order.status.State)
+	}
+
+	wrapper.cancelOrder(order)
+	return nil
+}
+
+// CancelOrderContext is like CancelOrder, ctx is only checked before starting.
+func (wrapper *ExchangeWrapperSimulator) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wrapper.CancelOrder(market, orderID)
+}
+
+// CancelAllOrders cancels all the FAKE open orders of the user on a market, releasing their reserved balance.
+func (wrapper *ExchangeWrapperSimulator) CancelAllOrders(market *environment.Market) error {
+	unlock := wrapper.lock()
+	defer unlock()
+
+	for _, order := range wrapper.orderList {
+		if order.market.Name == market.Name && order.status.State.IsOpen() {
+			wrapper.cancelOrder(order)
+		}
+	}
+	return nil
+}
+
+// CancelAllOrdersContext is like CancelAllOrders, ctx is only checked before starting.
+func (wrapper *ExchangeWrapperSimulator) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wrapper.CancelAllOrders(market)
+}
+
+// cancelOrder cancels a FAKE open order, releasing its reserved balance.
+func (wrapper *ExchangeWrapperSimulator) cancelOrder(order *simulatedOrder) {
+	reserveCurrency := order.market.MarketCurrency
+	if order.status.Type == environment.Bid {
+		reserveCurrency = order.market.BaseCurrency
+	}
+	wrapper.balances[reserveCurrency] = wrapper.balances[reserveCurrency].Add(order.reserved)
+	order.reserved = decimal.Zero
+	order.status.State = environment.OrderCanceled
+	wrapper.dirty = true
+}
+
+// GetMarketInfo gets the trading rules of a market from the inner wrapper, FAKE orders are rounded and validated as real ones.
+func (wrapper *ExchangeWrapperSimulator) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	provider, hasRules := wrapper.innerWrapper.(MarketInfoProvider)
+	if !hasRules {
+		return environment.MarketInfo{}, nil
+	}
+	return provider.GetMarketInfo(market)
 }
 
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
-func (wrapper *ExchangeWrapperSimulator) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
+func (wrapper *ExchangeWrapperSimulator) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
 	return wrapper.innerWrapper.CalculateTradingFees(market, amount, limit, orderType)
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *ExchangeWrapperSimulator) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
+func (wrapper *ExchangeWrapperSimulator) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
 	return wrapper.innerWrapper.CalculateWithdrawFees(market, amount)
 }
 
-// GetBalance gets the balance of the user of the specified currency.
+// GetBalance gets the available balance of the user of the specified currency, balance reserved by open orders excluded.
 func (wrapper *ExchangeWrapperSimulator) GetBalance(symbol string) (*decimal.Decimal, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	bal := wrapper.balance(symbol)
+	return &bal, nil
+}
+
+// balance gets the available balance of the specified currency, the account state must be locked.
+func (wrapper *ExchangeWrapperSimulator) balance(symbol string) decimal.Decimal {
 	bal, exists := wrapper.balances[symbol]
 	if !exists {
 		wrapper.balances[symbol] = decimal.Zero
-		var bal = decimal.Zero
-		return &bal, nil
+		return decimal.Zero
 	}
-	return &bal, nil
+	return bal
+}
+
+// GetBalanceContext is like GetBalance, ctx is only checked before starting.
+func (wrapper *ExchangeWrapperSimulator) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return wrapper.GetBalance(symbol)
+}
+
+// GetBalances gets the FAKE free, locked and total balances of the user of all the currencies, by currency:
+// the locked balances are the amounts reserved by the open orders.
+func (wrapper *ExchangeWrapperSimulator) GetBalances() (map[string]environment.Balance, error) {
+	wrapper.mu.Lock()
+	defer wrapper.mu.Unlock()
+
+	locked := make(map[string]decimal.Decimal)
+	for _, order := range wrapper.orderList {
+		if !order.status.State.IsOpen() {
+			continue
+		}
+		reserveCurrency := order.market.MarketCurrency
+		if order.status.Type == environment.Bid {
+			reserveCurrency = order.market.BaseCurrency
+		}
+		locked[reserveCurrency] = locked[reserveCurrency].Add(order.reserved)
+	}
+
+	ret := make(map[string]environment.Balance, len(wrapper.balances))
+	for currency, free := range wrapper.balances {
+		ret[currency] = newBalance(free, locked[currency])
+	}
+	for currency, amount := range locked {
+		if _, exists := ret[currency]; !exists {
+			ret[currency] = newBalance(decimal.Zero, amount)
+		}
+	}
+	return ret, nil
+}
+
+// GetBalancesContext is like GetBalances, ctx is only checked before starting.
+func (wrapper *ExchangeWrapperSimulator) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return wrapper.GetBalances()
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -164,22 +1143,75 @@ func (wrapper *ExchangeWrapperSimulator) GetDepositAddress(coinTicker string) (s
 
 // FeedConnect connects to the feed of the exchange.
 func (wrapper *ExchangeWrapperSimulator) FeedConnect(markets []*environment.Market) error {
-	return wrapper.innerWrapper.FeedConnect(markets)
+	return wrapper.FeedConnectContext(context.Background(), markets)
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *ExchangeWrapperSimulator) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return BindContext(ctx, wrapper.innerWrapper).FeedConnect(markets)
+}
+
+// SetMaxDataAge sets the max age of the data cached by the inner wrapper, if it limits it.
+func (wrapper *ExchangeWrapperSimulator) SetMaxDataAge(maxAge time.Duration) {
+	if limiter, isLimiter := wrapper.innerWrapper.(DataAgeLimiter); isLimiter {
+		limiter.SetMaxDataAge(maxAge)
+	}
+}
+
+// SetOrderBookDepth sets the max number of price levels of the order books maintained by the inner wrapper, if it maintains them.
+func (wrapper *ExchangeWrapperSimulator) SetOrderBookDepth(depth int) {
+	if limiter, isLimiter := wrapper.innerWrapper.(OrderBookDepthLimiter); isLimiter {
+		limiter.SetOrderBookDepth(depth)
+	}
+}
+
+// FeedStatus gets the status of the websocket feeds of the inner wrapper.
+func (wrapper *ExchangeWrapperSimulator) FeedStatus() []FeedStatus {
+	return FeedStatusOf(wrapper.innerWrapper)
+}
+
+// FeedRelease releases a subscription to the feed of the markets of the inner wrapper.
+func (wrapper *ExchangeWrapperSimulator) FeedRelease(markets []*environment.Market) {
+	ReleaseFeed(wrapper.innerWrapper, markets)
+}
+
+// FeedClose releases all the subscriptions to the feed of the markets of the inner wrapper.
+func (wrapper *ExchangeWrapperSimulator) FeedClose(markets []*environment.Market) {
+	CloseFeed(wrapper.innerWrapper, markets)
+}
+
+// SubscribeAccount subscribes a handler to the FAKE fills and to the changes of the FAKE orders and balances on the markets.
+//
+//     NOTE: the handler is called synchronously by the call which caused the change,
+//     after the account state has been unlocked, so it can call the simulator.
+func (wrapper *ExchangeWrapperSimulator) SubscribeAccount(markets []*environment.Market, handler func(environment.AccountEvent)) (func(), error) {
+	return wrapper.account.subscribe(markets, handler, nil)
 }
 
 // Withdraw performs a FAKE withdraw operation from the exchange to a destination address.
-func (wrapper *ExchangeWrapperSimulator) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	if amount <= 0 {
+func (wrapper *ExchangeWrapperSimulator) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
 		return errors.New("Withdraw amount must be > 0")
 	}
 
+	unlock := wrapper.lock()
+	defer unlock()
+
 	bal, exists := wrapper.balances[coinTicker]
-	amt := decimal.NewFromFloat(amount)
-	if !exists || amt.GreaterThan(bal) {
-		return errors.New("Not enough balance")
+	if !exists || amount.GreaterThan(bal) {
+		return fmt.Errorf("Cannot withdraw: %w, not enough %s balance", ErrInsufficientFunds, coinTicker)
 	}
 
-	wrapper.balances[coinTicker] = bal.Sub(amt)
+	wrapper.balances[coinTicker] = bal.Sub(amount)
+	wrapper.dirty = true
 
 	return nil
 }
+
+// WithdrawContext is like Withdraw, ctx is only checked before starting.
+func (wrapper *ExchangeWrapperSimulator) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wrapper.Withdraw(destinationAddress, coinTicker, amount)
+}
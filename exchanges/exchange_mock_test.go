@@ -0,0 +1,412 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+// The fee rates of the notional charged by bookWrapper.
+var (
+	testMakerFee = decimal.RequireFromString("0.001")
+	testTakerFee = decimal.RequireFromString("0.002")
+)
+
+// bookWrapper is an ExchangeWrapper serving the order book and the ticker set by the test, charging testMakerFee and testTakerFee.
+type bookWrapper struct {
+	namedWrapper
+	book    environment.OrderBook
+	ticker  environment.MarketSummary
+	feesErr error // returned by CalculateTradingFees, if not nil.
+}
+
+func (wrapper *bookWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	book := wrapper.book
+	return &book, nil
+}
+
+func (wrapper *bookWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	summary := wrapper.ticker
+	return &summary, nil
+}
+
+func (wrapper *bookWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	if wrapper.feesErr != nil {
+		return decimal.Zero, wrapper.feesErr
+	}
+	if orderType == MakerTrade {
+		return amount.Mul(limit).Mul(testMakerFee), nil
+	}
+	return amount.Mul(limit).Mul(testTakerFee), nil
+}
+
+var testMarket = &environment.Market{Name: "ETH-BTC", BaseCurrency: "BTC", MarketCurrency: "ETH"}
+
+// levels creates the levels of an order book side from price, quantity pairs.
+func levels(values ...string) []environment.Order {
+	ret := make([]environment.Order, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		ret = append(ret, environment.Order{Value: decimal.RequireFromString(values[i]), Quantity: decimal.RequireFromString(values[i+1])})
+	}
+	return ret
+}
+
+// simulatorCall performs a call to the simulator, returning the ID of the placed order, if any.
+type simulatorCall func(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error)
+
+func buyLimit(quantity string, price string) simulatorCall {
+	return func(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error) {
+		return sim.BuyLimit(testMarket, decimal.RequireFromString(quantity), decimal.RequireFromString(price))
+	}
+}
+
+func sellLimit(quantity string, price string) simulatorCall {
+	return func(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error) {
+		return sim.SellLimit(testMarket, decimal.RequireFromString(quantity), decimal.RequireFromString(price))
+	}
+}
+
+func buyMarket(quantity string) simulatorCall {
+	return func(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error) {
+		return sim.BuyMarket(testMarket, decimal.RequireFromString(quantity))
+	}
+}
+
+func sellMarket(quantity string) simulatorCall {
+	return func(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error) {
+		return sim.SellMarket(testMarket, decimal.RequireFromString(quantity))
+	}
+}
+
+func cancelOrder(index int) simulatorCall {
+	return func(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error) {
+		return "", sim.CancelOrder(testMarket, orderIDs[index])
+	}
+}
+
+func getOrderBook(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error) {
+	_, err := sim.GetOrderBook(testMarket)
+	return "", err
+}
+
+func getMarketSummary(sim *ExchangeWrapperSimulator, orderIDs []string) (string, error) {
+	_, err := sim.GetMarketSummary(testMarket)
+	return "", err
+}
+
+// testFill represents an expected FAKE fill.
+type testFill struct {
+	price    string
+	quantity string
+	fee      string
+	maker    bool
+}
+
+// simulatorStep represents a call to the simulator and the account state expected after it.
+type simulatorStep struct {
+	name    string
+	book    *environment.OrderBook     // replaces the order book of the inner wrapper before the call, if not nil.
+	ticker  *environment.MarketSummary // replaces the ticker of the inner wrapper before the call, if not nil.
+	call    simulatorCall
+	wantErr bool
+	free    map[string]string        // free balances.
+	locked  map[string]string        // balances reserved by the open orders, zero if missing.
+	states  []environment.OrderState // states of the orders placed so far.
+	fills   []testFill               // all the fills occurred so far.
+}
+
+func TestSimulator(t *testing.T) {
+	book := environment.OrderBook{Asks: levels("2", "5"), Bids: levels("0.5", "5")}
+
+	tests := []struct {
+		name    string
+		options environment.SimulationConfig
+		feesErr error
+		steps   []simulatorStep
+	}{
+		{"limit buy matched against the book", environment.SimulationConfig{}, nil, []simulatorStep{
+			{
+				name:   "rests below the asks, reserving the highest fee",
+				call:   buyLimit("1", "1"),
+				free:   map[string]string{"BTC": "8.998", "ETH": "10"},
+				locked: map[string]string{"BTC": "1.002"},
+				states: []environment.OrderState{environment.OrderNew},
+			},
+			{
+				name:   "filled at its limit as maker when the asks cross it",
+				book:   &environment.OrderBook{Asks: levels("0.95", "5")},
+				call:   getOrderBook,
+				free:   map[string]string{"BTC": "8.999", "ETH": "11"},
+				states: []environment.OrderState{environment.OrderFilled},
+				fills:  []testFill{{"1", "1", "0.001", true}},
+			},
+		}},
+		{"limit sell matched against the ticker", environment.SimulationConfig{}, nil, []simulatorStep{
+			{
+				name:   "rests above the bids",
+				call:   sellLimit("2", "1"),
+				free:   map[string]string{"BTC": "10", "ETH": "8"},
+				locked: map[string]string{"ETH": "2"},
+				states: []environment.OrderState{environment.OrderNew},
+			},
+			{
+				name:   "ticker not crossing",
+				ticker: &environment.MarketSummary{Bid: decimal.RequireFromString("0.9"), Ask: decimal.RequireFromString("2")},
+				call:   getMarketSummary,
+				free:   map[string]string{"BTC": "10", "ETH": "8"},
+				locked: map[string]string{"ETH": "2"},
+				states: []environment.OrderState{environment.OrderNew},
+			},
+			{
+				name:   "completely filled at its limit when the bid crosses it",
+				ticker: &environment.MarketSummary{Bid: decimal.RequireFromString("1.1"), Ask: decimal.RequireFromString("1.2")},
+				call:   getMarketSummary,
+				free:   map[string]string{"BTC": "11.998", "ETH": "8"},
+				states: []environment.OrderState{environment.OrderFilled},
+				fills:  []testFill{{"1", "2", "0.002", true}},
+			},
+		}},
+		{"partial fill and cancel", environment.SimulationConfig{}, nil, []simulatorStep{
+			{
+				name:   "rests",
+				call:   buyLimit("2", "1"),
+				free:   map[string]string{"BTC": "7.996", "ETH": "10"},
+				locked: map[string]string{"BTC": "2.004"},
+				states: []environment.OrderState{environment.OrderNew},
+			},
+			{
+				name:   "partially filled by a shallow level, releasing the reserve of the filled quantity",
+				book:   &environment.OrderBook{Asks: levels("1", "0.5")},
+				call:   getOrderBook,
+				free:   map[string]string{"BTC": "7.9965", "ETH": "10.5"},
+				locked: map[string]string{"BTC": "1.503"},
+				states: []environment.OrderState{environment.OrderPartiallyFilled},
+				fills:  []testFill{{"1", "0.5", "0.0005", true}},
+			},
+			{
+				name:   "cancel releases the remaining reserve",
+				call:   cancelOrder(0),
+				free:   map[string]string{"BTC": "9.4995", "ETH": "10.5"},
+				states: []environment.OrderState{environment.OrderCanceled},
+				fills:  []testFill{{"1", "0.5", "0.0005", true}},
+			},
+			{
+				name:    "cancel of a closed order",
+				call:    cancelOrder(0),
+				wantErr: true,
+				free:    map[string]string{"BTC": "9.4995", "ETH": "10.5"},
+				states:  []environment.OrderState{environment.OrderCanceled},
+				fills:   []testFill{{"1", "0.5", "0.0005", true}},
+			},
+		}},
+		{"limit buy crossing the book with slippage", environment.SimulationConfig{Slippage: 0.01}, nil, []simulatorStep{
+			{
+				name:   "filled as taker at the slipped prices of the levels",
+				book:   &environment.OrderBook{Asks: levels("1", "1", "1.05", "5")},
+				call:   buyLimit("2", "1.1"),
+				free:   map[string]string{"BTC": "7.925359", "ETH": "12"},
+				states: []environment.OrderState{environment.OrderFilled},
+				fills:  []testFill{{"1.01", "1", "0.00202", false}, {"1.0605", "1", "0.002121", false}},
+			},
+		}},
+		{"slipped price capped at the limit", environment.SimulationConfig{Slippage: 0.05}, nil, []simulatorStep{
+			{
+				name:   "filled as taker at its limit",
+				book:   &environment.OrderBook{Asks: levels("1", "5")},
+				call:   buyLimit("1", "1.02"),
+				free:   map[string]string{"BTC": "8.97796", "ETH": "11"},
+				states: []environment.OrderState{environment.OrderFilled},
+				fills:  []testFill{{"1.02", "1", "0.00204", false}},
+			},
+		}},
+		{"fee reserve", environment.SimulationConfig{}, nil, []simulatorStep{
+			{
+				name:    "balance covering the notional but not the fees",
+				call:    buyLimit("10", "1"),
+				wantErr: true,
+				free:    map[string]string{"BTC": "10", "ETH": "10"},
+			},
+			{
+				name:   "balance covering the notional and the fees",
+				call:   buyLimit("9.9", "1"),
+				free:   map[string]string{"BTC": "0.0802", "ETH": "10"},
+				locked: map[string]string{"BTC": "9.9198"},
+				states: []environment.OrderState{environment.OrderNew},
+			},
+		}},
+		{"fees not calculated", environment.SimulationConfig{}, errors.New("Fees not available"), []simulatorStep{
+			{
+				name:    "limit order rejected",
+				call:    buyLimit("1", "1"),
+				wantErr: true,
+				free:    map[string]string{"BTC": "10", "ETH": "10"},
+			},
+			{
+				name:    "market order rejected",
+				book:    &environment.OrderBook{Asks: levels("1", "5")},
+				call:    buyMarket("1"),
+				wantErr: true,
+				free:    map[string]string{"BTC": "10", "ETH": "10"},
+			},
+		}},
+		{"market buy depth", environment.SimulationConfig{}, nil, []simulatorStep{
+			{
+				name:    "rejected when the book is not deep enough",
+				book:    &environment.OrderBook{Asks: levels("1", "1")},
+				call:    buyMarket("2"),
+				wantErr: true,
+				free:    map[string]string{"BTC": "10", "ETH": "10"},
+			},
+			{
+				name:   "filled as taker when the book is deep enough",
+				call:   buyMarket("1"),
+				free:   map[string]string{"BTC": "8.998", "ETH": "11"},
+				states: []environment.OrderState{environment.OrderFilled},
+				fills:  []testFill{{"1", "1", "0.002", false}},
+			},
+		}},
+		{"market buy partial fills", environment.SimulationConfig{PartialFills: true}, nil, []simulatorStep{
+			{
+				name:   "filled up to the depth of the book, the rest canceled",
+				book:   &environment.OrderBook{Asks: levels("1", "1")},
+				call:   buyMarket("2"),
+				free:   map[string]string{"BTC": "8.998", "ETH": "11"},
+				states: []environment.OrderState{environment.OrderCanceled},
+				fills:  []testFill{{"1", "1", "0.002", false}},
+			},
+		}},
+		{"market sell with slippage", environment.SimulationConfig{Slippage: 0.01}, nil, []simulatorStep{
+			{
+				name:   "walks the bids at their slipped prices, charging taker fees",
+				book:   &environment.OrderBook{Bids: levels("1", "1", "0.9", "5")},
+				call:   sellMarket("2"),
+				free:   map[string]string{"BTC": "11.877238", "ETH": "8"},
+				states: []environment.OrderState{environment.OrderFilled},
+				fills:  []testFill{{"0.99", "1", "0.00198", false}, {"0.891", "1", "0.001782", false}},
+			},
+		}},
+		{"market order after the resting orders", environment.SimulationConfig{}, nil, []simulatorStep{
+			{
+				name:   "resting order",
+				call:   buyLimit("1", "1"),
+				free:   map[string]string{"BTC": "8.998", "ETH": "10"},
+				locked: map[string]string{"BTC": "1.002"},
+				states: []environment.OrderState{environment.OrderNew},
+			},
+			{
+				name:    "rejected on the liquidity left by the resting order, filled in the same book",
+				book:    &environment.OrderBook{Asks: levels("1", "1.5")},
+				call:    buyMarket("1"),
+				wantErr: true,
+				free:    map[string]string{"BTC": "8.999", "ETH": "11"},
+				states:  []environment.OrderState{environment.OrderFilled},
+				fills:   []testFill{{"1", "1", "0.001", true}},
+			},
+			{
+				name:   "filled on the liquidity left",
+				call:   buyMarket("0.5"),
+				free:   map[string]string{"BTC": "8.498", "ETH": "11.5"},
+				states: []environment.OrderState{environment.OrderFilled, environment.OrderFilled},
+				fills:  []testFill{{"1", "1", "0.001", true}, {"1", "0.5", "0.001", false}},
+			},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inner := &bookWrapper{namedWrapper: namedWrapper{name: "exchange"}, book: book, feesErr: test.feesErr}
+			sim := NewExchangeWrapperSimulator(inner, map[string]decimal.Decimal{
+				"BTC": decimal.NewFromInt(10),
+				"ETH": decimal.NewFromInt(10),
+			})
+			sim.SetOptions(test.options)
+
+			var orderIDs []string
+			for _, step := range test.steps {
+				if step.book != nil {
+					inner.book = *step.book
+				}
+				if step.ticker != nil {
+					inner.ticker = *step.ticker
+				}
+
+				orderID, err := step.call(sim, orderIDs)
+				if (err != nil) != step.wantErr {
+					t.Fatalf("%s: error = %v, want error %t", step.name, err, step.wantErr)
+				}
+				if orderID != "" {
+					orderIDs = append(orderIDs, orderID)
+				}
+				checkSimulator(t, sim, step, orderIDs)
+			}
+		})
+	}
+}
+
+// checkSimulator verifies the balances, the orders and the fills of the simulator after a step.
+func checkSimulator(t *testing.T, sim *ExchangeWrapperSimulator, step simulatorStep, orderIDs []string) {
+	t.Helper()
+
+	balances, err := sim.GetBalances()
+	if err != nil {
+		t.Fatalf("%s: GetBalances failed: %s", step.name, err)
+	}
+	for currency, balance := range balances {
+		want := decimal.Zero
+		if free, expected := step.free[currency]; expected {
+			want = decimal.RequireFromString(free)
+		}
+		if !balance.Free.Equal(want) {
+			t.Errorf("%s: free %s = %s, want %s", step.name, currency, balance.Free, want)
+		}
+
+		want = decimal.Zero
+		if locked, expected := step.locked[currency]; expected {
+			want = decimal.RequireFromString(locked)
+		}
+		if !balance.Locked.Equal(want) {
+			t.Errorf("%s: locked %s = %s, want %s", step.name, currency, balance.Locked, want)
+		}
+	}
+
+	if len(orderIDs) != len(step.states) {
+		t.Fatalf("%s: %d orders placed, want %d", step.name, len(orderIDs), len(step.states))
+	}
+	sim.mu.Lock()
+	for i, orderID := range orderIDs {
+		if state := sim.orders[orderID].status.State; state != step.states[i] {
+			t.Errorf("%s: order %d is %s, want %s", step.name, i, state, step.states[i])
+		}
+	}
+	sim.mu.Unlock()
+
+	fills := sim.Fills(testMarket)
+	if len(fills) != len(step.fills) {
+		t.Fatalf("%s: %d fills, want %d", step.name, len(fills), len(step.fills))
+	}
+	for i, fill := range fills {
+		want := step.fills[i]
+		if !fill.Price.Equal(decimal.RequireFromString(want.price)) || !fill.Quantity.Equal(decimal.RequireFromString(want.quantity)) ||
+			!fill.Fee.Equal(decimal.RequireFromString(want.fee)) || fill.Maker != want.maker {
+			t.Errorf("%s: fill %d = %s @ %s (fee %s, maker %t), want %s @ %s (fee %s, maker %t)", step.name, i,
+				fill.Quantity, fill.Price, fill.Fee, fill.Maker, want.quantity, want.price, want.fee, want.maker)
+		}
+	}
+}
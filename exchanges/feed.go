@@ -0,0 +1,413 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/sirupsen/logrus"
+)
+
+// FeedState represents the state of the connection of a websocket feed.
+type FeedState string
+
+const (
+	// FeedConnecting represents a feed connecting for the first time.
+	FeedConnecting FeedState = "connecting"
+	// FeedConnected represents a feed connected and subscribed to all its markets.
+	FeedConnected FeedState = "connected"
+	// FeedReconnecting represents a feed which lost its connection, waiting to reconnect.
+	FeedReconnecting FeedState = "reconnecting"
+)
+
+const (
+	feedReconnectDelay    = time.Second      // first delay before reconnecting, doubled at each failed attempt.
+	feedMaxReconnectDelay = time.Minute      // max delay before reconnecting.
+	feedStaleAfter        = 90 * time.Second // a feed without messages for this time is considered disconnected.
+)
+
+// FeedStatus represents the health of a websocket feed of an exchange.
+type FeedStatus struct {
+	Name        string    //Name of the feed.
+	State       FeedState //State of the connection.
+	Since       time.Time //Time of the last change of state.
+	LastMessage time.Time //Time of the last message received, zero if none.
+	Reconnects  int       //Number of disconnections since the feed was connected.
+	LastError   error     //Error which caused the last disconnection, nil if none.
+}
+
+// Healthy returns true if the feed is connected and received a message in the specified time.
+func (status FeedStatus) Healthy(maxSilence time.Duration) bool {
+	return status.State == FeedConnected && time.Since(status.LastMessage) <= maxSilence
+}
+
+// FeedMonitor is implemented by the wrappers which supervise their websocket feeds.
+type FeedMonitor interface {
+	FeedStatus() []FeedStatus // Gets the status of the websocket feeds connected.
+}
+
+// FeedStatusOf gets the status of the websocket feeds of a wrapper, nil if it has no supervised feeds.
+func FeedStatusOf(wrapper ExchangeWrapper) []FeedStatus {
+	monitor, isMonitor := wrapper.(FeedMonitor)
+	if !isMonitor {
+		return nil
+	}
+	return monitor.FeedStatus()
+}
+
+// FeedReleaser is implemented by the wrappers sharing the feed of a market between all the FeedConnect calls subscribing it,
+// disconnecting the feed once all of them released it.
+type FeedReleaser interface {
+	FeedRelease(markets []*environment.Market) // Releases a subscription to the feed of the markets.
+}
+
+// ReleaseFeed releases a subscription to the feed of the markets, if the wrapper counts its subscriptions.
+func ReleaseFeed(wrapper ExchangeWrapper, markets []*environment.Market) {
+	if releaser, isReleaser := wrapper.(FeedReleaser); isReleaser {
+		releaser.FeedRelease(markets)
+	}
+}
+
+// FeedCloser is implemented by the wrappers which can disconnect the feeds of markets whatever the subscriptions left,
+// so that the feeds not released by the strategies are closed on shutdown.
+type FeedCloser interface {
+	FeedClose(markets []*environment.Market) // Releases all the subscriptions to the feed of the markets.
+}
+
+// CloseFeed releases all the subscriptions to the feed of the markets, if the wrapper counts its subscriptions.
+func CloseFeed(wrapper ExchangeWrapper, markets []*environment.Market) {
+	if closer, isCloser := wrapper.(FeedCloser); isCloser {
+		closer.FeedClose(markets)
+	}
+}
+
+// feedSupervisor keeps a websocket feed connected, reconnecting it with backoff when the connection fails or goes silent.
+//
+//     NOTE: the session connects to the feed, subscribes all its markets, calls connected and reads the feed
+//     (calling alive for each message) until the connection fails or ctx is done.
+//     Before each session resync, if not nil, loads from REST the data (order books) the session updates,
+//     the updates sent during a disconnection are lost.
+type feedSupervisor struct {
+	name       string
+	resync     func() error
+	session    func(ctx context.Context, feed *feedSupervisor) error
+	staleAfter time.Duration // not positive for the feeds silent when idle, never considered disconnected.
+	markets    []marketKey   // markets subscribed by the feed.
+	ctx        context.Context
+	stop       context.CancelFunc // stops the supervision, disconnecting the feed.
+
+	lastMessage atomic.Int64 // unix nanoseconds.
+	mutex       sync.Mutex
+	status      FeedStatus
+	ready       chan error // receives the outcome of the first connection, nil once connected.
+}
+
+// newFeedSupervisor creates a supervisor of a websocket feed.
+func newFeedSupervisor(name string, resync func() error, session func(ctx context.Context, feed *feedSupervisor) error) *feedSupervisor {
+	ctx, stop := context.WithCancel(context.Background())
+	return &feedSupervisor{
+		name:       name,
+		resync:     resync,
+		session:    session,
+		staleAfter: feedStaleAfter,
+		ctx:        ctx,
+		stop:       stop,
+		status: FeedStatus{
+			Name:  name,
+			State: FeedConnecting,
+			Since: time.Now(),
+		},
+	}
+}
+
+// start connects the feed, then keeps it connected in background.
+//
+//     NOTE: if the first connection fails the error is returned and the feed is not supervised.
+func (feed *feedSupervisor) start() error {
+	ready := make(chan error, 1)
+	feed.ready = ready
+	go feed.run()
+	return <-ready
+}
+
+// run runs the sessions of the feed, once the first one connected until the feed is stopped.
+func (feed *feedSupervisor) run() {
+	retry := 0
+	for {
+		err := feed.connect()
+		if feed.ctx.Err() != nil {
+			return
+		}
+
+		feed.mutex.Lock()
+		if feed.ready != nil {
+			feed.ready <- err
+			feed.ready = nil
+			feed.mutex.Unlock()
+			return
+		}
+		if feed.status.State == FeedConnected {
+			retry = 0
+		}
+		feed.status.State = FeedReconnecting
+		feed.status.Since = time.Now()
+		feed.status.Reconnects++
+		feed.status.LastError = err
+		feed.mutex.Unlock()
+
+		delay := backoff(feedReconnectDelay, feedMaxReconnectDelay, retry)
+		retry++
+		logrus.Warnf("%s feed disconnected, reconnecting in %s: %s", feed.name, delay, err)
+		select {
+		case <-feed.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect resyncs the feed and runs a session, returning why it ended.
+func (feed *feedSupervisor) connect() error {
+	if feed.resync != nil {
+		if err := feed.resync(); err != nil {
+			return fmt.Errorf("Cannot resync %s feed: %w", feed.name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(feed.ctx)
+	defer cancel(nil)
+	if feed.staleAfter > 0 {
+		go feed.watch(ctx, cancel, time.Now())
+	}
+
+	err := feed.session(ctx, feed)
+	if cause := context.Cause(ctx); cause != nil {
+		return cause
+	}
+	if err == nil {
+		return errors.New("Connection closed")
+	}
+	return err
+}
+
+// watch cancels the session started at the specified time if the feed goes silent.
+func (feed *feedSupervisor) watch(ctx context.Context, cancel context.CancelCauseFunc, started time.Time) {
+	ticker := time.NewTicker(feed.staleAfter / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lastMessage := time.Unix(0, feed.lastMessage.Load())
+			if lastMessage.Before(started) {
+				lastMessage = started
+			}
+			if time.Since(lastMessage) > feed.staleAfter {
+				cancel(fmt.Errorf("No messages received for %s", feed.staleAfter))
+				return
+			}
+		}
+	}
+}
+
+// connected marks the feed as connected, the session calls it once all the markets are subscribed.
+func (feed *feedSupervisor) connected() {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	feed.status.State = FeedConnected
+	feed.status.Since = time.Now()
+	if feed.ready != nil {
+		feed.ready <- nil
+		feed.ready = nil
+	}
+}
+
+// alive records a message received by the feed.
+func (feed *feedSupervisor) alive() {
+	feed.lastMessage.Store(time.Now().UnixNano())
+}
+
+// Status gets the status of the feed.
+func (feed *feedSupervisor) Status() FeedStatus {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	ret := feed.status
+	if lastMessage := feed.lastMessage.Load(); lastMessage != 0 {
+		ret.LastMessage = time.Unix(0, lastMessage)
+	}
+	return ret
+}
+
+// feedSet represents the supervised feeds of a wrapper, shared between all the subscriptions of their markets.
+type feedSet struct {
+	mutex       sync.Mutex
+	feeds       []*feedSupervisor
+	subscribers map[marketKey]int // subscriptions of each market.
+}
+
+// connect adds a subscription to the markets, starting a feed created by newFeed for the ones without a feed yet.
+//
+//     NOTE: if the feed cannot be started the subscriptions are removed.
+func (set *feedSet) connect(markets []*environment.Market, newFeed func(markets []*environment.Market) (*feedSupervisor, error)) error {
+	markets = set.subscribe(markets)
+	if len(markets) == 0 {
+		return nil
+	}
+
+	feed, err := newFeed(markets)
+	if err == nil {
+		for _, market := range markets {
+			feed.markets = append(feed.markets, keyOf(market))
+		}
+		err = feed.start()
+	}
+	if err != nil {
+		set.unsubscribe(markets)
+		return err
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	if !set.subscribedLocked(feed) { // released while connecting.
+		feed.stop()
+		return nil
+	}
+	set.feeds = append(set.feeds, feed)
+	return nil
+}
+
+// subscribe adds a subscription to the markets, returning the ones subscribed for the first time.
+func (set *feedSet) subscribe(markets []*environment.Market) []*environment.Market {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if set.subscribers == nil {
+		set.subscribers = make(map[marketKey]int)
+	}
+
+	var ret []*environment.Market
+	for _, market := range uniqueMarkets(markets) {
+		key := keyOf(market)
+		set.subscribers[key]++
+		if set.subscribers[key] == 1 {
+			ret = append(ret, market)
+		}
+	}
+	return ret
+}
+
+// unsubscribe removes a subscription from the markets, stopping the feeds without subscribed markets left.
+//
+// It returns the markets without subscriptions left.
+func (set *feedSet) unsubscribe(markets []*environment.Market) []*environment.Market {
+	return set.release(markets, 1)
+}
+
+// unsubscribeAll removes all the subscriptions from the markets, stopping the feeds without subscribed markets left.
+//
+// It returns the markets which were subscribed.
+func (set *feedSet) unsubscribeAll(markets []*environment.Market) []*environment.Market {
+	return set.release(markets, math.MaxInt)
+}
+
+// release removes at most count subscriptions from each market, stopping the feeds without subscribed markets left.
+//
+// It returns the markets without subscriptions left.
+func (set *feedSet) release(markets []*environment.Market, count int) []*environment.Market {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	var ret []*environment.Market
+	for _, market := range uniqueMarkets(markets) {
+		key := keyOf(market)
+		if set.subscribers[key] == 0 {
+			continue
+		}
+		set.subscribers[key] -= min(count, set.subscribers[key])
+		if set.subscribers[key] == 0 {
+			delete(set.subscribers, key)
+			ret = append(ret, market)
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil
+	}
+
+	feeds := set.feeds[:0]
+	for _, feed := range set.feeds {
+		if set.subscribedLocked(feed) {
+			feeds = append(feeds, feed)
+		} else {
+			feed.stop()
+		}
+	}
+	set.feeds = feeds
+	return ret
+}
+
+// subscribedLocked returns true if a market of the feed is subscribed, the set must be locked.
+func (set *feedSet) subscribedLocked(feed *feedSupervisor) bool {
+	for _, key := range feed.markets {
+		if set.subscribers[key] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribed returns true if the market is subscribed to a feed of the set.
+func (set *feedSet) subscribed(market *environment.Market) bool {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return set.subscribers[keyOf(market)] > 0
+}
+
+// status gets the status of all the feeds of the set.
+func (set *feedSet) status() []FeedStatus {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	ret := make([]FeedStatus, len(set.feeds))
+	for i, feed := range set.feeds {
+		ret[i] = feed.Status()
+	}
+	return ret
+}
+
+// uniqueMarkets gets the markets without duplicates, the same market may be described by more instances.
+func uniqueMarkets(markets []*environment.Market) []*environment.Market {
+	seen := make(map[marketKey]bool, len(markets))
+	ret := make([]*environment.Market, 0, len(markets))
+	for _, market := range markets {
+		if key := keyOf(market); !seen[key] {
+			seen[key] = true
+			ret = append(ret, market)
+		}
+	}
+	return ret
+}
@@ -16,10 +16,19 @@
 package exchanges
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 )
 
 // TradeType represents a type of order, from trading fees point of view.
@@ -34,33 +43,205 @@ const (
 
 //ExchangeWrapper provides a generic wrapper for exchange services.
 type ExchangeWrapper interface {
-	Name() string                                                                    // Gets the name of the exchange.
-	GetCandles(market *environment.Market) ([]environment.CandleStick, error)        // Gets the candle data from the exchange.
-	GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) // Gets the current market summary.
-	GetOrderBook(market *environment.Market) (*environment.OrderBook, error)         // Gets the order(ASK + BID) book of a market.
+	Name() string                                                                                                                                // Gets the name of the exchange.
+	Capabilities() Capabilities                                                                                                                  // Gets the operations supported by the wrapper.
+	GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) // Gets the candles of a market opened in the [from, to) time range.
+	GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error)                                                             // Gets the current market summary.
+	GetOrderBook(market *environment.Market) (*environment.OrderBook, error)                                                                     // Gets the order(ASK + BID) book of a market.
+	GetRecentTrades(market *environment.Market) ([]environment.Trade, error)                                                                     // Gets the most recent trades of a market, sorted by time.
 
-	BuyLimit(market *environment.Market, amount float64, limit float64) (string, error)  // Performs a limit buy action.
-	SellLimit(market *environment.Market, amount float64, limit float64) (string, error) // Performs a limit sell action.
-	BuyMarket(market *environment.Market, amount float64) (string, error)                // Performs a market buy action.
-	SellMarket(market *environment.Market, amount float64) (string, error)               // Performs a market sell action.
+	BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error)  // Performs a limit buy action.
+	SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) // Performs a limit sell action.
+	BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error)                        // Performs a market buy action.
+	SellMarket(market *environment.Market, amount decimal.Decimal) (string, error)                       // Performs a market sell action.
 
-	CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 // Calculates the trading fees for an order on a specified market.
-	CalculateWithdrawFees(market *environment.Market, amount float64) float64                                    // Calculates the withdrawal fees on a specified market.
+	GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) // Gets the status of an order placed on the exchange.
+	GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error)           // Gets the open orders of the user on a market.
+	CancelOrder(market *environment.Market, orderID string) error                          // Cancels an open order.
+	CancelAllOrders(market *environment.Market) error                                      // Cancels all the open orders of the user on a market.
 
-	GetBalance(symbol string) (*decimal.Decimal, error) // Gets the balance of the user of the specified currency.
-	GetDepositAddress(coinTicker string) (string, bool) // Gets the deposit address for the specified coin on the exchange, if exists.
+	CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) // Calculates the trading fees for an order on a specified market.
+	CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error)                                            // Calculates the withdrawal fees on a specified market.
+
+	GetBalance(symbol string) (*decimal.Decimal, error)   // Gets the balance of the user of the specified currency.
+	GetBalances() (map[string]environment.Balance, error) // Gets the free, locked and total balances of the user of all the currencies, by currency.
+	GetDepositAddress(coinTicker string) (string, bool)   // Gets the deposit address for the specified coin on the exchange, if exists.
 
 	FeedConnect(markets []*environment.Market) error // Connects to the feed of the exchange.
 
-	Withdraw(destinationAddress string, coinTicker string, amount float64) error // Performs a withdraw operation from the exchange to a destination address.
+	Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error // Performs a withdraw operation from the exchange to a destination address.
 
 	String() string // Returns a string representation of the object.
 }
 
-// ErrWebsocketNotSupported is the error representing when an exchange does not support websocket.
-var ErrWebsocketNotSupported = errors.New("Cannot use websocket: exchange does not support it")
+// ErrWebsocketNotSupported is the error representing when an exchange does not support websocket, it is an ErrNotSupported.
+var ErrWebsocketNotSupported = withKind(ErrNotSupported, errors.New("Cannot use websocket: exchange does not support it"))
 
 // MarketNameFor gets the market name as seen by the exchange.
 func MarketNameFor(m *environment.Market, wrapper ExchangeWrapper) string {
 	return m.ExchangeNames[wrapper.Name()]
 }
+
+// MarketInfoProvider is implemented by the wrappers which know the trading rules (tick size, lot size, min notional) of their markets.
+type MarketInfoProvider interface {
+	GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) // Gets the trading rules of a market.
+}
+
+// DefaultMaxDataAge represents the max age of the data served from the websocket feeds, if not configured.
+const DefaultMaxDataAge = 2 * time.Minute
+
+// DataAgeLimiter is implemented by the wrappers serving the data of their websocket feeds from a cache,
+// failing with ErrStaleData when it is older than a max age.
+type DataAgeLimiter interface {
+	SetMaxDataAge(maxAge time.Duration) // Sets the max age of the cached data, not positive means no limit.
+}
+
+// prepareOrder rounds the amount and the limit (zero for market orders) of an order to the trading rules of its market,
+// then validates it before the submission.
+//
+//     NOTE: if the rules of the market cannot be loaded the order is submitted as is.
+func prepareOrder(wrapper ExchangeWrapper, market *environment.Market, orderType environment.OrderType, amount decimal.Decimal, limit decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	provider, hasRules := wrapper.(MarketInfoProvider)
+	if !hasRules {
+		return amount, limit, nil
+	}
+
+	info, err := provider.GetMarketInfo(market)
+	if err != nil {
+		logrus.Warnf("Cannot get the trading rules of %s on %s, order not validated: %s", market.Name, wrapper.Name(), err)
+		return amount, limit, nil
+	}
+
+	quantity, price, err := info.PrepareOrder(orderType, amount, limit)
+	if err != nil {
+		return amount, limit, withKind(ErrInvalidOrder, err)
+	}
+	return quantity, price, nil
+}
+
+// formatOrder formats the quantity and the price (empty for market orders) of a prepared order
+// with the decimal places of the quantity step and the price tick of its market, for the requests sent as text.
+//
+//     NOTE: without trading rules the exact decimal is sent, never a float64 approximation.
+func formatOrder(wrapper ExchangeWrapper, market *environment.Market, quantity decimal.Decimal, price decimal.Decimal) (string, string) {
+	var info environment.MarketInfo
+	if provider, hasRules := wrapper.(MarketInfoProvider); hasRules {
+		info, _ = provider.GetMarketInfo(market) // already logged by prepareOrder, formatted as is on error.
+	}
+
+	formattedPrice := ""
+	if price.IsPositive() {
+		formattedPrice = formatDecimal(price, info.PriceTick)
+	}
+	return formatDecimal(quantity, info.QuantityStep), formattedPrice
+}
+
+// formatDecimal formats a value with the decimal places of the specified step, as is if the step is not positive.
+func formatDecimal(value decimal.Decimal, step decimal.Decimal) string {
+	if !step.IsPositive() {
+		return value.String()
+	}
+
+	places := int32(0)
+	for !step.Shift(places).IsInteger() {
+		places++
+	}
+	return value.StringFixed(places)
+}
+
+// filterCandles gets the candles opened in the [from, to) time range, where a zero time means no bound.
+func filterCandles(candles []environment.CandleStick, from time.Time, to time.Time) []environment.CandleStick {
+	ret := make([]environment.CandleStick, 0, len(candles))
+	for _, candle := range candles {
+		if candle.OpenTime.Before(from) || (!to.IsZero() && !candle.OpenTime.Before(to)) {
+			continue
+		}
+		ret = append(ret, candle)
+	}
+	return ret
+}
+
+// candlesCover returns true if the candles, sorted by open time, cover the time range starting from the specified time.
+func candlesCover(candles []environment.CandleStick, from time.Time) bool {
+	return len(candles) > 0 && (from.IsZero() || !candles[0].OpenTime.After(from))
+}
+
+// paginateCandles gets the candles opened in the [from, to) time range, calling fetch for each page until the range is covered.
+//
+//     NOTE: fetch gets the candles opened since the specified time, at most a page at a time.
+//     A zero from fetches a single page, usually the most recent candles.
+func paginateCandles(interval environment.CandleInterval, from time.Time, to time.Time, fetch func(since time.Time) ([]environment.CandleStick, error)) ([]environment.CandleStick, error) {
+	if interval.Duration() == 0 {
+		return nil, fmt.Errorf("Invalid candle interval: %s", interval)
+	}
+
+	if from.IsZero() {
+		page, err := fetch(from)
+		if err != nil {
+			return nil, err
+		}
+		return filterCandles(page, from, to), nil
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	var ret []environment.CandleStick
+	for since := from; since.Before(to); {
+		page, err := fetch(since)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		ret = append(ret, filterCandles(page, since, to)...)
+
+		next := page[len(page)-1].OpenTime.Add(interval.Duration())
+		if !next.After(since) {
+			break
+		}
+		since = next
+	}
+	return ret, nil
+}
+
+// takerSide gets the side of a trade from the side of its taker.
+func takerSide(buy bool) environment.OrderType {
+	if buy {
+		return environment.Bid
+	}
+	return environment.Ask
+}
+
+// restTimeout is the maximum duration of the REST requests sent by the adapters, response body included.
+const restTimeout = 30 * time.Second
+
+// restClient sends the REST requests not sent through the client of an exchange.
+var restClient = &http.Client{Timeout: restTimeout}
+
+// getJSON performs a GET request to a public endpoint not exposed by the client of an exchange, decoding its JSON response.
+func getJSON(ctx context.Context, endpoint string, query url.Values, target interface{}) error {
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Request to %s failed: %s %s", endpoint, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,48 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		step  string
+		want  string
+	}{
+		{"no step", "0.1234567890123", "0", "0.1234567890123"},
+		{"padded to the step", "1.5", "0.001", "1.500"},
+		{"step with trailing zeros", "0.12", "0.00100000", "0.120"},
+		{"integer step", "42", "1", "42"},
+		{"step coarser than one", "1200", "100", "1200"},
+		{"beyond float64 precision", "12345678.12345678", "0.00000001", "12345678.12345678"},
+		{"tiny step", "0.0000000001", "0.0000000001", "0.0000000001"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := formatDecimal(decimal.RequireFromString(test.value), decimal.RequireFromString(test.step))
+			if got != test.want {
+				t.Errorf("formatDecimal(%s, %s) = %s, want %s", test.value, test.step, got, test.want)
+			}
+		})
+	}
+}
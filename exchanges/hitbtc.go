@@ -17,38 +17,85 @@
 package exchanges
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"sort"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/gorilla/websocket"
 
 	"github.com/juju/errors"
 	"github.com/saniales/go-hitbtc"
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 )
 
 // HitBtcWrapperV2 wraps HitBtc API v2.0
 type HitBtcWrapperV2 struct {
 	api              *hitbtc.HitBtc
 	ws               *hitbtc.WSClient
+	publicKey        string // credentials of the login to the websocket reports, not exposed by the client.
+	secretKey        string
 	websocketOn      bool
 	summaries        *SummaryCache
 	orderbook        *OrderbookCache
+	candles          *CandlesCache
+	candleFeeds      map[string]bool           // if true, i am subscribing to the candles of the market with the period in the key.
+	candleRequests   map[hitbtcCandleFeed]bool // candles requested, subscribed again when the feed reconnects.
+	candleFeedsMutex *sync.Mutex
+	marketInfo       *MarketInfoCache
 	depositAddresses map[string]string
+	feeds            feedSet
+	account          accountStream
+	maxDataAge       time.Duration
+	bookDepth        int
+}
+
+const (
+	hitbtcWebsocketURL          = "wss://api.hitbtc.com/api/2/ws"
+	hitbtcBalancePollInterval   = 30 * time.Second // the reports do not include the balances, they are requested on the same websocket.
+	hitbtcReportsRequestID      = 1
+	hitbtcBalancesRequestIDBase = 2
+)
+
+// hitbtcCandleFeed represents the candles feed of a market for an interval.
+type hitbtcCandleFeed struct {
+	market   *environment.Market
+	interval environment.CandleInterval
 }
 
 // NewHitBtcV2Wrapper creates a generic wrapper of the HitBtc API v2.0.
 func NewHitBtcV2Wrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
-	ws, _ := hitbtc.NewWSClient()
-	return &HitBtcWrapperV2{
-		api:              hitbtc.New(publicKey, secretKey),
-		ws:               ws,
+	wrapper := &HitBtcWrapperV2{
+		api:              hitbtc.NewWithCustomHttpClient(publicKey, secretKey, restClient),
+		publicKey:        publicKey,
+		secretKey:        secretKey,
 		websocketOn:      false,
 		summaries:        NewSummaryCache(),
 		orderbook:        NewOrderbookCache(),
+		candles:          NewCandlesCache(),
+		candleFeeds:      make(map[string]bool),
+		candleRequests:   make(map[hitbtcCandleFeed]bool),
+		candleFeedsMutex: &sync.Mutex{},
 		depositAddresses: depositAddresses,
+		maxDataAge:       DefaultMaxDataAge,
 	}
+	wrapper.marketInfo = NewMarketInfoCache(wrapper.GetMarkets)
+	wrapper.account.exchange = wrapper.Name()
+	return wrapper
+}
+
+func init() {
+	Register("hitbtc", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewHitBtcV2Wrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
 }
 
 // Name returns the name of the wrapped exchange.
@@ -56,6 +103,21 @@ func (wrapper *HitBtcWrapperV2) Name() string {
 	return "hitbtc"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *HitBtcWrapperV2) Capabilities() Capabilities {
+	return Capabilities{
+		WebsocketFeeds: true,
+		Candles:        true,
+		Trades:         true,
+		LimitOrders:    true,
+		MarketOrders:   true,
+		Withdraw:       true,
+		TradingFees:    true,
+		OrderQuery:     true,
+		AccountStream:  true,
+	}
+}
+
 func (wrapper *HitBtcWrapperV2) String() string {
 	return wrapper.Name()
 }
@@ -65,7 +127,7 @@ func (wrapper *HitBtcWrapperV2) GetMarkets() ([]*environment.Market, error) {
 	HitBtcMarkets, err := wrapper.api.GetSymbols()
 
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	wrappedMarkets := make([]*environment.Market, 0, len(HitBtcMarkets))
@@ -74,23 +136,31 @@ func (wrapper *HitBtcWrapperV2) GetMarkets() ([]*environment.Market, error) {
 			Name:           market.Id,
 			BaseCurrency:   market.BaseCurrency,
 			MarketCurrency: market.QuoteCurrency,
+			Info: &environment.MarketInfo{
+				PriceTick:    decimal.NewFromFloat(market.TickSize),
+				QuantityStep: decimal.NewFromFloat(market.QuantityIncrement),
+			},
 		})
 	}
 
 	return wrappedMarkets, nil
 }
 
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *HitBtcWrapperV2) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return wrapper.marketInfo.Get(MarketNameFor(market, wrapper))
+}
+
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *HitBtcWrapperV2) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
-	ret, exists := wrapper.orderbook.Get(market)
 	if !wrapper.websocketOn {
 		hitbtcOrderBook, err := wrapper.api.GetOrderbook(MarketNameFor(market, wrapper))
 
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
-		ret = &environment.OrderBook{}
+		ret := &environment.OrderBook{}
 		for _, order := range hitbtcOrderBook.Bid {
 			amount := decimal.NewFromFloat(order.Size)
 			rate := decimal.NewFromFloat(order.Price)
@@ -112,92 +182,235 @@ func (wrapper *HitBtcWrapperV2) GetOrderBook(market *environment.Market) (*envir
 		return ret, nil
 	}
 
-	if !exists {
-		return nil, errors.New("Orderbook not loaded")
-	}
-
-	return ret, nil
+	return wrapper.orderbook.GetFresh(market, wrapper.maxDataAge)
 }
 
 // BuyLimit performs a limit buy action.
-func (wrapper *HitBtcWrapperV2) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
+func (wrapper *HitBtcWrapperV2) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Bid, "limit", amount, limit)
+}
+
+// BuyMarket performs a market buy action.
+func (wrapper *HitBtcWrapperV2) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Bid, "market", amount, decimal.Zero)
+}
+
+// SellLimit performs a limit sell action.
+func (wrapper *HitBtcWrapperV2) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Ask, "limit", amount, limit)
+}
+
+// SellMarket performs a market sell action.
+func (wrapper *HitBtcWrapperV2) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.placeOrder(market, environment.Ask, "market", amount, decimal.Zero)
+}
 
-	requestOrder := hitbtc.Order{
-		Symbol:   MarketNameFor(market, wrapper),
-		Side:     "buy",
-		Status:   "new",
-		Type:     "limit",
-		Quantity: amount,
-		Price:    limit,
+// placeOrder places an order with a client order ID generated here, the price is zero for market orders.
+//
+//     NOTE: the client formats the quantity and the price from float64 with 8 decimals, so the order
+//     is sent by the wrapper with the decimals formatted at the precision of the market.
+func (wrapper *HitBtcWrapperV2) placeOrder(market *environment.Market, orderType environment.OrderType, hitbtcType string, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, orderType, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
 	}
 
-	orderNumber, err := wrapper.api.PlaceOrder(requestOrder)
+	clientOrderID, err := uuid.NewV4()
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
 	}
-	return fmt.Sprint(orderNumber.ClientOrderId), nil
-}
 
-// BuyMarket performs a market buy action.
-func (wrapper *HitBtcWrapperV2) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	requestOrder := hitbtc.Order{
-		Symbol:   MarketNameFor(market, wrapper),
-		Side:     "buy",
-		Status:   "new",
-		Type:     "market",
-		Quantity: amount,
+	side := "buy"
+	if orderType == environment.Ask {
+		side = "sell"
 	}
 
-	orderNumber, err := wrapper.api.PlaceOrder(requestOrder)
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	params := url.Values{}
+	params.Set("symbol", MarketNameFor(market, wrapper))
+	params.Set("side", side)
+	params.Set("type", hitbtcType)
+	params.Set("quantity", formattedQuantity)
+	if formattedPrice != "" {
+		params.Set("price", formattedPrice)
+	}
+
+	var order hitbtc.Order
+	err = wrapper.privateRequest(http.MethodPut, "/order/"+clientOrderID.String()[:32], params, &order) // max length is 32 characters
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
 	}
-	return fmt.Sprint(orderNumber.ClientOrderId), nil
+	return order.ClientOrderId, nil
 }
 
-// SellLimit performs a limit sell action.
-func (wrapper *HitBtcWrapperV2) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	requestOrder := hitbtc.Order{
-		Symbol:   MarketNameFor(market, wrapper),
-		Side:     "sell",
-		Type:     "limit",
-		Quantity: amount,
-		Price:    limit,
+// hitbtcError represents an error returned by the REST API.
+type hitbtcError struct {
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+}
+
+func (e *hitbtcError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
 	}
+	return fmt.Sprintf("%s: %s (code %d)", e.Message, e.Description, e.Code)
+}
 
-	orderNumber, err := wrapper.api.PlaceOrder(requestOrder)
+// privateRequest performs a request authenticated with the API keys to a path of the REST API,
+// sending the parameters as a form and decoding the JSON response into target.
+func (wrapper *HitBtcWrapperV2) privateRequest(method string, path string, params url.Values, target interface{}) error {
+	req, err := http.NewRequest(method, hitbtc.API_BASE+path, strings.NewReader(params.Encode()))
 	if err != nil {
-		return "", err
+		return err
 	}
-	return fmt.Sprint(orderNumber.ClientOrderId), nil
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(wrapper.publicKey, wrapper.secretKey)
+
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var failure struct {
+		Error *hitbtcError `json:"error"`
+	}
+	if json.Unmarshal(body, &failure) == nil && failure.Error != nil {
+		return failure.Error
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to %s failed: %s %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, target)
 }
 
-// SellMarket performs a market sell action.
-func (wrapper *HitBtcWrapperV2) SellMarket(market *environment.Market, amount float64) (string, error) {
-	clientOrderID, err := uuid.NewV4()
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *HitBtcWrapperV2) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	var ret *environment.OrderStatus
+
+	openOrders, err := wrapper.api.GetOpenOrders()
 	if err != nil {
-		return "", err
+		return nil, mapError(wrapper, err)
+	}
+
+	for _, order := range openOrders {
+		if order.ClientOrderId == orderID {
+			status := convertFromHitBtcOrder(order)
+			ret = &status
+			break
+		}
 	}
-	requestOrder := hitbtc.Order{
-		Symbol:        MarketNameFor(market, wrapper),
-		Side:          "sell",
-		Type:          "market",
-		Quantity:      amount,
-		ClientOrderId: clientOrderID.String()[:32], // max length is 32 characters
+
+	if ret == nil {
+		hitbtcOrders, err := wrapper.api.GetOrder(orderID)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+		if len(hitbtcOrders) == 0 {
+			return nil, errors.New("Order not found")
+		}
+		status := convertFromHitBtcOrder(hitbtcOrders[0])
+		ret = &status
 	}
 
-	orderNumber, err := wrapper.api.PlaceOrder(requestOrder)
+	if !ret.FilledQuantity.IsZero() {
+		hitbtcTrades, err := wrapper.api.GetTrades(MarketNameFor(market, wrapper))
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+
+		total := decimal.Zero
+		for _, trade := range hitbtcTrades {
+			if trade.ClientOrderId != orderID {
+				continue
+			}
+			total = total.Add(decimal.NewFromFloat(trade.Quantity).Mul(decimal.NewFromFloat(trade.Price)))
+			ret.Fee = ret.Fee.Add(decimal.NewFromFloat(trade.Fee))
+		}
+		ret.AveragePrice = total.Div(ret.FilledQuantity)
+		ret.FeeCurrency = market.BaseCurrency
+	}
+
+	return ret, nil
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+//
+//     NOTE: fees and average prices are not loaded, use GetOrder to get them.
+func (wrapper *HitBtcWrapperV2) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	hitbtcOrders, err := wrapper.api.GetOpenOrders()
 	if err != nil {
-		return "", err
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, 0, len(hitbtcOrders))
+	for _, order := range hitbtcOrders {
+		if order.Symbol == MarketNameFor(market, wrapper) {
+			ret = append(ret, convertFromHitBtcOrder(order))
+		}
+	}
+
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+//
+//     NOTE: the HitBtc client only supports the cancellation of all orders of a market, use CancelAllOrders instead.
+func (wrapper *HitBtcWrapperV2) CancelOrder(market *environment.Market, orderID string) error {
+	return errors.New("CancelOrder not supported on hitbtc, use CancelAllOrders")
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *HitBtcWrapperV2) CancelAllOrders(market *environment.Market) error {
+	_, err := wrapper.api.CancelOrder(MarketNameFor(market, wrapper))
+	return mapError(wrapper, err)
+}
+
+// convertFromHitBtcOrder converts a hitbtc order to a environment.OrderStatus.
+func convertFromHitBtcOrder(order hitbtc.Order) environment.OrderStatus {
+	ret := environment.OrderStatus{
+		ID:             order.ClientOrderId,
+		Type:           environment.Bid,
+		Price:          decimal.NewFromFloat(order.Price),
+		Quantity:       decimal.NewFromFloat(order.Quantity),
+		FilledQuantity: decimal.NewFromFloat(order.CumQuantity),
+		Timestamp:      order.Created,
+	}
+
+	if order.Side == "sell" {
+		ret.Type = environment.Ask
+	}
+	ret.State = hitbtcOrderState(order.Status)
+
+	return ret
+}
+
+// hitbtcOrderState converts the status of a HitBtc order to a environment.OrderState.
+func hitbtcOrderState(status string) environment.OrderState {
+	switch status {
+	case "new", "suspended":
+		return environment.OrderNew
+	case "partiallyFilled":
+		return environment.OrderPartiallyFilled
+	case "filled":
+		return environment.OrderFilled
+	default: // canceled or expired.
+		return environment.OrderCanceled
 	}
-	return fmt.Sprint(orderNumber.ClientOrderId), nil
 }
 
 // GetTicker gets the updated ticker for a market.
 func (wrapper *HitBtcWrapperV2) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 	hitbtcTicker, err := wrapper.api.GetTicker(MarketNameFor(market, wrapper))
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	ask := decimal.NewFromFloat(hitbtcTicker.Ask)
@@ -212,11 +425,10 @@ func (wrapper *HitBtcWrapperV2) GetTicker(market *environment.Market) (*environm
 
 // GetMarketSummary gets the current market summary.
 func (wrapper *HitBtcWrapperV2) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
-	ret, exists := wrapper.summaries.Get(market)
 	if !wrapper.websocketOn {
 		hitbtcSummary, err := wrapper.api.GetTicker(MarketNameFor(market, wrapper))
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		ask := decimal.NewFromFloat(hitbtcSummary.Ask)
@@ -226,7 +438,7 @@ func (wrapper *HitBtcWrapperV2) GetMarketSummary(market *environment.Market) (*e
 		last := decimal.NewFromFloat(hitbtcSummary.Last)
 		volume := decimal.NewFromFloat(hitbtcSummary.Volume)
 
-		ret = &environment.MarketSummary{
+		ret := &environment.MarketSummary{
 			Last:   last,
 			Ask:    ask,
 			Bid:    bid,
@@ -239,33 +451,30 @@ func (wrapper *HitBtcWrapperV2) GetMarketSummary(market *environment.Market) (*e
 		return ret, nil
 	}
 
-	if !exists {
-		return nil, errors.New("Summary not loaded")
-	}
-
-	return ret, nil
+	return wrapper.summaries.GetFresh(market, wrapper.maxDataAge)
 }
 
 // GetBalance gets the balance of the user of the specified currency.
 func (wrapper *HitBtcWrapperV2) GetBalance(symbol string) (*decimal.Decimal, error) {
-	Hitbtcbalance, err := wrapper.api.GetBalances()
-
+	balances, err := wrapper.GetBalances()
 	if err != nil {
 		return nil, err
 	}
+	return freeBalance(balances, symbol)
+}
 
-	for _, hitbtcBalance := range Hitbtcbalance {
-		if hitbtcBalance.Currency == symbol {
-			ret := decimal.NewFromFloat(hitbtcBalance.Available)
-			if err != nil {
-				return nil, err
-			}
-
-			return &ret, nil
-		}
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+func (wrapper *HitBtcWrapperV2) GetBalances() (map[string]environment.Balance, error) {
+	hitbtcBalances, err := wrapper.api.GetBalances()
+	if err != nil {
+		return nil, mapError(wrapper, err)
 	}
 
-	return nil, errors.New("Symbol not found")
+	ret := make(map[string]environment.Balance, len(hitbtcBalances))
+	for _, hitbtcBalance := range hitbtcBalances {
+		ret[hitbtcBalance.Currency] = newBalance(decimal.NewFromFloat(hitbtcBalance.Available), decimal.NewFromFloat(hitbtcBalance.Reserved))
+	}
+	return ret, nil
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -275,50 +484,317 @@ func (wrapper *HitBtcWrapperV2) GetDepositAddress(coinTicker string) (string, bo
 }
 
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
-func (wrapper *HitBtcWrapperV2) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
-	var feePercentage float64
+func (wrapper *HitBtcWrapperV2) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *HitBtcWrapperV2) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *HitBtcWrapperV2) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
+}
+
+// hitbtcCandlesPageSize represents the max number of candles returned by a single candles request.
+const hitbtcCandlesPageSize = 1000
+
+// hitbtcCandlePeriods represents the candle periods supported by HitBtc.
+var hitbtcCandlePeriods = map[environment.CandleInterval]string{
+	environment.Interval1m:  "M1",
+	environment.Interval5m:  "M5",
+	environment.Interval15m: "M15",
+	environment.Interval30m: hitbtc.Interval30Minutes,
+	environment.Interval1h:  hitbtc.Interval1Hour,
+	environment.Interval4h:  "H4",
+	environment.Interval1d:  "D1",
+}
+
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+//
+//     NOTE: when the websocket is on, the candles of the requested market and interval
+//     are kept updated by the feed after the first call.
+func (wrapper *HitBtcWrapperV2) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.getCandles(context.Background(), market, interval, from, to)
+}
+
+// getCandles gets the candles of a market opened in the [from, to) time range, requesting them within ctx.
+func (wrapper *HitBtcWrapperV2) getCandles(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	period, supported := hitbtcCandlePeriods[interval]
+	if !supported {
+		return nil, fmt.Errorf("Candle interval %s not supported by HitBtc", interval)
+	}
+
+	if wrapper.websocketOn {
+		cached, err := wrapper.candles.GetFresh(market, interval, wrapper.maxDataAge)
+		if err == nil && candlesCover(cached, from) {
+			return filterCandles(cached, from, to), nil
+		}
+	}
+
+	ret, err := paginateCandles(interval, from, to, func(since time.Time) ([]environment.CandleStick, error) {
+		query := url.Values{
+			"period": {period},
+			"limit":  {fmt.Sprint(hitbtcCandlesPageSize)},
+			"sort":   {"ASC"},
+		}
+		if since.IsZero() {
+			query.Set("sort", "DESC") // the most recent candles.
+		} else {
+			query.Set("from", since.UTC().Format(time.RFC3339))
+		}
+		if !to.IsZero() {
+			query.Set("till", to.UTC().Format(time.RFC3339))
+		}
+
+		var hitbtcCandles []hitbtc.WSCandles
+		err := getJSON(ctx, hitbtc.API_BASE+"/public/candles/"+MarketNameFor(market, wrapper), query, &hitbtcCandles)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+
+		page := make([]environment.CandleStick, len(hitbtcCandles))
+		for i, hitbtcCandle := range hitbtcCandles {
+			if since.IsZero() {
+				page[len(page)-1-i] = convertFromHitBtcCandle(hitbtcCandle)
+			} else {
+				page[i] = convertFromHitBtcCandle(hitbtcCandle)
+			}
+		}
+		return page, nil
+	})
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	if wrapper.websocketOn {
+		wrapper.candles.Merge(market, interval, ret)
+		err = wrapper.subscribeCandles(market, interval)
+		if err != nil { // subscribed again when the feed reconnects.
+			logrus.Warnf("Cannot subscribe to the %s candles of %s on %s: %s", interval, market.Name, wrapper.Name(), err)
+		}
+	}
+
+	return ret, nil
+}
+
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+//
+//     NOTE: the trades are always requested to the REST API, since the client cannot decode
+//     the trades updates of the websocket (and blocks the feed when it fails).
+func (wrapper *HitBtcWrapperV2) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.getRecentTrades(context.Background(), market)
+}
+
+// getRecentTrades gets the most recent trades of a market, requesting them within ctx.
+func (wrapper *HitBtcWrapperV2) getRecentTrades(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	query := url.Values{
+		"limit": {fmt.Sprint(tradesCacheSize)},
+		"sort":  {"DESC"},
+	}
+
+	var hitbtcTrades []hitbtc.WSTrades
+	err := getJSON(ctx, hitbtc.API_BASE+"/public/trades/"+MarketNameFor(market, wrapper), query, &hitbtcTrades)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	// the trades are sent from the most recent.
+	trades := make([]environment.Trade, len(hitbtcTrades))
+	for i, trade := range hitbtcTrades {
+		price, _ := decimal.NewFromString(trade.Price)
+		quantity, _ := decimal.NewFromString(trade.Quantity)
+		timestamp, _ := time.Parse(time.RFC3339, trade.Timestamp)
+		trades[len(trades)-1-i] = environment.Trade{
+			ID:       fmt.Sprint(trade.ID),
+			Price:    price,
+			Quantity: quantity,
+			Side:     takerSide(trade.Side == "buy"),
+			Time:     timestamp,
+		}
+	}
+	return trades, nil
+}
+
+// convertFromHitBtcCandle converts a HitBtc candle to a environment.CandleStick.
+func convertFromHitBtcCandle(candle hitbtc.WSCandles) environment.CandleStick {
+	high, _ := decimal.NewFromString(candle.Max)
+	open, _ := decimal.NewFromString(candle.Open)
+	close, _ := decimal.NewFromString(candle.Close)
+	low, _ := decimal.NewFromString(candle.Min)
+	volume, _ := decimal.NewFromString(candle.Volume)
+
+	return environment.CandleStick{
+		OpenTime: candle.Timestamp,
+		High:     high,
+		Open:     open,
+		Close:    close,
+		Low:      low,
+		Volume:   volume,
+	}
+}
+
+// subscribeCandles subscribes to the candles feed of a market for the specified interval, if not already subscribed.
+func (wrapper *HitBtcWrapperV2) subscribeCandles(market *environment.Market, interval environment.CandleInterval) error {
+	wrapper.candleFeedsMutex.Lock()
+	defer wrapper.candleFeedsMutex.Unlock()
+
+	wrapper.candleRequests[hitbtcCandleFeed{market, interval}] = true
+	return wrapper.subscribeCandlesLocked(market, interval)
+}
+
+// subscribeCandlesLocked is like subscribeCandles, candleFeedsMutex must be locked.
+func (wrapper *HitBtcWrapperV2) subscribeCandlesLocked(market *environment.Market, interval environment.CandleInterval) error {
+	symbol := MarketNameFor(market, wrapper)
+	period := hitbtcCandlePeriods[interval]
+
+	if wrapper.candleFeeds[symbol+"/"+period] {
+		return nil
+	}
+
+	candleUpdateChannel, candleSnapshotChannel, err := wrapper.ws.SubscribeCandles(symbol, period)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	// the channels are shared by all the periods of a market, only one handler is needed.
+	if !wrapper.candleFeeds[symbol] {
+		go wrapper.handleCandles(market, candleUpdateChannel, candleSnapshotChannel)
+		wrapper.candleFeeds[symbol] = true
+	}
+	wrapper.candleFeeds[symbol+"/"+period] = true
+
+	return nil
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *HitBtcWrapperV2) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	panic("Not Implemented")
+// handleCandles merges the candles received from the feed of a market into the cache.
+func (wrapper *HitBtcWrapperV2) handleCandles(market *environment.Market, candleUpdateChannel <-chan hitbtc.WSNotificationCandlesUpdate, candleSnapshotChannel <-chan hitbtc.WSNotificationCandlesSnapshot) {
+	intervalOf := make(map[string]environment.CandleInterval, len(hitbtcCandlePeriods))
+	for interval, period := range hitbtcCandlePeriods {
+		intervalOf[period] = interval
+	}
+
+	for {
+		select {
+		case snap, stillOpen := <-candleSnapshotChannel:
+			if !stillOpen {
+				return
+			}
+
+			candles := make([]environment.CandleStick, len(snap.Data))
+			for i, hitbtcCandle := range snap.Data {
+				candles[i] = convertFromHitBtcCandle(hitbtcCandle)
+			}
+			wrapper.candles.Merge(market, intervalOf[snap.Period], candles)
+		case update, stillOpen := <-candleUpdateChannel:
+			if !stillOpen {
+				return
+			}
+
+			wrapper.candles.Merge(market, intervalOf[update.Period], []environment.CandleStick{convertFromHitBtcCandle(update.Data)})
+		}
+	}
 }
 
 // FeedConnect connects to the feed of the exchange.
 func (wrapper *HitBtcWrapperV2) FeedConnect(markets []*environment.Market) error {
+	err := wrapper.feeds.connect(markets, func(markets []*environment.Market) (*feedSupervisor, error) {
+		return newFeedSupervisor(wrapper.Name(), nil, func(ctx context.Context, feed *feedSupervisor) error {
+			return wrapper.readFeeds(ctx, feed, markets)
+		}), nil
+	})
+	if err != nil {
+		return mapError(wrapper, err)
+	}
 	wrapper.websocketOn = true
-	for _, m := range markets {
-		err := wrapper.subscribeFeeds(m)
-		if err != nil {
-			return err
+
+	return nil
+}
+
+// FeedStatus gets the status of the websocket feeds connected, including the reports.
+func (wrapper *HitBtcWrapperV2) FeedStatus() []FeedStatus {
+	return append(wrapper.feeds.status(), wrapper.account.status()...)
+}
+
+// SetMaxDataAge sets the max age of the data served from the websocket feeds, not positive means no limit.
+func (wrapper *HitBtcWrapperV2) SetMaxDataAge(maxAge time.Duration) {
+	wrapper.maxDataAge = maxAge
+}
+
+// SetOrderBookDepth sets the max number of price levels per side of the order books of the websocket feeds, not positive means all the levels.
+func (wrapper *HitBtcWrapperV2) SetOrderBookDepth(depth int) {
+	wrapper.bookDepth = depth
+}
+
+// FeedRelease releases a subscription to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *HitBtcWrapperV2) FeedRelease(markets []*environment.Market) {
+	wrapper.feeds.unsubscribe(markets)
+}
+
+// FeedClose releases all the subscriptions to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *HitBtcWrapperV2) FeedClose(markets []*environment.Market) {
+	wrapper.feeds.unsubscribeAll(markets)
+}
+
+// readFeeds connects to the websocket, subscribing to the markets and to the candles requested, until ctx is done.
+//
+//     NOTE: the client does not report disconnections, they are detected when the feed goes silent.
+//     The order books are resynced by the snapshots sent when subscribing, a gap in their updates ends the session.
+func (wrapper *HitBtcWrapperV2) readFeeds(ctx context.Context, feed *feedSupervisor, markets []*environment.Market) error {
+	ws, err := hitbtc.NewWSClient()
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	errs := make(chan error, len(markets))
+	err = func() error {
+		wrapper.candleFeedsMutex.Lock()
+		defer wrapper.candleFeedsMutex.Unlock()
+
+		wrapper.ws = ws
+		wrapper.candleFeeds = make(map[string]bool)
+
+		for _, m := range markets {
+			if err := wrapper.subscribeFeeds(m, feed, errs); err != nil {
+				return err
+			}
+		}
+		for request := range wrapper.candleRequests {
+			if err := wrapper.subscribeCandlesLocked(request.market, request.interval); err != nil {
+				return err
+			}
 		}
+		return nil
+	}()
+	if err != nil {
+		return err
 	}
+	feed.connected()
 
-	return nil
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	}
 }
 
-// subscribeFeeds subscribes to the Market Summary Feed service.
-func (wrapper *HitBtcWrapperV2) subscribeFeeds(market *environment.Market) error {
+// subscribeFeeds subscribes to the ticker and the order book of a market, sending to errs why the order book got out of sync.
+func (wrapper *HitBtcWrapperV2) subscribeFeeds(market *environment.Market, feed *feedSupervisor, errs chan<- error) error {
 	handleTicker := func(wrapper *HitBtcWrapperV2, summaryChannel <-chan hitbtc.WSNotificationTickerResponse, m *environment.Market) {
 		for {
 			summary, stillOpen := <-summaryChannel
 			if !stillOpen {
 				return
 			}
+			feed.alive()
 
 			high, _ := decimal.NewFromString(summary.High)
 			low, _ := decimal.NewFromString(summary.Low)
@@ -341,69 +817,44 @@ func (wrapper *HitBtcWrapperV2) subscribeFeeds(market *environment.Market) error
 	}
 
 	handleOrderbook := func(wrapper *HitBtcWrapperV2, bookSnapshotChannel <-chan hitbtc.WSNotificationOrderbookSnapshot, bookUpdateChannel <-chan hitbtc.WSNotificationOrderbookUpdate, m *environment.Market) {
-		var currentSequence int64
+		book := newL2Book(m, wrapper.orderbook, wrapper.bookDepth)
 
 		for {
+			var err error
 			select {
 			case snap, stillOpen := <-bookSnapshotChannel:
 				if !stillOpen {
 					return
 				}
-				if currentSequence > snap.Sequence { // my snapshot is more recent than the one provided
-					continue
-				}
-
-				orderbook := new(environment.OrderBook)
-
-				for _, item := range snap.Ask {
-					price, _ := decimal.NewFromString(item.Price)
-					size, _ := decimal.NewFromString(item.Size)
-
-					orderbook.Asks = append(orderbook.Asks, environment.Order{
-						Value:    price,
-						Quantity: size,
-					})
-				}
-				for _, item := range snap.Bid {
-					price, _ := decimal.NewFromString(item.Price)
-					size, _ := decimal.NewFromString(item.Size)
-
-					orderbook.Bids = append(orderbook.Bids, environment.Order{
-						Value:    price,
-						Quantity: size,
-					})
-				}
-				wrapper.orderbook.Set(market, orderbook)
+				feed.alive()
+				err = book.reset(snap.Sequence, hitbtcBookLevels(snap.Ask), hitbtcBookLevels(snap.Bid))
 			case update, stillOpen := <-bookUpdateChannel:
 				if !stillOpen {
 					return
 				}
+				feed.alive()
+				err = book.apply(bookUpdate{
+					Sequence: update.Sequence,
+					Asks:     hitbtcBookLevels(update.Ask),
+					Bids:     hitbtcBookLevels(update.Bid),
+				})
+			}
 
-				if currentSequence > update.Sequence {
-					continue // my snapshot is more recent than the one provided
-				}
-
-				orderbook, exists := wrapper.orderbook.Get(m)
-				if !exists {
-					continue // wait for snapshot
-				}
-
-				orderbook.Asks = updateBook(orderbook.Asks, update.Ask, false)
-				orderbook.Bids = updateBook(orderbook.Bids, update.Bid, true)
-
-				wrapper.orderbook.Set(market, orderbook)
+			if err != nil {
+				errs <- err
+				return
 			}
 		}
 	}
 
 	summaryChannel, err := wrapper.ws.SubscribeTicker(MarketNameFor(market, wrapper))
 	if err != nil {
-		return err
+		return mapError(wrapper, err)
 	}
 
 	bookUpdateChannel, bookSnapshotChannel, err := wrapper.ws.SubscribeOrderbook(MarketNameFor(market, wrapper))
 	if err != nil {
-		return err
+		return mapError(wrapper, err)
 	}
 
 	go handleTicker(wrapper, summaryChannel, market)
@@ -411,59 +862,357 @@ func (wrapper *HitBtcWrapperV2) subscribeFeeds(market *environment.Market) error
 	return nil
 }
 
-func updateBook(ordersToUpdate []environment.Order, newOrders []hitbtc.WSSubtypeTrade, reverseOrdering bool) []environment.Order {
-	N := len(ordersToUpdate)
-
-	for _, item := range newOrders {
-		// replace values
-		price, _ := decimal.NewFromString(item.Price)
-		size, _ := decimal.NewFromString(item.Size)
+// hitbtcBookLevels converts the price levels of an order book notification, a zero size removes the level.
+func hitbtcBookLevels(levels []hitbtc.WSSubtypeTrade) []environment.Order {
+	ret := make([]environment.Order, len(levels))
+	for i, level := range levels {
+		price, _ := decimal.NewFromString(level.Price)
+		size, _ := decimal.NewFromString(level.Size)
 
-		newOrder := environment.Order{
+		ret[i] = environment.Order{
 			Value:    price,
 			Quantity: size,
 		}
+	}
+	return ret
+}
 
-		i := sort.Search(N, func(i int) bool {
-			if reverseOrdering {
-				return ordersToUpdate[i].Value.LessThanOrEqual(price)
+// hitbtcWsRequest represents a JSON-RPC request to the HitBtc websocket.
+type hitbtcWsRequest struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+	ID     int64       `json:"id"`
+}
+
+// hitbtcWsLogin represents the params of the login request to the HitBtc websocket.
+type hitbtcWsLogin struct {
+	Algo      string `json:"algo"`
+	PublicKey string `json:"pKey"`
+	SecretKey string `json:"sKey"`
+}
+
+// hitbtcWsMessage represents a notification (method, params) or a response (result or error, id) of the HitBtc websocket.
+type hitbtcWsMessage struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message     string `json:"message"`
+		Description string `json:"description"`
+	} `json:"error"`
+	ID int64 `json:"id"`
+}
+
+// hitbtcWsReport represents a report of an order of the user sent by the HitBtc websocket.
+type hitbtcWsReport struct {
+	ClientOrderID string          `json:"clientOrderId"`
+	Symbol        string          `json:"symbol"`
+	Side          string          `json:"side"`
+	Status        string          `json:"status"`
+	Quantity      decimal.Decimal `json:"quantity"`
+	Price         decimal.Decimal `json:"price"`
+	CumQuantity   decimal.Decimal `json:"cumQuantity"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+	ReportType    string          `json:"reportType"` // status, new, canceled, expired, suspended, trade, replaced.
+	TradeQuantity decimal.Decimal `json:"tradeQuantity"`
+	TradePrice    decimal.Decimal `json:"tradePrice"`
+	TradeID       int64           `json:"tradeId"`
+	TradeFee      decimal.Decimal `json:"tradeFee"`
+}
+
+// hitbtcWsBalance represents the trading balance of a currency sent by the HitBtc websocket.
+type hitbtcWsBalance struct {
+	Currency  string          `json:"currency"`
+	Available decimal.Decimal `json:"available"`
+	Reserved  decimal.Decimal `json:"reserved"`
+}
+
+// SubscribeAccount subscribes a handler to the events of the account on the markets, sent by the websocket reports.
+//
+//     NOTE: the balances are requested every 30 seconds on the same websocket, the changes are sent as events.
+func (wrapper *HitBtcWrapperV2) SubscribeAccount(markets []*environment.Market, handler func(environment.AccountEvent)) (func(), error) {
+	unsubscribe, err := wrapper.account.subscribe(markets, handler, func() *feedSupervisor {
+		return newFeedSupervisor(wrapper.Name()+" reports", nil, wrapper.readReports)
+	})
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+	return unsubscribe, nil
+}
+
+// readReports logs in to the websocket and subscribes to the reports of the orders, reading them until the connection fails or ctx is done.
+func (wrapper *HitBtcWrapperV2) readReports(ctx context.Context, feed *feedSupervisor) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, hitbtcWebsocketURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	requests := []hitbtcWsRequest{
+		{Method: "login", Params: hitbtcWsLogin{Algo: "BASIC", PublicKey: wrapper.publicKey, SecretKey: wrapper.secretKey}},
+		{Method: "subscribeReports", Params: struct{}{}, ID: hitbtcReportsRequestID},
+		{Method: "getTradingBalance", Params: struct{}{}, ID: hitbtcBalancesRequestIDBase},
+	}
+	for _, request := range requests {
+		if err := conn.WriteJSON(request); err != nil {
+			return err
+		}
+	}
+
+	// the balances are requested by this goroutine only, the websocket supports one writer at a time.
+	go func() {
+		defer conn.Close()
+
+		ticker := time.NewTicker(hitbtcBalancePollInterval)
+		defer ticker.Stop()
+		for id := int64(hitbtcBalancesRequestIDBase + 1); ; id++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := conn.WriteJSON(hitbtcWsRequest{Method: "getTradingBalance", Params: struct{}{}, ID: id}); err != nil {
+					return
+				}
 			}
-			return ordersToUpdate[i].Value.GreaterThanOrEqual(price)
-		})
-		if size.Equals(decimal.Zero) { //remove it
-			if i == N-1 {
-				ordersToUpdate = ordersToUpdate[:i-1]
-				N--
-			} else { // i < N - 1
-				ordersToUpdate = append(ordersToUpdate[:i], ordersToUpdate[i+1:]...)
-				N--
+		}
+	}()
+
+	balances := make(map[string]decimal.Decimal)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		feed.alive()
+
+		var message hitbtcWsMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			logrus.Error(err)
+			continue
+		}
+
+		switch {
+		case message.Error != nil:
+			err := fmt.Errorf("%s: %s", message.Error.Message, message.Error.Description)
+			if message.ID < hitbtcBalancesRequestIDBase { // login or subscription failed.
+				return fmt.Errorf("Cannot subscribe to the reports of %s: %w", wrapper.Name(), err)
+			}
+			logrus.Warnf("Cannot get the balances from %s: %s", wrapper.Name(), err)
+		case message.ID == hitbtcReportsRequestID:
+			feed.connected()
+		case message.ID >= hitbtcBalancesRequestIDBase:
+			var hitbtcBalances []hitbtcWsBalance
+			if err := json.Unmarshal(message.Result, &hitbtcBalances); err != nil {
+				logrus.Error(err)
+				continue
+			}
+			wrapper.handleBalances(balances, hitbtcBalances)
+		case message.Method == "activeOrders":
+			var reports []hitbtcWsReport
+			if err := json.Unmarshal(message.Params, &reports); err != nil {
+				logrus.Error(err)
+				continue
+			}
+			for _, report := range reports {
+				wrapper.handleReport(report)
+			}
+		case message.Method == "report":
+			var report hitbtcWsReport
+			if err := json.Unmarshal(message.Params, &report); err != nil {
+				logrus.Error(err)
+				continue
 			}
-		} else if i == N { // not found, append
-			ordersToUpdate = append(ordersToUpdate, newOrder)
-			N++
-		} else if price.Equals(ordersToUpdate[i].Value) {
-			// replace it
-			ordersToUpdate[i] = newOrder
-		} else if i == 0 { // prepend it
-			ordersToUpdate = append([]environment.Order{newOrder}, ordersToUpdate...)
-			N++
-		} else { // 0 < i < N, so put new order in the middle
-			orders := ordersToUpdate[:i-1]
-			orders = append(orders, newOrder)
-			orders = append(orders, ordersToUpdate[i-1:]...)
-			ordersToUpdate = orders
-			N++
+			wrapper.handleReport(report)
 		}
 	}
+}
+
+// handleReport sends a report of an order to the subscribers, with its fill if it is a trade.
+func (wrapper *HitBtcWrapperV2) handleReport(report hitbtcWsReport) {
+	market := wrapper.account.market(report.Symbol)
+	if market == nil {
+		return
+	}
+
+	order := environment.OrderStatus{
+		ID:             report.ClientOrderID,
+		Type:           environment.Bid,
+		State:          hitbtcOrderState(report.Status),
+		Price:          report.Price,
+		Quantity:       report.Quantity,
+		FilledQuantity: report.CumQuantity,
+		Timestamp:      report.CreatedAt,
+	}
+	if report.Side == "sell" {
+		order.Type = environment.Ask
+	}
+
+	if report.ReportType == "trade" {
+		wrapper.account.dispatch(environment.AccountEvent{
+			Type:   environment.FillEvent,
+			Market: market,
+			Fill: &environment.Fill{
+				OrderID:     order.ID,
+				TradeID:     fmt.Sprint(report.TradeID),
+				Side:        order.Type,
+				Price:       report.TradePrice,
+				Quantity:    report.TradeQuantity,
+				Fee:         report.TradeFee,
+				FeeCurrency: market.BaseCurrency,
+				Time:        report.UpdatedAt,
+			},
+			Time: report.UpdatedAt,
+		})
+	}
 
-	return ordersToUpdate
+	wrapper.account.dispatch(environment.AccountEvent{
+		Type:   environment.OrderUpdateEvent,
+		Market: market,
+		Order:  &order,
+		Time:   report.UpdatedAt,
+	})
+}
+
+// handleBalances sends the balances changed since the previous request to the subscribers, all of them after the first request.
+func (wrapper *HitBtcWrapperV2) handleBalances(previous map[string]decimal.Decimal, hitbtcBalances []hitbtcWsBalance) {
+	for _, balance := range hitbtcBalances {
+		if free, exists := previous[balance.Currency]; exists && free.Equal(balance.Available) {
+			continue
+		}
+		previous[balance.Currency] = balance.Available
+
+		wrapper.account.dispatch(environment.AccountEvent{
+			Type: environment.BalanceEvent,
+			Balance: &environment.BalanceUpdate{
+				Currency: balance.Currency,
+				Free:     balance.Available,
+			},
+		})
+	}
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *HitBtcWrapperV2) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	_, err := wrapper.api.Withdraw(destinationAddress, coinTicker, amount)
+func (wrapper *HitBtcWrapperV2) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	params := url.Values{}
+	params.Set("currency", coinTicker)
+	params.Set("address", destinationAddress)
+	params.Set("amount", amount.String())
+
+	var withdrawal struct {
+		ID string `json:"id"`
+	}
+	err := wrapper.privateRequest(http.MethodPost, "/account/crypto/withdraw", params, &withdrawal)
 	if err != nil {
-		return err
+		return mapError(wrapper, err)
 	}
 	return nil
 }
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.getCandles(ctx, market, interval, from, to)
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return callContext(ctx, func() (*environment.MarketSummary, error) {
+		return wrapper.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return callContext(ctx, func() (*environment.OrderBook, error) {
+		return wrapper.GetOrderBook(market)
+	})
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.getRecentTrades(ctx, market)
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *HitBtcWrapperV2) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *HitBtcWrapperV2) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *HitBtcWrapperV2) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyMarket(market, amount)
+	})
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *HitBtcWrapperV2) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellMarket(market, amount)
+	})
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return callContext(ctx, func() (*environment.OrderStatus, error) {
+		return wrapper.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return callContext(ctx, func() ([]environment.OrderStatus, error) {
+		return wrapper.GetOpenOrders(market)
+	})
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelAllOrders(market)
+	})
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	return callContext(ctx, func() (*decimal.Decimal, error) {
+		return wrapper.GetBalance(symbol)
+	})
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return callContext(ctx, func() (map[string]environment.Balance, error) {
+		return wrapper.GetBalances()
+	})
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *HitBtcWrapperV2) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.FeedConnect(markets)
+	})
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *HitBtcWrapperV2) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return sendContextErr(ctx, func() error {
+		return wrapper.Withdraw(destinationAddress, coinTicker, amount)
+	})
+}
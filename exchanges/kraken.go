@@ -16,14 +16,24 @@
 package exchanges
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"math"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/beldur/kraken-go-api-client"
 	"github.com/fatih/structs"
+	"github.com/gorilla/websocket"
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 )
 
 // NOTE: https://www.kraken.com/help/api
@@ -33,19 +43,36 @@ type KrakenWrapper struct {
 	api              *krakenapi.KrakenApi
 	summaries        *SummaryCache
 	candles          *CandlesCache
+	orderbook        *OrderbookCache
+	trades           *TradesCache
+	marketInfo       *MarketInfoCache
 	depositAddresses map[string]string
 	websocketOn      bool
+	feeds            feedSet
+	maxDataAge       time.Duration
+	bookDepth        int
 }
 
 // NewKrakenWrapper creates a generic wrapper of the poloniex API.
 func NewKrakenWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
-	return &KrakenWrapper{
-		api:              krakenapi.New(publicKey, secretKey),
+	wrapper := &KrakenWrapper{
+		api:              krakenapi.NewWithClient(publicKey, secretKey, restClient),
 		summaries:        NewSummaryCache(),
 		candles:          NewCandlesCache(),
+		orderbook:        NewOrderbookCache(),
+		trades:           NewTradesCache(),
 		depositAddresses: depositAddresses,
+		maxDataAge:       DefaultMaxDataAge,
 		websocketOn:      false,
 	}
+	wrapper.marketInfo = NewMarketInfoCache(wrapper.GetMarkets)
+	return wrapper
+}
+
+func init() {
+	Register("kraken", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewKrakenWrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
 }
 
 // Name returns the name of the wrapped exchange.
@@ -53,6 +80,20 @@ func (wrapper *KrakenWrapper) Name() string {
 	return "kraken"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *KrakenWrapper) Capabilities() Capabilities {
+	return Capabilities{
+		WebsocketFeeds: true,
+		Candles:        true,
+		Trades:         true,
+		LimitOrders:    true,
+		MarketOrders:   true,
+		Withdraw:       true,
+		TradingFees:    true,
+		OrderQuery:     true,
+	}
+}
+
 func (wrapper *KrakenWrapper) String() string {
 	return wrapper.Name()
 }
@@ -61,7 +102,7 @@ func (wrapper *KrakenWrapper) String() string {
 func (wrapper *KrakenWrapper) GetMarkets() ([]*environment.Market, error) {
 	krakenMarkets, err := wrapper.api.AssetPairs()
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	markets := structs.Map(krakenMarkets)
@@ -74,6 +115,11 @@ func (wrapper *KrakenWrapper) GetMarkets() ([]*environment.Market, error) {
 			Name:           name,
 			BaseCurrency:   p.Base,
 			MarketCurrency: p.Quote,
+			Info: &environment.MarketInfo{
+				PriceTick:    decimal.New(1, -int32(p.PairDecimals)),
+				QuantityStep: decimal.New(1, -int32(p.LotDecimals)),
+				MinQuantity:  decimal.NewFromFloat(p.OrderMin),
+			},
 		}
 		i++
 	}
@@ -81,11 +127,20 @@ func (wrapper *KrakenWrapper) GetMarkets() ([]*environment.Market, error) {
 	return wrappedMarkets, nil
 }
 
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *KrakenWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return wrapper.marketInfo.Get(MarketNameFor(market, wrapper))
+}
+
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *KrakenWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	if wrapper.websocketOn {
+		return wrapper.orderbook.GetFresh(market, wrapper.maxDataAge)
+	}
+
 	krakenOrderBook, err := wrapper.api.Depth(MarketNameFor(market, wrapper), 0)
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	var orderBook environment.OrderBook
@@ -112,48 +167,174 @@ func (wrapper *KrakenWrapper) GetOrderBook(market *environment.Market) (*environ
 }
 
 // BuyLimit performs a limit buy action.
-func (wrapper *KrakenWrapper) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "buy", "limit", fmt.Sprint(amount), map[string]string{"price": fmt.Sprint(limit)})
+func (wrapper *KrakenWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Bid, amount, limit)
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
 	}
-	return fmt.Sprint(orderNumber.TransactionIds), nil
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "buy", "limit", formattedQuantity, map[string]string{"price": formattedPrice})
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+	return strings.Join(orderNumber.TransactionIds, ","), nil
 }
 
 // SellLimit performs a limit sell action.
 //
 // NOTE: In kraken buy and sell orders behave the same (the go kraken api automatically puts it on correct side)
-func (wrapper *KrakenWrapper) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "sell", "limit", fmt.Sprint(amount), map[string]string{"price": fmt.Sprint(limit)})
+func (wrapper *KrakenWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Ask, amount, limit)
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
 	}
-	return fmt.Sprint(orderNumber.TransactionIds), nil
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "sell", "limit", formattedQuantity, map[string]string{"price": formattedPrice})
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+	return strings.Join(orderNumber.TransactionIds, ","), nil
 }
 
 // BuyMarket performs a market buy action.
-func (wrapper *KrakenWrapper) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "buy", "market", fmt.Sprint(amount), map[string]string{})
+func (wrapper *KrakenWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	quantity, _, err := prepareOrder(wrapper, market, environment.Bid, amount, decimal.Zero)
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
 	}
-	return fmt.Sprint(orderNumber.TransactionIds), nil
+
+	formattedQuantity, _ := formatOrder(wrapper, market, quantity, decimal.Zero)
+	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "buy", "market", formattedQuantity, map[string]string{})
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+	return strings.Join(orderNumber.TransactionIds, ","), nil
 }
 
 // SellMarket performs a market sell action.
-func (wrapper *KrakenWrapper) SellMarket(market *environment.Market, amount float64) (string, error) {
-	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "sell", "market", fmt.Sprint(amount), map[string]string{})
+func (wrapper *KrakenWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	quantity, _, err := prepareOrder(wrapper, market, environment.Ask, amount, decimal.Zero)
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
+	}
+
+	formattedQuantity, _ := formatOrder(wrapper, market, quantity, decimal.Zero)
+	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(market, wrapper), "sell", "market", formattedQuantity, map[string]string{})
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+	return strings.Join(orderNumber.TransactionIds, ","), nil
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *KrakenWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	krakenOrders, err := wrapper.api.QueryOrders(orderID, map[string]string{})
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	krakenOrder, exists := (*krakenOrders)[orderID]
+	if !exists {
+		return nil, errors.New("Order not found")
 	}
-	return fmt.Sprint(orderNumber.TransactionIds), nil
+
+	ret := convertFromKrakenOrder(orderID, krakenOrder)
+	ret.FeeCurrency = market.BaseCurrency
+
+	return &ret, nil
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+func (wrapper *KrakenWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	krakenOrders, err := wrapper.api.OpenOrders(map[string]string{})
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, 0, krakenOrders.Count)
+	for orderID, krakenOrder := range krakenOrders.Open {
+		if krakenOrder.Description.AssetPair == MarketNameFor(market, wrapper) {
+			order := convertFromKrakenOrder(orderID, krakenOrder)
+			order.FeeCurrency = market.BaseCurrency
+			ret = append(ret, order)
+		}
+	}
+
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *KrakenWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	_, err := wrapper.api.CancelOrder(orderID)
+	return mapError(wrapper, err)
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *KrakenWrapper) CancelAllOrders(market *environment.Market) error {
+	krakenOrders, err := wrapper.api.OpenOrders(map[string]string{})
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	for orderID, krakenOrder := range krakenOrders.Open {
+		if krakenOrder.Description.AssetPair != MarketNameFor(market, wrapper) {
+			continue
+		}
+		_, err := wrapper.api.CancelOrder(orderID)
+		if err != nil {
+			return mapError(wrapper, err)
+		}
+	}
+
+	return nil
+}
+
+// convertFromKrakenOrder converts a kraken order to a environment.OrderStatus.
+func convertFromKrakenOrder(orderID string, order krakenapi.Order) environment.OrderStatus {
+	quantity, _ := decimal.NewFromString(order.Volume)
+	price, _ := decimal.NewFromString(order.Description.PrimaryPrice)
+	openTime, fraction := math.Modf(order.OpenTime)
+
+	ret := environment.OrderStatus{
+		ID:             orderID,
+		Type:           environment.Bid,
+		Price:          price,
+		Quantity:       quantity,
+		FilledQuantity: decimal.NewFromFloat(order.VolumeExecuted),
+		AveragePrice:   decimal.NewFromFloat(order.Price),
+		Fee:            decimal.NewFromFloat(order.Fee),
+		Timestamp:      time.Unix(int64(openTime), int64(fraction*float64(time.Second))),
+	}
+
+	if order.Description.Type == "sell" {
+		ret.Type = environment.Ask
+	}
+
+	switch order.Status {
+	case "pending":
+		ret.State = environment.OrderNew
+	case "open":
+		if ret.FilledQuantity.IsZero() {
+			ret.State = environment.OrderNew
+		} else {
+			ret.State = environment.OrderPartiallyFilled
+		}
+	case "closed":
+		ret.State = environment.OrderFilled
+	default: // canceled or expired.
+		ret.State = environment.OrderCanceled
+	}
+
+	return ret
 }
 
 // GetTicker gets the updated ticker for a market.
 func (wrapper *KrakenWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 	krakenTicker, err := wrapper.api.Ticker(MarketNameFor(market, wrapper))
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	ticker := krakenTicker.GetPairTickerInfo(MarketNameFor(market, wrapper))
@@ -171,106 +352,235 @@ func (wrapper *KrakenWrapper) GetTicker(market *environment.Market) (*environmen
 
 // GetMarketSummary gets the current market summary.
 func (wrapper *KrakenWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
-	krakenSummary, err := wrapper.api.Ticker(MarketNameFor(market, wrapper))
-	if err != nil {
-		return nil, err
-	}
+	if !wrapper.websocketOn {
+		krakenSummary, err := wrapper.api.Ticker(MarketNameFor(market, wrapper))
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
 
-	sum := krakenSummary.GetPairTickerInfo(MarketNameFor(market, wrapper))
+		sum := krakenSummary.GetPairTickerInfo(MarketNameFor(market, wrapper))
 
-	high, _ := decimal.NewFromString(sum.High[0])
-	low, _ := decimal.NewFromString(sum.Low[0])
-	volume, _ := decimal.NewFromString(sum.Volume[0])
-	bid, _ := decimal.NewFromString(sum.Bid[0])
-	ask, _ := decimal.NewFromString(sum.Ask[0])
+		high, _ := decimal.NewFromString(sum.High[1])
+		low, _ := decimal.NewFromString(sum.Low[1])
+		volume, _ := decimal.NewFromString(sum.Volume[1])
+		bid, _ := decimal.NewFromString(sum.Bid[0])
+		ask, _ := decimal.NewFromString(sum.Ask[0])
+		last, _ := decimal.NewFromString(sum.Close[0])
 
-	return &environment.MarketSummary{
-		High:   high,
-		Low:    low,
-		Volume: volume,
-		Bid:    bid,
-		Ask:    ask,
-		Last:   ask, // TODO: find a better way for last value, if any
-	}, nil
+		wrapper.summaries.Set(market, &environment.MarketSummary{
+			High:   high,
+			Low:    low,
+			Volume: volume,
+			Bid:    bid,
+			Ask:    ask,
+			Last:   last,
+		})
+	}
+
+	return wrapper.summaries.GetFresh(market, wrapper.maxDataAge)
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *KrakenWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	if !wrapper.websocketOn {
-		now := time.Now()
+// GetCandles gets the candles of a market opened in the [from, to) time range, aggregating its trades.
+//
+//     NOTE: a zero from gets the candles of the last 24 hours.
+func (wrapper *KrakenWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	step := interval.Duration()
+	if step == 0 {
+		return nil, fmt.Errorf("Invalid candle interval: %s", interval)
+	}
+
+	end := to
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := from
+	if start.IsZero() {
+		start = end.Add(-24 * time.Hour)
+	}
+
+	ret := make([]environment.CandleStick, 0, int(end.Sub(start)/step)+1)
 
-		krakenTrades, err := wrapper.api.Trades(MarketNameFor(market, wrapper), now.Add(-time.Hour*24).Unix())
+	// trades are returned a page at a time, since is the id (a timestamp in nanoseconds) of the next page.
+	for since, done := start.Truncate(step).UnixNano(), false; !done; {
+		krakenTrades, err := wrapper.api.Trades(MarketNameFor(market, wrapper), since)
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
-		trades := krakenTrades.Trades
+		for _, trade := range krakenTrades.Trades {
+			tradeTime := time.Unix(trade.Time, 0)
+			if !tradeTime.Before(end) {
+				done = true
+				break
+			}
 
-		for lastTradeTime := time.Unix(krakenTrades.Last, 0); lastTradeTime.Before(now); {
-			krakenTrades, err = wrapper.api.Trades(MarketNameFor(market, wrapper), now.Add(-time.Hour*24).Unix())
-			if err != nil {
-				return nil, err
+			price := decimal.NewFromFloat(trade.PriceFloat)
+			volume := decimal.NewFromFloat(trade.VolumeFloat)
+			openTime := tradeTime.Truncate(step)
+
+			if len(ret) == 0 || !ret[len(ret)-1].OpenTime.Equal(openTime) {
+				ret = append(ret, environment.CandleStick{
+					OpenTime: openTime,
+					High:     price,
+					Open:     price,
+					Close:    price,
+					Low:      price,
+					Volume:   volume,
+				})
+				continue
 			}
 
-			trades = append(trades, krakenTrades.Trades...)
+			// aggregate the trade into the current candle.
+			candle := &ret[len(ret)-1]
+			candle.High = decimal.Max(candle.High, price)
+			candle.Low = decimal.Min(candle.Low, price)
+			candle.Close = price
+			candle.Volume = candle.Volume.Add(volume)
 		}
 
-		ret := make([]environment.CandleStick, 0, 50)
+		if len(krakenTrades.Trades) == 0 || krakenTrades.Last <= since {
+			done = true
+		}
+		since = krakenTrades.Last
+	}
 
-		step := time.Minute * 30
-		start := time.Unix(krakenTrades.Trades[0].Time, 0)
+	wrapper.candles.Set(market, interval, ret)
 
-		var open = decimal.NewFromFloat(krakenTrades.Trades[0].PriceFloat)
-		var high = open
-		var low = open
-		var close decimal.Decimal
+	return filterCandles(ret, from, to), nil
+}
 
-		N := len(trades)
-		for i := 1; i < N; i++ {
-			currentTrade := trades[i]
-			candleTime := time.Unix(currentTrade.Time, 0)
-			isLastTrade := i == N-1
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+//
+//     NOTE: the trades are requested without the client, which truncates their time to the second.
+//     The trades of the markets subscribed to the feed are loaded once, then updated by the websocket.
+func (wrapper *KrakenWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.getRecentTrades(context.Background(), market)
+}
 
-			if candleTime.Before(start.Add(step)) || isLastTrade {
-				// aggregate candles from trades.
-				currentPrice := decimal.NewFromFloat(currentTrade.PriceFloat)
-				high = decimal.Max(high, currentPrice)
-				low = decimal.Min(low, currentPrice)
-			} else {
-				// add candle with aggregate data and reset.
-				previousTrade := trades[i-1]
-				close = decimal.NewFromFloat(previousTrade.PriceFloat)
-				ret = append(ret, environment.CandleStick{
-					High:  high,
-					Open:  open,
-					Close: close,
-					Low:   low,
-				})
-				open = decimal.NewFromFloat(currentTrade.PriceFloat)
-				high = decimal.NewFromFloat(0)
-				low = decimal.NewFromFloat(999999999)
-			}
+// getRecentTrades gets the most recent trades of a market, requesting them within ctx.
+func (wrapper *KrakenWrapper) getRecentTrades(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	subscribed := wrapper.feeds.subscribed(market)
+	if trades, loaded := wrapper.trades.Get(market); subscribed && loaded {
+		return trades, nil
+	}
+
+	var resp struct {
+		Error  []string                   `json:"error"`
+		Result map[string]json.RawMessage `json:"result"` // the trades keyed by the pair name, and the last id.
+	}
+	if err := getJSON(ctx, krakenTradesURL, url.Values{"pair": {MarketNameFor(market, wrapper)}}, &resp); err != nil {
+		return nil, mapError(wrapper, err)
+	}
+	if len(resp.Error) > 0 {
+		return nil, mapError(wrapper, errors.New(strings.Join(resp.Error, ", ")))
+	}
+
+	var trades []environment.Trade
+	for key, result := range resp.Result {
+		if key == "last" {
+			continue
 		}
 
-		wrapper.candles.Set(market, ret)
+		var krakenTrades [][]json.RawMessage
+		if err := json.Unmarshal(result, &krakenTrades); err != nil {
+			return nil, mapError(wrapper, err)
+		}
+		trades = krakenTradesOf(krakenTrades)
 	}
 
-	ret, candleLoaded := wrapper.candles.Get(market)
-	if !candleLoaded {
-		return nil, errors.New("No candle data yet")
+	if subscribed {
+		return wrapper.trades.Load(market, trades), nil
 	}
+	return trades, nil
+}
 
-	return ret, nil
+// krakenAssetAliases maps the tickers to the names of the Kraken assets, where they differ.
+var krakenAssetAliases = map[string]string{
+	"BTC":  "XBT",
+	"DOGE": "XDG",
+}
+
+// krakenAssetNames gets the names a Kraken asset may have for a ticker, the older assets are prefixed by X (crypto) or Z (fiat).
+func krakenAssetNames(symbol string) []string {
+	if alias, exists := krakenAssetAliases[symbol]; exists {
+		symbol = alias
+	}
+	return []string{symbol, "X" + symbol, "Z" + symbol}
 }
 
 // GetBalance gets the balance of the user of the specified currency.
+//
+//     NOTE: Kraken balances include the amounts reserved by open orders.
 func (wrapper *KrakenWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
-	_, err := wrapper.api.Balance()
+	krakenBalances, err := wrapper.krakenBalances()
 	if err != nil {
 		return nil, err
 	}
 
-	panic("Help me integrate this feature!")
+	for _, asset := range krakenAssetNames(symbol) {
+		if krakenBalance, exists := krakenBalances[asset]; exists {
+			return &krakenBalance, nil
+		}
+	}
+
+	return nil, errors.New("Symbol not found")
+}
+
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+//
+//     NOTE: Kraken balances include the amounts reserved by open orders, which are not known:
+//     the free balance is the total one and the locked balance is always 0.
+func (wrapper *KrakenWrapper) GetBalances() (map[string]environment.Balance, error) {
+	krakenBalances, err := wrapper.krakenBalances()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]environment.Balance, len(krakenBalances))
+	for asset, krakenBalance := range krakenBalances {
+		ret[krakenTicker(asset)] = newBalance(krakenBalance, decimal.Zero)
+	}
+	return ret, nil
+}
+
+// krakenBalances gets the balances of the user, by name of the Kraken asset.
+func (wrapper *KrakenWrapper) krakenBalances() (map[string]decimal.Decimal, error) {
+	resp, err := wrapper.api.Query("Balance", map[string]string{})
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	krakenBalances, ok := resp.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Invalid balance response")
+	}
+
+	ret := make(map[string]decimal.Decimal, len(krakenBalances))
+	for asset, value := range krakenBalances {
+		krakenBalance, isString := value.(string)
+		if !isString {
+			continue
+		}
+		balance, err := decimal.NewFromString(krakenBalance)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+		ret[asset] = balance
+	}
+	return ret, nil
+}
+
+// krakenTicker gets the ticker of a Kraken asset, removing the X (crypto) or Z (fiat) prefix of the older assets.
+func krakenTicker(asset string) string {
+	if len(asset) == 4 && (asset[0] == 'X' || asset[0] == 'Z') {
+		asset = asset[1:]
+	}
+	for ticker, alias := range krakenAssetAliases {
+		if alias == asset {
+			return ticker
+		}
+	}
+	return asset
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -282,35 +592,512 @@ func (wrapper *KrakenWrapper) GetDepositAddress(coinTicker string) (string, bool
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
 //
 //     NOTE: In Kraken fees are currently hardcoded.
-func (wrapper *KrakenWrapper) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
-	var feePercentage float64
+func (wrapper *KrakenWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0016
+		feePercentage = decimal.NewFromFloat(0.0016)
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0026
+		feePercentage = decimal.NewFromFloat(0.0026)
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *KrakenWrapper) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *KrakenWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
 }
 
-// FeedConnect connects to the feed of the exchange.
+// FeedConnect connects to the feed of the exchange, keeping the market summaries, order books and trades updated.
 func (wrapper *KrakenWrapper) FeedConnect(markets []*environment.Market) error {
-	return ErrWebsocketNotSupported
+	err := wrapper.feeds.connect(markets, func(markets []*environment.Market) (*feedSupervisor, error) {
+		pairs, err := wrapper.websocketPairs(markets)
+		if err != nil {
+			return nil, err
+		}
+
+		return newFeedSupervisor(wrapper.Name(), nil, func(ctx context.Context, feed *feedSupervisor) error {
+			wrapper.trades.Reset(markets)
+			conn, err := dialKrakenFeed(pairs)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			feed.connected()
+
+			go func() {
+				<-ctx.Done()
+				conn.Close()
+			}()
+			return wrapper.readFeed(conn, feed, pairs)
+		}), nil
+	})
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+	wrapper.websocketOn = true
+
+	return nil
+}
+
+// FeedStatus gets the status of the websocket feeds connected.
+func (wrapper *KrakenWrapper) FeedStatus() []FeedStatus {
+	return wrapper.feeds.status()
+}
+
+// SetMaxDataAge sets the max age of the data served from the websocket feeds, not positive means no limit.
+func (wrapper *KrakenWrapper) SetMaxDataAge(maxAge time.Duration) {
+	wrapper.maxDataAge = maxAge
 }
 
-// SubscribeMarketSummaryFeed subscribes to the Market Summary Feed service.
-func (wrapper *KrakenWrapper) subscribeMarketSummaryFeed(market *environment.Market) {
-	panic("Websocket Not Supported")
+// SetOrderBookDepth sets the max number of price levels per side of the order books of the websocket feeds, not positive means all the levels.
+func (wrapper *KrakenWrapper) SetOrderBookDepth(depth int) {
+	wrapper.bookDepth = depth
+}
+
+// FeedRelease releases a subscription to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *KrakenWrapper) FeedRelease(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribe(markets))
+}
+
+// FeedClose releases all the subscriptions to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *KrakenWrapper) FeedClose(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribeAll(markets))
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *KrakenWrapper) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	panic("Not Supported")
+//
+//     NOTE: Kraken withdraws only to the addresses registered in the account, destinationAddress is the name (key) of the address.
+func (wrapper *KrakenWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	krakenAmount, _ := new(big.Float).SetString(amount.String())
+
+	asset := coinTicker
+	if alias, exists := krakenAssetAliases[coinTicker]; exists {
+		asset = alias
+	}
+
+	_, err := wrapper.api.Withdraw(asset, destinationAddress, krakenAmount)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	return nil
+}
+
+const (
+	krakenWebsocketURL  = "wss://ws.kraken.com"
+	krakenAssetPairsURL = "https://api.kraken.com/0/public/AssetPairs"
+	krakenTradesURL     = "https://api.kraken.com/0/public/Trades"
+	krakenBookDepth     = 25
+)
+
+// krakenWsSubscribe represents a subscription request to the Kraken websocket.
+type krakenWsSubscribe struct {
+	Event        string               `json:"event"`
+	Pair         []string             `json:"pair"`
+	Subscription krakenWsSubscription `json:"subscription"`
+}
+
+// krakenWsSubscription represents a channel of the Kraken websocket.
+type krakenWsSubscription struct {
+	Name  string `json:"name"`
+	Depth int    `json:"depth,omitempty"`
+}
+
+// krakenWsEvent represents an event (heartbeat, status) sent by the Kraken websocket.
+type krakenWsEvent struct {
+	Event        string `json:"event"`
+	Status       string `json:"status"`
+	Pair         string `json:"pair"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// krakenWsTicker represents a ticker update of the Kraken websocket.
+type krakenWsTicker struct {
+	Ask    []interface{} `json:"a"` // price, whole lot volume, lot volume.
+	Bid    []interface{} `json:"b"` // price, whole lot volume, lot volume.
+	Close  []interface{} `json:"c"` // price, lot volume.
+	Volume []interface{} `json:"v"` // today, last 24 hours.
+	Low    []interface{} `json:"l"` // today, last 24 hours.
+	High   []interface{} `json:"h"` // today, last 24 hours.
+}
+
+// krakenWsBook represents a snapshot (as, bs) or an update (a, b) of an order book of the Kraken websocket.
+//
+//     NOTE: each level is price, volume, timestamp, a zero volume removes the level.
+type krakenWsBook struct {
+	AsksSnapshot [][]string `json:"as"`
+	BidsSnapshot [][]string `json:"bs"`
+	Asks         [][]string `json:"a"`
+	Bids         [][]string `json:"b"`
+	Checksum     string     `json:"c"`
+}
+
+// websocketPairs maps the websocket names of the pairs (e.g. XBT/USD) to the markets.
+func (wrapper *KrakenWrapper) websocketPairs(markets []*environment.Market) (map[string]*environment.Market, error) {
+	var resp struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			Altname string `json:"altname"`
+			WsName  string `json:"wsname"`
+		} `json:"result"`
+	}
+	if err := getJSON(context.Background(), krakenAssetPairsURL, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Error) > 0 {
+		return nil, errors.New(strings.Join(resp.Error, ", "))
+	}
+
+	pairs := make(map[string]*environment.Market, len(markets))
+	for _, market := range markets {
+		name := MarketNameFor(market, wrapper)
+		found := false
+		for pairName, pair := range resp.Result {
+			if pairName == name || pair.Altname == name {
+				pairs[pair.WsName] = market
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Market %s not found on %s", name, wrapper.Name())
+		}
+	}
+	return pairs, nil
+}
+
+// dialKrakenFeed connects to the Kraken websocket, subscribing to the tickers, the order books and the trades of the pairs.
+func dialKrakenFeed(pairs map[string]*environment.Market) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(krakenWebsocketURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(pairs))
+	for name := range pairs {
+		names = append(names, name)
+	}
+
+	for _, subscription := range []krakenWsSubscription{{Name: "ticker"}, {Name: "book", Depth: krakenBookDepth}, {Name: "trade"}} {
+		err := conn.WriteJSON(krakenWsSubscribe{
+			Event:        "subscribe",
+			Pair:         names,
+			Subscription: subscription,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// readFeed reads the messages of the Kraken websocket until the connection fails.
+//
+//     NOTE: channel messages are arrays [channelID, payload..., channelName, pair],
+//     the book updates may have two payloads (asks and bids).
+//     The order books are resynced by the snapshots sent when subscribing, the updates carry the checksum of the book.
+func (wrapper *KrakenWrapper) readFeed(conn *websocket.Conn, feed *feedSupervisor, pairs map[string]*environment.Market) error {
+	books := make(map[*environment.Market]*l2Book, len(pairs))
+	for _, market := range pairs {
+		book := newL2Book(market, wrapper.orderbook, wrapper.bookDepth)
+		book.limit = krakenBookDepth
+		book.checksum = krakenBookChecksum
+		books[market] = book
+	}
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		feed.alive() // including the heartbeats.
+
+		var fields []json.RawMessage
+		if err := json.Unmarshal(message, &fields); err != nil {
+			var event krakenWsEvent
+			if json.Unmarshal(message, &event) == nil && event.Status == "error" {
+				logrus.Errorf("Cannot subscribe to %s on %s: %s", event.Pair, wrapper.Name(), event.ErrorMessage)
+			}
+			continue
+		}
+		if len(fields) < 4 {
+			continue
+		}
+
+		var channel, pair string
+		if json.Unmarshal(fields[len(fields)-2], &channel) != nil || json.Unmarshal(fields[len(fields)-1], &pair) != nil {
+			continue
+		}
+		market, exists := pairs[pair]
+		if !exists {
+			continue
+		}
+		payloads := fields[1 : len(fields)-2]
+
+		switch {
+		case channel == "ticker":
+			var ticker krakenWsTicker
+			if err := json.Unmarshal(payloads[0], &ticker); err != nil {
+				logrus.Error(err)
+				continue
+			}
+			wrapper.handleTicker(market, ticker)
+		case channel == "trade":
+			var krakenTrades [][]json.RawMessage
+			if err := json.Unmarshal(payloads[0], &krakenTrades); err != nil {
+				logrus.Error(err)
+				continue
+			}
+			wrapper.trades.Add(market, krakenTradesOf(krakenTrades)...)
+		case strings.HasPrefix(channel, "book"):
+			var snapshot bool
+			var update bookUpdate
+			for _, payload := range payloads {
+				var message krakenWsBook
+				if err := json.Unmarshal(payload, &message); err != nil {
+					logrus.Error(err)
+					continue
+				}
+				if message.AsksSnapshot != nil || message.BidsSnapshot != nil {
+					snapshot = true
+					update.Asks = append(update.Asks, krakenBookLevels(message.AsksSnapshot)...)
+					update.Bids = append(update.Bids, krakenBookLevels(message.BidsSnapshot)...)
+				}
+				update.Asks = append(update.Asks, krakenBookLevels(message.Asks)...)
+				update.Bids = append(update.Bids, krakenBookLevels(message.Bids)...)
+				if message.Checksum != "" {
+					update.Checksum = message.Checksum
+				}
+			}
+
+			var err error
+			if snapshot {
+				err = books[market].reset(0, update.Asks, update.Bids)
+			} else {
+				err = books[market].apply(update)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleTicker updates the market summary with a ticker update.
+func (wrapper *KrakenWrapper) handleTicker(market *environment.Market, ticker krakenWsTicker) {
+	wrapper.summaries.Set(market, &environment.MarketSummary{
+		High:   krakenWsDecimal(ticker.High, 1),
+		Low:    krakenWsDecimal(ticker.Low, 1),
+		Volume: krakenWsDecimal(ticker.Volume, 1),
+		Bid:    krakenWsDecimal(ticker.Bid, 0),
+		Ask:    krakenWsDecimal(ticker.Ask, 0),
+		Last:   krakenWsDecimal(ticker.Close, 0),
+	})
+}
+
+// krakenWsDecimal gets the decimal value at the specified index of a ticker field, zero if missing.
+func krakenWsDecimal(values []interface{}, i int) decimal.Decimal {
+	if i >= len(values) {
+		return decimal.Zero
+	}
+	value, _ := values[i].(string)
+	ret, _ := decimal.NewFromString(value)
+	return ret
+}
+
+// krakenBookLevels parses the price levels [price, volume, timestamp] of an order book message, skipping the malformed ones.
+//
+//     NOTE: the prices and volumes keep the decimals sent, they are needed by the checksum.
+func krakenBookLevels(levels [][]string) []environment.Order {
+	ret := make([]environment.Order, 0, len(levels))
+	for _, level := range levels {
+		if len(level) < 3 {
+			continue
+		}
+		price, err := decimal.NewFromString(level[0])
+		if err != nil {
+			continue
+		}
+		volume, err := decimal.NewFromString(level[1])
+		if err != nil {
+			continue
+		}
+		timestamp, _ := decimal.NewFromString(level[2])
+
+		ret = append(ret, environment.Order{
+			Value:     price,
+			Quantity:  volume,
+			Timestamp: time.Unix(0, timestamp.Shift(9).IntPart()),
+		})
+	}
+	return ret
+}
+
+// krakenTradesOf parses the trades [price, volume, time, side, order type, misc, trade id] of the REST API or of the websocket,
+// skipping the malformed ones.
+//
+//     NOTE: the values are strings or numbers depending on the API, the websocket does not send the trade id.
+func krakenTradesOf(krakenTrades [][]json.RawMessage) []environment.Trade {
+	ret := make([]environment.Trade, 0, len(krakenTrades))
+	for _, fields := range krakenTrades {
+		if len(fields) < 4 {
+			continue
+		}
+		value := func(i int) string {
+			return strings.Trim(string(fields[i]), `"`)
+		}
+
+		price, err := decimal.NewFromString(value(0))
+		if err != nil {
+			continue
+		}
+		volume, err := decimal.NewFromString(value(1))
+		if err != nil {
+			continue
+		}
+		timestamp, err := decimal.NewFromString(value(2))
+		if err != nil {
+			continue
+		}
+
+		trade := environment.Trade{
+			Price:    price,
+			Quantity: volume,
+			Side:     takerSide(value(3) == "b"),
+			Time:     time.Unix(0, timestamp.Shift(9).IntPart()),
+		}
+		if len(fields) > 6 {
+			trade.ID = value(6)
+		}
+		ret = append(ret, trade)
+	}
+	return ret
+}
+
+// krakenBookChecksum computes the checksum of a Kraken order book: the CRC32 of the 10 best asks then the 10 best bids,
+// each level written as its price and volume without the decimal point and the leading zeros.
+func krakenBookChecksum(asks, bids []environment.Order) string {
+	var text strings.Builder
+	write := func(orders []environment.Order) {
+		for i := 0; i < len(orders) && i < 10; i++ {
+			text.WriteString(orders[i].Value.Coefficient().String())
+			text.WriteString(orders[i].Quantity.Coefficient().String())
+		}
+	}
+	write(asks)
+	write(bids)
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(text.String()))), 10)
+}
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return callContext(ctx, func() ([]environment.CandleStick, error) {
+		return wrapper.GetCandles(market, interval, from, to)
+	})
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return callContext(ctx, func() (*environment.MarketSummary, error) {
+		return wrapper.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return callContext(ctx, func() (*environment.OrderBook, error) {
+		return wrapper.GetOrderBook(market)
+	})
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.getRecentTrades(ctx, market)
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KrakenWrapper) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KrakenWrapper) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KrakenWrapper) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyMarket(market, amount)
+	})
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KrakenWrapper) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellMarket(market, amount)
+	})
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return callContext(ctx, func() (*environment.OrderStatus, error) {
+		return wrapper.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return callContext(ctx, func() ([]environment.OrderStatus, error) {
+		return wrapper.GetOpenOrders(market)
+	})
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelAllOrders(market)
+	})
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	return callContext(ctx, func() (*decimal.Decimal, error) {
+		return wrapper.GetBalance(symbol)
+	})
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return callContext(ctx, func() (map[string]environment.Balance, error) {
+		return wrapper.GetBalances()
+	})
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *KrakenWrapper) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.FeedConnect(markets)
+	})
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KrakenWrapper) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return sendContextErr(ctx, func() error {
+		return wrapper.Withdraw(destinationAddress, coinTicker, amount)
+	})
 }
@@ -17,8 +17,19 @@
 package exchanges
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/fiore/kucoin-go"
 	"github.com/fiore/kucoin-go/websocket"
@@ -29,24 +40,40 @@ import (
 // KucoinWrapper wrapsKucoin
 type KucoinWrapper struct {
 	api              *kucoin.Kucoin
-	ws               *websocket.WebSocket
+	publicKey        string
+	secretKey        string
 	websocketOn      bool
 	summaries        *SummaryCache
 	orderbook        *OrderbookCache
+	trades           *TradesCache
+	marketInfo       *MarketInfoCache
 	depositAddresses map[string]string
+	feeds            feedSet
+	maxDataAge       time.Duration
+	bookDepth        int
 }
 
 // NewKucoinWrapper creates a generic wrapper of theKucoin
 func NewKucoinWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
-	ws, _ := websocket.NewWS()
-	return &KucoinWrapper{
-		api:              kucoin.New(publicKey, secretKey),
-		ws:               ws,
+	wrapper := &KucoinWrapper{
+		api:              kucoin.NewCustomTimeout(publicKey, secretKey, restTimeout),
+		publicKey:        publicKey,
+		secretKey:        secretKey,
 		websocketOn:      false,
 		summaries:        NewSummaryCache(),
 		orderbook:        NewOrderbookCache(),
+		trades:           NewTradesCache(),
 		depositAddresses: depositAddresses,
+		maxDataAge:       DefaultMaxDataAge,
 	}
+	wrapper.marketInfo = NewMarketInfoCache(wrapper.GetMarkets)
+	return wrapper
+}
+
+func init() {
+	Register("kucoin", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewKucoinWrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
 }
 
 // Name returns the name of the wrapped exchange.
@@ -54,6 +81,19 @@ func (wrapper *KucoinWrapper) Name() string {
 	return "kucoin"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *KucoinWrapper) Capabilities() Capabilities {
+	return Capabilities{
+		WebsocketFeeds: true,
+		Candles:        true,
+		Trades:         true,
+		LimitOrders:    true,
+		Withdraw:       true,
+		TradingFees:    true,
+		OrderQuery:     true,
+	}
+}
+
 func (wrapper *KucoinWrapper) String() string {
 	return wrapper.Name()
 }
@@ -63,90 +103,240 @@ func (wrapper *KucoinWrapper) GetMarkets() ([]*environment.Market, error) {
 	KucoinMarkets, err := wrapper.api.GetSymbols()
 
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
+	}
+
+	coins, err := wrapper.api.GetCoins()
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	// the quantity of an order is limited to the trade precision of the traded coin.
+	tradePrecisions := make(map[string]int, len(coins))
+	for _, coin := range coins {
+		tradePrecisions[coin.Coin] = coin.TradePrecision
 	}
 
 	wrappedMarkets := make([]*environment.Market, 0, len(KucoinMarkets))
 	for _, market := range KucoinMarkets {
+		info := &environment.MarketInfo{}
+		if precision, exists := tradePrecisions[market.CoinType]; exists {
+			info.QuantityStep = decimal.New(1, -int32(precision))
+		}
+
 		wrappedMarkets = append(wrappedMarkets, &environment.Market{
 			Name:           market.Symbol,
 			BaseCurrency:   market.CoinType,
 			MarketCurrency: market.CoinTypePair,
+			Info:           info,
 		})
 	}
 
 	return wrappedMarkets, nil
 }
 
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *KucoinWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return wrapper.marketInfo.Get(MarketNameFor(market, wrapper))
+}
+
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *KucoinWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
-	ret, exists := wrapper.orderbook.Get(market)
 	if !wrapper.websocketOn {
-		kucoinOrderBook, err := wrapper.api.OrdersBook(MarketNameFor(market, wrapper), 0, 0, "")
-
+		ret, err := wrapper.orderbookFromREST(market)
 		if err != nil {
-			return nil, err
-		}
-
-		ret = &environment.OrderBook{}
-		for _, order := range kucoinOrderBook.BUY {
-			amount := order[1]
-			rate := order[0]
-			ret.Bids = append(ret.Bids, environment.Order{
-				Quantity: decimal.NewFromFloat(amount),
-				Value:    decimal.NewFromFloat(rate),
-			})
-		}
-		for _, order := range kucoinOrderBook.SELL {
-			amount := order[1]
-			rate := order[0]
-			ret.Asks = append(ret.Asks, environment.Order{
-				Quantity: decimal.NewFromFloat(amount),
-				Value:    decimal.NewFromFloat(rate),
-			})
+			return nil, mapError(wrapper, err)
 		}
 
 		wrapper.orderbook.Set(market, ret)
 		return ret, nil
 	}
 
-	if !exists {
-		return nil, errors.New("Orderbook not loaded")
+	return wrapper.orderbook.GetFresh(market, wrapper.maxDataAge)
+}
+
+func (wrapper *KucoinWrapper) orderbookFromREST(market *environment.Market) (*environment.OrderBook, error) {
+	kucoinOrderBook, err := wrapper.api.OrdersBook(MarketNameFor(market, wrapper), 0, 0, "")
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := &environment.OrderBook{}
+	for _, order := range kucoinOrderBook.BUY {
+		amount := order[1]
+		rate := order[0]
+		ret.Bids = append(ret.Bids, environment.Order{
+			Quantity: decimal.NewFromFloat(amount),
+			Value:    decimal.NewFromFloat(rate),
+		})
+	}
+	for _, order := range kucoinOrderBook.SELL {
+		amount := order[1]
+		rate := order[0]
+		ret.Asks = append(ret.Asks, environment.Order{
+			Quantity: decimal.NewFromFloat(amount),
+			Value:    decimal.NewFromFloat(rate),
+		})
 	}
 
 	return ret, nil
 }
 
 // BuyLimit performs a limit buy action.
-func (wrapper *KucoinWrapper) BuyLimit(market *environment.Market, amount, limit float64) (string, error) {
-	orderOid, err := wrapper.api.CreateOrder(MarketNameFor(market, wrapper), "BUY", limit, amount)
+func (wrapper *KucoinWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Bid, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderOid, err := wrapper.api.CreateOrderByString(MarketNameFor(market, wrapper), "BUY", formattedPrice, formattedQuantity)
 
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
 	}
 
 	return fmt.Sprint(orderOid), nil
 }
 
 // BuyMarket performs a market buy action.
-func (wrapper *KucoinWrapper) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	panic("Not Implemented")
+func (wrapper *KucoinWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", notSupported(wrapper, "BuyMarket")
 }
 
 // SellLimit performs a limit sell action.
-func (wrapper *KucoinWrapper) SellLimit(market *environment.Market, amount, limit float64) (string, error) {
-	orderOid, err := wrapper.api.CreateOrder(MarketNameFor(market, wrapper), "SELL", limit, amount)
+func (wrapper *KucoinWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Ask, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	orderOid, err := wrapper.api.CreateOrderByString(MarketNameFor(market, wrapper), "SELL", formattedPrice, formattedQuantity)
 
 	if err != nil {
-		return "", err
+		return "", mapError(wrapper, err)
 	}
 
 	return fmt.Sprint(orderOid), nil
 }
 
 // SellMarket performs a market sell action.
-func (wrapper *KucoinWrapper) SellMarket(market *environment.Market, amount float64) (string, error) {
-	panic("Not Implemented")
+func (wrapper *KucoinWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", notSupported(wrapper, "SellMarket")
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+//
+//     NOTE: Kucoin needs the side of the order to query it, so both sides are tried.
+func (wrapper *KucoinWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	var err error
+	for _, side := range []string{"BUY", "SELL"} {
+		var kucoinOrder kucoin.OrderDetails
+		kucoinOrder, err = wrapper.api.OrderDetails(MarketNameFor(market, wrapper), side, orderID, 0, 0)
+		if err != nil || kucoinOrder.OrderOid == "" {
+			continue
+		}
+
+		ret := environment.OrderStatus{
+			ID:             kucoinOrder.OrderOid,
+			Type:           environment.Bid,
+			Price:          decimal.NewFromFloat(kucoinOrder.OrderPrice),
+			Quantity:       decimal.NewFromFloat(kucoinOrder.DealAmount + kucoinOrder.PendingAmount),
+			FilledQuantity: decimal.NewFromFloat(kucoinOrder.DealAmount),
+			AveragePrice:   decimal.NewFromFloat(kucoinOrder.DealPriceAverage),
+			Fee:            decimal.NewFromFloat(kucoinOrder.FeeTotal),
+			FeeCurrency:    market.BaseCurrency,
+		}
+
+		if side == "SELL" {
+			ret.Type = environment.Ask
+		}
+
+		if kucoinOrder.PendingAmount > 0 {
+			if kucoinOrder.DealAmount > 0 {
+				ret.State = environment.OrderPartiallyFilled
+			} else {
+				ret.State = environment.OrderNew
+			}
+		} else if kucoinOrder.DealAmount > 0 {
+			ret.State = environment.OrderFilled
+		} else {
+			ret.State = environment.OrderCanceled
+		}
+
+		return &ret, nil
+	}
+
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+	return nil, errors.New("Order not found")
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+//
+//     NOTE: fees and average prices are not loaded, use GetOrder to get them.
+func (wrapper *KucoinWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	kucoinOrders, err := wrapper.api.ListActiveMapOrders(MarketNameFor(market, wrapper), "")
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, 0, len(kucoinOrders.BUY)+len(kucoinOrders.SELL))
+	for _, order := range kucoinOrders.BUY {
+		ret = append(ret, newKucoinOpenOrder(order.Oid, environment.Bid, order.Price, order.DealAmount, order.PendingAmount, order.CreatedAt))
+	}
+	for _, order := range kucoinOrders.SELL {
+		ret = append(ret, newKucoinOpenOrder(order.Oid, environment.Ask, order.Price, order.DealAmount, order.PendingAmount, order.CreatedAt))
+	}
+
+	return ret, nil
+}
+
+// newKucoinOpenOrder creates a environment.OrderStatus from the data of an active kucoin order.
+func newKucoinOpenOrder(orderID string, orderType environment.OrderType, price, dealAmount, pendingAmount float64, createdAt int64) environment.OrderStatus {
+	ret := environment.OrderStatus{
+		ID:             orderID,
+		Type:           orderType,
+		State:          environment.OrderNew,
+		Price:          decimal.NewFromFloat(price),
+		Quantity:       decimal.NewFromFloat(dealAmount + pendingAmount),
+		FilledQuantity: decimal.NewFromFloat(dealAmount),
+		Timestamp:      time.Unix(0, createdAt*int64(time.Millisecond)),
+	}
+
+	if dealAmount > 0 {
+		ret.State = environment.OrderPartiallyFilled
+	}
+
+	return ret
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *KucoinWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	openOrders, err := wrapper.GetOpenOrders(market)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	for _, order := range openOrders {
+		if order.ID != orderID {
+			continue
+		}
+		side := "BUY"
+		if order.Type == environment.Ask {
+			side = "SELL"
+		}
+		return wrapper.api.CancelOrder(MarketNameFor(market, wrapper), orderID, side)
+	}
+
+	return errors.New("Order not found")
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *KucoinWrapper) CancelAllOrders(market *environment.Market) error {
+	return wrapper.api.CancelAllOrders(MarketNameFor(market, wrapper), "")
 }
 
 // GetTicker gets the updated ticker for a market.
@@ -154,7 +344,7 @@ func (wrapper *KucoinWrapper) GetTicker(market *environment.Market) (*environmen
 
 	kucoinTicker, err := wrapper.api.GetSymbol(MarketNameFor(market, wrapper))
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	ask := decimal.NewFromFloat(kucoinTicker.Sell)
@@ -169,11 +359,10 @@ func (wrapper *KucoinWrapper) GetTicker(market *environment.Market) (*environmen
 
 // GetMarketSummary gets the current market summary.
 func (wrapper *KucoinWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
-	ret, exists := wrapper.summaries.Get(market)
 	if !wrapper.websocketOn {
 		kucoinSummary, err := wrapper.api.GetSymbol(MarketNameFor(market, wrapper))
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		ask := decimal.NewFromFloat(kucoinSummary.Sell)
@@ -183,7 +372,7 @@ func (wrapper *KucoinWrapper) GetMarketSummary(market *environment.Market) (*env
 		last := decimal.NewFromFloat(kucoinSummary.LastDealPrice)
 		volume := decimal.NewFromFloat(kucoinSummary.VolValue)
 
-		ret = &environment.MarketSummary{
+		ret := &environment.MarketSummary{
 			Last:   last,
 			Ask:    ask,
 			Bid:    bid,
@@ -196,11 +385,7 @@ func (wrapper *KucoinWrapper) GetMarketSummary(market *environment.Market) (*env
 		return ret, nil
 	}
 
-	if !exists {
-		return nil, errors.New("Summary not loaded")
-	}
-
-	return ret, nil
+	return wrapper.summaries.GetFresh(market, wrapper.maxDataAge)
 }
 
 // GetBalance gets the balance of the user of the specified currency.
@@ -216,6 +401,91 @@ func (wrapper *KucoinWrapper) GetBalance(symbol string) (*decimal.Decimal, error
 	return &ret, nil
 }
 
+const (
+	kucoinAPIURL           = "https://api.kucoin.com"
+	kucoinBalancesPath     = "/v1/account/balances"
+	kucoinWithdrawPath     = "/v1/account/%s/withdraw/apply"
+	kucoinBalancesPageSize = 20 // max balances per page.
+)
+
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+//
+//     NOTE: the client does not expose the balances list endpoint, it is requested to the REST API page by page.
+func (wrapper *KucoinWrapper) GetBalances() (map[string]environment.Balance, error) {
+	ret := make(map[string]environment.Balance)
+	for page := 1; ; page++ {
+		query := url.Values{
+			"limit": {fmt.Sprint(kucoinBalancesPageSize)},
+			"page":  {fmt.Sprint(page)},
+		}
+
+		var resp struct {
+			Success bool   `json:"success"`
+			Msg     string `json:"msg"`
+			Data    struct {
+				Datas   []kucoin.CoinBalance `json:"datas"`
+				PageNos int                  `json:"pageNos"`
+			} `json:"data"`
+		}
+		if err := wrapper.privateJSON(http.MethodGet, kucoinBalancesPath, query, &resp); err != nil {
+			return nil, mapError(wrapper, err)
+		}
+		if !resp.Success {
+			return nil, mapError(wrapper, errors.New(resp.Msg))
+		}
+
+		for _, kucoinBalance := range resp.Data.Datas {
+			ret[kucoinBalance.CoinType] = newBalance(decimal.NewFromFloat(kucoinBalance.Balance), decimal.NewFromFloat(kucoinBalance.FreezeBalance))
+		}
+		if page >= resp.Data.PageNos || len(resp.Data.Datas) == 0 {
+			return ret, nil
+		}
+	}
+}
+
+// privateJSON performs a signed request to a path of the REST API, decoding the JSON response into target.
+//
+//     NOTE: the parameters are sent in the query string of GET requests, as a form in the body otherwise.
+func (wrapper *KucoinWrapper) privateJSON(method string, path string, params url.Values, target interface{}) error {
+	encodedParams := params.Encode()
+
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		req, err = http.NewRequest(method, kucoinAPIURL+path+"?"+encodedParams, nil)
+	} else {
+		req, err = http.NewRequest(method, kucoinAPIURL+path, strings.NewReader(encodedParams))
+	}
+	if err != nil {
+		return err
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=utf-8")
+	}
+
+	// the signature is the HMAC-SHA256 of the base64 of "path/nonce/params".
+	nonce := fmt.Sprint(time.Now().UnixNano() / int64(time.Millisecond))
+	mac := hmac.New(sha256.New, []byte(wrapper.secretKey))
+	mac.Write([]byte(base64.StdEncoding.EncodeToString([]byte(path + "/" + nonce + "/" + encodedParams))))
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("KC-API-KEY", wrapper.publicKey)
+	req.Header.Set("KC-API-NONCE", nonce)
+	req.Header.Set("KC-API-SIGNATURE", hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Request to %s failed: %s %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
 func (wrapper *KucoinWrapper) GetDepositAddress(coinTicker string) (string, bool) {
 	addr, exists := wrapper.depositAddresses[coinTicker]
@@ -223,45 +493,485 @@ func (wrapper *KucoinWrapper) GetDepositAddress(coinTicker string) (string, bool
 }
 
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
-func (wrapper *KucoinWrapper) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
-	var feePercentage float64
+func (wrapper *KucoinWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0025
+		feePercentage = decimal.NewFromFloat(0.0025)
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *KucoinWrapper) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *KucoinWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
+}
+
+// kucoinCandlesPageSize represents the number of candles requested to the chart history endpoint at a time.
+const kucoinCandlesPageSize = 500
+
+// kucoinCandleResolutions represents the candle resolutions supported by Kucoin.
+var kucoinCandleResolutions = map[environment.CandleInterval]string{
+	environment.Interval1m:  "1",
+	environment.Interval5m:  "5",
+	environment.Interval15m: "15",
+	environment.Interval30m: "30",
+	environment.Interval1h:  "60",
+	environment.Interval1d:  "D",
+}
+
+// kucoinChartHistory represents a response of the chart history endpoint, a column per candle field.
+type kucoinChartHistory struct {
+	Status string    `json:"s"`
+	Time   []int64   `json:"t"`
+	Open   []float64 `json:"o"`
+	High   []float64 `json:"h"`
+	Low    []float64 `json:"l"`
+	Close  []float64 `json:"c"`
+	Volume []float64 `json:"v"`
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *KucoinWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	panic("Not Implemented")
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+//
+//     NOTE: the client does not expose the chart history endpoint and the websocket
+//     does not provide candles, they are always requested to the REST API.
+func (wrapper *KucoinWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.getCandles(context.Background(), market, interval, from, to)
 }
 
-// FeedConnect connects to the feed of the exchange.
+// getCandles gets the candles of a market opened in the [from, to) time range, requesting them within ctx.
+func (wrapper *KucoinWrapper) getCandles(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	resolution, supported := kucoinCandleResolutions[interval]
+	if !supported {
+		return nil, fmt.Errorf("Candle interval %s not supported by Kucoin", interval)
+	}
+
+	return paginateCandles(interval, from, to, func(since time.Time) ([]environment.CandleStick, error) {
+		end := to
+		if end.IsZero() {
+			end = time.Now()
+		}
+
+		start := since
+		if start.IsZero() {
+			start = end.Add(-kucoinCandlesPageSize * interval.Duration()) // the most recent candles.
+		} else if maxEnd := start.Add(kucoinCandlesPageSize * interval.Duration()); end.After(maxEnd) {
+			end = maxEnd
+		}
+
+		query := url.Values{
+			"symbol":     {MarketNameFor(market, wrapper)},
+			"resolution": {resolution},
+			"from":       {fmt.Sprint(start.Unix())},
+			"to":         {fmt.Sprint(end.Unix())},
+		}
+
+		var history kucoinChartHistory
+		err := getJSON(ctx, "https://api.kucoin.com/v1/open/chart/history", query, &history)
+		if err != nil {
+			return nil, mapError(wrapper, err)
+		}
+		if history.Status == "no_data" {
+			return nil, nil
+		}
+		if history.Status != "ok" {
+			return nil, fmt.Errorf("Cannot get the candles of %s on Kucoin: status %s", market.Name, history.Status)
+		}
+
+		page := make([]environment.CandleStick, 0, len(history.Time))
+		for i := range history.Time {
+			if i >= len(history.Open) || i >= len(history.High) || i >= len(history.Low) || i >= len(history.Close) || i >= len(history.Volume) {
+				break
+			}
+
+			page = append(page, environment.CandleStick{
+				OpenTime: time.Unix(history.Time[i], 0),
+				High:     decimal.NewFromFloat(history.High[i]),
+				Open:     decimal.NewFromFloat(history.Open[i]),
+				Close:    decimal.NewFromFloat(history.Close[i]),
+				Low:      decimal.NewFromFloat(history.Low[i]),
+				Volume:   decimal.NewFromFloat(history.Volume[i]),
+			})
+		}
+		return page, nil
+	})
+}
+
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+//
+//     NOTE: the client does not expose the trades endpoint, Kucoin does not publish the trade ids.
+//     The trades of the markets subscribed to the feed are loaded once, then updated by the websocket.
+func (wrapper *KucoinWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.getRecentTrades(context.Background(), market)
+}
+
+// getRecentTrades gets the most recent trades of a market, requesting them within ctx.
+func (wrapper *KucoinWrapper) getRecentTrades(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	subscribed := wrapper.feeds.subscribed(market)
+	if trades, loaded := wrapper.trades.Get(market); subscribed && loaded {
+		return trades, nil
+	}
+
+	query := url.Values{
+		"symbol": {MarketNameFor(market, wrapper)},
+		"limit":  {fmt.Sprint(tradesCacheSize)},
+	}
+
+	// each deal is [time (ms), direction, price, amount, volume value].
+	var resp struct {
+		Success bool            `json:"success"`
+		Msg     string          `json:"msg"`
+		Data    [][]interface{} `json:"data"`
+	}
+	if err := getJSON(ctx, "https://api.kucoin.com/v1/open/deal-orders", query, &resp); err != nil {
+		return nil, mapError(wrapper, err)
+	}
+	if !resp.Success {
+		return nil, mapError(wrapper, errors.New(resp.Msg))
+	}
+
+	// the deals are sent from the most recent.
+	trades := make([]environment.Trade, 0, len(resp.Data))
+	for i := len(resp.Data) - 1; i >= 0; i-- {
+		deal := resp.Data[i]
+		if len(deal) < 4 {
+			continue
+		}
+		timestamp, _ := deal[0].(float64)
+		direction, _ := deal[1].(string)
+		price, _ := deal[2].(float64)
+		amount, _ := deal[3].(float64)
+
+		trades = append(trades, environment.Trade{
+			Price:    decimal.NewFromFloat(price),
+			Quantity: decimal.NewFromFloat(amount),
+			Side:     takerSide(direction == "BUY"),
+			Time:     time.UnixMilli(int64(timestamp)),
+		})
+	}
+
+	if subscribed {
+		return wrapper.trades.Load(market, trades), nil
+	}
+	return trades, nil
+}
+
+// FeedConnect connects to the feed of the exchange, keeping the market summaries, order books and trades updated.
 func (wrapper *KucoinWrapper) FeedConnect(markets []*environment.Market) error {
-	panic("Not Implemented")
+	err := wrapper.feeds.connect(markets, func(markets []*environment.Market) (*feedSupervisor, error) {
+		books := make(map[*environment.Market]*l2Book, len(markets))
+		for _, m := range markets {
+			books[m] = newL2Book(m, wrapper.orderbook, wrapper.bookDepth)
+		}
+
+		resync := func() error {
+			for m, book := range books {
+				orderbook, err := wrapper.orderbookFromREST(m)
+				if err != nil {
+					return err
+				}
+				if err := book.reset(0, orderbook.Asks, orderbook.Bids); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		return newFeedSupervisor(wrapper.Name(), resync, func(ctx context.Context, feed *feedSupervisor) error {
+			wrapper.trades.Reset(markets)
+			return wrapper.readFeeds(ctx, feed, books)
+		}), nil
+	})
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+	wrapper.websocketOn = true
+
+	return nil
 }
 
-// subscribeFeeds subscribes to the Market Summary Feed service.
-func (wrapper *KucoinWrapper) subscribeFeeds(market *environment.Market) error {
-	panic("Not Implemented")
+// FeedStatus gets the status of the websocket feeds connected.
+func (wrapper *KucoinWrapper) FeedStatus() []FeedStatus {
+	return wrapper.feeds.status()
 }
 
-// Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *KucoinWrapper) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	_, err := wrapper.api.CreateWithdrawalApply(coinTicker, destinationAddress, amount)
+// SetMaxDataAge sets the max age of the data served from the websocket feeds, not positive means no limit.
+func (wrapper *KucoinWrapper) SetMaxDataAge(maxAge time.Duration) {
+	wrapper.maxDataAge = maxAge
+}
+
+// SetOrderBookDepth sets the max number of price levels per side of the order books of the websocket feeds, not positive means all the levels.
+func (wrapper *KucoinWrapper) SetOrderBookDepth(depth int) {
+	wrapper.bookDepth = depth
+}
+
+// FeedRelease releases a subscription to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *KucoinWrapper) FeedRelease(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribe(markets))
+}
+
+// FeedClose releases all the subscriptions to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *KucoinWrapper) FeedClose(markets []*environment.Market) {
+	wrapper.trades.Reset(wrapper.feeds.unsubscribeAll(markets))
+}
+
+// readFeeds subscribes to the ticker, the order book and the trades feeds of the markets, reading them until a connection fails or ctx is done.
+//
+//     NOTE: the order book feed sends the quantities added to and removed from each price level,
+//     it is applied to the snapshot loaded from REST.
+//     Each session gets a new token from the websocket servers, they expire.
+func (wrapper *KucoinWrapper) readFeeds(ctx context.Context, feed *feedSupervisor, books map[*environment.Market]*l2Book) error {
+	ws, err := websocket.NewWS()
 	if err != nil {
 		return err
 	}
 
+	var conns []*websocket.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	errs := make(chan error, 3*len(books))
+	for m, book := range books {
+		tickConn, err := ws.Subscribe(websocket.Tick, MarketNameFor(m, wrapper))
+		if err != nil {
+			return err
+		}
+		conns = append(conns, tickConn)
+
+		bookConn, err := ws.Subscribe(websocket.TOrderBook, MarketNameFor(m, wrapper))
+		if err != nil {
+			return err
+		}
+		conns = append(conns, bookConn)
+
+		tradesConn, err := ws.Subscribe(websocket.THistory, MarketNameFor(m, wrapper))
+		if err != nil {
+			return err
+		}
+		conns = append(conns, tradesConn)
+
+		go wrapper.readTicker(m, tickConn.Updates(), feed, errs)
+		go wrapper.readOrderbook(book, bookConn.Updates(), feed, errs)
+		go wrapper.readTrades(m, tradesConn.Updates(), feed, errs)
+	}
+	feed.connected()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	}
+}
+
+// readTicker updates the market summary with the ticker feed of a market, until the feed is closed or fails.
+func (wrapper *KucoinWrapper) readTicker(market *environment.Market, updates <-chan interface{}, feed *feedSupervisor, errs chan<- error) {
+	for update := range updates {
+		feed.alive()
+
+		switch update := update.(type) {
+		case *websocket.Market:
+			wrapper.summaries.Set(market, &environment.MarketSummary{
+				Last:   decimal.NewFromFloat(update.LastDealPrice),
+				Ask:    decimal.NewFromFloat(update.Sell),
+				Bid:    decimal.NewFromFloat(update.Buy),
+				High:   decimal.NewFromFloat(update.High),
+				Low:    decimal.NewFromFloat(update.Low),
+				Volume: decimal.NewFromFloat(update.VolValue),
+			})
+		case error:
+			errs <- update
+			return
+		}
+	}
+}
+
+// readOrderbook applies the order book feed of a market to its order book, until the feed is closed or fails.
+func (wrapper *KucoinWrapper) readOrderbook(book *l2Book, updates <-chan interface{}, feed *feedSupervisor, errs chan<- error) {
+	for update := range updates {
+		feed.alive()
+
+		switch update := update.(type) {
+		case *websocket.OrderBook:
+			if err := book.apply(kucoinBookUpdate(update)); err != nil {
+				errs <- err
+				return
+			}
+		case error:
+			errs <- update
+			return
+		}
+	}
+}
+
+// readTrades adds the trades feed of a market to its recent trades, until the feed is closed or fails.
+func (wrapper *KucoinWrapper) readTrades(market *environment.Market, updates <-chan interface{}, feed *feedSupervisor, errs chan<- error) {
+	for update := range updates {
+		feed.alive()
+
+		switch update := update.(type) {
+		case *websocket.History:
+			wrapper.trades.Add(market, environment.Trade{
+				Price:    decimal.NewFromFloat(update.Price),
+				Quantity: decimal.NewFromFloat(update.Count),
+				Side:     takerSide(update.Direction == "BUY"),
+				Time:     time.UnixMilli(update.Time),
+			})
+		case error:
+			errs <- update
+			return
+		}
+	}
+}
+
+// kucoinBookUpdate converts an update of the order book feed, adding (ADD) or removing (CANCEL) a quantity at a price level.
+func kucoinBookUpdate(update *websocket.OrderBook) bookUpdate {
+	level := environment.Order{
+		Value:    decimal.NewFromFloat(update.Price),
+		Quantity: decimal.NewFromFloat(update.Count),
+	}
+	if update.Action == "CANCEL" {
+		level.Quantity = level.Quantity.Neg()
+	}
+
+	if update.Type == "BUY" {
+		return bookUpdate{Bids: []environment.Order{level}, Delta: true}
+	}
+	return bookUpdate{Asks: []environment.Order{level}, Delta: true}
+}
+
+// Withdraw performs a withdraw operation from the exchange to a destination address.
+func (wrapper *KucoinWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	params := url.Values{}
+	params.Set("address", destinationAddress)
+	params.Set("amount", amount.String())
+
+	var resp struct {
+		Success bool   `json:"success"`
+		Msg     string `json:"msg"`
+	}
+	err := wrapper.privateJSON(http.MethodPost, fmt.Sprintf(kucoinWithdrawPath, strings.ToUpper(coinTicker)), params, &resp)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+	if !resp.Success {
+		return mapError(wrapper, errors.New(resp.Msg))
+	}
+
 	return nil
 }
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.getCandles(ctx, market, interval, from, to)
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return callContext(ctx, func() (*environment.MarketSummary, error) {
+		return wrapper.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return callContext(ctx, func() (*environment.OrderBook, error) {
+		return wrapper.GetOrderBook(market)
+	})
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.getRecentTrades(ctx, market)
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KucoinWrapper) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KucoinWrapper) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KucoinWrapper) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyMarket(market, amount)
+	})
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KucoinWrapper) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellMarket(market, amount)
+	})
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return callContext(ctx, func() (*environment.OrderStatus, error) {
+		return wrapper.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return callContext(ctx, func() ([]environment.OrderStatus, error) {
+		return wrapper.GetOpenOrders(market)
+	})
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelAllOrders(market)
+	})
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	return callContext(ctx, func() (*decimal.Decimal, error) {
+		return wrapper.GetBalance(symbol)
+	})
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return callContext(ctx, func() (map[string]environment.Balance, error) {
+		return wrapper.GetBalances()
+	})
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *KucoinWrapper) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.FeedConnect(markets)
+	})
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *KucoinWrapper) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return sendContextErr(ctx, func() error {
+		return wrapper.Withdraw(destinationAddress, coinTicker, amount)
+	})
+}
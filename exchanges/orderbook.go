@@ -0,0 +1,215 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+// bookMaxPending is the max number of updates buffered while waiting for the snapshot of an order book.
+const bookMaxPending = 1000
+
+// OrderBookDepthLimiter is implemented by the wrappers maintaining the order books of their websocket feeds.
+type OrderBookDepthLimiter interface {
+	SetOrderBookDepth(depth int) // Sets the max number of price levels per side of the order books, not positive means all the levels.
+}
+
+// bookUpdate represents a change of an order book sent by a websocket feed.
+type bookUpdate struct {
+	FirstSequence int64               // first sequence number covered by the update, 0 if the same as Sequence.
+	Sequence      int64               // sequence number of the update, 0 if the exchange does not number them.
+	Asks          []environment.Order // changed ask levels, a zero quantity removes the level.
+	Bids          []environment.Order // changed bid levels, a zero quantity removes the level.
+	Delta         bool                // if true the quantities are added to the levels instead of replacing them.
+	Checksum      string              // checksum of the book after the update as sent by the exchange, empty if not sent.
+}
+
+// l2Book maintains the order book of a market from the snapshots and the updates of a websocket feed,
+// publishing a copy to the order book cache of the wrapper after each change.
+//
+//     NOTE: updates are applied in sequence, a gap or a checksum mismatch fails the update and
+//     the book waits for a new snapshot (the feed session ends and resyncs), buffering the updates received meanwhile.
+type l2Book struct {
+	market   *environment.Market
+	cache    *OrderbookCache
+	depth    int                                         // levels published per side, 0 for all.
+	limit    int                                         // levels kept per side as subscribed on the exchange, 0 for all.
+	checksum func(asks, bids []environment.Order) string // computes the checksum sent by the exchange, nil if not validated.
+
+	mutex    sync.Mutex
+	synced   bool
+	sequence int64
+	asks     []environment.Order // sorted from the lowest price.
+	bids     []environment.Order // sorted from the highest price.
+	pending  []bookUpdate        // updates received before the snapshot.
+}
+
+// newL2Book creates the order book of a market, publishing at most depth levels per side (not positive means all).
+//
+// The book must be loaded with a snapshot before the updates are applied.
+func newL2Book(market *environment.Market, cache *OrderbookCache, depth int) *l2Book {
+	if depth < 0 {
+		depth = 0
+	}
+	return &l2Book{
+		market: market,
+		cache:  cache,
+		depth:  depth,
+	}
+}
+
+// reset loads a snapshot of the book, then applies the buffered updates newer than the snapshot.
+func (book *l2Book) reset(sequence int64, asks []environment.Order, bids []environment.Order) error {
+	book.mutex.Lock()
+	defer book.mutex.Unlock()
+
+	book.asks = book.asks[:0]
+	book.bids = book.bids[:0]
+	book.setLevels(asks, bids, false)
+	book.sequence = sequence
+	book.synced = true
+
+	pending := book.pending
+	book.pending = nil
+	for _, update := range pending {
+		if err := book.applyLocked(update); err != nil {
+			return err
+		}
+	}
+
+	book.publishLocked()
+	return nil
+}
+
+// apply applies an update to the book, buffering it if the book is waiting for a snapshot.
+func (book *l2Book) apply(update bookUpdate) error {
+	book.mutex.Lock()
+	defer book.mutex.Unlock()
+
+	if !book.synced {
+		if len(book.pending) == bookMaxPending {
+			book.pending = book.pending[1:]
+		}
+		book.pending = append(book.pending, update)
+		return nil
+	}
+
+	if err := book.applyLocked(update); err != nil {
+		return err
+	}
+	book.publishLocked()
+	return nil
+}
+
+// applyLocked applies an update to a synced book, the book must be locked.
+func (book *l2Book) applyLocked(update bookUpdate) error {
+	if update.Sequence != 0 {
+		if update.Sequence <= book.sequence {
+			return nil // already in the snapshot.
+		}
+
+		first := update.FirstSequence
+		if first == 0 {
+			first = update.Sequence
+		}
+		if book.sequence != 0 && first > book.sequence+1 {
+			book.invalidateLocked()
+			return fmt.Errorf("Gap in the order book of %s: got update %d after %d", book.market.Name, first, book.sequence)
+		}
+		book.sequence = update.Sequence
+	}
+
+	book.setLevels(update.Asks, update.Bids, update.Delta)
+
+	if book.checksum != nil && update.Checksum != "" {
+		if checksum := book.checksum(book.asks, book.bids); checksum != update.Checksum {
+			book.invalidateLocked()
+			return fmt.Errorf("Checksum mismatch in the order book of %s: expected %s, got %s", book.market.Name, update.Checksum, checksum)
+		}
+	}
+	return nil
+}
+
+// invalidateLocked marks the book as out of sync, waiting for a new snapshot, the book must be locked.
+func (book *l2Book) invalidateLocked() {
+	book.synced = false
+	book.sequence = 0
+	book.pending = nil
+}
+
+// setLevels updates the price levels of both sides of the book, keeping the subscribed depth.
+func (book *l2Book) setLevels(asks []environment.Order, bids []environment.Order, delta bool) {
+	for _, level := range asks {
+		book.asks = setBookLevel(book.asks, level, delta, decimal.Decimal.LessThan)
+	}
+	for _, level := range bids {
+		book.bids = setBookLevel(book.bids, level, delta, decimal.Decimal.GreaterThan)
+	}
+
+	if book.limit > 0 && len(book.asks) > book.limit {
+		book.asks = book.asks[:book.limit]
+	}
+	if book.limit > 0 && len(book.bids) > book.limit {
+		book.bids = book.bids[:book.limit]
+	}
+}
+
+// publishLocked sets a copy of the book in the cache, the book must be locked.
+func (book *l2Book) publishLocked() {
+	book.cache.Set(book.market, &environment.OrderBook{
+		Asks: copyBookLevels(book.asks, book.depth),
+		Bids: copyBookLevels(book.bids, book.depth),
+	})
+}
+
+// setBookLevel sets (or, if delta, adds to) the quantity of a price level of a side of an order book, sorted from the best price.
+//
+// A level without a positive quantity left is removed.
+func setBookLevel(orders []environment.Order, level environment.Order, delta bool, better func(decimal.Decimal, decimal.Decimal) bool) []environment.Order {
+	i := sort.Search(len(orders), func(i int) bool {
+		return !better(orders[i].Value, level.Value)
+	})
+	exists := i < len(orders) && orders[i].Value.Equal(level.Value)
+
+	if delta && exists {
+		level.Quantity = orders[i].Quantity.Add(level.Quantity)
+	}
+
+	switch {
+	case exists && !level.Quantity.IsPositive():
+		return append(orders[:i], orders[i+1:]...)
+	case exists:
+		orders[i] = level
+	case level.Quantity.IsPositive():
+		orders = append(orders, environment.Order{})
+		copy(orders[i+1:], orders[i:])
+		orders[i] = level
+	}
+	return orders
+}
+
+// copyBookLevels copies at most depth levels of a side of an order book, not positive means all the levels.
+func copyBookLevels(orders []environment.Order, depth int) []environment.Order {
+	if depth > 0 && len(orders) > depth {
+		orders = orders[:depth]
+	}
+	return append([]environment.Order(nil), orders...)
+}
@@ -0,0 +1,285 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"testing"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+)
+
+// krakenExampleAsks and krakenExampleBids are the order book of the checksum example of the Kraken documentation.
+var (
+	krakenExampleAsks = levels(
+		"0.05005", "0.00000500", "0.05010", "0.00000500", "0.05015", "0.00000500", "0.05020", "0.00000500", "0.05025", "0.00000500",
+		"0.05030", "0.00000500", "0.05035", "0.00000500", "0.05040", "0.00000500", "0.05045", "0.00000500", "0.05050", "0.00000500",
+	)
+	krakenExampleBids = levels(
+		"0.05000", "0.00000500", "0.04995", "0.00000500", "0.04990", "0.00000500", "0.04980", "0.00000500", "0.04975", "0.00000500",
+		"0.04970", "0.00000500", "0.04965", "0.00000500", "0.04960", "0.00000500", "0.04955", "0.00000500", "0.04950", "0.00000500",
+	)
+)
+
+// krakenExampleChecksum is the checksum of the example order book of the Kraken documentation.
+const krakenExampleChecksum = "974947235"
+
+// bookStep represents a snapshot or an update received by an order book.
+type bookStep struct {
+	snapshot *bookSnapshot // loaded with reset if not nil, update is applied otherwise.
+	update   bookUpdate
+	wantErr  bool
+}
+
+// bookSnapshot represents a snapshot of an order book.
+type bookSnapshot struct {
+	sequence int64
+	asks     []environment.Order
+	bids     []environment.Order
+}
+
+func TestL2Book(t *testing.T) {
+	snapshot := &bookSnapshot{2, levels("1", "1", "2", "1"), levels("0.9", "1", "0.8", "1")}
+
+	tests := []struct {
+		name       string
+		depth      int
+		limit      int
+		checksum   bool
+		steps      []bookStep
+		wantSynced bool
+		wantAsks   []environment.Order // published levels.
+		wantBids   []environment.Order
+	}{
+		{
+			name:       "snapshot",
+			steps:      []bookStep{{snapshot: snapshot}},
+			wantSynced: true,
+			wantAsks:   levels("1", "1", "2", "1"),
+			wantBids:   levels("0.9", "1", "0.8", "1"),
+		},
+		{
+			name: "levels replaced and inserted",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 3, Asks: levels("1", "3", "1.5", "2"), Bids: levels("0.95", "1")}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("1", "3", "1.5", "2", "2", "1"),
+			wantBids:   levels("0.95", "1", "0.9", "1", "0.8", "1"),
+		},
+		{
+			name: "zero quantities remove the levels",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 3, Asks: levels("1", "0"), Bids: levels("0.9", "0", "0.7", "0")}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("2", "1"),
+			wantBids:   levels("0.8", "1"),
+		},
+		{
+			name: "deltas added to the levels, removing the exhausted ones",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 3, Asks: levels("1", "0.5", "3", "1"), Delta: true}},
+				{update: bookUpdate{Sequence: 4, Asks: levels("1", "-1.5"), Bids: levels("0.8", "-2"), Delta: true}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("2", "1", "3", "1"),
+			wantBids:   levels("0.9", "1"),
+		},
+		{
+			name: "updates already in the snapshot ignored",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 2, Asks: levels("1", "5")}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("1", "1", "2", "1"),
+			wantBids:   levels("0.9", "1", "0.8", "1"),
+		},
+		{
+			name: "update range covering the snapshot",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{FirstSequence: 1, Sequence: 4, Asks: levels("1", "5")}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("1", "5", "2", "1"),
+			wantBids:   levels("0.9", "1", "0.8", "1"),
+		},
+		{
+			name: "sequence gap",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 4, Asks: levels("1", "5")}, wantErr: true},
+			},
+			wantSynced: false,
+			wantAsks:   levels("1", "1", "2", "1"), // the book published last.
+			wantBids:   levels("0.9", "1", "0.8", "1"),
+		},
+		{
+			name: "updates buffered after a gap",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 4, Asks: levels("1", "5")}, wantErr: true},
+				{update: bookUpdate{Sequence: 5, Asks: levels("1", "6")}},
+			},
+			wantSynced: false,
+			wantAsks:   levels("1", "1", "2", "1"),
+			wantBids:   levels("0.9", "1", "0.8", "1"),
+		},
+		{
+			name: "resync replaying the buffered updates newer than the snapshot",
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 4, Asks: levels("1", "5")}, wantErr: true},
+				{update: bookUpdate{Sequence: 5, Asks: levels("1", "6")}},
+				{update: bookUpdate{Sequence: 6, Bids: levels("0.9", "0")}},
+				{snapshot: &bookSnapshot{5, levels("1", "6", "2", "1"), levels("0.9", "2")}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("1", "6", "2", "1"),
+			wantBids:   nil, // the only bid removed by the replayed update.
+		},
+		{
+			name: "updates buffered before the first snapshot",
+			steps: []bookStep{
+				{update: bookUpdate{Sequence: 2, Asks: levels("1", "7")}},
+				{update: bookUpdate{Sequence: 3, Asks: levels("2", "0")}},
+				{snapshot: snapshot},
+			},
+			wantSynced: true,
+			wantAsks:   levels("1", "1"),
+			wantBids:   levels("0.9", "1", "0.8", "1"),
+		},
+		{
+			name: "gap between the snapshot and the buffered updates",
+			steps: []bookStep{
+				{update: bookUpdate{Sequence: 5, Asks: levels("1", "7")}},
+				{snapshot: snapshot, wantErr: true},
+			},
+			wantSynced: false,
+		},
+		{
+			name:  "depth of the published levels",
+			depth: 1,
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 3, Asks: levels("1.5", "1")}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("1", "1"),
+			wantBids:   levels("0.9", "1"),
+		},
+		{
+			name:  "levels kept up to the subscribed limit",
+			limit: 2,
+			steps: []bookStep{
+				{snapshot: snapshot},
+				{update: bookUpdate{Sequence: 3, Asks: levels("0.95", "1"), Bids: levels("0.7", "1")}},
+				{update: bookUpdate{Sequence: 4, Asks: levels("0.95", "0")}},
+			},
+			wantSynced: true,
+			wantAsks:   levels("1", "1"), // the level beyond the limit is dropped, not restored.
+			wantBids:   levels("0.9", "1", "0.8", "1"),
+		},
+		{
+			name:     "checksum matching",
+			checksum: true,
+			steps: []bookStep{
+				{snapshot: &bookSnapshot{0, krakenExampleAsks, krakenExampleBids}},
+				{update: bookUpdate{Asks: levels("0.05060", "0.00000500"), Checksum: krakenExampleChecksum}}, // beyond the 10 levels checked.
+			},
+			wantSynced: true,
+			wantAsks:   append(append([]environment.Order(nil), krakenExampleAsks...), levels("0.05060", "0.00000500")...),
+			wantBids:   krakenExampleBids,
+		},
+		{
+			name:     "checksum mismatch",
+			checksum: true,
+			steps: []bookStep{
+				{snapshot: &bookSnapshot{0, krakenExampleAsks, krakenExampleBids}},
+				{update: bookUpdate{Asks: levels("0.05005", "0.00001000"), Checksum: krakenExampleChecksum}, wantErr: true},
+			},
+			wantSynced: false,
+			wantAsks:   krakenExampleAsks,
+			wantBids:   krakenExampleBids,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewOrderbookCache()
+			book := newL2Book(testMarket, cache, test.depth)
+			book.limit = test.limit
+			if test.checksum {
+				book.checksum = krakenBookChecksum
+			}
+
+			for i, step := range test.steps {
+				var err error
+				if step.snapshot != nil {
+					err = book.reset(step.snapshot.sequence, step.snapshot.asks, step.snapshot.bids)
+				} else {
+					err = book.apply(step.update)
+				}
+				if (err != nil) != step.wantErr {
+					t.Fatalf("step %d: error = %v, want error %t", i, err, step.wantErr)
+				}
+			}
+
+			if book.synced != test.wantSynced {
+				t.Errorf("synced = %t, want %t", book.synced, test.wantSynced)
+			}
+			published, exists := cache.Get(testMarket)
+			if !exists {
+				published = &environment.OrderBook{}
+			}
+			if !equalLevels(published.Asks, test.wantAsks) {
+				t.Errorf("asks = %v, want %v", published.Asks, test.wantAsks)
+			}
+			if !equalLevels(published.Bids, test.wantBids) {
+				t.Errorf("bids = %v, want %v", published.Bids, test.wantBids)
+			}
+		})
+	}
+}
+
+func TestKrakenBookChecksum(t *testing.T) {
+	if checksum := krakenBookChecksum(krakenExampleAsks, krakenExampleBids); checksum != krakenExampleChecksum {
+		t.Errorf("krakenBookChecksum = %s, want %s", checksum, krakenExampleChecksum)
+	}
+
+	// only the 10 best levels per side are covered.
+	asks := append(append([]environment.Order(nil), krakenExampleAsks...), levels("0.05060", "1")...)
+	if checksum := krakenBookChecksum(asks, krakenExampleBids); checksum != krakenExampleChecksum {
+		t.Errorf("krakenBookChecksum with 11 asks = %s, want %s", checksum, krakenExampleChecksum)
+	}
+}
+
+// equalLevels tells if two sides of an order book have the same prices and quantities.
+func equalLevels(got []environment.Order, want []environment.Order) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].Value.Equal(want[i].Value) || !got[i].Quantity.Equal(want[i].Quantity) {
+			return false
+		}
+	}
+	return true
+}
@@ -16,9 +16,20 @@
 package exchanges
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/shopspring/decimal"
 
@@ -26,33 +37,72 @@ import (
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 )
 
+// poloniexMarketInfo represents the trading rules of the Poloniex markets, which are not published per market.
+var poloniexMarketInfo = environment.MarketInfo{
+	PriceTick:    decimal.New(1, -8),
+	QuantityStep: decimal.New(1, -8),
+}
+
 // PoloniexWrapper provides a Generic wrapper of the Poloniex API.
 type PoloniexWrapper struct {
 	api              *poloniex.Poloniex // access to Poloniex API
-	bindedTickers    map[string]bool    // if true, i am subscribing to market ticker.
+	publicKey        string             // credentials of the private commands, performed by the wrapper.
+	secretKey        string
+	nonce            int64                      // nonce of the last private command.
+	privateMutex     sync.Mutex                 // sends the private commands one at a time, so that their nonces arrive in order.
+	bindedTickers    map[string]*feedSupervisor // feed subscribing each market ticker, nil if released.
+	tickersMutex     sync.Mutex
 	summaries        *SummaryCache
 	candles          *CandlesCache
+	trades           *TradesCache
 	depositAddresses map[string]string
 	websocketOn      bool
+	startWS          sync.Once
+	feeds            feedSet
+	maxDataAge       time.Duration
 }
 
 // NewPoloniexWrapper creates a generic wrapper of the poloniex API.
 func NewPoloniexWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
 	return &PoloniexWrapper{
 		api:              poloniex.NewWithCredentials(publicKey, secretKey),
-		bindedTickers:    make(map[string]bool),
+		publicKey:        publicKey,
+		secretKey:        secretKey,
+		nonce:            time.Now().UnixNano(),
+		bindedTickers:    make(map[string]*feedSupervisor),
 		summaries:        NewSummaryCache(),
 		candles:          NewCandlesCache(),
+		trades:           NewTradesCache(),
 		depositAddresses: depositAddresses,
+		maxDataAge:       DefaultMaxDataAge,
 		websocketOn:      false,
 	}
 }
 
+func init() {
+	Register("poloniex", func(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+		return NewPoloniexWrapper(config.PublicKey, config.SecretKey, config.DepositAddresses), nil
+	})
+}
+
 // Name returns the name of the wrapped exchange.
 func (wrapper *PoloniexWrapper) Name() string {
 	return "poloniex"
 }
 
+// Capabilities gets the operations supported by the wrapper.
+func (wrapper *PoloniexWrapper) Capabilities() Capabilities {
+	return Capabilities{
+		WebsocketFeeds: true,
+		Candles:        true,
+		Trades:         true,
+		LimitOrders:    true,
+		Withdraw:       true,
+		TradingFees:    true,
+		OrderQuery:     true,
+	}
+}
+
 func (wrapper *PoloniexWrapper) String() string {
 	return wrapper.Name()
 }
@@ -61,58 +111,91 @@ func (wrapper *PoloniexWrapper) String() string {
 func (wrapper *PoloniexWrapper) GetMarkets() ([]*environment.Market, error) {
 	poloniexMarkets, err := wrapper.api.Currencies()
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 	wrappedMarkets := make([]*environment.Market, 0, len(poloniexMarkets))
 	for _, market := range poloniexMarkets {
 		if market.Disabled == 1 {
 			name := strings.SplitN(market.Name, "/", 2)
+			info := poloniexMarketInfo
 			wrappedMarkets = append(wrappedMarkets, &environment.Market{
 				Name:           market.Name,
 				BaseCurrency:   name[1],
 				MarketCurrency: name[0],
+				Info:           &info,
 			})
 		}
 	}
 	return wrappedMarkets, nil
 }
 
-// GetCandles gets the candle data from the exchange.
-func (wrapper *PoloniexWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+// poloniexCandlePeriods represents the candle periods (in seconds) supported by Poloniex.
+var poloniexCandlePeriods = map[environment.CandleInterval]int{
+	environment.Interval5m:  300,
+	environment.Interval15m: 900,
+	environment.Interval30m: 1800,
+	environment.Interval4h:  14400,
+	environment.Interval1d:  86400,
+}
+
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+//
+//     NOTE: a zero from gets the candles of the last 24 hours.
+func (wrapper *PoloniexWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
 	if !wrapper.websocketOn {
-		poloniesCandles, err := wrapper.api.ChartData(MarketNameFor(market, wrapper))
+		period, supported := poloniexCandlePeriods[interval]
+		if !supported {
+			return nil, fmt.Errorf("Candle interval %s not supported by Poloniex", interval)
+		}
+
+		end := to
+		if end.IsZero() {
+			end = time.Now()
+		}
+		start := from
+		if start.IsZero() {
+			start = end.Add(-24 * time.Hour)
+		}
+
+		poloniesCandles, err := wrapper.api.ChartDataPeriod(MarketNameFor(market, wrapper), start, end, period)
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		ret := make([]environment.CandleStick, len(poloniesCandles))
 
 		for i, poloniexCandle := range poloniesCandles {
 			ret[i] = environment.CandleStick{
-				High:   decimal.NewFromFloat(poloniexCandle.High),
-				Open:   decimal.NewFromFloat(poloniexCandle.Open),
-				Close:  decimal.NewFromFloat(poloniexCandle.Close),
-				Low:    decimal.NewFromFloat(poloniexCandle.Low),
-				Volume: decimal.NewFromFloat(poloniexCandle.Volume),
+				OpenTime: time.Unix(poloniexCandle.Date, 0),
+				High:     decimal.NewFromFloat(poloniexCandle.High),
+				Open:     decimal.NewFromFloat(poloniexCandle.Open),
+				Close:    decimal.NewFromFloat(poloniexCandle.Close),
+				Low:      decimal.NewFromFloat(poloniexCandle.Low),
+				Volume:   decimal.NewFromFloat(poloniexCandle.Volume),
 			}
 		}
 
-		wrapper.candles.Set(market, ret)
+		wrapper.candles.Set(market, interval, ret)
 	}
 
-	ret, candleLoaded := wrapper.candles.Get(market)
-	if !candleLoaded {
-		return nil, errors.New("No candle data yet")
+	ret, err := wrapper.candles.GetFresh(market, interval, wrapper.maxDataAge)
+	if err != nil {
+		return nil, err
 	}
 
-	return ret, nil
+	return filterCandles(ret, from, to), nil
+}
+
+// GetMarketInfo gets the trading rules of a market.
+func (wrapper *PoloniexWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	return poloniexMarketInfo, nil
 }
 
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *PoloniexWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
 	poloniexOrderBook, err := wrapper.api.OrderBook(MarketNameFor(market, wrapper))
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 
 	var orderBook environment.OrderBook
@@ -132,33 +215,290 @@ func (wrapper *PoloniexWrapper) GetOrderBook(market *environment.Market) (*envir
 	return &orderBook, nil
 }
 
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+//
+//     NOTE: the trades of the markets subscribed to the feed are loaded once, then updated by the websocket.
+func (wrapper *PoloniexWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	subscribed := wrapper.feeds.subscribed(market)
+	if trades, loaded := wrapper.trades.Get(market); subscribed && loaded {
+		return trades, nil
+	}
+
+	poloniexTrades, err := wrapper.api.TradeHistory(MarketNameFor(market, wrapper))
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	// the trades are sent from the most recent.
+	trades := make([]environment.Trade, len(poloniexTrades))
+	for i, trade := range poloniexTrades {
+		timestamp, _ := time.Parse("2006-01-02 15:04:05", trade.Date)
+		trades[len(trades)-1-i] = environment.Trade{
+			ID:       fmt.Sprint(trade.TradeID),
+			Price:    decimal.NewFromFloat(trade.Rate),
+			Quantity: decimal.NewFromFloat(trade.Amount),
+			Side:     takerSide(trade.Type == "buy"),
+			Time:     timestamp,
+		}
+	}
+
+	if subscribed {
+		return wrapper.trades.Load(market, trades), nil
+	}
+	return trades, nil
+}
+
 // BuyLimit performs a limit buy action.
-func (wrapper *PoloniexWrapper) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.Buy(MarketNameFor(market, wrapper), amount, limit)
-	return fmt.Sprint(orderNumber.OrderNumber), err
+func (wrapper *PoloniexWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Bid, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	return wrapper.placeOrder(market, "buy", quantity, price)
 }
 
 // SellLimit performs a limit sell action.
-func (wrapper *PoloniexWrapper) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
-	orderNumber, err := wrapper.api.Sell(MarketNameFor(market, wrapper), amount, limit)
-	return fmt.Sprint(orderNumber.OrderNumber), err
+func (wrapper *PoloniexWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	quantity, price, err := prepareOrder(wrapper, market, environment.Ask, amount, limit)
+	if err != nil {
+		return "", mapError(wrapper, err)
+	}
+
+	return wrapper.placeOrder(market, "sell", quantity, price)
 }
 
 // BuyMarket performs a market buy action.
-func (wrapper *PoloniexWrapper) BuyMarket(market *environment.Market, amount float64) (string, error) {
-	panic("Not supported on poloniex")
+func (wrapper *PoloniexWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", notSupported(wrapper, "BuyMarket")
 }
 
 // SellMarket performs a market sell action.
-func (wrapper *PoloniexWrapper) SellMarket(market *environment.Market, amount float64) (string, error) {
-	panic("Not supported on poloniex")
+func (wrapper *PoloniexWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", notSupported(wrapper, "SellMarket")
+}
+
+// placeOrder performs a buy or sell command of a limit order.
+func (wrapper *PoloniexWrapper) placeOrder(market *environment.Market, command string, quantity decimal.Decimal, price decimal.Decimal) (string, error) {
+	formattedQuantity, formattedPrice := formatOrder(wrapper, market, quantity, price)
+	params := url.Values{}
+	params.Set("currencyPair", MarketNameFor(market, wrapper))
+	params.Set("rate", formattedPrice)
+	params.Set("amount", formattedQuantity)
+
+	var order poloniex.Buy
+	if err := wrapper.privateRequest(command, params, &order); err != nil {
+		return "", mapError(wrapper, err)
+	}
+	return fmt.Sprint(order.OrderNumber), nil
+}
+
+// openOrders gets the open orders of the user on a market.
+func (wrapper *PoloniexWrapper) openOrders(market *environment.Market) (poloniex.OpenOrders, error) {
+	var poloniexOrders poloniex.OpenOrders
+	err := wrapper.privateRequest("returnOpenOrders", url.Values{"currencyPair": {MarketNameFor(market, wrapper)}}, &poloniexOrders)
+	return poloniexOrders, err
+}
+
+// privateRequest performs a command of the trading API, decoding the JSON response into target.
+//
+//     NOTE: the client formats the orders from float64 with 8 decimals and uses its own nonces,
+//     so every private command of the wrapper is performed here to keep the nonces increasing.
+func (wrapper *PoloniexWrapper) privateRequest(command string, params url.Values, target interface{}) error {
+	wrapper.privateMutex.Lock()
+	defer wrapper.privateMutex.Unlock()
+
+	wrapper.nonce++
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("command", command)
+	params.Set("nonce", strconv.FormatInt(wrapper.nonce, 10))
+	postData := params.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, poloniex.PRIVATEURI, strings.NewReader(postData))
+	if err != nil {
+		return err
+	}
+	signature := hmac.New(sha512.New, []byte(wrapper.secretKey))
+	signature.Write([]byte(postData))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Key", wrapper.publicKey)
+	req.Header.Set("Sign", hex.EncodeToString(signature.Sum(nil)))
+
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var failure poloniex.Error
+	if json.Unmarshal(body, &failure) == nil && failure.Error != "" {
+		return errors.New(failure.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to %s failed: %s %s", command, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if strings.TrimSpace(string(body)) == "[]" {
+		return nil // returned when there is no data, even by the commands returning an object.
+	}
+	return json.Unmarshal(body, target)
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *PoloniexWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	orderNumber, err := strconv.ParseInt(orderID, 10, 64)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	var ret *environment.OrderStatus
+
+	poloniexOrders, err := wrapper.openOrders(market)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	for _, order := range poloniexOrders {
+		if order.OrderNumber == orderNumber {
+			status := convertFromPoloniexOrder(order)
+			ret = &status
+			break
+		}
+	}
+
+	// poloniex returns an error when the order has no trades.
+	var poloniexTrades poloniex.OrderTrades
+	err = wrapper.privateRequest("returnOrderTrades", url.Values{"orderNumber": {orderID}}, &poloniexTrades)
+	if err != nil {
+		if ret != nil {
+			return ret, nil
+		}
+		return nil, mapError(wrapper, err)
+	}
+
+	if ret == nil { // not open anymore and with trades, so it has been filled.
+		ret = &environment.OrderStatus{
+			ID:    orderID,
+			Type:  environment.Bid,
+			State: environment.OrderFilled,
+		}
+		if len(poloniexTrades) > 0 && poloniexTrades[0].Type == "sell" {
+			ret.Type = environment.Ask
+		}
+	}
+
+	filled := decimal.Zero
+	total := decimal.Zero
+	for _, trade := range poloniexTrades {
+		filled = filled.Add(decimal.NewFromFloat(trade.Amount))
+		total = total.Add(decimal.NewFromFloat(trade.Total))
+		ret.Fee = ret.Fee.Add(decimal.NewFromFloat(trade.Fee).Mul(decimal.NewFromFloat(trade.Total)))
+	}
+	ret.FeeCurrency = market.BaseCurrency
+
+	if ret.State == environment.OrderFilled {
+		ret.Quantity = filled
+		ret.FilledQuantity = filled
+	}
+	if !filled.IsZero() {
+		ret.AveragePrice = total.Div(filled)
+	}
+
+	return ret, nil
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+//
+//     NOTE: fees and average prices are not loaded, use GetOrder to get them.
+func (wrapper *PoloniexWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	poloniexOrders, err := wrapper.openOrders(market)
+	if err != nil {
+		return nil, mapError(wrapper, err)
+	}
+
+	ret := make([]environment.OrderStatus, len(poloniexOrders))
+	for i, order := range poloniexOrders {
+		ret[i] = convertFromPoloniexOrder(order)
+	}
+
+	return ret, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *PoloniexWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	orderNumber, err := strconv.ParseInt(orderID, 10, 64)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	var result poloniex.Base
+	err = wrapper.privateRequest("cancelOrder", url.Values{"orderNumber": {fmt.Sprint(orderNumber)}}, &result)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+	if result.Success != 1 {
+		return errors.New("Cannot cancel order")
+	}
+
+	return nil
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *PoloniexWrapper) CancelAllOrders(market *environment.Market) error {
+	poloniexOrders, err := wrapper.openOrders(market)
+	if err != nil {
+		return mapError(wrapper, err)
+	}
+
+	for _, order := range poloniexOrders {
+		err := wrapper.CancelOrder(market, fmt.Sprint(order.OrderNumber))
+		if err != nil {
+			return mapError(wrapper, err)
+		}
+	}
+
+	return nil
+}
+
+// convertFromPoloniexOrder converts a poloniex open order to a environment.OrderStatus.
+func convertFromPoloniexOrder(order poloniex.OpenOrder) environment.OrderStatus {
+	quantity := decimal.NewFromFloat(order.StartingAmount)
+	remaining := decimal.NewFromFloat(order.Amount)
+	timestamp, _ := time.Parse("2006-01-02 15:04:05", order.Date)
+
+	ret := environment.OrderStatus{
+		ID:             fmt.Sprint(order.OrderNumber),
+		Type:           environment.Bid,
+		State:          environment.OrderNew,
+		Price:          decimal.NewFromFloat(order.Rate),
+		Quantity:       quantity,
+		FilledQuantity: quantity.Sub(remaining),
+		Timestamp:      timestamp,
+	}
+
+	if order.Type == "sell" {
+		ret.Type = environment.Ask
+	}
+
+	if !ret.FilledQuantity.IsZero() {
+		ret.State = environment.OrderPartiallyFilled
+	}
+
+	return ret
 }
 
 // GetTicker gets the updated ticker for a market.
 func (wrapper *PoloniexWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 	poloniexTicker, err := wrapper.api.Ticker()
 	if err != nil {
-		return nil, err
+		return nil, mapError(wrapper, err)
 	}
 	ticker, exists := poloniexTicker[MarketNameFor(market, wrapper)]
 	if !exists {
@@ -177,7 +517,7 @@ func (wrapper *PoloniexWrapper) GetMarketSummary(market *environment.Market) (*e
 	if !wrapper.websocketOn {
 		poloniexSummaries, err := wrapper.api.Ticker()
 		if err != nil {
-			return nil, err
+			return nil, mapError(wrapper, err)
 		}
 
 		for pair, poloniexSummary := range poloniexSummaries {
@@ -193,29 +533,31 @@ func (wrapper *PoloniexWrapper) GetMarketSummary(market *environment.Market) (*e
 		}
 	}
 
-	ret, exists := wrapper.summaries.Get(market)
-	if !exists {
-		return nil, errors.New("Market not found")
-	}
-
-	return ret, nil
+	return wrapper.summaries.GetFresh(market, wrapper.maxDataAge)
 }
 
 // GetBalance gets the balance of the user of the specified currency.
 func (wrapper *PoloniexWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
-	poloniexBalances, err := wrapper.api.Balances()
+	balances, err := wrapper.GetBalances()
 	if err != nil {
 		return nil, err
 	}
+	return freeBalance(balances, symbol)
+}
 
-	for asset, poloniexBalance := range poloniexBalances {
-		if asset == symbol {
-			ret := decimal.NewFromFloat(poloniexBalance.Available)
-			return &ret, nil
-		}
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+func (wrapper *PoloniexWrapper) GetBalances() (map[string]environment.Balance, error) {
+	var poloniexBalances poloniex.Balances
+	err := wrapper.privateRequest("returnCompleteBalances", nil, &poloniexBalances)
+	if err != nil {
+		return nil, mapError(wrapper, err)
 	}
 
-	return nil, errors.New("Symbol not found")
+	ret := make(map[string]environment.Balance, len(poloniexBalances))
+	for asset, poloniexBalance := range poloniexBalances {
+		ret[asset] = newBalance(decimal.NewFromFloat(poloniexBalance.Available), decimal.NewFromFloat(poloniexBalance.OnOrders))
+	}
+	return ret, nil
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -227,76 +569,275 @@ func (wrapper *PoloniexWrapper) GetDepositAddress(coinTicker string) (string, bo
 // CalculateTradingFees calculates the trading fees for an order on a specified market.
 //
 //     NOTE: In Binance fees are currently hardcoded.
-func (wrapper *PoloniexWrapper) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType TradeType) float64 {
+func (wrapper *PoloniexWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
 	// NOTE: possibility to use wrapper FeesInfo function.
-	var feePercentage float64
+	var feePercentage decimal.Decimal
 	if orderType == MakerTrade {
-		feePercentage = 0.0010
+		feePercentage = decimal.NewFromFloat(0.0010)
 	} else if orderType == TakerTrade {
-		feePercentage = 0.0020
+		feePercentage = decimal.NewFromFloat(0.0020)
 	} else {
-		panic("Unknown trade type")
+		return decimal.Zero, fmt.Errorf("%w: unknown trade type %s", ErrInvalidOrder, orderType)
 	}
 
-	return amount * limit * feePercentage
+	return amount.Mul(limit).Mul(feePercentage), nil
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
-func (wrapper *PoloniexWrapper) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
-	panic("Not Implemented")
+func (wrapper *PoloniexWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Zero, notSupported(wrapper, "CalculateWithdrawFees")
 }
 
 // FeedConnect connects to the feed of the poloniex websocket.
+//
+//     NOTE: the client reconnects the websocket by itself, without subscribing again,
+//     the ticker and the trades (sent in the order book channel of each market) are subscribed again when the feed goes silent.
 func (wrapper *PoloniexWrapper) FeedConnect(markets []*environment.Market) error {
-	wrapper.api.StartWS()
-	wrapper.websocketOn = true
+	err := wrapper.feeds.connect(markets, func(markets []*environment.Market) (*feedSupervisor, error) {
+		feed := newFeedSupervisor(wrapper.Name(), nil, func(ctx context.Context, feed *feedSupervisor) error {
+			wrapper.trades.Reset(markets)
+			if err := wrapper.api.Subscribe("ticker"); err != nil {
+				return err
+			}
+			for _, m := range markets {
+				if err := wrapper.api.Subscribe(MarketNameFor(m, wrapper)); err != nil {
+					return err
+				}
+			}
+			feed.connected()
 
-	for _, m := range markets {
-		wrapper.subscribeMarketSummaryFeed(m)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		for _, m := range markets {
+			wrapper.subscribeMarketSummaryFeed(m, feed)
+		}
+		wrapper.startWS.Do(func() {
+			wrapper.api.On("ticker", wrapper.dispatchTicker)
+			go wrapper.api.StartWS() // reads the websocket forever.
+		})
+		return feed, nil
+	})
+	if err != nil {
+		return mapError(wrapper, err)
 	}
+	wrapper.websocketOn = true
 
 	return nil
 }
 
-// SubscribeMarketSummaryFeed subscribes to the Market Summary Feed service.
-func (wrapper *PoloniexWrapper) subscribeMarketSummaryFeed(market *environment.Market) {
-	if wrapper.websocketOn {
-		subTicker := fmt.Sprintf("ticker:%s", MarketNameFor(market, wrapper))
-		if len(wrapper.bindedTickers) == 0 {
-			wrapper.api.Subscribe("ticker")
+// FeedStatus gets the status of the websocket feeds connected.
+func (wrapper *PoloniexWrapper) FeedStatus() []FeedStatus {
+	return wrapper.feeds.status()
+}
 
-			wrapper.api.On("ticker", func(t poloniex.WSTicker) {
-				for bindedTicker := range wrapper.bindedTickers {
-					if bindedTicker == t.Pair {
-						wrapper.api.Emit(subTicker, t)
-					}
-				}
-			})
-		}
+// SetMaxDataAge sets the max age of the data served from the websocket feeds, not positive means no limit.
+func (wrapper *PoloniexWrapper) SetMaxDataAge(maxAge time.Duration) {
+	wrapper.maxDataAge = maxAge
+}
 
-		if _, exists := wrapper.bindedTickers[MarketNameFor(market, wrapper)]; !exists {
-			wrapper.bindedTickers[MarketNameFor(market, wrapper)] = true
+// FeedRelease releases a subscription to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *PoloniexWrapper) FeedRelease(markets []*environment.Market) {
+	wrapper.forgetFeeds(wrapper.feeds.unsubscribe(markets))
+}
 
-			wrapper.api.On(subTicker, func(t poloniex.WSTicker) {
-				wrapper.summaries.Set(market, &environment.MarketSummary{
-					High:   decimal.NewFromFloat(t.DailyHigh),
-					Low:    decimal.NewFromFloat(t.DailyLow),
-					Last:   decimal.NewFromFloat(t.Last),
-					Ask:    decimal.NewFromFloat(t.Ask),
-					Bid:    decimal.NewFromFloat(t.Bid),
-					Volume: decimal.NewFromFloat(t.BaseVolume),
-				})
+// FeedClose releases all the subscriptions to the feed of the markets, disconnecting the feeds without subscribed markets left.
+func (wrapper *PoloniexWrapper) FeedClose(markets []*environment.Market) {
+	wrapper.forgetFeeds(wrapper.feeds.unsubscribeAll(markets))
+}
+
+// forgetFeeds forgets the trades and the tickers of the released markets, without subscriptions left.
+func (wrapper *PoloniexWrapper) forgetFeeds(released []*environment.Market) {
+	wrapper.trades.Reset(released)
+
+	wrapper.tickersMutex.Lock()
+	defer wrapper.tickersMutex.Unlock()
+	for _, m := range released {
+		wrapper.bindedTickers[MarketNameFor(m, wrapper)] = nil
+	}
+}
+
+// SubscribeMarketSummaryFeed subscribes to the Market Summary Feed service, and to the trades of the market.
+func (wrapper *PoloniexWrapper) subscribeMarketSummaryFeed(market *environment.Market, feed *feedSupervisor) {
+	pair := MarketNameFor(market, wrapper)
+
+	wrapper.tickersMutex.Lock()
+	defer wrapper.tickersMutex.Unlock()
+
+	if _, exists := wrapper.bindedTickers[pair]; !exists {
+		wrapper.api.On("ticker:"+pair, func(t poloniex.WSTicker) {
+			wrapper.summaries.Set(market, &environment.MarketSummary{
+				High:   decimal.NewFromFloat(t.DailyHigh),
+				Low:    decimal.NewFromFloat(t.DailyLow),
+				Last:   decimal.NewFromFloat(t.Last),
+				Ask:    decimal.NewFromFloat(t.Ask),
+				Bid:    decimal.NewFromFloat(t.Bid),
+				Volume: decimal.NewFromFloat(t.BaseVolume),
 			})
-		}
+		})
+		wrapper.api.On(pair+"-trade", func(t poloniex.WSOrderbook) {
+			wrapper.dispatchTrade(market, t)
+		})
+	}
+	wrapper.bindedTickers[pair] = feed
+}
+
+// dispatchTicker forwards a ticker to the handler of its market, if subscribed.
+func (wrapper *PoloniexWrapper) dispatchTicker(t poloniex.WSTicker) {
+	wrapper.tickersMutex.Lock()
+	feed := wrapper.bindedTickers[t.Pair]
+	wrapper.tickersMutex.Unlock()
+
+	if feed != nil {
+		feed.alive()
+		wrapper.api.Emit("ticker:"+t.Pair, t)
+	}
+}
+
+// dispatchTrade adds a trade to the recent trades of its market, if subscribed.
+//
+//     NOTE: the client takes the sequence number of the message as trade id, the trades are added without it.
+func (wrapper *PoloniexWrapper) dispatchTrade(market *environment.Market, t poloniex.WSOrderbook) {
+	wrapper.tickersMutex.Lock()
+	feed := wrapper.bindedTickers[t.Pair]
+	wrapper.tickersMutex.Unlock()
+
+	if feed != nil {
+		feed.alive()
+		wrapper.trades.Add(market, environment.Trade{
+			Price:    decimal.NewFromFloat(t.Rate),
+			Quantity: decimal.NewFromFloat(t.Amount),
+			Side:     takerSide(t.Type == "buy"),
+			Time:     t.TS,
+		})
 	}
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *PoloniexWrapper) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
-	_, err := wrapper.api.Withdraw(coinTicker, amount, destinationAddress)
+func (wrapper *PoloniexWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	params := url.Values{}
+	params.Set("currency", coinTicker)
+	params.Set("amount", amount.String())
+	params.Set("address", destinationAddress)
+
+	var result poloniex.Withdraw
+	err := wrapper.privateRequest("withdraw", params, &result)
 	if err != nil {
-		return err
+		return mapError(wrapper, err)
 	}
 
 	return nil
 }
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return callContext(ctx, func() ([]environment.CandleStick, error) {
+		return wrapper.GetCandles(market, interval, from, to)
+	})
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return callContext(ctx, func() (*environment.MarketSummary, error) {
+		return wrapper.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return callContext(ctx, func() (*environment.OrderBook, error) {
+		return wrapper.GetOrderBook(market)
+	})
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return callContext(ctx, func() ([]environment.Trade, error) {
+		return wrapper.GetRecentTrades(market)
+	})
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *PoloniexWrapper) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *PoloniexWrapper) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *PoloniexWrapper) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.BuyMarket(market, amount)
+	})
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *PoloniexWrapper) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return sendContext(ctx, func() (string, error) {
+		return wrapper.SellMarket(market, amount)
+	})
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return callContext(ctx, func() (*environment.OrderStatus, error) {
+		return wrapper.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return callContext(ctx, func() ([]environment.OrderStatus, error) {
+		return wrapper.GetOpenOrders(market)
+	})
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.CancelAllOrders(market)
+	})
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	return callContext(ctx, func() (*decimal.Decimal, error) {
+		return wrapper.GetBalance(symbol)
+	})
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return callContext(ctx, func() (map[string]environment.Balance, error) {
+		return wrapper.GetBalances()
+	})
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *PoloniexWrapper) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return callContextErr(ctx, func() error {
+		return wrapper.FeedConnect(markets)
+	})
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *PoloniexWrapper) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return sendContextErr(ctx, func() error {
+		return wrapper.Withdraw(destinationAddress, coinTicker, amount)
+	})
+}
@@ -0,0 +1,518 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// EndpointClass represents a class of endpoints of an exchange API sharing the same rate limit.
+type EndpointClass string
+
+const (
+	// MarketDataEndpoints represents the public endpoints (candles, summaries, order books).
+	MarketDataEndpoints EndpointClass = "market_data"
+	// OrderEndpoints represents the endpoints placing, querying and cancelling orders.
+	OrderEndpoints EndpointClass = "orders"
+	// AccountEndpoints represents the endpoints of balances and withdrawals.
+	AccountEndpoints EndpointClass = "account"
+)
+
+// endpointClasses represents all the endpoint classes.
+var endpointClasses = []EndpointClass{MarketDataEndpoints, OrderEndpoints, AccountEndpoints}
+
+// defaultRateLimits represents the limits used for the exchanges when not configured, below the published ones.
+var defaultRateLimits = map[string]map[EndpointClass]environment.RequestLimit{
+	"binance": {
+		MarketDataEndpoints: {Rate: 10, Burst: 20},
+		OrderEndpoints:      {Rate: 5, Burst: 10},
+		AccountEndpoints:    {Rate: 2, Burst: 5},
+	},
+	"bitfinex": {
+		MarketDataEndpoints: {Rate: 1, Burst: 5},
+		OrderEndpoints:      {Rate: 1, Burst: 5},
+		AccountEndpoints:    {Rate: 0.5, Burst: 3},
+	},
+	"bittrex": {
+		MarketDataEndpoints: {Rate: 1, Burst: 5},
+		OrderEndpoints:      {Rate: 1, Burst: 5},
+		AccountEndpoints:    {Rate: 1, Burst: 5},
+	},
+	"kraken": {
+		MarketDataEndpoints: {Rate: 1, Burst: 3},
+		OrderEndpoints:      {Rate: 0.5, Burst: 5},
+		AccountEndpoints:    {Rate: 0.3, Burst: 3},
+	},
+}
+
+// fallbackRateLimit represents the limit used for the endpoint classes without a configured or default limit.
+var fallbackRateLimit = environment.RequestLimit{Rate: 5, Burst: 10}
+
+const (
+	defaultRetries       = 3
+	defaultRetryDelay    = 500 * time.Millisecond
+	defaultMaxRetryDelay = 10 * time.Second
+)
+
+// RateLimitedWrapper decorates an exchange wrapper, limiting its requests with a token bucket for each endpoint class
+// and retrying the reads failed for network errors or rate limits with exponential backoff.
+//
+//     NOTE: order placements, cancellations and withdrawals are never retried, a failed request could have been executed.
+//     The balances are loaded at once and served from a cache for a couple of seconds, until an order or a withdrawal changes them.
+type RateLimitedWrapper struct {
+	innerWrapper  ExchangeWrapper
+	limiters      map[EndpointClass]*tokenBucket
+	retries       int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	balances      balancesCache
+}
+
+// NewRateLimitedWrapper creates a wrapper limiting the requests of the specified wrapper, as configured.
+func NewRateLimitedWrapper(wrapper ExchangeWrapper, config environment.RateLimitConfig) *RateLimitedWrapper {
+	ret := &RateLimitedWrapper{
+		innerWrapper:  wrapper,
+		limiters:      make(map[EndpointClass]*tokenBucket, len(endpointClasses)),
+		retries:       config.Retries,
+		retryDelay:    config.RetryDelay,
+		maxRetryDelay: config.MaxRetryDelay,
+	}
+
+	for _, class := range endpointClasses {
+		limit, configured := config.Limits[string(class)]
+		if !configured {
+			limit, configured = defaultRateLimits[wrapper.Name()][class]
+		}
+		if !configured {
+			limit = fallbackRateLimit
+		}
+		ret.limiters[class] = newTokenBucket(limit)
+	}
+
+	if ret.retries == 0 {
+		ret.retries = defaultRetries
+	}
+	if ret.retryDelay <= 0 {
+		ret.retryDelay = defaultRetryDelay
+	}
+	if ret.maxRetryDelay <= 0 {
+		ret.maxRetryDelay = defaultMaxRetryDelay
+	}
+	return ret
+}
+
+// tokenBucket represents a limit of requests per second, allowing bursts.
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket, nil (no limit) if the rate is not positive.
+func newTokenBucket(limit environment.RequestLimit) *tokenBucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+
+	burst := math.Max(float64(limit.Burst), 1)
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait waits for a token, returning ctx.Err() if ctx is done before.
+func (bucket *tokenBucket) wait(ctx context.Context) error {
+	if bucket == nil {
+		return ctx.Err()
+	}
+
+	for {
+		bucket.mutex.Lock()
+		now := time.Now()
+		bucket.tokens = math.Min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+		bucket.last = now
+
+		if bucket.tokens >= 1 {
+			bucket.tokens--
+			bucket.mutex.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+		bucket.mutex.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isTransient returns true if a failed request can be retried: network errors (server failures included) and rate limits.
+func isTransient(err error) bool {
+	return errors.Is(err, ErrNetwork) || errors.Is(err, ErrRateLimited)
+}
+
+// backoff gets the delay before the specified retry (starting from 0), doubling the base delay up to max, with jitter.
+func backoff(base time.Duration, max time.Duration, retry int) time.Duration {
+	delay := max
+	if retry < 30 && base<<retry < max {
+		delay = base << retry
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// read performs a read on the specified endpoint class, retrying it if it fails with a transient error.
+func read[T any](ctx context.Context, wrapper *RateLimitedWrapper, class EndpointClass, operation string, call func(wrapper ExchangeWrapper) (T, error)) (T, error) {
+	var zero T
+	for retry := 0; ; retry++ {
+		if err := wrapper.limiters[class].wait(ctx); err != nil {
+			return zero, err
+		}
+
+		value, err := call(BindContext(ctx, wrapper.innerWrapper))
+		if err == nil || retry >= wrapper.retries || !isTransient(err) {
+			return value, err
+		}
+
+		delay := backoff(wrapper.retryDelay, wrapper.maxRetryDelay, retry)
+		logrus.Warnf("%s on %s failed, retrying in %s: %s", operation, wrapper.Name(), delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// write performs a request changing the state of the account on the specified endpoint class, without retrying it.
+//
+//     NOTE: the cached balances are discarded once the request ends, even if failed.
+func write[T any](ctx context.Context, wrapper *RateLimitedWrapper, class EndpointClass, call func(wrapper ExchangeWrapper) (T, error)) (T, error) {
+	if err := wrapper.limiters[class].wait(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+	if class != MarketDataEndpoints {
+		defer wrapper.balances.invalidate()
+	}
+	return call(BindContext(ctx, wrapper.innerWrapper))
+}
+
+// writeErr is like write, for requests returning only an error.
+func writeErr(ctx context.Context, wrapper *RateLimitedWrapper, class EndpointClass, call func(wrapper ExchangeWrapper) error) error {
+	_, err := write(ctx, wrapper, class, func(inner ExchangeWrapper) (struct{}, error) {
+		return struct{}{}, call(inner)
+	})
+	return err
+}
+
+// Name gets the name of the exchange.
+func (wrapper *RateLimitedWrapper) Name() string {
+	return wrapper.innerWrapper.Name()
+}
+
+// Capabilities gets the operations supported by the decorated wrapper.
+func (wrapper *RateLimitedWrapper) Capabilities() Capabilities {
+	return wrapper.innerWrapper.Capabilities()
+}
+
+// String returns a string representation of the object.
+func (wrapper *RateLimitedWrapper) String() string {
+	return wrapper.innerWrapper.String()
+}
+
+// GetMarketInfo gets the trading rules of a market from the decorated wrapper, if it knows them.
+func (wrapper *RateLimitedWrapper) GetMarketInfo(market *environment.Market) (environment.MarketInfo, error) {
+	provider, hasRules := wrapper.innerWrapper.(MarketInfoProvider)
+	if !hasRules {
+		return environment.MarketInfo{}, nil
+	}
+	return read(context.Background(), wrapper, MarketDataEndpoints, "GetMarketInfo", func(ExchangeWrapper) (environment.MarketInfo, error) {
+		return provider.GetMarketInfo(market)
+	})
+}
+
+// GetCandles gets the candles of a market opened in the [from, to) time range.
+func (wrapper *RateLimitedWrapper) GetCandles(market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return wrapper.GetCandlesContext(context.Background(), market, interval, from, to)
+}
+
+// GetCandlesContext is like GetCandles but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetCandlesContext(ctx context.Context, market *environment.Market, interval environment.CandleInterval, from time.Time, to time.Time) ([]environment.CandleStick, error) {
+	return read(ctx, wrapper, MarketDataEndpoints, "GetCandles", func(inner ExchangeWrapper) ([]environment.CandleStick, error) {
+		return inner.GetCandles(market, interval, from, to)
+	})
+}
+
+// GetMarketSummary gets the current market summary.
+func (wrapper *RateLimitedWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	return wrapper.GetMarketSummaryContext(context.Background(), market)
+}
+
+// GetMarketSummaryContext is like GetMarketSummary but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetMarketSummaryContext(ctx context.Context, market *environment.Market) (*environment.MarketSummary, error) {
+	return read(ctx, wrapper, MarketDataEndpoints, "GetMarketSummary", func(inner ExchangeWrapper) (*environment.MarketSummary, error) {
+		return inner.GetMarketSummary(market)
+	})
+}
+
+// GetOrderBook gets the order(ASK + BID) book of a market.
+func (wrapper *RateLimitedWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	return wrapper.GetOrderBookContext(context.Background(), market)
+}
+
+// GetOrderBookContext is like GetOrderBook but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetOrderBookContext(ctx context.Context, market *environment.Market) (*environment.OrderBook, error) {
+	return read(ctx, wrapper, MarketDataEndpoints, "GetOrderBook", func(inner ExchangeWrapper) (*environment.OrderBook, error) {
+		return inner.GetOrderBook(market)
+	})
+}
+
+// GetRecentTrades gets the most recent trades of a market, sorted by time.
+func (wrapper *RateLimitedWrapper) GetRecentTrades(market *environment.Market) ([]environment.Trade, error) {
+	return wrapper.GetRecentTradesContext(context.Background(), market)
+}
+
+// GetRecentTradesContext is like GetRecentTrades but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetRecentTradesContext(ctx context.Context, market *environment.Market) ([]environment.Trade, error) {
+	return read(ctx, wrapper, MarketDataEndpoints, "GetRecentTrades", func(inner ExchangeWrapper) ([]environment.Trade, error) {
+		return inner.GetRecentTrades(market)
+	})
+}
+
+// BuyLimit performs a limit buy action.
+func (wrapper *RateLimitedWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.BuyLimitContext(context.Background(), market, amount, limit)
+}
+
+// BuyLimitContext is like BuyLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *RateLimitedWrapper) BuyLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return write(ctx, wrapper, OrderEndpoints, func(inner ExchangeWrapper) (string, error) {
+		return inner.BuyLimit(market, amount, limit)
+	})
+}
+
+// SellLimit performs a limit sell action.
+func (wrapper *RateLimitedWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.SellLimitContext(context.Background(), market, amount, limit)
+}
+
+// SellLimitContext is like SellLimit but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *RateLimitedWrapper) SellLimitContext(ctx context.Context, market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return write(ctx, wrapper, OrderEndpoints, func(inner ExchangeWrapper) (string, error) {
+		return inner.SellLimit(market, amount, limit)
+	})
+}
+
+// BuyMarket performs a market buy action.
+func (wrapper *RateLimitedWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.BuyMarketContext(context.Background(), market, amount)
+}
+
+// BuyMarketContext is like BuyMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *RateLimitedWrapper) BuyMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return write(ctx, wrapper, OrderEndpoints, func(inner ExchangeWrapper) (string, error) {
+		return inner.BuyMarket(market, amount)
+	})
+}
+
+// SellMarket performs a market sell action.
+func (wrapper *RateLimitedWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.SellMarketContext(context.Background(), market, amount)
+}
+
+// SellMarketContext is like SellMarket but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *RateLimitedWrapper) SellMarketContext(ctx context.Context, market *environment.Market, amount decimal.Decimal) (string, error) {
+	return write(ctx, wrapper, OrderEndpoints, func(inner ExchangeWrapper) (string, error) {
+		return inner.SellMarket(market, amount)
+	})
+}
+
+// GetOrder gets the status of an order placed on the exchange.
+func (wrapper *RateLimitedWrapper) GetOrder(market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return wrapper.GetOrderContext(context.Background(), market, orderID)
+}
+
+// GetOrderContext is like GetOrder but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetOrderContext(ctx context.Context, market *environment.Market, orderID string) (*environment.OrderStatus, error) {
+	return read(ctx, wrapper, OrderEndpoints, "GetOrder", func(inner ExchangeWrapper) (*environment.OrderStatus, error) {
+		return inner.GetOrder(market, orderID)
+	})
+}
+
+// GetOpenOrders gets the open orders of the user on a market.
+func (wrapper *RateLimitedWrapper) GetOpenOrders(market *environment.Market) ([]environment.OrderStatus, error) {
+	return wrapper.GetOpenOrdersContext(context.Background(), market)
+}
+
+// GetOpenOrdersContext is like GetOpenOrders but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetOpenOrdersContext(ctx context.Context, market *environment.Market) ([]environment.OrderStatus, error) {
+	return read(ctx, wrapper, OrderEndpoints, "GetOpenOrders", func(inner ExchangeWrapper) ([]environment.OrderStatus, error) {
+		return inner.GetOpenOrders(market)
+	})
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *RateLimitedWrapper) CancelOrder(market *environment.Market, orderID string) error {
+	return wrapper.CancelOrderContext(context.Background(), market, orderID)
+}
+
+// CancelOrderContext is like CancelOrder but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) CancelOrderContext(ctx context.Context, market *environment.Market, orderID string) error {
+	return writeErr(ctx, wrapper, OrderEndpoints, func(inner ExchangeWrapper) error {
+		return inner.CancelOrder(market, orderID)
+	})
+}
+
+// CancelAllOrders cancels all the open orders of the user on a market.
+func (wrapper *RateLimitedWrapper) CancelAllOrders(market *environment.Market) error {
+	return wrapper.CancelAllOrdersContext(context.Background(), market)
+}
+
+// CancelAllOrdersContext is like CancelAllOrders but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) CancelAllOrdersContext(ctx context.Context, market *environment.Market) error {
+	return writeErr(ctx, wrapper, OrderEndpoints, func(inner ExchangeWrapper) error {
+		return inner.CancelAllOrders(market)
+	})
+}
+
+// CalculateTradingFees calculates the trading fees for an order on a specified market.
+func (wrapper *RateLimitedWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderType TradeType) (decimal.Decimal, error) {
+	return wrapper.innerWrapper.CalculateTradingFees(market, amount, limit, orderType)
+}
+
+// CalculateWithdrawFees calculates the withdrawal fees on a specified market.
+func (wrapper *RateLimitedWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) (decimal.Decimal, error) {
+	return wrapper.innerWrapper.CalculateWithdrawFees(market, amount)
+}
+
+// GetBalance gets the balance of the user of the specified currency, from the cached balances.
+func (wrapper *RateLimitedWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	return wrapper.GetBalanceContext(context.Background(), symbol)
+}
+
+// GetBalanceContext is like GetBalance but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetBalanceContext(ctx context.Context, symbol string) (*decimal.Decimal, error) {
+	balances, err := wrapper.GetBalancesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return freeBalance(balances, symbol)
+}
+
+// GetBalances gets the free, locked and total balances of the user of all the currencies, by currency.
+//
+//     NOTE: the balances are loaded at most once every couple of seconds, the calls in the meanwhile get the cached ones.
+func (wrapper *RateLimitedWrapper) GetBalances() (map[string]environment.Balance, error) {
+	return wrapper.GetBalancesContext(context.Background())
+}
+
+// GetBalancesContext is like GetBalances but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) GetBalancesContext(ctx context.Context) (map[string]environment.Balance, error) {
+	return wrapper.balances.get(ctx, func(ctx context.Context) (map[string]environment.Balance, error) {
+		return read(ctx, wrapper, AccountEndpoints, "GetBalances", func(inner ExchangeWrapper) (map[string]environment.Balance, error) {
+			return inner.GetBalances()
+		})
+	})
+}
+
+// GetDepositAddress gets the deposit address for the specified coin on the exchange.
+func (wrapper *RateLimitedWrapper) GetDepositAddress(coinTicker string) (string, bool) {
+	return wrapper.innerWrapper.GetDepositAddress(coinTicker)
+}
+
+// FeedConnect connects to the feed of the exchange.
+func (wrapper *RateLimitedWrapper) FeedConnect(markets []*environment.Market) error {
+	return wrapper.FeedConnectContext(context.Background(), markets)
+}
+
+// FeedConnectContext is like FeedConnect but returns as soon as ctx is done.
+func (wrapper *RateLimitedWrapper) FeedConnectContext(ctx context.Context, markets []*environment.Market) error {
+	return writeErr(ctx, wrapper, MarketDataEndpoints, func(inner ExchangeWrapper) error {
+		return inner.FeedConnect(markets)
+	})
+}
+
+// SetMaxDataAge sets the max age of the data cached by the decorated wrapper, if it limits it.
+func (wrapper *RateLimitedWrapper) SetMaxDataAge(maxAge time.Duration) {
+	if limiter, isLimiter := wrapper.innerWrapper.(DataAgeLimiter); isLimiter {
+		limiter.SetMaxDataAge(maxAge)
+	}
+}
+
+// SetOrderBookDepth sets the max number of price levels of the order books maintained by the decorated wrapper, if it maintains them.
+func (wrapper *RateLimitedWrapper) SetOrderBookDepth(depth int) {
+	if limiter, isLimiter := wrapper.innerWrapper.(OrderBookDepthLimiter); isLimiter {
+		limiter.SetOrderBookDepth(depth)
+	}
+}
+
+// FeedStatus gets the status of the websocket feeds of the decorated wrapper.
+func (wrapper *RateLimitedWrapper) FeedStatus() []FeedStatus {
+	return FeedStatusOf(wrapper.innerWrapper)
+}
+
+// FeedRelease releases a subscription to the feed of the markets of the decorated wrapper.
+func (wrapper *RateLimitedWrapper) FeedRelease(markets []*environment.Market) {
+	ReleaseFeed(wrapper.innerWrapper, markets)
+}
+
+// FeedClose releases all the subscriptions to the feed of the markets of the decorated wrapper.
+func (wrapper *RateLimitedWrapper) FeedClose(markets []*environment.Market) {
+	CloseFeed(wrapper.innerWrapper, markets)
+}
+
+// SubscribeAccount subscribes a handler to the events of the account on the markets, sent by the private stream of the decorated wrapper.
+//
+//     NOTE: if the decorated wrapper has no private stream the account is polled through the limits.
+func (wrapper *RateLimitedWrapper) SubscribeAccount(markets []*environment.Market, handler func(environment.AccountEvent)) (func(), error) {
+	if streamer, isStreamer := wrapper.innerWrapper.(AccountStreamer); isStreamer {
+		return streamer.SubscribeAccount(markets, handler)
+	}
+	return pollAccount(wrapper, markets, handler), nil
+}
+
+// Withdraw performs a withdraw operation from the exchange to a destination address.
+func (wrapper *RateLimitedWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return wrapper.WithdrawContext(context.Background(), destinationAddress, coinTicker, amount)
+}
+
+// WithdrawContext is like Withdraw but ctx only bounds the wait before sending the request, never its outcome.
+func (wrapper *RateLimitedWrapper) WithdrawContext(ctx context.Context, destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+	return writeErr(ctx, wrapper, AccountEndpoints, func(inner ExchangeWrapper) error {
+		return inner.Withdraw(destinationAddress, coinTicker, amount)
+	})
+}
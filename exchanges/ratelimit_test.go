@@ -0,0 +1,180 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/shopspring/decimal"
+)
+
+// failingWrapper is an ExchangeWrapper whose order book reads and limit buys fail with the queued errors, then succeed.
+type failingWrapper struct {
+	namedWrapper
+	errs  []error
+	calls int
+}
+
+func (wrapper *failingWrapper) fail() error {
+	wrapper.calls++
+	if len(wrapper.errs) == 0 {
+		return nil
+	}
+	err := wrapper.errs[0]
+	wrapper.errs = wrapper.errs[1:]
+	return err
+}
+
+func (wrapper *failingWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	if err := wrapper.fail(); err != nil {
+		return nil, err
+	}
+	return &environment.OrderBook{}, nil
+}
+
+func (wrapper *failingWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	if err := wrapper.fail(); err != nil {
+		return "", err
+	}
+	return "order", nil
+}
+
+// newTestRateLimitedWrapper creates a rate limited wrapper without limits and with short retry delays.
+func newTestRateLimitedWrapper(inner ExchangeWrapper) *RateLimitedWrapper {
+	return NewRateLimitedWrapper(inner, environment.RateLimitConfig{
+		Limits: map[string]environment.RequestLimit{
+			string(MarketDataEndpoints): {},
+			string(OrderEndpoints):      {},
+			string(AccountEndpoints):    {},
+		},
+		Retries:       2,
+		RetryDelay:    time.Millisecond,
+		MaxRetryDelay: 2 * time.Millisecond,
+	})
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	bucket := newTokenBucket(environment.RequestLimit{Rate: 20, Burst: 3})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatalf("wait failed: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("burst of 3 waited %s, want no wait", elapsed)
+	}
+
+	start = time.Now()
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("wait failed: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("request after the burst waited %s, want about 50ms", elapsed)
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	bucket := newTokenBucket(environment.RequestLimit{Rate: 100, Burst: 1})
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("wait failed: %s", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("wait failed: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Millisecond {
+		t.Errorf("request after the refill waited %s, want no wait", elapsed)
+	}
+}
+
+func TestTokenBucketContext(t *testing.T) {
+	bucket := newTokenBucket(environment.RequestLimit{Rate: 0.1, Burst: 1})
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("wait failed: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bucket.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait on an empty bucket = %v, want %s", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTokenBucketNoLimit(t *testing.T) {
+	if bucket := newTokenBucket(environment.RequestLimit{}); bucket != nil {
+		t.Fatalf("newTokenBucket without rate = %v, want nil", bucket)
+	}
+
+	var bucket *tokenBucket
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Errorf("wait without limit failed: %s", err)
+	}
+}
+
+func TestReadRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", nil, 1, false},
+		{"network error", []error{fmt.Errorf("%w: connection reset", ErrNetwork)}, 2, false},
+		{"rate limited", []error{fmt.Errorf("%w: slow down", ErrRateLimited)}, 2, false},
+		{"server failure", []error{mapError(namedWrapper{name: "exchange"}, errors.New("Request to trades failed: 502 Bad Gateway"))}, 2, false},
+		{"unknown error", []error{errors.New("Something went wrong")}, 1, true},
+		{"retries exhausted", []error{ErrNetwork, ErrNetwork, ErrNetwork}, 3, true},
+		{"auth error", []error{fmt.Errorf("%w: bad key", ErrAuth)}, 1, true},
+		{"invalid order", []error{fmt.Errorf("%w: too small", ErrInvalidOrder)}, 1, true},
+		{"not supported", []error{ErrNotSupported}, 1, true},
+		{"stale data", []error{ErrStaleData}, 1, true},
+		{"canceled", []error{context.Canceled}, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inner := &failingWrapper{namedWrapper: namedWrapper{name: "exchange"}, errs: test.errs}
+			_, err := newTestRateLimitedWrapper(inner).GetOrderBook(&environment.Market{Name: "ETH-BTC"})
+			if (err != nil) != test.wantErr {
+				t.Errorf("GetOrderBook error = %v, want error %t", err, test.wantErr)
+			}
+			if inner.calls != test.wantCalls {
+				t.Errorf("GetOrderBook performed %d calls, want %d", inner.calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWriteNotRetried(t *testing.T) {
+	inner := &failingWrapper{namedWrapper: namedWrapper{name: "exchange"}, errs: []error{ErrNetwork}}
+	_, err := newTestRateLimitedWrapper(inner).BuyLimit(&environment.Market{Name: "ETH-BTC"}, decimal.NewFromInt(1), decimal.NewFromInt(1))
+	if !errors.Is(err, ErrNetwork) {
+		t.Errorf("BuyLimit error = %v, want %s", err, ErrNetwork)
+	}
+	if inner.calls != 1 {
+		t.Errorf("BuyLimit performed %d calls, want 1", inner.calls)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exchanges
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+)
+
+// Factory creates the wrapper of an exchange from its configuration.
+type Factory func(config environment.ExchangeConfig) (ExchangeWrapper, error)
+
+// ErrUnknownExchange is the error representing an exchange name without a registered factory.
+var ErrUnknownExchange = errors.New("Unknown exchange")
+
+var factories = make(map[string]Factory) //mapped exchange name -> factory
+var factoriesMutex sync.RWMutex
+
+// Register makes an exchange available with the specified name, as used in the exchange field of the configuration.
+//
+//     NOTE: the built-in exchanges register themselves, custom exchanges should be registered in an init func.
+//     Register panics if the name is already registered or the factory is nil.
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("exchanges: Register factory is nil for " + name)
+	}
+	if _, exists := factories[name]; exists {
+		panic("exchanges: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Registered gets the names of the registered exchanges, sorted.
+func Registered() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the wrapper of the exchange named in the configuration, using its registered factory.
+func New(config environment.ExchangeConfig) (ExchangeWrapper, error) {
+	factoriesMutex.RLock()
+	factory, exists := factories[config.ExchangeName]
+	factoriesMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w %q, available exchanges are: %s", ErrUnknownExchange, config.ExchangeName, strings.Join(Registered(), ", "))
+	}
+	wrapper, err := factory(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.MaxDataAge != 0 {
+		if limiter, isLimiter := wrapper.(DataAgeLimiter); isLimiter {
+			limiter.SetMaxDataAge(config.MaxDataAge)
+		}
+	}
+	if config.OrderBookDepth > 0 {
+		if limiter, isLimiter := wrapper.(OrderBookDepthLimiter); isLimiter {
+			limiter.SetOrderBookDepth(config.OrderBookDepth)
+		}
+	}
+	return wrapper, nil
+}
@@ -0,0 +1,51 @@
+// Copyright © 2017 Alessandro Sanino <saninoale@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package strategies
+
+import "time"
+
+// Clock provides the time to the strategies.
+//
+//     Replaced by a virtual clock when backtesting.
+type Clock interface {
+	Now() time.Time                         // Gets the current time.
+	After(d time.Duration) <-chan time.Time // Waits for the duration to elapse and then sends the current time on the returned channel.
+}
+
+// realClock is the Clock based on wall time.
+type realClock struct{}
+
+// Now gets the current wall time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse in wall time.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var clock Clock = realClock{}
+
+// SetClock sets the clock used by the strategies, must be called before applying them.
+func SetClock(c Clock) {
+	clock = c
+}
+
+// Now gets the current time of the clock used by the strategies.
+func Now() time.Time {
+	return clock.Now()
+}
@@ -16,8 +16,13 @@
 package strategies
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/saniales/golang-crypto-trading-bot/environment"
 	"github.com/saniales/golang-crypto-trading-bot/exchanges"
@@ -26,24 +31,122 @@ import (
 var available map[string]Strategy //mapped name -> strategy
 var appliedTactics []Tactic
 
+// DefaultTearDownTimeout is the maximum time given to a TearDown func to complete, if not specified.
+const DefaultTearDownTimeout = 30 * time.Second
+
+var stopped atomic.Pointer[stopSignal] // closed when the strategies are asked to stop.
+var tearDownTimeout atomic.Int64       // max duration of a TearDown func.
+
+// stopSignal represents the request to stop the strategies, closed once.
+type stopSignal struct {
+	once sync.Once
+	done chan struct{}
+}
+
 // Strategy represents a generic strategy.
 type Strategy interface {
 	Name() string                                             // Name returns the name of the strategy.
 	Apply([]exchanges.ExchangeWrapper, []*environment.Market) // Apply applies the strategy when called, using the specified wrapper.
 }
 
+// Requirer is implemented by the strategies which declare the operations they need from the exchanges of their markets.
+type Requirer interface {
+	Requires() exchanges.Capabilities // Requires returns the operations needed by the strategy.
+}
+
 // StrategyFunc represents a standard function binded to a strategy model execution.
 //
 //     Can define a Setup, TearDown and Update behaviour.
 type StrategyFunc func([]exchanges.ExchangeWrapper, []*environment.Market) error
 
 //StrategyModel represents a strategy model used by strategies.
+//
+//     NOTE: OnOrderUpdate, OnFill and OnBalanceChange are called by the private streams of the exchanges
+//     from Setup to TearDown, concurrently with OnUpdate.
 type StrategyModel struct {
-	Name     string
-	Setup    StrategyFunc
-	TearDown StrategyFunc
-	OnUpdate StrategyFunc
-	OnError  func(error)
+	Name            string
+	Setup           StrategyFunc
+	TearDown        StrategyFunc
+	OnUpdate        StrategyFunc
+	OnError         func(error)
+	OnOrderUpdate   func(exchanges.ExchangeWrapper, *environment.Market, environment.OrderStatus) //Called when an order of the user on the markets changes.
+	OnFill          func(exchanges.ExchangeWrapper, *environment.Market, environment.Fill)        //Called when an order of the user on the markets is (partially) executed.
+	OnBalanceChange func(exchanges.ExchangeWrapper, environment.BalanceUpdate)                    //Called when a balance of the user on the exchanges of the markets changes.
+	Requires        exchanges.Capabilities                                                        //The operations the strategy needs from the exchanges of its markets.
+}
+
+// requires gets the operations needed by the model: the declared ones, plus the account stream if it handles the orders or the fills,
+// which cannot be followed by polling (an order can be placed and filled between two polls).
+func (model StrategyModel) requires() exchanges.Capabilities {
+	required := model.Requires
+	if model.OnOrderUpdate != nil || model.OnFill != nil {
+		required.AccountStream = true
+	}
+	return required
+}
+
+// hasAccountHandlers returns true if the model handles the events of the account of the user.
+func (model StrategyModel) hasAccountHandlers() bool {
+	return model.OnOrderUpdate != nil || model.OnFill != nil || model.OnBalanceChange != nil
+}
+
+// subscribeAccount subscribes the account handlers of the model to the private streams of the exchanges of the markets,
+// returning the function removing the subscriptions.
+//
+//     NOTE: the exchanges which cannot be subscribed are reported to OnError.
+func (model StrategyModel) subscribeAccount(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (unsubscribe func()) {
+	if !model.hasAccountHandlers() {
+		return func() {}
+	}
+
+	var unsubscribers []func()
+	for _, wrapper := range wrappers {
+		var bound []*environment.Market
+		for _, market := range markets {
+			if exchanges.MarketNameFor(market, wrapper) != "" {
+				bound = append(bound, market)
+			}
+		}
+		if len(bound) == 0 {
+			continue
+		}
+
+		wrapper := wrapper
+		unsubscribe, err := exchanges.SubscribeAccount(wrapper, bound, func(event environment.AccountEvent) {
+			model.handleAccountEvent(wrapper, event)
+		})
+		if err != nil {
+			if model.OnError != nil {
+				model.OnError(fmt.Errorf("Cannot subscribe to the account on %s: %w", wrapper.Name(), err))
+			}
+			continue
+		}
+		unsubscribers = append(unsubscribers, unsubscribe)
+	}
+
+	return func() {
+		for _, unsubscribe := range unsubscribers {
+			unsubscribe()
+		}
+	}
+}
+
+// handleAccountEvent calls the handler of the model for the type of the event, if set.
+func (model StrategyModel) handleAccountEvent(wrapper exchanges.ExchangeWrapper, event environment.AccountEvent) {
+	switch event.Type {
+	case environment.OrderUpdateEvent:
+		if model.OnOrderUpdate != nil {
+			model.OnOrderUpdate(wrapper, event.Market, *event.Order)
+		}
+	case environment.FillEvent:
+		if model.OnFill != nil {
+			model.OnFill(wrapper, event.Market, *event.Fill)
+		}
+	case environment.BalanceEvent:
+		if model.OnBalanceChange != nil {
+			model.OnBalanceChange(wrapper, *event.Balance)
+		}
+	}
 }
 
 // Tactic represents the effective appliance of a strategy.
@@ -59,6 +162,8 @@ func (t *Tactic) Execute(wrappers []exchanges.ExchangeWrapper) {
 
 func init() {
 	available = make(map[string]Strategy)
+	stopped.Store(&stopSignal{done: make(chan struct{})})
+	tearDownTimeout.Store(int64(DefaultTearDownTimeout))
 }
 
 // AddCustomStrategy adds a strategy to the available set.
@@ -79,6 +184,55 @@ func MatchWithMarkets(strategyName string, markets []*environment.Market) error
 	return nil
 }
 
+// AppliedTactics gets the tactics matched with markets.
+func AppliedTactics() []Tactic {
+	return appliedTactics
+}
+
+// CheckRequirements verifies that every market of the applied tactics is bound to exchanges supporting the
+// operations needed by its strategy, returning an error describing all the unsupported ones.
+//
+//     NOTE: a market bound to an exchange without a wrapper is reported as well.
+func CheckRequirements(wrappers []exchanges.ExchangeWrapper) error {
+	return CheckTacticsRequirements(appliedTactics, wrappers)
+}
+
+// CheckTacticsRequirements is like CheckRequirements, for the specified tactics instead of the applied ones.
+func CheckTacticsRequirements(tactics []Tactic, wrappers []exchanges.ExchangeWrapper) error {
+	wrappersByName := make(map[string]exchanges.ExchangeWrapper, len(wrappers))
+	for _, wrapper := range wrappers {
+		wrappersByName[wrapper.Name()] = wrapper
+	}
+
+	var problems []string
+	for _, t := range tactics {
+		var required exchanges.Capabilities
+		if requirer, ok := t.Strategy.(Requirer); ok {
+			required = requirer.Requires()
+		}
+
+		for _, market := range t.Markets {
+			for exchangeName := range market.ExchangeNames {
+				wrapper, exists := wrappersByName[exchangeName]
+				if !exists {
+					problems = append(problems, fmt.Sprintf("strategy %s: market %s bound to %s, which is not configured", t.Strategy.Name(), market.Name, exchangeName))
+					continue
+				}
+
+				if missing := wrapper.Capabilities().Missing(required); len(missing) > 0 {
+					problems = append(problems, fmt.Sprintf("strategy %s: market %s bound to %s, which does not support %s", t.Strategy.Name(), market.Name, exchangeName, strings.Join(missing, ", ")))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%w:\n\t%s", exchanges.ErrNotSupported, strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
 // ApplyAllStrategies applies all matched strategies concurrently.
 func ApplyAllStrategies(wrappers []exchanges.ExchangeWrapper) {
 	var wg sync.WaitGroup
@@ -91,3 +245,72 @@ func ApplyAllStrategies(wrappers []exchanges.ExchangeWrapper) {
 	}
 	wg.Wait()
 }
+
+// StopAllStrategies asks all the applied strategies to stop, giving each TearDown func at most timeout to complete.
+//
+//     NOTE: ApplyAllStrategies returns when all the strategies completed their TearDown.
+func StopAllStrategies(timeout time.Duration) {
+	signal := stopped.Load()
+	signal.once.Do(func() {
+		if timeout > 0 {
+			tearDownTimeout.Store(int64(timeout))
+		}
+		close(signal.done)
+	})
+}
+
+// SetStopContext makes the strategies applied afterwards stop when ctx is done, as well as when StopAllStrategies is called.
+// Must be called before applying them.
+//
+//     NOTE: used to run the strategies more than once in the same process (e.g. by the backtests),
+//     since StopAllStrategies stops them for good otherwise.
+func SetStopContext(ctx context.Context) {
+	signal := &stopSignal{done: make(chan struct{})}
+	stopped.Store(signal)
+	go func() {
+		select {
+		case <-ctx.Done():
+			signal.once.Do(func() { close(signal.done) })
+		case <-signal.done:
+		}
+	}()
+}
+
+// Stopped returns a channel which is closed when the strategies are asked to stop.
+//
+//     Custom strategies should return from Apply when it is closed.
+func Stopped() <-chan struct{} {
+	return stopped.Load().done
+}
+
+// stoppedContext returns a context which is canceled when the strategies are asked to stop.
+func stoppedContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-Stopped():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// runTearDown executes a TearDown func, waiting for it at most the configured timeout.
+func runTearDown(tearDown StrategyFunc, wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
+	timeout := time.Duration(tearDownTimeout.Load())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tearDown(exchanges.BindContextAll(ctx, wrappers), markets)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("TearDown did not complete within %s", timeout)
+	}
+}
@@ -16,6 +16,7 @@
 package strategies
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -24,9 +25,14 @@ import (
 )
 
 // IntervalStrategy is an interval based strategy.
+//
+//     NOTE: each OnUpdate call has a deadline of Timeout (Interval if not set):
+//     exchange calls performed after the deadline fail with context.DeadlineExceeded,
+//     the ones performed after the strategies are asked to stop fail with context.Canceled.
 type IntervalStrategy struct {
 	Model    StrategyModel
 	Interval time.Duration
+	Timeout  time.Duration
 }
 
 // Name returns the name of the strategy.
@@ -34,12 +40,17 @@ func (is IntervalStrategy) Name() string {
 	return is.Model.Name
 }
 
+// Requires returns the operations needed by the strategy.
+func (is IntervalStrategy) Requires() exchanges.Capabilities {
+	return is.Model.requires()
+}
+
 // String returns a string representation of the object.
 func (is IntervalStrategy) String() string {
 	return is.Name()
 }
 
-// Apply executes Cyclically the On Update, basing on provided interval.
+// Apply executes Cyclically the On Update, basing on provided interval, until the strategies are stopped.
 func (is IntervalStrategy) Apply(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) {
 	var err error
 
@@ -55,6 +66,8 @@ func (is IntervalStrategy) Apply(wrappers []exchanges.ExchangeWrapper, markets [
 		}
 	}
 
+	unsubscribeAccount := is.Model.subscribeAccount(wrappers, markets)
+
 	if !hasUpdateFunc {
 		_err := errors.New("OnUpdate func cannot be empty")
 		if hasErrorFunc {
@@ -63,17 +76,43 @@ func (is IntervalStrategy) Apply(wrappers []exchanges.ExchangeWrapper, markets [
 			panic(_err)
 		}
 	}
+
+updateLoop:
 	for err == nil {
-		err = is.Model.OnUpdate(wrappers, markets)
+		err = is.update(wrappers, markets)
 		if err != nil && hasErrorFunc {
 			is.Model.OnError(err)
 		}
-		time.Sleep(is.Interval)
+
+		select {
+		case <-Stopped():
+			break updateLoop
+		case <-clock.After(is.Interval):
+		}
 	}
 	if hasTearDownFunc {
-		err = is.Model.TearDown(wrappers, markets)
+		err = runTearDown(is.Model.TearDown, wrappers, markets)
 		if err != nil && hasErrorFunc {
 			is.Model.OnError(err)
 		}
 	}
+	unsubscribeAccount()
+}
+
+// update executes the OnUpdate func, bounding the exchange calls with the tick deadline and the stop of the strategies.
+func (is IntervalStrategy) update(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
+	ctx, cancel := stoppedContext()
+	defer cancel()
+
+	timeout := is.Timeout
+	if timeout <= 0 {
+		timeout = is.Interval
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	return is.Model.OnUpdate(exchanges.BindContextAll(ctx, wrappers), markets)
 }
@@ -19,12 +19,17 @@ func (wss WebsocketStrategy) Name() string {
 	return wss.Model.Name
 }
 
+// Requires returns the operations needed by the strategy.
+func (wss WebsocketStrategy) Requires() exchanges.Capabilities {
+	return wss.Model.requires()
+}
+
 // String returns a string representation of the object.
 func (wss WebsocketStrategy) String() string {
 	return wss.Name()
 }
 
-// Apply executes Cyclically the On Update, basing on provided interval.
+// Apply executes the Setup and waits for the strategies to be stopped before executing the TearDown.
 func (wss WebsocketStrategy) Apply(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) {
 	var err error
 
@@ -40,6 +45,8 @@ func (wss WebsocketStrategy) Apply(wrappers []exchanges.ExchangeWrapper, markets
 		}
 	}
 
+	unsubscribeAccount := wss.Model.subscribeAccount(wrappers, markets)
+
 	// update is handled by the developer externally, here we just checked for existence.
 	if !hasUpdateFunc {
 		_err := errors.New("OnUpdate func cannot be empty")
@@ -50,10 +57,13 @@ func (wss WebsocketStrategy) Apply(wrappers []exchanges.ExchangeWrapper, markets
 		}
 	}
 
+	<-Stopped()
+
 	if hasTearDownFunc {
-		err = wss.Model.TearDown(wrappers, markets)
+		err = runTearDown(wss.Model.TearDown, wrappers, markets)
 		if err != nil && hasErrorFunc {
 			wss.Model.OnError(err)
 		}
 	}
+	unsubscribeAccount()
 }